@@ -1,12 +1,75 @@
 package main
 
 import (
+	"flag"
 	"log"
+	"net/http"
 
+	"github.com/phaseharry/distributed-log/serve-requests-with-grpc/auth"
+	"github.com/phaseharry/distributed-log/serve-requests-with-grpc/gateway"
+	commitlog "github.com/phaseharry/distributed-log/serve-requests-with-grpc/log"
 	"github.com/phaseharry/distributed-services-with-go/http-server/internal/server"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
 )
 
 func main() {
-	srv := server.NewHTTPServer(":8080")
+	addr := flag.String("addr", ":8080", "address the http server listens on")
+	// pointing the gRPC broker at the same directory serves the same records over both
+	dataDir := flag.String("data-dir", "data", "directory the log's segments are stored in")
+	// the gRPC broker's rpcs are served as json under /v1/ on the same port when it's given
+	grpcAddr := flag.String("grpc-addr", "", "address of the gRPC broker the gateway calls")
+	gzip := flag.Bool("gzip", true, "compress the responses of clients that accept gzip")
+	// requests have to carry a bearer token signed by one of the provider's keys when it's given
+	jwksURL := flag.String("jwks-url", "", "url of the json web key set bearer tokens are verified against")
+	jwtIssuer := flag.String("jwt-issuer", "", "issuer bearer tokens have to be issued by")
+	jwtAudience := flag.String("jwt-audience", "", "audience bearer tokens have to be for")
+	flag.Parse()
+
+	logger, err := zap.NewProduction()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer logger.Sync()
+	middleware := []server.Middleware{
+		server.RequestIDs(),
+		server.AccessLog(logger),
+		server.Recovery(func(p any, stack []byte) {
+			logger.Error("panic", zap.Any("panic", p), zap.ByteString("stack", stack))
+		}),
+	}
+	if *gzip {
+		middleware = append(middleware, server.Gzip())
+	}
+	if *jwksURL != "" {
+		j, err := auth.NewJWT(auth.JWTConfig{JWKSURL: *jwksURL, Issuer: *jwtIssuer, Audience: *jwtAudience})
+		if err != nil {
+			log.Fatal(err)
+		}
+		// the gateway's requests are authenticated too since it's mounted after
+		middleware = append(middleware, server.JWT(j))
+	}
+
+	if *grpcAddr != "" {
+		cc, err := grpc.Dial(*grpcAddr, grpc.WithInsecure())
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer cc.Close()
+		// mounted as the innermost middleware so the gateway's requests go through the rest of them too
+		middleware = append(middleware, func(next http.Handler) http.Handler {
+			mux := http.NewServeMux()
+			mux.Handle(gateway.Prefix, gateway.New(cc))
+			mux.Handle("/", next)
+			return mux
+		})
+	}
+
+	l, err := commitlog.Open(*dataDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer l.Close()
+	srv := server.NewHTTPServer(*addr, l, middleware...)
 	log.Fatal(srv.ListenAndServe())
 }
@@ -0,0 +1,178 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+// content types bodies can be sent and asked for in, json when a request doesn't say
+const (
+	JSONType     = "application/json"
+	MsgpackType  = "application/msgpack"
+	ProtobufType = "application/x-protobuf"
+)
+
+/*
+encodes and decodes bodies in a content type. json and msgpack bodies are the server's structs with the same
+field names, protobuf bodies are the api's messages: records are produced as an api.Record, ex. one with a key
+and headers, and consumed as the api.ConsumeResponse and api.ConsumeBatchResponse the gRPC server responds with
+*/
+type codec struct {
+	contentType string
+	protobuf    bool
+	decode      func(b []byte, v any) error
+	encode      func(v any) ([]byte, error)
+}
+
+var codecs = []codec{{
+	contentType: JSONType,
+	decode:      json.Unmarshal,
+	encode: func(v any) ([]byte, error) {
+		var buf bytes.Buffer
+		err := json.NewEncoder(&buf).Encode(v)
+		return buf.Bytes(), err
+	},
+}, {
+	contentType: MsgpackType,
+	decode: func(b []byte, v any) error {
+		dec := msgpack.NewDecoder(bytes.NewReader(b))
+		dec.SetCustomStructTag("json")
+		return dec.Decode(v)
+	},
+	encode: func(v any) ([]byte, error) {
+		var buf bytes.Buffer
+		enc := msgpack.NewEncoder(&buf)
+		enc.SetCustomStructTag("json")
+		err := enc.Encode(v)
+		return buf.Bytes(), err
+	},
+}, {
+	contentType: ProtobufType,
+	protobuf:    true,
+	decode: func(b []byte, v any) error {
+		return proto.Unmarshal(b, v.(proto.Message))
+	},
+	encode: func(v any) ([]byte, error) {
+		return proto.Marshal(v.(proto.Message))
+	},
+}}
+
+// other names clients send the content types by
+var aliases = map[string]string{
+	"application/x-msgpack": MsgpackType,
+	"application/protobuf":  ProtobufType,
+}
+
+func codecFor(contentType string) (codec, bool) {
+	if alias, ok := aliases[contentType]; ok {
+		contentType = alias
+	}
+	for _, c := range codecs {
+		if c.contentType == contentType {
+			return c, true
+		}
+	}
+	return codec{}, false
+}
+
+// the codec of the request's body by its Content-Type, json without one
+func requestCodec(r *http.Request) (codec, error) {
+	header := r.Header.Get("Content-Type")
+	if header == "" {
+		return codecs[0], nil
+	}
+	contentType, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		return codec{}, err
+	}
+	c, ok := codecFor(contentType)
+	if !ok {
+		return codec{}, fmt.Errorf("unsupported content type %q", contentType)
+	}
+	return c, nil
+}
+
+/*
+the codec of the response by the request's Accept header: the supported type with the highest q value, the
+first one listed on ties. json when the client takes anything, ex. without an Accept header or with a wildcard
+*/
+func responseCodec(r *http.Request) (codec, bool) {
+	header := r.Header.Get("Accept")
+	if header == "" {
+		return codecs[0], true
+	}
+	var best codec
+	var bestQ float64
+	for _, accepted := range strings.Split(header, ",") {
+		contentType, params, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		c, ok := codecFor(contentType)
+		if contentType == "*/*" || contentType == "application/*" {
+			c, ok = codecs[0], true
+		}
+		if ok && q > bestQ {
+			best, bestQ = c, q
+		}
+	}
+	return best, bestQ > 0
+}
+
+/*
+negotiates the response's codec before the request is handled so it isn't handled for nothing, responding with
+NotAcceptable when the client doesn't take any of the content types
+*/
+func negotiate(w http.ResponseWriter, r *http.Request) (codec, bool) {
+	c, ok := responseCodec(r)
+	if !ok {
+		types := make([]string, len(codecs))
+		for i, c := range codecs {
+			types[i] = c.contentType
+		}
+		http.Error(w, "responses are in "+strings.Join(types, ", "), http.StatusNotAcceptable)
+	}
+	return c, ok
+}
+
+// decodes the request's body with its codec, into msg for protobuf and into v otherwise
+func decodeBody(r *http.Request, c codec, v any, msg proto.Message) error {
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	if c.protobuf {
+		return c.decode(b, msg)
+	}
+	return c.decode(b, v)
+}
+
+// writes res, or msg in protobuf, in the codec's content type
+func writeBody(w http.ResponseWriter, c codec, res any, msg proto.Message) {
+	if c.protobuf {
+		res = msg
+	}
+	b, err := c.encode(res)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", c.contentType)
+	w.Header().Add("Vary", "Accept")
+	w.Write(b)
+}
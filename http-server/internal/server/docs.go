@@ -0,0 +1,174 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// a route the server handles and what the openapi document says about it
+type route struct {
+	method  string
+	path    string
+	summary string
+	handler http.HandlerFunc
+	params  []param
+	// zero values of the json and msgpack bodies, and of the protobuf messages in their place. nil when there isn't one
+	request         any
+	response        any
+	requestMessage  proto.Message
+	responseMessage proto.Message
+	// error statuses the route responds with besides 200 and the 500 every route can fail with
+	responses []int
+}
+
+type param struct {
+	name        string
+	in          string
+	description string
+}
+
+// strips the patterns out of mux's path variables, ex. /records/{offset:[0-9]+} is /records/{offset} in openapi
+var pathPattern = regexp.MustCompile(`{([^:}]+)(:[^}]+)?}`)
+
+// openapi v3 document describing the routes, the schemas of their bodies come from their json fields
+func openAPI(routes []route) map[string]any {
+	schemas := make(map[string]any)
+	paths := make(map[string]map[string]any)
+	for _, r := range routes {
+		path := pathPattern.ReplaceAllString(r.path, "{$1}")
+		if paths[path] == nil {
+			paths[path] = make(map[string]any)
+		}
+		op := map[string]any{"summary": r.summary}
+		var params []map[string]any
+		for _, p := range r.params {
+			params = append(params, map[string]any{
+				"name":        p.name,
+				"in":          p.in,
+				"description": p.description,
+				"required":    p.in == "path",
+				"schema":      map[string]any{"type": "integer", "format": "uint64", "minimum": 0},
+			})
+		}
+		if params != nil {
+			op["parameters"] = params
+		}
+		if r.request != nil {
+			op["requestBody"] = map[string]any{
+				"required": true,
+				"content":  bodyContent(schemaRef(reflect.TypeOf(r.request), schemas), r.requestMessage),
+			}
+		}
+		responses := map[string]any{
+			"200": map[string]any{
+				"description": "OK",
+				"content":     bodyContent(schemaRef(reflect.TypeOf(r.response), schemas), r.responseMessage),
+			},
+		}
+		for _, code := range append(r.responses, http.StatusInternalServerError) {
+			responses[fmt.Sprint(code)] = map[string]any{
+				"description": http.StatusText(code),
+				"content":     map[string]any{"text/plain": map[string]any{"schema": map[string]any{"type": "string"}}},
+			}
+		}
+		op["responses"] = responses
+		paths[path][strings.ToLower(r.method)] = op
+	}
+	return map[string]any{
+		"openapi":    "3.0.3",
+		"info":       map[string]any{"title": "distributed log", "version": "1.0.0"},
+		"paths":      paths,
+		"components": map[string]any{"schemas": schemas},
+	}
+}
+
+// the body in every content type, protobuf bodies are the binary encoding of the message
+func bodyContent(schema map[string]any, msg proto.Message) map[string]any {
+	return map[string]any{
+		JSONType:    map[string]any{"schema": schema},
+		MsgpackType: map[string]any{"schema": schema},
+		ProtobufType: map[string]any{"schema": map[string]any{
+			"type":        "string",
+			"format":      "binary",
+			"description": string(proto.MessageName(msg)),
+		}},
+	}
+}
+
+// the schema of the type, structs are added to the components by their name and referenced
+func schemaRef(t reflect.Type, schemas map[string]any) map[string]any {
+	switch t.Kind() {
+	case reflect.Struct:
+		if _, ok := schemas[t.Name()]; !ok {
+			properties := make(map[string]any)
+			// set before the fields so types that refer to themselves are only added once
+			schemas[t.Name()] = map[string]any{"type": "object", "properties": properties}
+			for i := 0; i < t.NumField(); i++ {
+				f := t.Field(i)
+				name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+				if name == "-" || !f.IsExported() {
+					continue
+				}
+				if name == "" {
+					name = f.Name
+				}
+				properties[name] = schemaRef(f.Type, schemas)
+			}
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + t.Name()}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// encoding/json writes bytes as base64
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+		return map[string]any{"type": "array", "items": schemaRef(t.Elem(), schemas)}
+	case reflect.Uint64, reflect.Uint32, reflect.Uint:
+		return map[string]any{"type": "integer", "format": t.Kind().String(), "minimum": 0}
+	case reflect.Int64, reflect.Int32, reflect.Int:
+		return map[string]any{"type": "integer", "format": t.Kind().String()}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	default:
+		return map[string]any{"type": "string"}
+	}
+}
+
+// the document is generated once, the routes don't change while the server runs
+func openAPIHandler(routes []route) http.Handler {
+	doc, err := json.MarshalIndent(openAPI(routes), "", "  ")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(doc)
+	})
+}
+
+// swagger ui for the openapi document, its assets are loaded from the unpkg cdn
+const docsPage = `<!DOCTYPE html>
+<html>
+<head>
+  <meta charset="utf-8">
+  <title>distributed log</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>SwaggerUIBundle({url: "/docs/openapi.json", dom_id: "#swagger-ui"});</script>
+</body>
+</html>
+`
+
+func handleDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(docsPage))
+}
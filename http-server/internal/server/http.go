@@ -1,37 +1,92 @@
 package server
 
 import (
-	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"strconv"
 
 	"github.com/gorilla/mux"
+	api "github.com/phaseharry/distributed-log/serve-requests-with-grpc/api/v1"
 )
 
-func NewHTTPServer(addr string) *http.Server {
-	httpsrv := newHTTPServer()
+/*
+serves the commit log over http, the log stays open after the server is shut down.
+the middleware wraps every request in order, ex. RequestIDs, AccessLog, Recovery and Gzip
+*/
+func NewHTTPServer(addr string, commitLog CommitLog, middleware ...Middleware) *http.Server {
+	httpsrv := newHTTPServer(commitLog)
 	r := mux.NewRouter()
 
-	r.HandleFunc("/", httpsrv.handleProduce).Methods("POST")
-	r.HandleFunc("/", httpsrv.handleConsume).Methods("GET")
+	routes := httpsrv.routes()
+	for _, route := range routes {
+		r.HandleFunc(route.path, route.handler).Methods(route.method)
+	}
+	r.Handle("/docs/openapi.json", openAPIHandler(routes)).Methods("GET")
+	r.HandleFunc("/docs", handleDocs).Methods("GET")
+
+	var handler http.Handler = r
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
 
 	log.Printf("listing on port%v", addr)
 	return &http.Server{
 		Addr:    addr,
-		Handler: r,
+		Handler: handler,
 	}
 }
 
 type httpServer struct {
-	Log *Log
+	Log CommitLog
 }
 
-func newHTTPServer() *httpServer {
+func newHTTPServer(commitLog CommitLog) *httpServer {
 	return &httpServer{
-		Log: NewLog(),
+		Log: commitLog,
 	}
 }
 
+/*
+the routes the server handles, the openapi document served at /docs is generated from them so it can't
+drift from what's served
+*/
+func (s *httpServer) routes() []route {
+	return []route{{
+		method:          "POST",
+		path:            "/records",
+		summary:         "appends the record to the log",
+		handler:         s.handleProduce,
+		request:         ProduceRequest{},
+		response:        ProduceResponse{},
+		requestMessage:  &api.Record{},
+		responseMessage: &api.ProduceResponse{},
+		responses:       []int{http.StatusBadRequest, http.StatusNotAcceptable, http.StatusUnsupportedMediaType},
+	}, {
+		method:  "GET",
+		path:    "/records",
+		summary: "reads a range of records, past the end of the log it's empty",
+		handler: s.handleConsumeRange,
+		params: []param{
+			{name: "from", in: "query", description: "offset the range starts from, defaults to 0"},
+			{name: "limit", in: "query", description: "most records in the range, defaults to 100 and is capped at 10000"},
+		},
+		response:        ConsumeRangeResponse{},
+		responseMessage: &api.ConsumeBatchResponse{},
+		responses:       []int{http.StatusBadRequest, http.StatusNotFound, http.StatusNotAcceptable},
+	}, {
+		method:          "GET",
+		path:            "/records/{offset:[0-9]+}",
+		summary:         "reads the record at the offset",
+		handler:         s.handleConsume,
+		params:          []param{{name: "offset", in: "path", description: "offset of the record"}},
+		response:        ConsumeResponse{},
+		responseMessage: &api.ConsumeResponse{},
+		responses:       []int{http.StatusNotFound, http.StatusNotAcceptable},
+	}}
+}
+
 type ProduceRequest struct {
 	Record Record `json:"record"`
 }
@@ -40,56 +95,78 @@ type ProduceResponse struct {
 	Offset uint64 `json:"offset"`
 }
 
-type ConsumeRequest struct {
-	Offset uint64 `json:"offset"`
-}
-
 type ConsumeResponse struct {
 	Record Record `json:"record"`
 }
 
+type ConsumeRangeResponse struct {
+	Records []Record `json:"records"`
+	// offset the next range starts from
+	NextOffset uint64 `json:"next_offset"`
+}
+
+const (
+	// records a range responds with when the request doesn't ask for a limit
+	defaultRangeLimit = 100
+	// most records a range responds with so one request can't make the server hold the whole log in memory
+	maxRangeLimit = 10000
+)
+
 /*
 takes an incoming Record as payload and appends it to our log.
 returns the offset (idx) position of where the log is as part of the
-response to client
+response to client, ex. POST /records. see codec for the content types
 */
 func (s *httpServer) handleProduce(w http.ResponseWriter, r *http.Request) {
+	c, ok := negotiate(w, r)
+	if !ok {
+		return
+	}
+	reqCodec, err := requestCodec(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
 	var req ProduceRequest
-	err := json.NewDecoder(r.Body).Decode(&req)
+	record := &api.Record{}
+	err = decodeBody(r, reqCodec, &req, record)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if !reqCodec.protobuf {
+		record = &api.Record{Value: req.Record.Value}
+	}
+	// the log assigns the offset
+	record.Offset = 0
 
-	offset, err := s.Log.Append(req.Record)
+	offset, err := s.Log.Append(record)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	res := ProduceResponse{Offset: offset}
-	err = json.NewEncoder(w).Encode(res)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
+	writeBody(w, c, res, &api.ProduceResponse{Offset: offset})
 }
 
 /*
-takes an offset and return the record associated with the offset.
+takes the offset from the path and returns the record associated with it, ex. GET /records/3.
 if the offset does not exist, return a NotFound
 */
 func (s *httpServer) handleConsume(w http.ResponseWriter, r *http.Request) {
-	var req ConsumeRequest
-
-	err := json.NewDecoder(r.Body).Decode(&req)
+	c, ok := negotiate(w, r)
+	if !ok {
+		return
+	}
+	offset, err := strconv.ParseUint(mux.Vars(r)["offset"], 10, 64)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	record, err := s.Log.Read(req.Offset)
-	if err == ErrOffsetNotFound {
+	record, err := s.Log.Read(offset)
+	if errors.As(err, &api.ErrOffsetOutOfRange{}) {
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
@@ -98,10 +175,74 @@ func (s *httpServer) handleConsume(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	res := ConsumeResponse{Record: record}
-	err = json.NewEncoder(w).Encode(res)
+	res := ConsumeResponse{Record: fromAPI(record)}
+	writeBody(w, c, res, &api.ConsumeResponse{Record: record})
+}
+
+/*
+returns up to limit records from the from offset on, ex. GET /records?from=10&limit=5. both default to the
+start of the log and 100 records. past the end of the log the range is empty so clients can poll with the
+next offset, before the start of it is a NotFound
+*/
+func (s *httpServer) handleConsumeRange(w http.ResponseWriter, r *http.Request) {
+	c, ok := negotiate(w, r)
+	if !ok {
+		return
+	}
+	from, err := queryUint(r, "from", 0)
 	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, err := queryUint(r, "limit", defaultRangeLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit = min(limit, maxRangeLimit)
+
+	res := ConsumeRangeResponse{Records: []Record{}, NextOffset: from}
+	msg := &api.ConsumeBatchResponse{NextOffset: from}
+	it, err := s.Log.ReadRange(from, from+limit)
+	switch {
+	case errors.As(err, &api.ErrOffsetOutOfRange{}):
+		lowest, err := s.Log.LowestOffset()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if from < lowest {
+			http.Error(w, fmt.Sprintf("offset %d is before the start of the log at %d", from, lowest), http.StatusNotFound)
+			return
+		}
+	case err != nil:
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
+	default:
+		for it.Next() {
+			record := it.Record()
+			res.Records = append(res.Records, fromAPI(record))
+			res.NextOffset = record.Offset + 1
+			msg.Records = append(msg.Records, record)
+		}
+		if err = it.Err(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	msg.NextOffset = res.NextOffset
+	writeBody(w, c, res, msg)
+}
+
+// parses the query parameter as an offset or count, def when it isn't set
+func queryUint(r *http.Request, name string, def uint64) (uint64, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %q", name, value)
 	}
+	return n, nil
 }
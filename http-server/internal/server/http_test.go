@@ -0,0 +1,204 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	api "github.com/phaseharry/distributed-log/serve-requests-with-grpc/api/v1"
+	commitlog "github.com/phaseharry/distributed-log/serve-requests-with-grpc/log"
+	"github.com/stretchr/testify/require"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+// testing that produced records are consumed by their offset, and are still there once the log is reopened
+func TestHTTPServer(t *testing.T) {
+	dir, err := os.MkdirTemp("", "http-server-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	l, err := commitlog.Open(dir)
+	require.NoError(t, err)
+	srv := httptest.NewServer(NewHTTPServer(":0", l).Handler)
+
+	want := []byte("hello world")
+	var produced ProduceResponse
+	require.Equal(t, http.StatusOK, do(t, srv, "POST", "/records", ProduceRequest{Record: Record{Value: want}}, &produced))
+	var consumed ConsumeResponse
+	require.Equal(t, http.StatusOK, do(t, srv, "GET", fmt.Sprintf("/records/%d", produced.Offset), nil, &consumed))
+	require.Equal(t, want, consumed.Record.Value)
+	require.Equal(t, produced.Offset, consumed.Record.Offset)
+	require.Equal(t, http.StatusNotFound, do(t, srv, "GET", fmt.Sprintf("/records/%d", produced.Offset+1), nil, nil))
+
+	srv.Close()
+	require.NoError(t, l.Close())
+	l, err = commitlog.Open(dir)
+	require.NoError(t, err)
+	defer l.Close()
+	srv = httptest.NewServer(NewHTTPServer(":0", l).Handler)
+	defer srv.Close()
+	consumed = ConsumeResponse{}
+	require.Equal(t, http.StatusOK, do(t, srv, "GET", fmt.Sprintf("/records/%d", produced.Offset), nil, &consumed))
+	require.Equal(t, want, consumed.Record.Value)
+}
+
+// testing that ranges are paged through with their next offsets, and end with an empty range
+func TestConsumeRange(t *testing.T) {
+	dir, err := os.MkdirTemp("", "http-server-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	l, err := commitlog.Open(dir)
+	require.NoError(t, err)
+	defer l.Close()
+	srv := httptest.NewServer(NewHTTPServer(":0", l).Handler)
+	defer srv.Close()
+
+	for i := 0; i < 5; i++ {
+		record := Record{Value: []byte(fmt.Sprintf("record %d", i))}
+		require.Equal(t, http.StatusOK, do(t, srv, "POST", "/records", ProduceRequest{Record: record}, &ProduceResponse{}))
+	}
+
+	var res ConsumeRangeResponse
+	require.Equal(t, http.StatusOK, do(t, srv, "GET", "/records?from=1&limit=3", nil, &res))
+	require.Len(t, res.Records, 3)
+	for i, record := range res.Records {
+		require.Equal(t, uint64(1+i), record.Offset)
+	}
+	require.Equal(t, uint64(4), res.NextOffset)
+
+	res = ConsumeRangeResponse{}
+	require.Equal(t, http.StatusOK, do(t, srv, "GET", "/records", nil, &res))
+	require.Len(t, res.Records, 5)
+	res = ConsumeRangeResponse{}
+	require.Equal(t, http.StatusOK, do(t, srv, "GET", "/records?from=5", nil, &res))
+	require.Empty(t, res.Records)
+	require.Equal(t, uint64(5), res.NextOffset)
+
+	require.Equal(t, http.StatusBadRequest, do(t, srv, "GET", "/records?limit=many", nil, nil))
+	require.Equal(t, http.StatusMethodNotAllowed, do(t, srv, "DELETE", "/records/1", nil, nil))
+}
+
+// sends the body as json and decodes the response into v when it's a 200, returning its status
+func do(t *testing.T, srv *httptest.Server, method, path string, body, v any) int {
+	t.Helper()
+	var b []byte
+	if body != nil {
+		var err error
+		b, err = json.Marshal(body)
+		require.NoError(t, err)
+	}
+	req, err := http.NewRequest(method, srv.URL+path, bytes.NewReader(b))
+	require.NoError(t, err)
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusOK && v != nil {
+		require.NoError(t, json.NewDecoder(res.Body).Decode(v))
+	}
+	return res.StatusCode
+}
+
+// testing that the openapi document describes every route with the schemas of their bodies
+func TestDocs(t *testing.T) {
+	srv := httptest.NewServer(NewHTTPServer(":0", nil).Handler)
+	defer srv.Close()
+
+	var doc struct {
+		OpenAPI string
+		Paths   map[string]map[string]struct {
+			Parameters []struct{ Name, In string }
+		}
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]struct {
+					Type, Format string
+					Ref          string `json:"$ref"`
+				}
+			}
+		}
+	}
+	require.Equal(t, http.StatusOK, do(t, srv, "GET", "/docs/openapi.json", nil, &doc))
+	require.Equal(t, "3.0.3", doc.OpenAPI)
+	require.Contains(t, doc.Paths["/records"], "post")
+	require.Contains(t, doc.Paths["/records"], "get")
+	require.Equal(t, "offset", doc.Paths["/records/{offset}"]["get"].Parameters[0].Name)
+	require.Equal(t, "path", doc.Paths["/records/{offset}"]["get"].Parameters[0].In)
+	require.Equal(t, "#/components/schemas/Record", doc.Components.Schemas["ProduceRequest"].Properties["record"].Ref)
+	require.Equal(t, "byte", doc.Components.Schemas["Record"].Properties["value"].Format)
+	require.Equal(t, "array", doc.Components.Schemas["ConsumeRangeResponse"].Properties["records"].Type)
+
+	res, err := http.Get(srv.URL + "/docs")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, "text/html; charset=utf-8", res.Header.Get("Content-Type"))
+}
+
+// testing that bodies are decoded by their content type and responses are encoded in the type that's accepted
+func TestContentTypes(t *testing.T) {
+	dir, err := os.MkdirTemp("", "http-server-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	l, err := commitlog.Open(dir)
+	require.NoError(t, err)
+	defer l.Close()
+	srv := httptest.NewServer(NewHTTPServer(":0", l).Handler)
+	defer srv.Close()
+
+	send := func(method, path, contentType, accept string, body []byte) (*http.Response, []byte) {
+		req, err := http.NewRequest(method, srv.URL+path, bytes.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Accept", accept)
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		b, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res, b
+	}
+
+	// protobuf records keep what json can't carry, ex. their key
+	record, err := proto.Marshal(&api.Record{Key: []byte("key"), Value: []byte("hello world")})
+	require.NoError(t, err)
+	res, body := send("POST", "/records", ProtobufType, ProtobufType, record)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, ProtobufType, res.Header.Get("Content-Type"))
+	var produced api.ProduceResponse
+	require.NoError(t, proto.Unmarshal(body, &produced))
+	res, body = send("GET", fmt.Sprintf("/records/%d", produced.Offset), "", "application/protobuf", nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	var consumed api.ConsumeResponse
+	require.NoError(t, proto.Unmarshal(body, &consumed))
+	require.Equal(t, []byte("key"), consumed.Record.Key)
+	require.Equal(t, []byte("hello world"), consumed.Record.Value)
+
+	req, err := msgpack.Marshal(map[string]any{"record": map[string]any{"value": []byte("msgpack")}})
+	require.NoError(t, err)
+	res, body = send("POST", "/records", MsgpackType, "application/json;q=0.5, application/msgpack", req)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, MsgpackType, res.Header.Get("Content-Type"))
+	var offset struct {
+		Offset uint64 `msgpack:"offset"`
+	}
+	require.NoError(t, msgpack.Unmarshal(body, &offset))
+	require.Equal(t, produced.Offset+1, offset.Offset)
+
+	res, body = send("GET", "/records?from=0", "", "text/html, */*;q=0.1", nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, JSONType, res.Header.Get("Content-Type"))
+	var ranged ConsumeRangeResponse
+	require.NoError(t, json.Unmarshal(body, &ranged))
+	require.Equal(t, []byte("msgpack"), ranged.Records[1].Value)
+
+	res, _ = send("GET", "/records/0", "", "text/html", nil)
+	require.Equal(t, http.StatusNotAcceptable, res.StatusCode)
+	res, _ = send("POST", "/records", "text/plain", "", []byte("hello world"))
+	require.Equal(t, http.StatusUnsupportedMediaType, res.StatusCode)
+}
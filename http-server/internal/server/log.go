@@ -1,43 +1,27 @@
 package server
 
 import (
-	"fmt"
-	"sync"
+	api "github.com/phaseharry/distributed-log/serve-requests-with-grpc/api/v1"
+	commitlog "github.com/phaseharry/distributed-log/serve-requests-with-grpc/log"
 )
 
-type Log struct {
-	mutex   sync.Mutex
-	records []Record
+/*
+the part of the gRPC server's CommitLog the http server uses, so both serve the same segmented log on disk.
+ex. the log from the log package's Open, anything else with these methods works too, ex. in tests
+*/
+type CommitLog interface {
+	Append(*api.Record) (uint64, error)
+	Read(uint64) (*api.Record, error)
+	ReadRange(from, to uint64) (commitlog.RecordIterator, error)
+	LowestOffset() (uint64, error)
 }
 
+// the records as they're sent over http, their values are base64 in json
 type Record struct {
-	Value  []byte `json: "value`
-	Offset uint64 `json: "offset"`
+	Value  []byte `json:"value"`
+	Offset uint64 `json:"offset"`
 }
 
-func NewLog() *Log {
-	return &Log{}
+func fromAPI(record *api.Record) Record {
+	return Record{Value: record.Value, Offset: record.Offset}
 }
-
-func (l *Log) Append(record Record) (uint64, error) {
-	l.mutex.Lock()
-	// assigning an index to the record that's being appended to our log
-	record.Offset = uint64(len(l.records))
-	l.records = append(l.records, record)
-	l.mutex.Unlock()
-
-	return record.Offset, nil
-}
-
-func (l *Log) Read(offset uint64) (Record, error) {
-	l.mutex.Lock()
-	// deferring the mutex.Unlock call so it will call after we've returned out of this function
-	defer l.mutex.Unlock()
-	if offset >= uint64(len(l.records)) {
-		return Record{}, ErrOffsetNotFound
-	}
-
-	return l.records[offset], nil
-}
-
-var ErrOffsetNotFound = fmt.Errorf("offset not found")
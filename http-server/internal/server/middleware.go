@@ -0,0 +1,211 @@
+package server
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/phaseharry/distributed-log/serve-requests-with-grpc/auth"
+	"go.uber.org/zap"
+)
+
+/*
+Middleware wraps the server's handler, ex. to log or recover requests. NewHTTPServer applies them in order
+so the first one is the outermost and sees every request, including the ones the router doesn't have a route for
+*/
+type Middleware func(http.Handler) http.Handler
+
+// header requests are identified by, a request that comes with one keeps it so ids carry across services
+const RequestIDHeader = "X-Request-Id"
+
+type requestIDKey struct{}
+
+// RequestIDs gives every request an id, sending it back in RequestIDHeader. handlers get it with RequestID
+func RequestIDs() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(RequestIDHeader)
+			if id == "" {
+				b := make([]byte, 8)
+				rand.Read(b)
+				id = hex.EncodeToString(b)
+			}
+			w.Header().Set(RequestIDHeader, id)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+		})
+	}
+}
+
+// RequestID returns the id RequestIDs gave the request, empty without it
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// records the status and size of the response for the access log
+type recorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (r *recorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
+
+/*
+AccessLog logs every request once it's handled with its method, path, status, response size, duration, the
+client's address and its request id when it has one. server errors are logged at the error level.
+it should come after RequestIDs so the id is set
+*/
+func AccessLog(logger *zap.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := &recorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+			fields := []zap.Field{
+				zap.String("method", r.Method),
+				zap.String("path", r.URL.Path),
+				zap.Int("status", rec.status),
+				zap.Int("bytes", rec.bytes),
+				zap.Duration("duration", time.Since(start)),
+				zap.String("remote", r.RemoteAddr),
+			}
+			if id := RequestID(r.Context()); id != "" {
+				fields = append(fields, zap.String("request_id", id))
+			}
+			if rec.status >= http.StatusInternalServerError {
+				logger.Error("request", fields...)
+			} else {
+				logger.Info("request", fields...)
+			}
+		})
+	}
+}
+
+/*
+Recovery turns panics in handlers into 500s for the client instead of crashing the server, after handing the
+panic and its stack to fn. responses that were already started are cut off instead. it should come right
+after the access log so the 500s are logged
+*/
+func Recovery(fn func(p any, stack []byte)) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				if p := recover(); p != nil {
+					if p == http.ErrAbortHandler {
+						panic(p)
+					}
+					fn(p, debug.Stack())
+					http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				}
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+/*
+JWT authenticates requests by the bearer token the JWT verifies, requests without a valid one are rejected with
+401 before they reach the routes or the gateway. handlers get the principal with auth.Principal
+*/
+func JWT(j *auth.JWT) Middleware {
+	return func(next http.Handler) http.Handler {
+		return j.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if auth.Principal(r.Context()) == "" {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, "a bearer token is required", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		}))
+	}
+}
+
+/*
+compresses the body written to it. the status is held back until the body's first write so responses without
+a body, and the 500s of handlers that panic before writing, are sent uncompressed
+*/
+type gzipWriter struct {
+	http.ResponseWriter
+	gz     *gzip.Writer
+	status int
+}
+
+func (g *gzipWriter) WriteHeader(status int) {
+	if g.status == 0 {
+		g.status = status
+	}
+}
+
+func (g *gzipWriter) Write(b []byte) (int, error) {
+	if g.gz == nil {
+		if g.status == 0 {
+			g.status = http.StatusOK
+		}
+		// the length of the body the handler set is its uncompressed length
+		g.Header().Del("Content-Length")
+		g.Header().Set("Content-Encoding", "gzip")
+		g.ResponseWriter.WriteHeader(g.status)
+		g.gz = gzip.NewWriter(g.ResponseWriter)
+	}
+	return g.gz.Write(b)
+}
+
+// sends the held back status of a response without a body, and finishes the compressed body
+func (g *gzipWriter) close() {
+	if g.gz == nil {
+		if g.status != 0 {
+			g.ResponseWriter.WriteHeader(g.status)
+		}
+		return
+	}
+	g.gz.Close()
+}
+
+// Gzip compresses the responses of clients that accept gzip, ex. ranges of records
+func Gzip() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+			if !acceptsGzip(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			gw := &gzipWriter{ResponseWriter: w}
+			defer gw.close()
+			next.ServeHTTP(gw, r)
+		})
+	}
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, encoding := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(encoding), ";")
+		if strings.TrimSpace(name) == "gzip" && strings.ReplaceAll(params, " ", "") != "q=0" {
+			return true
+		}
+	}
+	return false
+}
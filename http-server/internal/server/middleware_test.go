@@ -0,0 +1,166 @@
+package server
+
+import (
+	"compress/gzip"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/phaseharry/distributed-log/serve-requests-with-grpc/auth"
+	commitlog "github.com/phaseharry/distributed-log/serve-requests-with-grpc/log"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// testing that requests get ids, are logged, have their panics recovered and their responses gzipped in order
+func TestMiddleware(t *testing.T) {
+	dir, err := os.MkdirTemp("", "http-server-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	l, err := commitlog.Open(dir)
+	require.NoError(t, err)
+	defer l.Close()
+
+	core, logs := observer.New(zapcore.InfoLevel)
+	var panics []any
+	panicking := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/panic" {
+				panic("oops")
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+	srv := httptest.NewServer(NewHTTPServer(":0", l,
+		RequestIDs(),
+		AccessLog(zap.New(core)),
+		Recovery(func(p any, stack []byte) { panics = append(panics, p) }),
+		Gzip(),
+		panicking,
+	).Handler)
+	defer srv.Close()
+
+	// the transport only decompresses responses itself when it asked for gzip
+	get := func(path, id string) *http.Response {
+		req, err := http.NewRequest("GET", srv.URL+path, nil)
+		require.NoError(t, err)
+		req.Header.Set("Accept-Encoding", "gzip")
+		if id != "" {
+			req.Header.Set(RequestIDHeader, id)
+		}
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return res
+	}
+
+	res := get("/records", "")
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, "gzip", res.Header.Get("Content-Encoding"))
+	gz, err := gzip.NewReader(res.Body)
+	require.NoError(t, err)
+	body, err := io.ReadAll(gz)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"records": [], "next_offset": 0}`, string(body))
+	id := res.Header.Get(RequestIDHeader)
+	require.Len(t, id, 16)
+
+	res = get("/panic", "from-upstream")
+	res.Body.Close()
+	require.Equal(t, http.StatusInternalServerError, res.StatusCode)
+	require.Equal(t, "from-upstream", res.Header.Get(RequestIDHeader))
+	require.Equal(t, []any{"oops"}, panics)
+
+	entries := logs.AllUntimed()
+	require.Len(t, entries, 2)
+	logged := entries[0].ContextMap()
+	require.Equal(t, "GET", logged["method"])
+	require.Equal(t, "/records", logged["path"])
+	require.Equal(t, int64(http.StatusOK), logged["status"])
+	require.Equal(t, id, logged["request_id"])
+	require.Equal(t, zapcore.ErrorLevel, entries[1].Level)
+	require.Equal(t, int64(http.StatusInternalServerError), entries[1].ContextMap()["status"])
+	require.Equal(t, "from-upstream", entries[1].ContextMap()["request_id"])
+
+	// clients that don't accept gzip get the body as is
+	req, err := http.NewRequest("GET", srv.URL+"/docs", nil)
+	require.NoError(t, err)
+	req.Header.Set("Accept-Encoding", "identity")
+	res, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Empty(t, res.Header.Get("Content-Encoding"))
+	body, err = io.ReadAll(res.Body)
+	require.NoError(t, err)
+	require.Contains(t, string(body), "swagger-ui")
+}
+
+// testing that requests without a valid bearer token are rejected before they reach the routes
+func TestJWT(t *testing.T) {
+	dir, err := os.MkdirTemp("", "http-server-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	l, err := commitlog.Open(dir)
+	require.NoError(t, err)
+	defer l.Close()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kid": "key-1",
+			"kty": "RSA",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	}))
+	defer provider.Close()
+	j, err := auth.NewJWT(auth.JWTConfig{JWKSURL: provider.URL})
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(NewHTTPServer(":0", l, JWT(j)).Handler)
+	defer srv.Close()
+
+	token := signJWT(t, key, map[string]any{"sub": "billing", "exp": time.Now().Add(time.Hour).Unix()})
+	for authorization, want := range map[string]int{
+		"":                http.StatusUnauthorized,
+		"Bearer nope":     http.StatusUnauthorized,
+		"Bearer " + token: http.StatusOK,
+	} {
+		req, err := http.NewRequest("GET", srv.URL+"/records", nil)
+		require.NoError(t, err)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+		require.Equal(t, want, res.StatusCode, authorization)
+	}
+}
+
+// signs an RS256 token with the claims for the key published as key-1
+func signJWT(t *testing.T, key *rsa.PrivateKey, claims map[string]any) string {
+	t.Helper()
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": "key-1"})
+	require.NoError(t, err)
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
@@ -0,0 +1,96 @@
+package log_v1
+
+import (
+	"fmt"
+	"mime"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+const (
+	// header producers and consumers use to tell each other how a record's value is encoded
+	ContentTypeHeader = "content-type"
+	// the value is a marshaled google.protobuf.Any
+	AnyContentType = "application/x-protobuf-any"
+	/*
+		the value is a marshaled protobuf message, the message's full name is in the messagetype parameter.
+		ex. application/x-protobuf; messagetype=foo.v1.Bar
+	*/
+	ProtobufContentType = "application/x-protobuf"
+)
+
+/*
+NewAnyRecord packs the message into a google.protobuf.Any and returns a record with it as its value,
+the record's content type tells consumers the value can be unpacked
+*/
+func NewAnyRecord(m proto.Message) (*Record, error) {
+	a, err := anypb.New(m)
+	if err != nil {
+		return nil, err
+	}
+	value, err := proto.Marshal(a)
+	if err != nil {
+		return nil, err
+	}
+	return &Record{
+		Value:   value,
+		Headers: map[string]string{ContentTypeHeader: AnyContentType},
+	}, nil
+}
+
+/*
+UnpackAny returns a copy of the record with its google.protobuf.Any value replaced by the message it holds
+and its content type set to the message's type. records that weren't produced as an Any are returned as is
+*/
+func UnpackAny(r *Record) (*Record, error) {
+	if r.Headers[ContentTypeHeader] != AnyContentType {
+		return r, nil
+	}
+	a := &anypb.Any{}
+	if err := proto.Unmarshal(r.Value, a); err != nil {
+		return nil, err
+	}
+	unpacked := proto.Clone(r).(*Record)
+	unpacked.Value = a.Value
+	unpacked.Headers[ContentTypeHeader] = mime.FormatMediaType(
+		ProtobufContentType,
+		map[string]string{"messageType": string(a.MessageName())},
+	)
+	return unpacked, nil
+}
+
+/*
+UnmarshalAny unmarshals the record's value into m whether it was consumed as the google.protobuf.Any it was
+produced as or already unpacked by the server. fails if the value holds a different message than m
+*/
+func UnmarshalAny(r *Record, m proto.Message) error {
+	want := m.ProtoReflect().Descriptor().FullName()
+	contentType := r.Headers[ContentTypeHeader]
+	if contentType == AnyContentType {
+		a := &anypb.Any{}
+		if err := proto.Unmarshal(r.Value, a); err != nil {
+			return err
+		}
+		if a.MessageName() != want {
+			return fmt.Errorf("record holds %s, not %s", a.MessageName(), want)
+		}
+		return proto.Unmarshal(a.Value, m)
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != ProtobufContentType {
+		return fmt.Errorf("record isn't a protobuf message: %q", contentType)
+	}
+	// media type parameter names are case insensitive so they're parsed lower cased
+	if got := protoreflect.FullName(params["messagetype"]); got != want {
+		return fmt.Errorf("record holds %s, not %s", got, want)
+	}
+	return proto.Unmarshal(r.Value, m)
+}
+
+// returns the full name of the message in a type url, ex. type.googleapis.com/foo.v1.Bar is foo.v1.Bar
+func MessageName(typeURL string) protoreflect.FullName {
+	return protoreflect.FullName(typeURL[strings.LastIndex(typeURL, "/")+1:])
+}
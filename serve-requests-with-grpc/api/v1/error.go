@@ -2,18 +2,34 @@ package log_v1
 
 import (
 	"fmt"
+	"strconv"
+	"time"
 
 	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
 )
 
+/*
+errors the log's api fails with. each one carries the grpc code clients branch on and errdetails describing it,
+so a client can tell ex. a throttled produce it should retry later from a record it should never send again:
+- ErrOffsetOutOfRange: OutOfRange, reading past either end of the log
+- ErrRecordTooLarge: InvalidArgument with a BadRequest detail, the record is bigger than the log accepts
+- ErrUnknownTopic: NotFound, the topic doesn't exist
+- ErrNotLeader: Unavailable with an ErrorInfo detail naming the leader the request should go to instead
+- ErrThrottled: ResourceExhausted with RetryInfo and QuotaFailure details, the client is over its quota
+- ErrCorrupt: DataLoss, the record at the offset can't be decoded
+*/
+
+// returned when reading an offset the log doesn't have a record at
 type ErrOffsetOutOfRange struct {
 	Offset uint64
 }
 
 func (e ErrOffsetOutOfRange) GRPCStatus() *status.Status {
 	initialStatus := status.New(
-		404,
+		codes.OutOfRange,
 		fmt.Sprintf("offset out of range: %d, ", e.Offset),
 	)
 	message := fmt.Sprintf(
@@ -36,3 +52,282 @@ func (e ErrOffsetOutOfRange) GRPCStatus() *status.Status {
 func (e ErrOffsetOutOfRange) Error() string {
 	return e.GRPCStatus().Err().Error()
 }
+
+/*
+returned when an idempotent produce skips ahead of or falls behind the producer's next sequence number,
+the record isn't appended
+*/
+type ErrOutOfOrderSequence struct {
+	ProducerId uint64
+	Sequence   uint64
+	Expected   uint64
+}
+
+func (e ErrOutOfOrderSequence) GRPCStatus() *status.Status {
+	initialStatus := status.New(
+		codes.FailedPrecondition,
+		fmt.Sprintf("out of order sequence for producer %d: %d, ", e.ProducerId, e.Sequence),
+	)
+	message := fmt.Sprintf(
+		"Producer %d sent sequence %d, expected sequence %d",
+		e.ProducerId,
+		e.Sequence,
+		e.Expected,
+	)
+
+	details := &errdetails.LocalizedMessage{
+		Locale:  "en-US",
+		Message: message,
+	}
+
+	statusWithDetails, err := initialStatus.WithDetails(details)
+	if err != nil {
+		return initialStatus
+	}
+	return statusWithDetails
+}
+
+func (e ErrOutOfOrderSequence) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
+
+// returned when fetching the offset of a consumer that never committed one
+type ErrUnknownConsumer struct {
+	ConsumerId string
+}
+
+func (e ErrUnknownConsumer) GRPCStatus() *status.Status {
+	initialStatus := status.New(
+		codes.NotFound,
+		fmt.Sprintf("unknown consumer: %s, ", e.ConsumerId),
+	)
+	message := fmt.Sprintf(
+		"Consumer %s hasn't committed an offset",
+		e.ConsumerId,
+	)
+
+	details := &errdetails.LocalizedMessage{
+		Locale:  "en-US",
+		Message: message,
+	}
+
+	statusWithDetails, err := initialStatus.WithDetails(details)
+	if err != nil {
+		return initialStatus
+	}
+	return statusWithDetails
+}
+
+func (e ErrUnknownConsumer) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
+
+// returned when a request names a topic that doesn't exist
+type ErrUnknownTopic struct {
+	Topic string
+}
+
+func (e ErrUnknownTopic) GRPCStatus() *status.Status {
+	initialStatus := status.New(
+		codes.NotFound,
+		fmt.Sprintf("unknown topic: %s, ", e.Topic),
+	)
+	message := fmt.Sprintf(
+		"Topic %s doesn't exist",
+		e.Topic,
+	)
+
+	details := &errdetails.LocalizedMessage{
+		Locale:  "en-US",
+		Message: message,
+	}
+
+	statusWithDetails, err := initialStatus.WithDetails(details)
+	if err != nil {
+		return initialStatus
+	}
+	return statusWithDetails
+}
+
+func (e ErrUnknownTopic) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
+
+// returned when creating a topic that already exists
+type ErrTopicExists struct {
+	Topic string
+}
+
+func (e ErrTopicExists) GRPCStatus() *status.Status {
+	initialStatus := status.New(
+		codes.AlreadyExists,
+		fmt.Sprintf("topic already exists: %s, ", e.Topic),
+	)
+	message := fmt.Sprintf(
+		"Topic %s already exists",
+		e.Topic,
+	)
+
+	details := &errdetails.LocalizedMessage{
+		Locale:  "en-US",
+		Message: message,
+	}
+
+	statusWithDetails, err := initialStatus.WithDetails(details)
+	if err != nil {
+		return initialStatus
+	}
+	return statusWithDetails
+}
+
+func (e ErrTopicExists) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
+
+// returned when creating a topic whose name can't be used as a directory name
+type ErrInvalidTopic struct {
+	Topic string
+}
+
+func (e ErrInvalidTopic) GRPCStatus() *status.Status {
+	initialStatus := status.New(
+		codes.InvalidArgument,
+		fmt.Sprintf("invalid topic name: %q, ", e.Topic),
+	)
+	message := fmt.Sprintf(
+		"Topic names are 1 to 249 letters, digits, '.', '_' and '-' and can't start with '.', got %q",
+		e.Topic,
+	)
+
+	details := &errdetails.LocalizedMessage{
+		Locale:  "en-US",
+		Message: message,
+	}
+
+	statusWithDetails, err := initialStatus.WithDetails(details)
+	if err != nil {
+		return initialStatus
+	}
+	return statusWithDetails
+}
+
+func (e ErrInvalidTopic) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
+
+// returned when appending a record bigger than the log's MaxRecordBytes
+type ErrRecordTooLarge struct {
+	Size uint64
+	Max  uint64
+}
+
+func (e ErrRecordTooLarge) GRPCStatus() *status.Status {
+	initialStatus := status.New(
+		codes.InvalidArgument,
+		fmt.Sprintf("record too large: %d bytes, ", e.Size),
+	)
+	details := &errdetails.BadRequest{
+		FieldViolations: []*errdetails.BadRequest_FieldViolation{{
+			Field:       "record",
+			Description: fmt.Sprintf("The record is %d bytes, the log accepts records of up to %d bytes", e.Size, e.Max),
+		}},
+	}
+
+	statusWithDetails, err := initialStatus.WithDetails(details)
+	if err != nil {
+		return initialStatus
+	}
+	return statusWithDetails
+}
+
+func (e ErrRecordTooLarge) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
+
+/*
+returned by a broker for requests only the log's leader can serve. Leader is the address of the broker the
+request should be sent to instead, empty while there's no leader
+*/
+type ErrNotLeader struct {
+	Leader string
+}
+
+func (e ErrNotLeader) GRPCStatus() *status.Status {
+	initialStatus := status.New(
+		codes.Unavailable,
+		fmt.Sprintf("not the leader, leader is %q, ", e.Leader),
+	)
+	details := &errdetails.ErrorInfo{
+		Reason:   "NOT_LEADER",
+		Domain:   "log.v1",
+		Metadata: map[string]string{"leader": e.Leader},
+	}
+
+	statusWithDetails, err := initialStatus.WithDetails(details)
+	if err != nil {
+		return initialStatus
+	}
+	return statusWithDetails
+}
+
+func (e ErrNotLeader) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
+
+// returned when a client is producing faster than its quota allows, it has room again after RetryAfter
+type ErrThrottled struct {
+	Client     string
+	RetryAfter time.Duration
+}
+
+func (e ErrThrottled) GRPCStatus() *status.Status {
+	initialStatus := status.New(
+		codes.ResourceExhausted,
+		fmt.Sprintf("%s is producing faster than its quota allows", e.Client),
+	)
+
+	// the details grpc clients use to back off, like an http Retry-After
+	statusWithDetails, err := initialStatus.WithDetails(
+		&errdetails.RetryInfo{RetryDelay: durationpb.New(e.RetryAfter)},
+		&errdetails.QuotaFailure{Violations: []*errdetails.QuotaFailure_Violation{{
+			Subject:     e.Client,
+			Description: "produce rate",
+		}}},
+	)
+	if err != nil {
+		return initialStatus
+	}
+	return statusWithDetails
+}
+
+func (e ErrThrottled) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
+
+// returned when the record stored at the offset can't be decoded, ex. its bytes were damaged on disk
+type ErrCorrupt struct {
+	Offset uint64
+	Reason string
+}
+
+func (e ErrCorrupt) GRPCStatus() *status.Status {
+	initialStatus := status.New(
+		codes.DataLoss,
+		fmt.Sprintf("corrupt record at offset %d: %s, ", e.Offset, e.Reason),
+	)
+	details := &errdetails.ErrorInfo{
+		Reason:   "CORRUPT_RECORD",
+		Domain:   "log.v1",
+		Metadata: map[string]string{"offset": strconv.FormatUint(e.Offset, 10)},
+	}
+
+	statusWithDetails, err := initialStatus.WithDetails(details)
+	if err != nil {
+		return initialStatus
+	}
+	return statusWithDetails
+}
+
+func (e ErrCorrupt) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
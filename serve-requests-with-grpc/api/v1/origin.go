@@ -0,0 +1,38 @@
+package log_v1
+
+import "strings"
+
+/*
+headers the server stamps records with when it's configured to record where they came from.
+every header with the reserved prefix belongs to the server, the ones producers send are dropped
+so a record's origin can't be forged
+*/
+const (
+	ReservedHeaderPrefix = "log-"
+	// address of the connection the record was produced over
+	OriginPeerHeader = "log-origin-peer"
+	// identity the producer authenticated as, ex. the common name of its tls client certificate
+	OriginIdentityHeader = "log-origin-identity"
+	// when the server received the record, RFC 3339 in UTC
+	OriginTimeHeader = "log-origin-time"
+)
+
+/*
+headers records are stamped with when a consumer group routes them to its dead letter topic once they ran out of
+delivery attempts, so they can be traced back to where they were consumed from
+*/
+const (
+	// the group that gave up on the record
+	DeadLetterGroupHeader = "log-dead-letter-group"
+	// topic the record was consumed from, empty for the server's default log
+	DeadLetterTopicHeader = "log-dead-letter-topic"
+	// offset of the record in the topic it was consumed from
+	DeadLetterOffsetHeader = "log-dead-letter-offset"
+	// how many times the record was delivered before the group gave up on it
+	DeadLetterAttemptsHeader = "log-dead-letter-attempts"
+)
+
+// IsReservedHeader reports whether the header belongs to the server and can't be set by producers
+func IsReservedHeader(name string) bool {
+	return strings.HasPrefix(name, ReservedHeaderPrefix)
+}
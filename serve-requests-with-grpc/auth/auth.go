@@ -0,0 +1,35 @@
+/*
+Package auth is the stable API of the log's bearer token authentication for projects that serve the log
+themselves, ex. an embedded broker or an http server in front of it. tokens are verified against the signing
+keys an OIDC provider publishes:
+
+	j, err := auth.NewJWT(auth.JWTConfig{JWKSURL: "https://issuer/.well-known/jwks.json", Audience: "log"})
+	broker, err := embedded.Start(embedded.Config{JWT: j})
+	http.Handle("/", j.Middleware(handler))
+*/
+package auth
+
+import (
+	"context"
+
+	engine "github.com/phaseharry/distributed-log/serve-requests-with-grpc/internal/auth"
+)
+
+// JWTConfig configures where the provider's keys are fetched from and the claims tokens have to carry
+type JWTConfig = engine.JWTConfig
+
+/*
+JWT authenticates clients by the RS256 or ES256 signed tokens they send as bearer tokens, over gRPC with its
+Authenticate and over http with its Middleware
+*/
+type JWT = engine.JWT
+
+// NewJWT fetches the provider's keys up front so a misconfigured url fails on startup instead of on the first request
+func NewJWT(c JWTConfig) (*JWT, error) {
+	return engine.NewJWT(c)
+}
+
+// Principal returns the principal a JWT's Middleware authenticated the request as, "" for requests without a token
+func Principal(ctx context.Context) string {
+	return engine.Principal(ctx)
+}
@@ -0,0 +1,355 @@
+/*
+Package embedded runs the log and its gRPC server in-process, so applications can embed the log
+as a library or use it in integration tests without running a separate server:
+
+	broker, err := embedded.Start(embedded.Config{})
+	defer broker.Close()
+	res, err := broker.Client.Produce(ctx, &api.ProduceRequest{Record: record})
+*/
+package embedded
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"time"
+
+	api "github.com/phaseharry/distributed-log/serve-requests-with-grpc/api/v1"
+	"github.com/phaseharry/distributed-log/serve-requests-with-grpc/auth"
+	"github.com/phaseharry/distributed-log/serve-requests-with-grpc/gateway"
+	"github.com/phaseharry/distributed-log/serve-requests-with-grpc/internal/log"
+	"github.com/phaseharry/distributed-log/serve-requests-with-grpc/internal/server"
+	"github.com/phaseharry/distributed-log/serve-requests-with-grpc/metrics"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultDialTimeout     = 5 * time.Second
+	defaultShutdownTimeout = 5 * time.Second
+	// directory inside of the data directory where the consumers' committed offsets are stored
+	offsetsDir = ".offsets"
+	// directory inside of the data directory where the topics' logs are stored
+	topicsDir = ".topics"
+)
+
+type Config struct {
+	/*
+		directory the log's segments are stored in. when empty a temporary directory
+		is created and removed again when the broker is closed
+	*/
+	DataDir string
+	// address the gRPC server listens on. defaults to an ephemeral port on localhost
+	BindAddr string
+	/*
+		addresses the gRPC server is served on in place of BindAddr, ex. a unix socket as a local only fast path
+		next to a tcp address with tls. the client connects over the first one
+	*/
+	Listeners []server.ListenerConfig
+	// tls settings the client dials the first listener with, it has to be set when that listener serves tls
+	ClientTLS *tls.Config
+	// configuration of the log, ex. segment sizes and retention. topics start from it too
+	Log log.Config
+	// how long Start waits for the client to connect to the server. defaults to 5 seconds
+	DialTimeout time.Duration
+	// how long Close waits for the rpcs in flight to finish before cancelling them. defaults to 5 seconds
+	ShutdownTimeout time.Duration
+	/*
+		where the server and the logs report metrics, ex. a metrics.Registry served at /metrics. it's used for
+		the log too unless Log has its own
+	*/
+	Metrics metrics.Metrics
+	// logs the server's rpcs and the logs' storage events, it's used for the log too unless Log has its own
+	Logger *zap.Logger
+	/*
+		tells systemd the broker is ready once Start has opened the log and connected the client, and that it's
+		stopping once Close is called, for units with Type=notify. pair it with listeners from server.SystemdListeners
+		so clients queue up on the sockets while the broker restarts. nothing is sent when the broker isn't run by systemd
+	*/
+	NotifySystemd bool
+	/*
+		address of an admin http listener serving pprof, gc stats and the log's segment layout, see
+		server.AdminHandler. it has no authentication so it should only be reachable by operators. disabled when empty
+	*/
+	AdminAddr string
+	// address of an http listener serving the rpcs as json, see gateway.New. disabled when empty
+	GatewayAddr string
+	/*
+		biggest messages the server receives and sends, the client is configured to match. MaxRecvMsgSize defaults
+		to what fits the log's MaxRecordBytes when it has one, and Start fails when it's set too small for them.
+		see server.MsgSizeFor
+	*/
+	MaxRecvMsgSize int
+	MaxSendMsgSize int
+	// compressor the client compresses its requests with and asks for responses in, ex. server.Zstd. uncompressed when empty
+	Compression string
+	/*
+		requires clients to authenticate with a bearer token the JWT verifies, over gRPC and the gateway. rpcs without
+		a valid token fail with Unauthenticated, so the broker's Client has to send one in its rpcs' metadata too
+	*/
+	JWT *auth.JWT
+}
+
+/*
+Broker is a log and gRPC server running in-process along with a client that's already connected to it
+*/
+type Broker struct {
+	// address the gRPC server is listening on, for clients other than the one provided
+	Addr string
+	// addresses of every listener the server is served on, Addr is the first one
+	Addrs []string
+	// address the admin listener is listening on, empty without one
+	AdminAddr string
+	// address the gateway listener is listening on, empty without one
+	GatewayAddr string
+	Client      api.LogClient
+
+	log             *log.Log
+	offsets         *log.Offsets
+	topics          *log.Topics
+	server          *server.Server
+	listeners       []net.Listener
+	admin           *http.Server
+	gateway         *http.Server
+	conn            *grpc.ClientConn
+	dataDir         string
+	removeData      bool
+	shutdownTimeout time.Duration
+	notifySystemd   bool
+}
+
+/*
+Start opens the log, serves it over gRPC and connects a client to it. the client is ready to use
+once Start returns. Close has to be called to stop the server and close the log.
+*/
+func Start(c Config) (_ *Broker, err error) {
+	if c.MaxRecvMsgSize == 0 && c.Log.Segment.MaxRecordBytes > 0 {
+		c.MaxRecvMsgSize = server.MsgSizeFor(c.Log.Segment.MaxRecordBytes)
+	}
+	if err = server.CheckMsgSize(c.MaxRecvMsgSize, c.Log.Segment.MaxRecordBytes); err != nil {
+		return nil, err
+	}
+	// closing what was opened so far when starting fails, the broker itself isn't returned then
+	b := &Broker{}
+	defer func() {
+		if err != nil {
+			b.Close()
+		}
+	}()
+
+	if c.DataDir == "" {
+		if c.DataDir, err = os.MkdirTemp("", "embedded-log"); err != nil {
+			return nil, err
+		}
+		b.removeData = true
+	}
+	if c.BindAddr == "" {
+		c.BindAddr = "127.0.0.1:0"
+	}
+	if len(c.Listeners) == 0 {
+		c.Listeners = []server.ListenerConfig{{Network: "tcp", Address: c.BindAddr}}
+	}
+	if c.DialTimeout == 0 {
+		c.DialTimeout = defaultDialTimeout
+	}
+	if c.ShutdownTimeout == 0 {
+		c.ShutdownTimeout = defaultShutdownTimeout
+	}
+	b.dataDir, b.shutdownTimeout = c.DataDir, c.ShutdownTimeout
+	if c.Log.Metrics == nil {
+		c.Log.Metrics = c.Metrics
+	}
+	if c.Log.Logger == nil {
+		c.Log.Logger = c.Logger
+	}
+
+	// only keeping the log once it opened, Close can't stop a log that never finished setting up
+	commitLog, err := log.NewLog(c.DataDir, c.Log)
+	if err != nil {
+		return nil, err
+	}
+	b.log = commitLog
+	if b.offsets, err = log.NewOffsets(path.Join(c.DataDir, offsetsDir), log.Config{}); err != nil {
+		return nil, err
+	}
+	if b.topics, err = log.NewTopics(path.Join(c.DataDir, topicsDir), c.Log); err != nil {
+		return nil, err
+	}
+	for _, lc := range c.Listeners {
+		l, err := server.Listen(lc)
+		if err != nil {
+			return nil, err
+		}
+		b.listeners = append(b.listeners, l)
+		b.Addrs = append(b.Addrs, l.Addr().String())
+	}
+	b.Addr = b.Addrs[0]
+	config := &server.Config{
+		CommitLog: b.log,
+		Offsets:   b.offsets,
+		Topics:    topicStore{b.topics},
+		Metrics:   c.Metrics,
+		Logger:    c.Logger,
+		// the client is limited to the same sizes below
+		MaxRecvMsgSize: c.MaxRecvMsgSize,
+		MaxSendMsgSize: c.MaxSendMsgSize,
+	}
+	if c.JWT != nil {
+		config.Authenticate = c.JWT.Authenticate
+		config.Authorizer = authenticated{}
+	}
+	if b.server, err = server.NewGrpcServer(config); err != nil {
+		return nil, err
+	}
+	for _, l := range b.listeners {
+		go b.server.Serve(l)
+	}
+	if c.AdminAddr != "" {
+		l, err := net.Listen("tcp", c.AdminAddr)
+		if err != nil {
+			return nil, err
+		}
+		b.AdminAddr = l.Addr().String()
+		b.admin = &http.Server{Handler: b.server.AdminHandler()}
+		go b.admin.Serve(l)
+	}
+
+	// blocking until the client is connected so the broker is ready to use when Start returns
+	ctx, cancel := context.WithTimeout(context.Background(), c.DialTimeout)
+	defer cancel()
+	network := b.listeners[0].Addr().Network()
+	opts := []grpc.DialOption{
+		grpc.WithBlock(),
+		// dialing the listener's network directly so the client can connect over unix sockets too
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		}),
+	}
+	var callOpts []grpc.CallOption
+	if c.MaxRecvMsgSize > 0 {
+		callOpts = append(callOpts, grpc.MaxCallSendMsgSize(c.MaxRecvMsgSize))
+	}
+	if c.MaxSendMsgSize > 0 {
+		callOpts = append(callOpts, grpc.MaxCallRecvMsgSize(c.MaxSendMsgSize))
+	}
+	if c.Compression != "" {
+		callOpts = append(callOpts, grpc.UseCompressor(c.Compression))
+	}
+	opts = append(opts, grpc.WithDefaultCallOptions(callOpts...))
+	if c.ClientTLS != nil {
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(c.ClientTLS)))
+	} else {
+		opts = append(opts, grpc.WithInsecure())
+	}
+	if b.conn, err = grpc.DialContext(ctx, b.Addr, opts...); err != nil {
+		return nil, err
+	}
+	b.Client = api.NewLogClient(b.conn)
+	if c.GatewayAddr != "" {
+		l, err := net.Listen("tcp", c.GatewayAddr)
+		if err != nil {
+			return nil, err
+		}
+		b.GatewayAddr = l.Addr().String()
+		mux := http.NewServeMux()
+		// calling the rpcs over the broker's own client
+		var handler http.Handler = gateway.New(b.conn)
+		if c.JWT != nil {
+			// invalid tokens are rejected before they're passed on to the server
+			handler = c.JWT.Middleware(handler)
+		}
+		mux.Handle(gateway.Prefix, handler)
+		b.gateway = &http.Server{Handler: mux}
+		go b.gateway.Serve(l)
+	}
+	if b.notifySystemd = c.NotifySystemd; b.notifySystemd {
+		if _, err = server.Notify("READY=1"); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+/*
+Close disconnects the client, shuts the server down, and closes the log. rpcs in flight get the
+shutdown timeout to finish. the log's data is removed if the broker created a temporary directory for it.
+*/
+func (b *Broker) Close() error {
+	if b == nil {
+		return nil
+	}
+	if b.notifySystemd {
+		// systemd only uses it to report the unit as deactivating, there's nothing to do if it can't be told
+		server.Notify("STOPPING=1")
+	}
+	if b.gateway != nil {
+		b.gateway.Close()
+	}
+	if b.conn != nil {
+		b.conn.Close()
+	}
+	if b.admin != nil {
+		b.admin.Close()
+	}
+	var err error
+	if b.server != nil {
+		// the server flushes and closes the log and the topics once it's done serving them
+		ctx, cancel := context.WithTimeout(context.Background(), b.shutdownTimeout)
+		defer cancel()
+		err = b.server.Shutdown(ctx)
+	} else {
+		for _, l := range b.listeners {
+			l.Close()
+		}
+		if b.topics != nil {
+			err = b.topics.Close()
+		}
+		if b.log != nil {
+			if cerr := b.log.Close(); err == nil {
+				err = cerr
+			}
+		}
+	}
+	if b.offsets != nil {
+		if cerr := b.offsets.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if b.removeData {
+		return os.RemoveAll(b.dataDir)
+	}
+	return nil
+}
+
+// authorizes every client that authenticated with a token, the ones without one fail with Unauthenticated
+type authenticated struct{}
+
+func (authenticated) Authorize(subject, topic, action string) error {
+	if subject == "" {
+		return status.Error(codes.Unauthenticated, "a bearer token is required")
+	}
+	return nil
+}
+
+// serves the topics to the server, whose topic store hands out its CommitLog interface instead of the log itself
+type topicStore struct {
+	*log.Topics
+}
+
+func (t topicStore) Topic(name string) (server.CommitLog, error) {
+	l, err := t.Topics.Topic(name)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
@@ -0,0 +1,356 @@
+package embedded
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	api "github.com/phaseharry/distributed-log/serve-requests-with-grpc/api/v1"
+	"github.com/phaseharry/distributed-log/serve-requests-with-grpc/auth"
+	"github.com/phaseharry/distributed-log/serve-requests-with-grpc/gateway"
+	"github.com/phaseharry/distributed-log/serve-requests-with-grpc/internal/log"
+	"github.com/phaseharry/distributed-log/serve-requests-with-grpc/internal/server"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// testing that an embedded broker is ready to produce and consume records once it has started
+func TestStart(t *testing.T) {
+	broker, err := Start(Config{})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	want := []byte("hello world")
+	produce, err := broker.Client.Produce(ctx, &api.ProduceRequest{
+		Record: &api.Record{Value: want},
+	})
+	require.NoError(t, err)
+
+	consume, err := broker.Client.Consume(ctx, &api.ConsumeRequest{
+		Offset: produce.Offset,
+	})
+	require.NoError(t, err)
+	require.Equal(t, want, consume.Record.Value)
+
+	dir := broker.log.Dir
+	require.NoError(t, broker.Close())
+
+	// the temporary data directory is removed when the broker is closed
+	_, err = os.Stat(dir)
+	require.True(t, os.IsNotExist(err))
+}
+
+// testing that a broker that can't start cleans up after itself and returns the error
+func TestStartFails(t *testing.T) {
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer taken.Close()
+	before, err := filepath.Glob(filepath.Join(os.TempDir(), "embedded-log*"))
+	require.NoError(t, err)
+
+	broker, err := Start(Config{BindAddr: taken.Addr().String()})
+	require.Error(t, err)
+	require.Nil(t, broker)
+	require.NoError(t, broker.Close())
+	after, err := filepath.Glob(filepath.Join(os.TempDir(), "embedded-log*"))
+	require.NoError(t, err)
+	require.ElementsMatch(t, before, after)
+}
+
+// testing that a broker started on another cluster's data directory returns the error instead of crashing
+func TestStartClusterMismatch(t *testing.T) {
+	dir, err := os.MkdirTemp("", "embedded-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	broker, err := Start(Config{DataDir: dir})
+	require.NoError(t, err)
+	require.NoError(t, broker.Close())
+
+	broker, err = Start(Config{DataDir: dir, Log: log.Config{ClusterID: "another-cluster"}})
+	require.ErrorIs(t, err, log.ErrClusterMismatch)
+	require.Nil(t, broker)
+}
+
+// testing that an embedded broker keeps its records in a data directory it was given
+func TestStartDataDir(t *testing.T) {
+	dir, err := os.MkdirTemp("", "embedded-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	broker, err := Start(Config{DataDir: dir})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	_, err = broker.Client.Produce(ctx, &api.ProduceRequest{
+		Record: &api.Record{Value: []byte("hello world")},
+	})
+	require.NoError(t, err)
+	require.NoError(t, broker.Close())
+
+	broker, err = Start(Config{DataDir: dir})
+	require.NoError(t, err)
+	defer broker.Close()
+
+	consume, err := broker.Client.Consume(ctx, &api.ConsumeRequest{Offset: 0})
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello world"), consume.Record.Value)
+}
+
+// testing that a broker served on a unix socket and a tls tcp address at once serves the same log on both
+func TestStartListeners(t *testing.T) {
+	dir, err := os.MkdirTemp("", "embedded-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	cert, pool := selfSigned(t)
+
+	broker, err := Start(Config{
+		DataDir: dir,
+		Listeners: []server.ListenerConfig{
+			{Network: "unix", Address: path.Join(dir, "log.sock")},
+			{Network: "tcp", Address: "127.0.0.1:0", TLS: &tls.Config{Certificates: []tls.Certificate{cert}}},
+		},
+	})
+	require.NoError(t, err)
+	defer broker.Close()
+	require.Len(t, broker.Addrs, 2)
+
+	ctx := context.Background()
+	produce, err := broker.Client.Produce(ctx, &api.ProduceRequest{Record: &api.Record{Value: []byte("hello world")}})
+	require.NoError(t, err)
+
+	dialCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	conn, err := grpc.DialContext(dialCtx, broker.Addrs[1], grpc.WithBlock(),
+		grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{RootCAs: pool, ServerName: "127.0.0.1"})),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+	consume, err := api.NewLogClient(conn).Consume(ctx, &api.ConsumeRequest{Offset: produce.Offset})
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello world"), consume.Record.Value)
+}
+
+/*
+testing that a broker served on a listener that was bound for it, like systemd's socket activated ones, tells
+systemd it's ready once it's serving and that it's stopping once it's closed
+*/
+func TestStartSystemd(t *testing.T) {
+	dir, err := os.MkdirTemp("", "embedded-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	notify, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path.Join(dir, "notify.sock"), Net: "unixgram"})
+	require.NoError(t, err)
+	defer notify.Close()
+	t.Setenv("NOTIFY_SOCKET", path.Join(dir, "notify.sock"))
+	bound, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	broker, err := Start(Config{
+		DataDir:       dir,
+		Listeners:     []server.ListenerConfig{{Listener: bound}},
+		NotifySystemd: true,
+	})
+	require.NoError(t, err)
+	require.Equal(t, bound.Addr().String(), broker.Addr)
+	received := func() string {
+		b := make([]byte, 64)
+		require.NoError(t, notify.SetReadDeadline(time.Now().Add(time.Second)))
+		n, err := notify.Read(b)
+		require.NoError(t, err)
+		return string(b[:n])
+	}
+	require.Equal(t, "READY=1", received())
+	_, err = broker.Client.Produce(context.Background(), &api.ProduceRequest{Record: &api.Record{Value: []byte("hello world")}})
+	require.NoError(t, err)
+
+	require.NoError(t, broker.Close())
+	require.Equal(t, "STOPPING=1", received())
+}
+
+// testing that the admin listener serves the profiles, gc stats and the log's layout
+func TestStartAdmin(t *testing.T) {
+	broker, err := Start(Config{AdminAddr: "127.0.0.1:0"})
+	require.NoError(t, err)
+	defer broker.Close()
+	produce, err := broker.Client.Produce(context.Background(), &api.ProduceRequest{Record: &api.Record{Value: []byte("hello world")}})
+	require.NoError(t, err)
+
+	get := func(path string, v any) {
+		res, err := http.Get("http://" + broker.AdminAddr + path)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		if v != nil {
+			require.NoError(t, json.NewDecoder(res.Body).Decode(v))
+		}
+	}
+	get("/debug/pprof/goroutine?debug=1", nil)
+	var gc server.GCStats
+	get("/debug/gc", &gc)
+	require.Greater(t, gc.Goroutines, 0)
+	var layouts []server.LogLayout
+	get("/debug/log", &layouts)
+	require.Len(t, layouts, 1)
+	require.Equal(t, produce.Offset, layouts[0].HighestOffset)
+	require.Len(t, layouts[0].Segments, 1)
+	require.Equal(t, uint64(1), layouts[0].Segments[0].Records)
+}
+
+// testing that the gateway serves the rpcs as json with their errors mapped to http statuses
+func TestStartGateway(t *testing.T) {
+	broker, err := Start(Config{GatewayAddr: "127.0.0.1:0"})
+	require.NoError(t, err)
+	defer broker.Close()
+
+	call := func(method, body string, v any) int {
+		res, err := http.Post("http://"+broker.GatewayAddr+gateway.Prefix+method, "application/json", strings.NewReader(body))
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, "application/json", res.Header.Get("Content-Type"))
+		require.NoError(t, json.NewDecoder(res.Body).Decode(v))
+		return res.StatusCode
+	}
+	var produced struct{ Offset string }
+	require.Equal(t, http.StatusOK, call("Produce", `{"record": {"value": "aGVsbG8gd29ybGQ="}}`, &produced))
+	require.Equal(t, "", produced.Offset, "offset 0 is the json mapping's default and left out")
+	var consumed struct{ Record struct{ Value []byte } }
+	require.Equal(t, http.StatusOK, call("Consume", `{"offset": "0"}`, &consumed))
+	require.Equal(t, []byte("hello world"), consumed.Record.Value)
+
+	var failed struct {
+		Code    int
+		Message string
+	}
+	require.Equal(t, http.StatusBadRequest, call("Consume", `{"offset": "1"}`, &failed))
+	require.Equal(t, int(codes.OutOfRange), failed.Code)
+	require.Equal(t, http.StatusNotFound, call("Nope", `{}`, &failed))
+	require.Equal(t, http.StatusNotImplemented, call("ConsumeStream", `{}`, &failed))
+	require.Equal(t, http.StatusBadRequest, call("Consume", `{"offset": "zero"}`, &failed))
+}
+
+// testing that clients have to authenticate with a valid bearer token over gRPC and the gateway
+func TestStartJWT(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kid": "key-1",
+			"kty": "RSA",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	}))
+	defer provider.Close()
+	j, err := auth.NewJWT(auth.JWTConfig{JWKSURL: provider.URL})
+	require.NoError(t, err)
+
+	broker, err := Start(Config{JWT: j, GatewayAddr: "127.0.0.1:0"})
+	require.NoError(t, err)
+	defer broker.Close()
+
+	token := signJWT(t, key, map[string]any{"sub": "billing", "exp": time.Now().Add(time.Hour).Unix()})
+	req := &api.ProduceRequest{Record: &api.Record{Value: []byte("hello world")}}
+	_, err = broker.Client.Produce(context.Background(), req)
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer nope")
+	_, err = broker.Client.Produce(ctx, req)
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+	ctx = metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+	_, err = broker.Client.Produce(ctx, req)
+	require.NoError(t, err)
+
+	for authorization, want := range map[string]int{
+		"":                http.StatusUnauthorized,
+		"Bearer nope":     http.StatusUnauthorized,
+		"Bearer " + token: http.StatusOK,
+	} {
+		req, err := http.NewRequest("POST", "http://"+broker.GatewayAddr+gateway.Prefix+"Consume", strings.NewReader(`{"offset": "0"}`))
+		require.NoError(t, err)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+		require.Equal(t, want, res.StatusCode, authorization)
+	}
+}
+
+// signs an RS256 token with the claims for the key published as key-1
+func signJWT(t *testing.T, key *rsa.PrivateKey, claims map[string]any) string {
+	t.Helper()
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": "key-1"})
+	require.NoError(t, err)
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// testing that records over the log's limit reach it and fail as too large, and limits that can't fit them don't start
+func TestStartMaxRecordBytes(t *testing.T) {
+	c := Config{Compression: server.Zstd}
+	c.Log.Segment.MaxRecordBytes = 1000
+	broker, err := Start(c)
+	require.NoError(t, err)
+	defer broker.Close()
+
+	ctx := context.Background()
+	_, err = broker.Client.Produce(ctx, &api.ProduceRequest{Record: &api.Record{Value: make([]byte, 900)}})
+	require.NoError(t, err)
+	_, err = broker.Client.Produce(ctx, &api.ProduceRequest{Record: &api.Record{Value: make([]byte, 2000)}})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	c.MaxRecvMsgSize = 1000
+	_, err = Start(c)
+	require.Error(t, err)
+}
+
+func selfSigned(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	parsed, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(parsed)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
@@ -0,0 +1,163 @@
+/*
+Package gateway serves the Log service's unary rpcs as json over http, transcoding every request to the rpc
+and its response back, so http clients get the same api as gRPC clients instead of a hand-written copy of it:
+
+	cc, err := grpc.Dial(addr, grpc.WithInsecure())
+	http.Handle("/v1/", gateway.New(cc))
+
+every rpc is a POST to /v1/ and its name with the request as its body, ex.
+
+	curl -d '{"record": {"value": "aGVsbG8gd29ybGQ="}}' localhost:8080/v1/Produce
+	curl -d '{"offset": "0"}' localhost:8080/v1/Consume
+
+messages are in protobuf's json mapping, so bytes are base64 and 64 bit integers are strings. streaming rpcs
+aren't served, Fetch pages through the log instead of ConsumeStream
+*/
+package gateway
+
+import (
+	"io"
+	"net/http"
+	"strings"
+
+	api "github.com/phaseharry/distributed-log/serve-requests-with-grpc/api/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// Prefix is the path every rpc is served under
+const Prefix = "/v1/"
+
+// response headers the rpc's header metadata is sent back in, ex. Grpc-Metadata-Log-Warning
+const MetadataHeader = "Grpc-Metadata-"
+
+type gateway struct {
+	cc      grpc.ClientConnInterface
+	service protoreflect.ServiceDescriptor
+}
+
+// New returns a handler that calls the rpcs on the connection, the handler has to be mounted at Prefix
+func New(cc grpc.ClientConnInterface) http.Handler {
+	return &gateway{cc: cc, service: api.File_api_v1_log_proto.Services().ByName("Log")}
+}
+
+func (g *gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	method := g.service.Methods().ByName(protoreflect.Name(strings.TrimPrefix(r.URL.Path, Prefix)))
+	if !strings.HasPrefix(r.URL.Path, Prefix) || method == nil {
+		writeError(w, status.Errorf(codes.NotFound, "no rpc at %s", r.URL.Path))
+		return
+	}
+	if method.IsStreamingClient() || method.IsStreamingServer() {
+		writeError(w, status.Errorf(codes.Unimplemented, "%s is a streaming rpc", method.Name()))
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "rpcs are called with POST", http.StatusMethodNotAllowed)
+		return
+	}
+	req, err := newMessage(method.Input())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	res, err := newMessage(method.Output())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, status.Error(codes.InvalidArgument, err.Error()))
+		return
+	}
+	// an empty body is the request's zero value
+	if len(body) > 0 {
+		if err = protojson.Unmarshal(body, req.Interface()); err != nil {
+			writeError(w, status.Error(codes.InvalidArgument, err.Error()))
+			return
+		}
+	}
+
+	// the bearer token is passed on so the server authenticates the http client instead of the gateway
+	ctx := r.Context()
+	if authorization := r.Header.Get("Authorization"); authorization != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", authorization)
+	}
+	var header metadata.MD
+	fullMethod := "/" + string(g.service.FullName()) + "/" + string(method.Name())
+	err = g.cc.Invoke(ctx, fullMethod, req.Interface(), res.Interface(), grpc.Header(&header))
+	for k, values := range header {
+		for _, v := range values {
+			w.Header().Add(MetadataHeader+k, v)
+		}
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	b, err := protojson.Marshal(res.Interface())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+func newMessage(desc protoreflect.MessageDescriptor) (protoreflect.Message, error) {
+	typ, err := protoregistry.GlobalTypes.FindMessageByName(desc.FullName())
+	if err != nil {
+		return nil, err
+	}
+	return typ.New(), nil
+}
+
+// writes the error's status as json with the http status closest to its code, details included
+func writeError(w http.ResponseWriter, err error) {
+	st := status.Convert(err)
+	b, err := protojson.Marshal(st.Proto())
+	if err != nil {
+		http.Error(w, st.Message(), HTTPStatus(st.Code()))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(HTTPStatus(st.Code()))
+	w.Write(b)
+}
+
+// HTTPStatus maps the grpc code to an http status the way google's api transcoding does
+func HTTPStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		// client closed request, nginx's status for it
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,93 @@
+/*
+Package auth decides what clients are allowed to do with the log from an access control list. every rule grants
+a subject (ex. the common name of a client's tls certificate) an action on a topic, "*" matches anything:
+
+	# subject, topic, action
+	billing, orders, consume
+	checkout, orders, produce
+	admin, *, *
+*/
+package auth
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// matches any subject, topic or action in a rule
+const Wildcard = "*"
+
+// Rule grants the subject the action on the topic, the server's default log is the topic ""
+type Rule struct {
+	Subject, Topic, Action string
+}
+
+func (r Rule) matches(subject, topic, action string) bool {
+	return (r.Subject == Wildcard || r.Subject == subject) &&
+		(r.Topic == Wildcard || r.Topic == topic) &&
+		(r.Action == Wildcard || r.Action == action)
+}
+
+// Authorizer denies everything its rules don't grant
+type Authorizer struct {
+	rules []Rule
+}
+
+func New(rules ...Rule) *Authorizer {
+	return &Authorizer{rules: rules}
+}
+
+/*
+Load reads the rules from a policy file, one "subject, topic, action" rule per line. blank lines and lines
+starting with # are skipped, an empty topic is the server's default log
+*/
+func Load(path string) (*Authorizer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	a := &Authorizer{}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Split(text, ",")
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("%s:%d: want subject, topic, action", path, line)
+		}
+		a.rules = append(a.rules, Rule{
+			Subject: strings.TrimSpace(fields[0]),
+			Topic:   strings.TrimSpace(fields[1]),
+			Action:  strings.TrimSpace(fields[2]),
+		})
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Authorize returns a PermissionDenied status unless a rule grants the subject the action on the topic
+func (a *Authorizer) Authorize(subject, topic, action string) error {
+	for _, r := range a.rules {
+		if r.matches(subject, topic, action) {
+			return nil
+		}
+	}
+	return status.Errorf(codes.PermissionDenied, "%s isn't permitted to %s on %s", subject, action, topicName(topic))
+}
+
+func topicName(topic string) string {
+	if topic == "" {
+		return "the default log"
+	}
+	return topic
+}
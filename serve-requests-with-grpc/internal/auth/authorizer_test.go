@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// testing that the rules loaded from a policy file grant exactly what they list
+func TestAuthorizer(t *testing.T) {
+	dir, err := os.MkdirTemp("", "auth-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	policy := path.Join(dir, "policy.csv")
+	require.NoError(t, os.WriteFile(policy, []byte(`
+# subject, topic, action
+billing, orders, consume
+checkout, orders, produce
+checkout, , produce
+admin, *, *
+`), 0644))
+	a, err := Load(policy)
+	require.NoError(t, err)
+
+	for _, allowed := range []Rule{
+		{"billing", "orders", "consume"},
+		{"checkout", "orders", "produce"},
+		{"checkout", "", "produce"},
+		{"admin", "payments", "admin"},
+	} {
+		require.NoError(t, a.Authorize(allowed.Subject, allowed.Topic, allowed.Action))
+	}
+	for _, denied := range []Rule{
+		{"billing", "orders", "produce"},
+		{"billing", "payments", "consume"},
+		{"checkout", "", "consume"},
+		{"", "orders", "consume"},
+	} {
+		err = a.Authorize(denied.Subject, denied.Topic, denied.Action)
+		require.Equal(t, codes.PermissionDenied, status.Code(err))
+	}
+
+	require.NoError(t, os.WriteFile(policy, []byte("billing, orders\n"), 0644))
+	_, err = Load(policy)
+	require.Error(t, err)
+}
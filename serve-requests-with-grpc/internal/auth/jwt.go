@@ -0,0 +1,298 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// jwks are fetched again at most this often when a token is signed with a key that isn't known yet
+const defaultJWKSRefresh = time.Minute
+
+/*
+JWTConfig configures bearer token authentication against an OIDC provider's signing keys
+- JWKSURL: where the provider publishes its json web key set, ex. https://issuer/.well-known/jwks.json
+- Issuer and Audience: tokens have to carry them in their iss and aud claims, they aren't checked when empty
+- Claim: claim the principal is taken from. defaults to sub
+- MinRefresh: how long after fetching the keys they can be fetched again for an unknown key id. defaults to a minute
+*/
+type JWTConfig struct {
+	JWKSURL    string
+	Issuer     string
+	Audience   string
+	Claim      string
+	MinRefresh time.Duration
+	Client     *http.Client
+}
+
+/*
+JWT authenticates clients by the RS256 or ES256 signed tokens they send as bearer tokens, as an alternative
+to tls client certificates. the principal it maps a token to is the subject rules are written for
+*/
+type JWT struct {
+	config JWTConfig
+
+	mu      sync.Mutex
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+	// held while the keys are fetched again so tokens signed with the same new key only fetch them once
+	refreshing sync.Mutex
+}
+
+// fetches the provider's keys up front so a misconfigured url fails on startup instead of on the first rpc
+func NewJWT(c JWTConfig) (*JWT, error) {
+	if c.Claim == "" {
+		c.Claim = "sub"
+	}
+	if c.MinRefresh == 0 {
+		c.MinRefresh = defaultJWKSRefresh
+	}
+	if c.Client == nil {
+		c.Client = http.DefaultClient
+	}
+	j := &JWT{config: c}
+	if err := j.refresh(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+/*
+Authenticate returns the principal of the bearer token in the rpc's authorization metadata. clients without a
+token are the subject "" so rules decide what anonymous clients can do, invalid tokens fail with Unauthenticated
+*/
+func (j *JWT) Authenticate(ctx context.Context) (string, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return "", nil
+	}
+	return j.bearer(values[0])
+}
+
+type principalKey struct{}
+
+/*
+Middleware authenticates http requests by their bearer token like Authenticate, rejecting invalid tokens with
+401. handlers get the principal with Principal
+*/
+func (j *JWT) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var principal string
+		if header := r.Header.Get("Authorization"); header != "" {
+			var err error
+			if principal, err = j.bearer(header); err != nil {
+				http.Error(w, status.Convert(err).Message(), http.StatusUnauthorized)
+				return
+			}
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, principal)))
+	})
+}
+
+// Principal returns the principal Middleware authenticated the request as
+func Principal(ctx context.Context) string {
+	principal, _ := ctx.Value(principalKey{}).(string)
+	return principal
+}
+
+func (j *JWT) bearer(header string) (string, error) {
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok {
+		return "", status.Error(codes.Unauthenticated, "authorization isn't a bearer token")
+	}
+	principal, err := j.Verify(token)
+	if err != nil {
+		return "", status.Error(codes.Unauthenticated, err.Error())
+	}
+	return principal, nil
+}
+
+/*
+Verify checks the token's signature against the provider's keys and its expiry, issuer and audience,
+and returns the principal in its claim
+*/
+func (j *JWT) Verify(token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("malformed token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return "", err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", fmt.Errorf("malformed signature: %w", err)
+	}
+	key, err := j.key(header.Kid)
+	if err != nil {
+		return "", err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if header.Alg != "RS256" || rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) != nil {
+			return "", fmt.Errorf("invalid signature")
+		}
+	case *ecdsa.PublicKey:
+		if header.Alg != "ES256" || len(sig) != 64 ||
+			!ecdsa.Verify(key, digest[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])) {
+			return "", fmt.Errorf("invalid signature")
+		}
+	default:
+		return "", fmt.Errorf("unsupported signing key %q", header.Kid)
+	}
+
+	var claims map[string]any
+	if err = decodeSegment(parts[1], &claims); err != nil {
+		return "", err
+	}
+	now := float64(time.Now().Unix())
+	if exp, ok := claims["exp"].(float64); !ok || now >= exp {
+		return "", fmt.Errorf("token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now < nbf {
+		return "", fmt.Errorf("token isn't valid yet")
+	}
+	if j.config.Issuer != "" && claims["iss"] != j.config.Issuer {
+		return "", fmt.Errorf("token wasn't issued by %s", j.config.Issuer)
+	}
+	if j.config.Audience != "" && !hasAudience(claims["aud"], j.config.Audience) {
+		return "", fmt.Errorf("token isn't for %s", j.config.Audience)
+	}
+	principal, ok := claims[j.config.Claim].(string)
+	if !ok || principal == "" {
+		return "", fmt.Errorf("token has no %s claim", j.config.Claim)
+	}
+	return principal, nil
+}
+
+// the aud claim is either a single audience or a list of them
+func hasAudience(aud any, want string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == want
+	case []any:
+		for _, a := range aud {
+			if a == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func decodeSegment(segment string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return fmt.Errorf("malformed token: %w", err)
+	}
+	if err = json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("malformed token: %w", err)
+	}
+	return nil
+}
+
+// returns the key with the id, fetching the keys again if it isn't known in case the provider rotated them
+func (j *JWT) key(kid string) (crypto.PublicKey, error) {
+	j.mu.Lock()
+	key, ok := j.keys[kid]
+	stale := time.Since(j.fetched) >= j.config.MinRefresh
+	j.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+	if stale {
+		j.refreshing.Lock()
+		defer j.refreshing.Unlock()
+		// the keys may have been fetched again while waiting for another token's refresh
+		j.mu.Lock()
+		key, ok = j.keys[kid]
+		stale = time.Since(j.fetched) >= j.config.MinRefresh
+		j.mu.Unlock()
+		if ok {
+			return key, nil
+		}
+		if stale {
+			if err := j.refresh(); err != nil {
+				return nil, err
+			}
+			j.mu.Lock()
+			key, ok = j.keys[kid]
+			j.mu.Unlock()
+			if ok {
+				return key, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// fetches the provider's key set, keys of types other than RSA and P-256 EC are skipped
+func (j *JWT) refresh() error {
+	res, err := j.config.Client.Get(j.config.JWKSURL)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching jwks: %s", res.Status)
+	}
+	var set struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			Crv string `json:"crv"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err = json.NewDecoder(res.Body).Decode(&set); err != nil {
+		return fmt.Errorf("decoding jwks: %w", err)
+	}
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range set.Keys {
+		switch {
+		case k.Kty == "RSA":
+			n, err1 := base64.RawURLEncoding.DecodeString(k.N)
+			e, err2 := base64.RawURLEncoding.DecodeString(k.E)
+			if err1 != nil || err2 != nil {
+				continue
+			}
+			keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case k.Kty == "EC" && k.Crv == "P-256":
+			x, err1 := base64.RawURLEncoding.DecodeString(k.X)
+			y, err2 := base64.RawURLEncoding.DecodeString(k.Y)
+			if err1 != nil || err2 != nil {
+				continue
+			}
+			keys[k.Kid] = &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		}
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.keys = keys
+	j.fetched = time.Now()
+	return nil
+}
@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// testing that tokens are verified against the provider's keys and mapped to the principal in their claim
+func TestJWT(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	rotated, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	var fetches atomic.Int32
+	published := map[string]*rsa.PrivateKey{"key-1": key}
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		var set struct {
+			Keys []map[string]string `json:"keys"`
+		}
+		for kid, k := range published {
+			set.Keys = append(set.Keys, map[string]string{
+				"kid": kid,
+				"kty": "RSA",
+				"n":   base64.RawURLEncoding.EncodeToString(k.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+			})
+		}
+		json.NewEncoder(w).Encode(set)
+	}))
+	defer provider.Close()
+
+	j, err := NewJWT(JWTConfig{JWKSURL: provider.URL, Issuer: "https://issuer", Audience: "log", MinRefresh: time.Nanosecond})
+	require.NoError(t, err)
+	claims := func(overrides map[string]any) map[string]any {
+		c := map[string]any{
+			"sub": "billing",
+			"iss": "https://issuer",
+			"aud": []string{"log", "other"},
+			"exp": time.Now().Add(time.Hour).Unix(),
+		}
+		for k, v := range overrides {
+			c[k] = v
+		}
+		return c
+	}
+
+	principal, err := j.Verify(sign(t, key, "key-1", claims(nil)))
+	require.NoError(t, err)
+	require.Equal(t, "billing", principal)
+
+	for name, token := range map[string]string{
+		"expired":        sign(t, key, "key-1", claims(map[string]any{"exp": time.Now().Add(-time.Minute).Unix()})),
+		"wrong issuer":   sign(t, key, "key-1", claims(map[string]any{"iss": "https://elsewhere"})),
+		"wrong audience": sign(t, key, "key-1", claims(map[string]any{"aud": "other"})),
+		"wrong key":      sign(t, rotated, "key-1", claims(nil)),
+		"unknown key":    sign(t, rotated, "key-2", claims(nil)),
+	} {
+		_, err = j.Verify(token)
+		require.Error(t, err, name)
+	}
+
+	// keys the provider rotated in are fetched the first time a token is signed with them
+	published["key-2"] = rotated
+	principal, err = j.Verify(sign(t, rotated, "key-2", claims(map[string]any{"sub": "checkout"})))
+	require.NoError(t, err)
+	require.Equal(t, "checkout", principal)
+	fetched := fetches.Load()
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		"authorization", "Bearer "+sign(t, key, "key-1", claims(nil)),
+	))
+	principal, err = j.Authenticate(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "billing", principal)
+	require.Equal(t, fetched, fetches.Load())
+	principal, err = j.Authenticate(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "", principal)
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer nope"))
+	_, err = j.Authenticate(ctx)
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	handler := j.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(Principal(r.Context())))
+	}))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+sign(t, key, "key-1", claims(nil)))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, "billing", rec.Body.String())
+	req.Header.Set("Authorization", "Bearer nope")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+// testing that tokens signed with the same new key at the same time only fetch the keys once between them
+func TestJWTConcurrentRefresh(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	var fetches atomic.Int32
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the first fetch doesn't publish the key yet, the slow ones after it overlap the tokens' refreshes
+		if fetches.Add(1) == 1 {
+			w.Write([]byte(`{"keys": []}`))
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kid": "key-1",
+			"kty": "RSA",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	}))
+	defer provider.Close()
+
+	j, err := NewJWT(JWTConfig{JWKSURL: provider.URL, MinRefresh: time.Nanosecond})
+	require.NoError(t, err)
+	token := sign(t, key, "key-1", map[string]any{"sub": "billing", "exp": time.Now().Add(time.Hour).Unix()})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := j.Verify(token)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	require.Equal(t, int32(2), fetches.Load())
+}
+
+func sign(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]any) string {
+	t.Helper()
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": kid})
+	require.NoError(t, err)
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
@@ -0,0 +1,112 @@
+package log
+
+import (
+	"os"
+	"path"
+	"sync"
+
+	api "github.com/phaseharry/distributed-log/serve-requests-with-grpc/api/v1"
+)
+
+const (
+	annotationsFileName = "annotations"
+	// 8 bytes for the record's absolute offset and 4 bytes for the annotation value
+	annotationWidth = 8 + 4
+)
+
+/*
+annotations is a sidecar file that lives next to the segment files and lets us attach metadata
+(processed, poisoned, redacted, etc.) to records that have already been appended. the store files are
+append-only and a record can't be rewritten to flag it, so instead every annotation is appended to this
+file as a fixed width {recordOffset}{annotation} entry. the file is replayed into memory when the log is
+set up so looking up the annotations of a record on consume doesn't touch disk.
+*/
+type annotations struct {
+	mu    sync.RWMutex
+	file  *os.File
+	byOff map[uint64][]api.Annotation
+}
+
+func newAnnotations(dir string) (*annotations, error) {
+	f, err := os.OpenFile(
+		path.Join(dir, annotationsFileName),
+		os.O_RDWR|os.O_CREATE|os.O_APPEND,
+		0644,
+	)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	/*
+		dropping a partially written entry at the end of the file (ex. crash mid write) so the
+		next appended entry lines up with the fixed entry width again
+	*/
+	size := fi.Size() - fi.Size()%annotationWidth
+	if err := f.Truncate(size); err != nil {
+		return nil, err
+	}
+	a := &annotations{
+		file:  f,
+		byOff: make(map[uint64][]api.Annotation),
+	}
+	// replaying every entry that was previously written so the in memory view matches what's on disk
+	entry := make([]byte, annotationWidth)
+	for pos := int64(0); pos < size; pos += annotationWidth {
+		if _, err := f.ReadAt(entry, pos); err != nil {
+			return nil, err
+		}
+		a.add(enc.Uint64(entry[:8]), api.Annotation(enc.Uint32(entry[8:])))
+	}
+	return a, nil
+}
+
+// records the annotation in memory, ignoring it if the record already has it
+func (a *annotations) add(off uint64, annotation api.Annotation) {
+	for _, existing := range a.byOff[off] {
+		if existing == annotation {
+			return
+		}
+	}
+	a.byOff[off] = append(a.byOff[off], annotation)
+}
+
+func (a *annotations) Annotate(off uint64, annotation api.Annotation) ([]api.Annotation, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	entry := make([]byte, annotationWidth)
+	enc.PutUint64(entry[:8], off)
+	enc.PutUint32(entry[8:], uint32(annotation))
+	if _, err := a.file.Write(entry); err != nil {
+		return nil, err
+	}
+	a.add(off, annotation)
+	return a.get(off), nil
+}
+
+func (a *annotations) Get(off uint64) []api.Annotation {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.get(off)
+}
+
+// returns a copy so callers can't mutate the in memory view without holding the lock
+func (a *annotations) get(off uint64) []api.Annotation {
+	if len(a.byOff[off]) == 0 {
+		return nil
+	}
+	return append([]api.Annotation(nil), a.byOff[off]...)
+}
+
+func (a *annotations) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.file.Sync(); err != nil {
+		return err
+	}
+	return a.file.Close()
+}
@@ -0,0 +1,67 @@
+package log
+
+import (
+	"sync"
+	"time"
+)
+
+/*
+background runs the log's periodic maintenance tasks (retention, compaction, etc.) on tickers
+so callers don't have to remember to call them. each task gets its own goroutine and all of
+them are stopped together when the log is closed.
+*/
+type background struct {
+	done    chan struct{}
+	stopped sync.Once
+	wg      sync.WaitGroup
+}
+
+func newBackground() *background {
+	return &background{done: make(chan struct{})}
+}
+
+// calls fn every interval until the background tasks are stopped
+func (b *background) run(interval time.Duration, fn func() error) {
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-b.done:
+				return
+			case <-ticker.C:
+				/*
+					there's no caller to hand the error to in the background. the next tick will
+					retry and callers that care can call the task themselves
+				*/
+				_ = fn()
+			}
+		}
+	}()
+}
+
+// runs fn once in its own goroutine, stop waits for it to return
+func (b *background) spawn(fn func()) {
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		fn()
+	}()
+}
+
+/*
+stops every task and waits for them to exit so they can't
+touch segments while they're being closed. it's safe to call more than once and
+on the nil background of a log whose setup failed before its tasks were started
+*/
+func (b *background) stop() {
+	if b == nil {
+		return
+	}
+	b.stopped.Do(func() {
+		close(b.done)
+	})
+	b.wg.Wait()
+}
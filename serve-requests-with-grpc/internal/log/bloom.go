@@ -0,0 +1,158 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"hash/fnv"
+	"math"
+	"os"
+
+	api "github.com/phaseharry/distributed-log/serve-requests-with-grpc/api/v1"
+)
+
+const (
+	// false positive rate the filters are sized for
+	bloomFalsePositiveRate = 0.01
+	// 4 bytes for the number of hash functions in front of the filter's bits
+	bloomHeaderWidth = 4
+)
+
+var (
+	errCorruptBloom = errors.New("corrupt bloom filter")
+
+	ErrKeyNotFound = errors.New("no record with the key")
+)
+
+/*
+bloom is a bloom filter of the keys of a closed segment's records. looking a key up in it either says the
+segment definitely has no record with that key or that it might, so key lookups only read the segments that
+might have the key. it's built from the hashes of the keys the segment was given while it was active and is
+written to a {baseOffset}.bloom file next to the segment's store and index when the log rolls over from it.
+*/
+type bloom struct {
+	k    uint32 // number of bit positions set for each key
+	bits []byte
+}
+
+// the two hashes every bit position of a key is derived from
+type keyHash struct {
+	h1, h2 uint64
+}
+
+func hashKey(key []byte) keyHash {
+	a := fnv.New64a()
+	a.Write(key)
+	b := fnv.New64()
+	b.Write(key)
+	// h2 has to be odd so the positions derived from it don't repeat before all the bits were visited
+	return keyHash{h1: a.Sum64(), h2: b.Sum64() | 1}
+}
+
+// sizes a filter for the number of keys and the false positive rate and adds every key to it
+func newBloom(keys []keyHash) *bloom {
+	n := float64(len(keys))
+	if n == 0 {
+		n = 1
+	}
+	m := math.Ceil(-n * math.Log(bloomFalsePositiveRate) / (math.Ln2 * math.Ln2))
+	b := &bloom{
+		k:    uint32(math.Max(1, math.Round(m/n*math.Ln2))),
+		bits: make([]byte, (uint64(m)+7)/8),
+	}
+	for _, key := range keys {
+		b.add(key)
+	}
+	return b
+}
+
+func (b *bloom) add(key keyHash) {
+	m := uint64(len(b.bits)) * 8
+	for i := uint64(0); i < uint64(b.k); i++ {
+		bit := (key.h1 + i*key.h2) % m
+		b.bits[bit/8] |= 1 << (bit % 8)
+	}
+}
+
+// reports whether a key might have been added to the filter, false means it definitely wasn't
+func (b *bloom) mayContain(key keyHash) bool {
+	m := uint64(len(b.bits)) * 8
+	for i := uint64(0); i < uint64(b.k); i++ {
+		bit := (key.h1 + i*key.h2) % m
+		if b.bits[bit/8]&(1<<(bit%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func writeBloom(name string, b *bloom) error {
+	p := make([]byte, bloomHeaderWidth+len(b.bits))
+	enc.PutUint32(p, b.k)
+	copy(p[bloomHeaderWidth:], b.bits)
+	// writing to a temporary file first so a crash never leaves a partial filter behind
+	tmp := name + swapSuffix
+	if err := os.WriteFile(tmp, p, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+func readBloom(name string) (*bloom, error) {
+	p, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(p) <= bloomHeaderWidth || enc.Uint32(p) == 0 {
+		return nil, errCorruptBloom
+	}
+	return &bloom{k: enc.Uint32(p), bits: p[bloomHeaderWidth:]}, nil
+}
+
+/*
+LookupKey returns the latest record with the key, or ErrKeyNotFound if the log doesn't have one.
+segments are searched from newest to oldest and the ones whose key filter rules the key out are skipped,
+so only the segments that might have the key are read. offloaded segments that might have the key are
+fetched from the remote object store.
+*/
+func (l *Log) LookupKey(key []byte) (*api.Record, error) {
+	if len(key) == 0 {
+		return nil, ErrKeyNotFound
+	}
+	h := hashKey(key)
+	l.mu.RLock()
+	if l.closed {
+		l.mu.RUnlock()
+		return nil, ErrClosed
+	}
+	for i := len(l.segments) - 1; i >= 0; i-- {
+		s := l.segments[i]
+		if !s.mayContain(h) {
+			continue
+		}
+		// fetching the segment and starting over since the segments might've changed without the lock
+		if s.remote {
+			l.mu.RUnlock()
+			if err := l.fetch(context.Background(), s); err != nil {
+				return nil, err
+			}
+			return l.LookupKey(key)
+		}
+		var latest *api.Record
+		if err := s.forEach(func(record *api.Record) error {
+			if bytes.Equal(record.Key, key) {
+				latest = record
+			}
+			return nil
+		}); err != nil {
+			l.mu.RUnlock()
+			return nil, err
+		}
+		if latest != nil {
+			defer l.mu.RUnlock()
+			return l.decrypt(latest)
+		}
+	}
+	l.mu.RUnlock()
+	return nil, ErrKeyNotFound
+}
@@ -0,0 +1,42 @@
+package log
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testing that a filter never rules out a key it has and rarely lets through one it doesn't
+func TestBloom(t *testing.T) {
+	var keys []keyHash
+	for i := 0; i < 1000; i++ {
+		keys = append(keys, hashKey([]byte(fmt.Sprintf("key %d", i))))
+	}
+	b := newBloom(keys)
+	for _, key := range keys {
+		require.True(t, b.mayContain(key))
+	}
+	var falsePositives int
+	for i := 0; i < 1000; i++ {
+		if b.mayContain(hashKey([]byte(fmt.Sprintf("other %d", i)))) {
+			falsePositives++
+		}
+	}
+	require.Less(t, falsePositives, 50)
+
+	dir, err := os.MkdirTemp("", "bloom-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	name := path.Join(dir, "0.bloom")
+	require.NoError(t, writeBloom(name, b))
+	read, err := readBloom(name)
+	require.NoError(t, err)
+	require.Equal(t, b, read)
+
+	require.NoError(t, os.WriteFile(name, []byte{0, 0}, 0644))
+	_, err = readBloom(name)
+	require.Equal(t, errCorruptBloom, err)
+}
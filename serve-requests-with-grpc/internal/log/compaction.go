@@ -0,0 +1,386 @@
+package log
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	api "github.com/phaseharry/distributed-log/serve-requests-with-grpc/api/v1"
+)
+
+const (
+	defaultCompactionInterval = time.Minute
+	// directory inside of the log's directory where compacted segments are built before they replace the originals
+	compactionDir = ".compaction"
+	swapSuffix    = ".swap"
+)
+
+// starts compacting the log in the background if compaction is enabled
+func (l *Log) startCompaction() {
+	if !l.Config.Compaction.Enabled {
+		return
+	}
+	interval := l.Config.Compaction.Interval
+	if interval == 0 {
+		interval = defaultCompactionInterval
+	}
+	l.background.run(interval, l.Compact)
+}
+
+/*
+Compact rewrites every closed segment so it only contains the latest record for each key (kafka style compaction).
+- records without a key are always kept
+- records keep their original offsets, so compacted segments have gaps where superseded records were dropped.
+reading an offset that was compacted away returns the next record that's still in the log
+- segments left without any records are removed entirely
+the active segment is never rewritten, but its records are taken into account when deciding which records are the latest.
+segments that were uploaded to the remote object store are left as they are.
+
+the segments are snapshotted while holding the read lock and the compacted copies are built without holding
+the log's lock at all, closed segments are never written to so appends and reads carry on. the write lock is only
+taken to swap the copies in. segments that were removed, rewritten, or uploaded in the meantime (ex. by retention)
+are left to the next compaction, and so is the whole log if it was truncated since it could've lost the latest records
+*/
+func (l *Log) Compact() error {
+	l.compacting.Lock()
+	defer l.compacting.Unlock()
+
+	l.mu.RLock()
+	snapshot, err := l.snapshotCompaction()
+	l.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	copies, err := l.buildCompacted(snapshot)
+	defer func() {
+		for _, c := range copies {
+			c.remove()
+		}
+	}()
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.swapCompacted(copies, snapshot.truncations)
+}
+
+/*
+the segments a compaction reads, taken while holding the log's read lock. the ranges hold on to the segments'
+store and index so they can be read after the lock is released, records appended to the active segment after
+the snapshot aren't read
+*/
+type compactionSnapshot struct {
+	closed      []segmentRange
+	active      segmentRange
+	truncations uint64
+}
+
+// snapshots the segments that aren't uploaded, has to be called while holding the log's read lock
+func (l *Log) snapshotCompaction() (compactionSnapshot, error) {
+	snapshot := compactionSnapshot{truncations: l.truncations}
+	if l.closed {
+		return snapshot, ErrClosed
+	}
+	for _, s := range l.segments {
+		/*
+			uploaded segments are never rewritten. leaving their records out can only keep a local record
+			that one of them supersedes, never drop a record that's the latest for its key
+		*/
+		if s.tiered {
+			continue
+		}
+		r, err := newSegmentRange(s)
+		if err != nil {
+			return snapshot, err
+		}
+		if s == l.activeSegment {
+			snapshot.active = r
+		} else {
+			snapshot.closed = append(snapshot.closed, r)
+		}
+	}
+	return snapshot, nil
+}
+
+/*
+swaps the compacted copies in place of the segments they were built from, has to be called while holding the
+log's write lock. truncations is what the log's truncations were at when the copies were built
+*/
+func (l *Log) swapCompacted(copies []compactedCopy, truncations uint64) error {
+	if l.closed {
+		return ErrClosed
+	}
+	if l.truncations != truncations {
+		return nil
+	}
+	for _, c := range copies {
+		i := slices.Index(l.segments, c.original)
+		if i == -1 || c.original.tiered {
+			continue
+		}
+		swapped, err := l.swapCopy(c)
+		if err != nil {
+			return err
+		}
+		if swapped == nil {
+			l.segments = slices.Delete(l.segments, i, i+1)
+		} else {
+			l.segments[i] = swapped
+		}
+	}
+	return nil
+}
+
+// builds the compacted copies of the snapshot's closed segments without holding the log's lock
+func (l *Log) buildCompacted(snapshot compactionSnapshot) ([]compactedCopy, error) {
+	// offset of the latest record for each key across the whole log
+	latest := make(map[string]uint64)
+	for _, r := range append(snapshot.closed, snapshot.active) {
+		if err := r.forEach(func(record *api.Record) error {
+			if len(record.Key) > 0 {
+				latest[string(record.Key)] = record.Offset
+			}
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	var copies []compactedCopy
+	for _, r := range snapshot.closed {
+		c, err := l.buildCopy(r, r.segment.baseOffset, func(record *api.Record) bool {
+			return len(record.Key) == 0 || latest[string(record.Key)] == record.Offset
+		})
+		if err != nil {
+			return copies, err
+		}
+		// segments that didn't have anything superseded are left as they are
+		if c.kept == c.total {
+			c.remove()
+			continue
+		}
+		copies = append(copies, c)
+	}
+	return copies, nil
+}
+
+/*
+builds a copy of the segment at baseOffset with only the records that keep returns true for and swaps it
+in place of the original. returns the original if every record was kept and nil if none of them were.
+it has to be called while holding the log's write lock
+*/
+func (l *Log) rewriteSegment(s *segment, baseOffset uint64, keep func(*api.Record) bool) (*segment, error) {
+	r, err := newSegmentRange(s)
+	if err != nil {
+		return nil, err
+	}
+	c, err := l.buildCopy(r, baseOffset, keep)
+	defer c.remove()
+	if err != nil {
+		return nil, err
+	}
+	return l.swapCopy(c)
+}
+
+// a copy of a segment with some of its records left out, built in its own directory inside the compaction directory
+type compactedCopy struct {
+	original    *segment
+	baseOffset  uint64
+	dir         string
+	kept, total int
+}
+
+// removes the copy's directory, and the compaction directory once no other copy is being built in it
+func (c compactedCopy) remove() {
+	if c.dir == "" {
+		return
+	}
+	os.RemoveAll(c.dir)
+	os.Remove(path.Dir(c.dir))
+}
+
+/*
+builds a copy of the segment at baseOffset with only the records that keep returns true for. it only reads
+the segment range so it doesn't need the log's lock. the copy's directory has to be removed once the copy
+was swapped in or given up on
+*/
+func (l *Log) buildCopy(r segmentRange, baseOffset uint64, keep func(*api.Record) bool) (compactedCopy, error) {
+	c := compactedCopy{original: r.segment, baseOffset: baseOffset}
+	tmpDir := path.Join(l.Dir, compactionDir)
+	if err := os.MkdirAll(tmpDir, 0755); err != nil {
+		return c, err
+	}
+	var err error
+	if c.dir, err = os.MkdirTemp(tmpDir, "segment-"); err != nil {
+		return c, err
+	}
+
+	rewritten, err := newSegment(c.dir, baseOffset, l.Config)
+	if err != nil {
+		return c, err
+	}
+	if err = r.forEach(func(record *api.Record) error {
+		c.total++
+		if !keep(record) {
+			return nil
+		}
+		c.kept++
+		_, err := rewritten.write(record)
+		return err
+	}); err != nil {
+		rewritten.Close()
+		return c, err
+	}
+	return c, rewritten.Close()
+}
+
+/*
+swaps the copy in place of its original segment. returns the original if every record was kept and nil if
+none of them were, it has to be called while holding the log's write lock.
+
+the copy is swapped in by:
+ 1. renaming the copy's index and then its store next to the originals with a .swap suffix.
+    the store's rename is the commit point, once it exists the rewrite will be finished even if we crash
+ 2. removing the original segment if the copy starts at a different base offset (ex. TruncateBefore), or moving
+    it to the trash if there's a grace period so RestoreTrash can undo the rewrite
+ 3. renaming the .swap index and store over the originals
+
+if we crash part way through, recoverCompaction finishes or rolls back the swap the next time the log is set up.
+uploaded segments stop being tracked as uploaded before the swap is committed since their objects no longer
+match, the copy is uploaded again the next time the log is tiered.
+*/
+func (l *Log) swapCopy(c compactedCopy) (*segment, error) {
+	s, baseOffset := c.original, c.baseOffset
+	if c.kept == c.total && baseOffset == s.baseOffset {
+		return s, nil
+	}
+	if c.kept == 0 {
+		return nil, l.removeSegment(s)
+	}
+
+	var err error
+	if s.tiered {
+		if err = l.tier.delete(s.baseOffset); err != nil {
+			return nil, err
+		}
+		s.tiered = false
+	}
+	/*
+		a copy at another base offset doesn't replace the original's files, which are removed once it's committed.
+		one at the same base offset does, so the original is moved to the trash once it's committed if there's a grace period
+	*/
+	trashed := baseOffset == s.baseOffset && l.Config.Trash.GracePeriod > 0 && !s.remote
+	if baseOffset == s.baseOffset && !trashed {
+		if err = s.Close(); err != nil {
+			return nil, err
+		}
+	}
+	for _, ext := range []string{".index", ".store"} {
+		if err = os.Rename(
+			segmentPath(c.dir, baseOffset, ext),
+			segmentPath(l.Dir, baseOffset, ext)+swapSuffix,
+		); err != nil {
+			return nil, err
+		}
+	}
+	if baseOffset != s.baseOffset || trashed {
+		if err = l.removeSegment(s); err != nil {
+			return nil, err
+		}
+	}
+	if err = finishSwap(l.Dir, baseOffset); err != nil {
+		return nil, err
+	}
+	/*
+		keeping the original segment's modification time so rewriting a segment
+		doesn't reset how old the retention policies think it is
+	*/
+	if err = os.Chtimes(segmentPath(l.Dir, baseOffset, ".store"), s.modTime, s.modTime); err != nil {
+		return nil, err
+	}
+	rewritten, err := newSegment(l.Dir, baseOffset, l.Config)
+	if err != nil {
+		return nil, err
+	}
+	return rewritten, rewritten.Seal()
+}
+
+// moves a compacted segment's .swap files over the original segment's files
+func finishSwap(dir string, baseOffset uint64) error {
+	for _, ext := range []string{".index", ".store"} {
+		name := segmentPath(dir, baseOffset, ext)
+		if _, err := os.Stat(name + swapSuffix); os.IsNotExist(err) {
+			// already moved before we crashed
+			continue
+		}
+		if err := os.Rename(name+swapSuffix, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+finishes or rolls back a compaction that was interrupted part way through swapping in a compacted segment.
+- a .swap store means the swap was committed, so the remaining .swap files are moved over the originals.
+a .swap store without an original was split off the front of a segment by TruncateBefore, so every segment
+with a lower base offset is removed first
+- a .swap index without a .swap store means the swap wasn't committed, so it's deleted and the original segment is kept
+- anything left in the compaction directory was never committed and is deleted
+*/
+func recoverCompaction(dir string) error {
+	if err := os.RemoveAll(path.Join(dir, compactionDir)); err != nil {
+		return err
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		var baseOffset uint64
+		if _, err := fmt.Sscanf(file.Name(), "%d.store"+swapSuffix, &baseOffset); err != nil {
+			continue
+		}
+		if _, err := os.Stat(segmentPath(dir, baseOffset, ".store")); os.IsNotExist(err) {
+			if err := removeSegmentsBefore(dir, files, baseOffset); err != nil {
+				return err
+			}
+		}
+		if err := finishSwap(dir, baseOffset); err != nil {
+			return err
+		}
+	}
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), ".index"+swapSuffix) {
+			continue
+		}
+		if err := os.Remove(path.Join(dir, file.Name())); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// deletes the files of every segment in the directory with a base offset lower than the given one
+func removeSegmentsBefore(dir string, files []os.DirEntry, baseOffset uint64) error {
+	for _, file := range files {
+		ext := path.Ext(file.Name())
+		off, err := strconv.ParseUint(strings.TrimSuffix(file.Name(), ext), 10, 64)
+		if err != nil || off >= baseOffset {
+			continue
+		}
+		switch ext {
+		case ".index", ".store", ".bloom", ".meta":
+			if err := os.Remove(path.Join(dir, file.Name())); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
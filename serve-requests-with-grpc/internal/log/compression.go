@@ -0,0 +1,112 @@
+package log
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+/*
+Compression is the codec used to compress records before they're written to a segment's store.
+every stored record is prefixed with the codec byte it was compressed with, so changing the configured
+codec only affects new records and segments with records of mixed codecs stay readable.
+*/
+type Compression byte
+
+const (
+	CompressionNone Compression = iota
+	CompressionGzip
+	CompressionSnappy
+	CompressionZstd
+)
+
+// 1 byte prefixed to every stored record for the codec it was compressed with
+const codecWidth = 1
+
+/*
+zstd encoders and decoders are expensive to create and safe for concurrent use with
+EncodeAll / DecodeAll, so one of each is shared by every segment
+*/
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+	// gzip writers allocate their compression state up front, so they're reset and reused
+	gzipWriters = sync.Pool{New: func() any { return gzip.NewWriter(nil) }}
+)
+
+func (c Compression) String() string {
+	switch c {
+	case CompressionNone:
+		return "none"
+	case CompressionGzip:
+		return "gzip"
+	case CompressionSnappy:
+		return "snappy"
+	case CompressionZstd:
+		return "zstd"
+	}
+	return fmt.Sprintf("Compression(%d)", byte(c))
+}
+
+/*
+compresses the marshaled record with the codec and appends it to dst as {codec}{compressedRecord},
+so callers can reuse a buffer across records instead of allocating one per record
+*/
+func compress(dst []byte, c Compression, p []byte) ([]byte, error) {
+	out := append(dst, byte(c))
+	switch c {
+	case CompressionNone:
+		return append(out, p...), nil
+	case CompressionGzip:
+		buf := bytes.NewBuffer(out)
+		w := gzipWriters.Get().(*gzip.Writer)
+		defer gzipWriters.Put(w)
+		w.Reset(buf)
+		if _, err := w.Write(p); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case CompressionSnappy:
+		// snappy encodes into the start of the slice it's given, so it's given the space after the codec
+		n := len(out)
+		out = slices.Grow(out, snappy.MaxEncodedLen(len(p)))
+		encoded := snappy.Encode(out[n:cap(out)], p)
+		return out[:n+len(encoded)], nil
+	case CompressionZstd:
+		return zstdEncoder.EncodeAll(p, out), nil
+	}
+	return nil, fmt.Errorf("unknown compression codec: %d", byte(c))
+}
+
+// reads the codec prefix of a stored record and decompresses the record with it
+func decompress(p []byte) ([]byte, error) {
+	if len(p) < codecWidth {
+		return nil, io.ErrUnexpectedEOF
+	}
+	c, p := Compression(p[0]), p[codecWidth:]
+	switch c {
+	case CompressionNone:
+		return p, nil
+	case CompressionGzip:
+		r, err := gzip.NewReader(bytes.NewReader(p))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+	case CompressionSnappy:
+		return snappy.Decode(nil, p)
+	case CompressionZstd:
+		return zstdDecoder.DecodeAll(p, nil)
+	}
+	return nil, fmt.Errorf("unknown compression codec: %d", byte(c))
+}
@@ -1,9 +1,117 @@
 package log
 
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/phaseharry/distributed-log/serve-requests-with-grpc/metrics"
+	"go.uber.org/zap"
+)
+
 type Config struct {
+	/*
+		id of the cluster the log belongs to. it's written to the log's genesis when the log is created and
+		checked every time it's opened, failing with ErrClusterMismatch for another cluster's log.
+		logs created without one get a random id, an empty id skips the check
+	*/
+	ClusterID string
 	Segment struct {
 		MaxStoreBytes uint64
 		MaxIndexBytes uint64
+		/*
+			number of bytes of a segment's index file that are memory mapped when the segment's opened. the mapping
+			is doubled whenever it's full until it reaches MaxIndexBytes, so MaxIndexBytes can be set generously without
+			every index taking it up front. zero maps the whole MaxIndexBytes right away
+		*/
+		InitialIndexBytes uint64
+		// number of records a segment holds before the log rolls over to a new segment, zero means no limit
+		MaxRecords    uint64
 		InitialOffset uint64
+		// encoded size of the biggest record appends accept, bigger ones fail with api.ErrRecordTooLarge. zero means no limit
+		MaxRecordBytes uint64
+		/*
+			codec new records are compressed with before they're stored. defaults to no compression.
+			values of encrypted logs are already encrypted by then so only the rest of the record shrinks
+		*/
+		Compression Compression
+		/*
+			creates the next segment's files in the background once the active segment is half full,
+			so appends don't block on creating and truncating files when the log rolls over to a new segment
+		*/
+		Preallocate bool
+		/*
+			flushes and fsyncs the active segment's store and index after every append so a record that was
+			appended survives the machine crashing, at the cost of a disk sync per append. use Log.AppendSync
+			instead to only sync the appends that need it
+		*/
+		Fsync bool
+		/*
+			byte order new stores write their record lengths in, big endian when it's nil. it's recorded in every
+			store's header so stores written with a different byte order stay readable
+		*/
+		ByteOrder binary.ByteOrder
+	}
+	/*
+		retention policies used to delete whole segments that are no longer needed.
+		a zero value disables the policy.
+		- MaxAge: segments whose newest record was written longer than MaxAge ago are deleted
+		- MaxBytes: oldest segments are deleted until the total size of the log is at or below MaxBytes
+		- MaxRecords: oldest segments are deleted until the log holds at most MaxRecords records
+		- CheckInterval: how often the policies are enforced in the background. defaults to a minute
+	*/
+	Retention struct {
+		MaxAge        time.Duration
+		MaxBytes      uint64
+		MaxRecords    uint64
+		CheckInterval time.Duration
+	}
+	/*
+		key compaction rewrites closed segments so only the latest record for each key is kept,
+		letting the log back key/value state and not just event streams. records without a key are always kept.
+		- Enabled: compacts the log in the background every Interval
+		- Interval: how often the log is compacted. defaults to a minute
+	*/
+	Compaction struct {
+		Enabled  bool
+		Interval time.Duration
+	}
+	/*
+		envelope encryption for record values. each record is encrypted with its own data key, which is
+		wrapped by MasterKey and stored in the log's keys sidecar. deleting a record's data key with Redact
+		makes the record unreadable without rewriting its segment (crypto-shredding).
+		- MasterKey: 16, 24, or 32 byte AES key. records are stored unencrypted when it's empty
+	*/
+	Encryption struct {
+		MasterKey []byte
+	}
+	/*
+		tiered storage offloads closed segments to a remote object store (ex. an S3 bucket) so the log can hold more
+		than fits on local disk. offloaded segments are fetched back transparently when one of their records is read.
+		- Remote: the object store segments are uploaded to. tiering is disabled when it's nil
+		- LocalRetention: uploaded segments keep their local files until they haven't been written to or fetched for this long
+		- Interval: how often closed segments are uploaded and offloaded in the background. defaults to a minute
+	*/
+	Tiering struct {
+		Remote         ObjectStore
+		LocalRetention time.Duration
+		Interval       time.Duration
+	}
+	/*
+		segments removed by retention, Truncate, or compaction are moved into the log's trash directory instead
+		of being deleted right away, so removing too much can be undone with RestoreTrash.
+		- GracePeriod: how long removed segments are kept in the trash. segments are deleted right away when it's zero
+		- CheckInterval: how often the trash is emptied of segments past the grace period. defaults to a minute
+		segments that were offloaded to a remote object store are deleted from it right away
+	*/
+	Trash struct {
+		GracePeriod   time.Duration
+		CheckInterval time.Duration
 	}
+	/*
+		where the log reports append latency, bytes written, segment rolls and the active index's size, labeled
+		with the log's directory. defaults to metrics.Nop
+	*/
+	Metrics metrics.Metrics
+	// logs the log's storage events at debug level, ex. segments being created and removed. defaults to a no-op logger
+	Logger *zap.Logger
 }
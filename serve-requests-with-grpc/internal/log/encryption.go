@@ -0,0 +1,269 @@
+package log
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sync"
+)
+
+const (
+	keysFileName = "keys"
+	dataKeyWidth = 32 // AES-256 data keys
+	nonceWidth   = 12 // standard GCM nonce size
+	tagWidth     = 16 // standard GCM authentication tag size
+	// a wrapped data key is {nonce}{encryptedDataKey}{tag}
+	wrappedKeyWidth = nonceWidth + dataKeyWidth + tagWidth
+	// 8 bytes for the record's absolute offset followed by its wrapped data key
+	keyEntryWidth = 8 + wrappedKeyWidth
+)
+
+var (
+	ErrEncryptionDisabled = errors.New("encryption isn't enabled for this log")
+	// returned when redacting a record that was appended before encryption was enabled
+	ErrNotEncrypted = errors.New("isn't encrypted and can't be redacted")
+	// returned when restoring a data key that was wrapped by another master key, ex. a snapshot of another log
+	ErrMasterKeyMismatch = errors.New("data key wasn't wrapped with the log's master key")
+	// returned internally when a record's data key has been deleted
+	errRedacted = errors.New("record has been redacted")
+)
+
+/*
+keystore holds the data keys that record values are encrypted with, one per record. every data key
+is wrapped (encrypted) by the master key before it's written to disk so the keys file alone can't
+decrypt anything. entries are a fixed width {recordOffset}{wrappedDataKey} so redacting a record can
+overwrite its wrapped key with zeros in place. once the key is gone the record's value can't be decrypted
+even though its bytes are still in the store file.
+*/
+type keystore struct {
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	master cipher.AEAD
+	// where each record's entry starts in the keys file and its wrapped data key. nil once redacted
+	entries map[uint64]keyEntry
+}
+
+type keyEntry struct {
+	pos     int64
+	wrapped []byte
+}
+
+func newKeystore(dir string, masterKey []byte) (*keystore, error) {
+	master, err := newAEAD(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	/*
+		not opening with os.O_APPEND since redacting overwrites entries in place with WriteAt.
+		new entries are written at the end of the file using the tracked size instead
+	*/
+	f, err := os.OpenFile(path.Join(dir, keysFileName), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	// ignoring a partially written entry at the end of the file (ex. crash mid write)
+	size := fi.Size() - fi.Size()%keyEntryWidth
+	k := &keystore{
+		file:    f,
+		size:    size,
+		master:  master,
+		entries: make(map[uint64]keyEntry),
+	}
+	entry := make([]byte, keyEntryWidth)
+	for pos := int64(0); pos < size; pos += keyEntryWidth {
+		if _, err := f.ReadAt(entry, pos); err != nil {
+			return nil, err
+		}
+		e := keyEntry{pos: pos}
+		if !isZero(entry[8:]) {
+			e.wrapped = append([]byte(nil), entry[8:]...)
+		}
+		k.entries[enc.Uint64(entry[:8])] = e
+	}
+	return k, nil
+}
+
+/*
+encrypts the value of the record that will be stored at the given offset with a newly generated
+data key and stores the wrapped data key. returns {nonce}{ciphertext}{tag}. the record's offset is
+used as additional data so an encrypted value can't be moved to another offset and still decrypt.
+*/
+func (k *keystore) Seal(off uint64, value []byte) ([]byte, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	dataKey := make([]byte, dataKeyWidth)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	ad := offsetData(off)
+	wrapped, err := seal(k.master, dataKey, ad)
+	if err != nil {
+		return nil, err
+	}
+	if err = k.write(off, wrapped); err != nil {
+		return nil, err
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return seal(aead, value, ad)
+}
+
+// appends the record's entry to the keys file, a nil wrapped key is written as a redacted entry
+func (k *keystore) write(off uint64, wrapped []byte) error {
+	entry := make([]byte, keyEntryWidth)
+	enc.PutUint64(entry[:8], off)
+	copy(entry[8:], wrapped)
+	if _, err := k.file.WriteAt(entry, k.size); err != nil {
+		return err
+	}
+	k.entries[off] = keyEntry{pos: k.size, wrapped: wrapped}
+	k.size += keyEntryWidth
+	return nil
+}
+
+/*
+stores the wrapped data key of a record that was encrypted by a log with the same master key, ex. one restored
+from a snapshot. a nil key stores the record as redacted. returns ErrMasterKeyMismatch if the master key can't unwrap it
+*/
+func (k *keystore) Add(off uint64, wrapped []byte) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if wrapped != nil {
+		if _, err := open(k.master, wrapped, offsetData(off)); err != nil {
+			return fmt.Errorf("record at offset %d: %w", off, ErrMasterKeyMismatch)
+		}
+	}
+	return k.write(off, wrapped)
+}
+
+// returns the record's wrapped data key, nil if it was redacted. ok is false if the record wasn't encrypted
+func (k *keystore) Wrapped(off uint64) (wrapped []byte, ok bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	e, ok := k.entries[off]
+	return e.wrapped, ok
+}
+
+/*
+decrypts the value of the record at the given offset. values of records that were appended
+before encryption was enabled don't have a data key and are returned as is.
+returns errRedacted if the record's data key was deleted.
+*/
+func (k *keystore) Open(off uint64, value []byte) ([]byte, error) {
+	k.mu.Lock()
+	e, ok := k.entries[off]
+	k.mu.Unlock()
+
+	if !ok {
+		return value, nil
+	}
+	if e.wrapped == nil {
+		return nil, errRedacted
+	}
+	ad := offsetData(off)
+	dataKey, err := open(k.master, e.wrapped, ad)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return open(aead, value, ad)
+}
+
+/*
+deletes the data key of the record at the given offset by overwriting its wrapped key with zeros
+and syncing the file, so the key is actually gone from disk once this returns
+*/
+func (k *keystore) Redact(off uint64) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	e, ok := k.entries[off]
+	if !ok {
+		return fmt.Errorf("record at offset %d %w", off, ErrNotEncrypted)
+	}
+	if e.wrapped == nil {
+		return nil
+	}
+	if _, err := k.file.WriteAt(make([]byte, wrappedKeyWidth), e.pos+8); err != nil {
+		return err
+	}
+	if err := k.file.Sync(); err != nil {
+		return err
+	}
+	k.entries[off] = keyEntry{pos: e.pos}
+	return nil
+}
+
+// syncs the data keys that were sealed so far to disk
+func (k *keystore) Sync() error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.file.Sync()
+}
+
+func (k *keystore) Close() error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if err := k.file.Sync(); err != nil {
+		return err
+	}
+	return k.file.Close()
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encrypts the plaintext with a random nonce and returns {nonce}{ciphertext}{tag}
+func seal(aead cipher.AEAD, plaintext, ad []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, ad), nil
+}
+
+func open(aead cipher.AEAD, ciphertext, ad []byte) ([]byte, error) {
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, errors.New("encrypted value is too short")
+	}
+	nonce := ciphertext[:aead.NonceSize()]
+	return aead.Open(nil, nonce, ciphertext[aead.NonceSize():], ad)
+}
+
+func offsetData(off uint64) []byte {
+	ad := make([]byte, 8)
+	enc.PutUint64(ad, off)
+	return ad
+}
+
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
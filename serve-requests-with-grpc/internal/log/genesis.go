@@ -0,0 +1,90 @@
+package log
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"time"
+)
+
+const (
+	// file in the log's directory the genesis is written to when the log is created
+	genesisFileName = "log.genesis"
+	// version of the log's on disk format, bumped when older code can't read what newer code writes
+	formatVersion = 1
+)
+
+var (
+	ErrClusterMismatch   = errors.New("log belongs to another cluster")
+	ErrUnsupportedFormat = errors.New("log was written with a newer format version")
+)
+
+/*
+Genesis describes where a log came from. it's written once when the log's directory is first used and
+checked every time the log is opened, so a broker pointed at another cluster's data directory (ex. a volume
+that was attached to the wrong machine) fails to open it instead of serving and appending to it
+*/
+type Genesis struct {
+	ClusterID     string    `json:"cluster_id"`
+	Created       time.Time `json:"created"`
+	FormatVersion uint32    `json:"format_version"`
+}
+
+/*
+reads the log's genesis, writing it first if the log doesn't have one yet. logs created
+before genesis existed get one the first time they're opened
+*/
+func loadGenesis(dir, clusterID string) (Genesis, error) {
+	name := path.Join(dir, genesisFileName)
+	var g Genesis
+	b, err := os.ReadFile(name)
+	switch {
+	case os.IsNotExist(err):
+		return newGenesis(name, clusterID)
+	case err != nil:
+		return g, err
+	}
+	if err = json.Unmarshal(b, &g); err != nil {
+		return g, err
+	}
+	if g.FormatVersion > formatVersion {
+		return g, fmt.Errorf("%w: %d, this version reads up to %d", ErrUnsupportedFormat, g.FormatVersion, formatVersion)
+	}
+	if clusterID != "" && g.ClusterID != clusterID {
+		return g, fmt.Errorf("%w: %s, not %s", ErrClusterMismatch, g.ClusterID, clusterID)
+	}
+	return g, nil
+}
+
+// writes a genesis for the cluster, logs created without a cluster id get a random one
+func newGenesis(name, clusterID string) (Genesis, error) {
+	g := Genesis{ClusterID: clusterID, Created: time.Now().UTC(), FormatVersion: formatVersion}
+	if g.ClusterID == "" {
+		id := make([]byte, 16)
+		if _, err := rand.Read(id); err != nil {
+			return g, err
+		}
+		g.ClusterID = hex.EncodeToString(id)
+	}
+	b, err := json.Marshal(g)
+	if err != nil {
+		return g, err
+	}
+	// writing to a temporary file first so a crash never leaves a partial genesis behind
+	tmp := name + swapSuffix
+	if err = os.WriteFile(tmp, b, 0644); err != nil {
+		return g, err
+	}
+	return g, os.Rename(tmp, name)
+}
+
+// Genesis returns the genesis the log was created with
+func (l *Log) Genesis() Genesis {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.genesis
+}
@@ -1,10 +1,12 @@
 package log
 
 import (
+	"errors"
+	"fmt"
 	"io"
 	"os"
-
-	"github.com/tysonmote/gommap"
+	"sort"
+	"sync"
 )
 
 var (
@@ -25,16 +27,49 @@ var (
 	entWidth uint64 = offWidth + posWidth
 )
 
+const (
+	indexMagic   = "DLIX"
+	indexVersion = uint16(1)
+	/*
+		every index file starts with a header: {magic}{version}{entWidth}{baseOffset}
+		- magic: 4 bytes that mark the file as an index so a store or foreign file is rejected when it's opened
+		- version: 2 byte format version
+		- entWidth: 2 byte width of the entries the index was written with
+		- baseOffset: 8 byte base offset of the segment the index belongs to, the entries' offsets are relative to it
+		the header is big endian like the entries. entries start right after it, so the index's size includes it.
+	*/
+	indexHeaderWidth = 16
+)
+
+var (
+	ErrNotIndex = errors.New("file isn't an index, its header doesn't start with the index magic")
+	// the index's entries don't line up with the entry width, ex. its file was truncated part way through an entry
+	ErrCorruptIndex = errors.New("index is corrupt")
+)
+
 type index struct {
 	file *os.File
-	mmap gommap.MMap
-	size uint64
+	/*
+		the index file's bytes, memory mapped unless the package is built with the nommap tag (see index_file.go).
+		mu guards the mapping being replaced or unmapped, iterators read entries without holding the log's lock
+	*/
+	mu     sync.RWMutex
+	mmap   []byte
+	size   uint64
+	max    uint64 // MaxIndexBytes, the mmap is grown up to it when it starts out smaller
+	synced uint64 // bytes before it were synced to the file, used by the fallback that has to write them itself
+	sealed bool   // the index was truncated to its entries and mapped read only, it can't be written to
 }
 
-func newIndex(f *os.File, c Config) (*index, error) {
+/*
+opens an index over the file for the segment starting at baseOffset. an empty file is given a header,
+otherwise the file's header is validated against the segment before the file is memory mapped
+*/
+func newIndex(f *os.File, baseOffset uint64, c Config) (*index, error) {
 	// create a new index that holds the persisted file
 	idx := &index{
 		file: f,
+		max:  c.Segment.MaxIndexBytes,
 	}
 
 	/*
@@ -49,43 +84,139 @@ func newIndex(f *os.File, c Config) (*index, error) {
 	}
 
 	idx.size = uint64(fi.Size())
-
-	/*
-		need to check:
-		assuming that if the file is not the size of "MaxIndexBytes" yet, truncate will
-		actually increase the file size by adding spaces. this seems to be needed to give
-		the gommap memory map implementation the max size it's memory mapped file should have.
-		as part of this truncating process to add white space, the last index entry will not
-		be within the actual last byte within the file. To remedy this, when we close the file,
-		we have to truncate to remove any white spaces so if it reopens, it will point to the correct position for the next appended record
-	*/
-	err = os.Truncate(f.Name(), int64(c.Segment.MaxIndexBytes))
+	if idx.size == 0 {
+		err = idx.writeHeader(baseOffset)
+	} else {
+		err = idx.readHeader(baseOffset)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	/*
-		initializing our memory mapped file by linking it to the passed in index file
-		and giving it read and write permissions.
-		using this memory map messes up the sizing of the file as it grows.
-		reads in the file and uses its size as the max length of the memory map.
-		that's why we have to truncate it in the above step to the "MaxIndexBytes" size.
-
-		ex. if MaxIndexBytes was 10, then there will be a list of 10 bytes where each idx correlates to the
-		position of the file offset.
-	*/
-	idx.mmap, err = gommap.Map(
-		idx.file.Fd(),
-		gommap.PROT_READ|gommap.PROT_WRITE,
-		gommap.MAP_SHARED,
-	)
-	if err != nil {
+	idx.synced = idx.size
+	if idx.mmap, err = mapIndex(f, idx.initialLen(c.Segment.InitialIndexBytes)); err != nil {
 		return nil, err
 	}
 
 	return idx, nil
 }
 
+// opens the index of a sealed segment, its file was truncated down to its entries and is mapped read only
+func newSealedIndex(f *os.File, baseOffset uint64) (*index, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	idx := &index{
+		file:   f,
+		size:   uint64(fi.Size()),
+		sealed: true,
+	}
+	idx.synced = idx.size
+	idx.max = idx.size
+	if err = idx.readHeader(baseOffset); err != nil {
+		return nil, err
+	}
+	if idx.mmap, err = mapSealedIndex(f); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+/*
+returns how many bytes of the file are mapped when the index is opened. the whole MaxIndexBytes is mapped
+unless InitialIndexBytes is smaller, then it's doubled until the entries that are already written fit
+*/
+func (i *index) initialLen(initial uint64) uint64 {
+	if initial == 0 || initial >= i.max {
+		return i.max
+	}
+	n := initial
+	for n < i.size && n < i.max {
+		n *= 2
+	}
+	return min(n, i.max)
+}
+
+/*
+doubles the memory mapped part of the index file, up to MaxIndexBytes, so another entry fits.
+the entries are synced and the file is mapped again at the new length before the old mapping is released
+*/
+func (i *index) grow() error {
+	n := min(uint64(len(i.mmap))*2, i.max)
+	if n < i.size+entWidth {
+		return io.EOF
+	}
+	if err := i.Sync(); err != nil {
+		return err
+	}
+	mmap, err := mapIndex(i.file, n)
+	if err != nil {
+		return err
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if err = unmapIndex(i.mmap); err != nil {
+		return err
+	}
+	i.mmap = mmap
+	return nil
+}
+
+// writes the header of a new index straight to the file before it's padded out and memory mapped
+func (i *index) writeHeader(baseOffset uint64) error {
+	header := make([]byte, indexHeaderWidth)
+	copy(header, indexMagic)
+	enc.PutUint16(header[4:6], indexVersion)
+	enc.PutUint16(header[6:8], uint16(entWidth))
+	enc.PutUint64(header[8:16], baseOffset)
+	if _, err := i.file.WriteAt(header, 0); err != nil {
+		return err
+	}
+	i.size = indexHeaderWidth
+	return nil
+}
+
+func (i *index) readHeader(baseOffset uint64) error {
+	if i.size < indexHeaderWidth {
+		return ErrNotIndex
+	}
+	header := make([]byte, indexHeaderWidth)
+	if _, err := i.file.ReadAt(header, 0); err != nil {
+		return err
+	}
+	if string(header[:4]) != indexMagic {
+		return ErrNotIndex
+	}
+	if version := enc.Uint16(header[4:6]); version != indexVersion {
+		return fmt.Errorf("unsupported index format version: %d", version)
+	}
+	if width := enc.Uint16(header[6:8]); uint64(width) != entWidth {
+		return fmt.Errorf("%w: written with %d byte entries, expected %d", ErrCorruptIndex, width, entWidth)
+	}
+	if base := enc.Uint64(header[8:16]); base != baseOffset {
+		return fmt.Errorf("%w: index belongs to the segment at offset %d, not %d", ErrCorruptIndex, base, baseOffset)
+	}
+	if (i.size-indexHeaderWidth)%entWidth != 0 {
+		return fmt.Errorf("%w: %d bytes of entries isn't a multiple of the %d byte entry width", ErrCorruptIndex, i.size-indexHeaderWidth, entWidth)
+	}
+	return nil
+}
+
+/*
+rewrites the base offset in the header, used when a spare segment is moved under the base offset
+it'll be used for
+*/
+func (i *index) setBaseOffset(baseOffset uint64) {
+	enc.PutUint64(i.mmap[8:indexHeaderWidth], baseOffset)
+	i.synced = 0
+}
+
+// returns the number of entries in the index
+func (i *index) len() uint64 {
+	return (i.size - indexHeaderWidth) / entWidth
+}
+
 /*
 Read takes in an offset value ("in" variable) and returns the associated record's position in the store.
 The given offset is relative to the segment's base offset. Using relative offsets to reduce
@@ -93,11 +224,17 @@ the size of the indexes by storing it as uint32s (4 bytes). If we were to use ab
 then we would need to store the values as uint64s (8 bytes).
 */
 func (i *index) Read(in int64) (out uint32, pos uint64, err error) {
+	// the mapping is released once the index is closed, reads that race the close fail instead of faulting
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	if i.mmap == nil {
+		return 0, 0, os.ErrClosed
+	}
 	/*
 	   Trying to read while our index size is 0, means we don't have
 	   any records yet so return an EOF error.
 	*/
-	if i.size == 0 {
+	if i.len() == 0 {
 		return 0, 0, io.EOF
 	}
 
@@ -108,7 +245,7 @@ func (i *index) Read(in int64) (out uint32, pos uint64, err error) {
 		Converting to int32 because the index's offset value is 4 bytes
 	*/
 	if in == -1 {
-		out = uint32((i.size / entWidth) - 1)
+		out = uint32(i.len() - 1)
 	} else {
 		out = uint32(in)
 	}
@@ -116,12 +253,12 @@ func (i *index) Read(in int64) (out uint32, pos uint64, err error) {
 	   using the offset to calculate the actual byte position of where it would be stored within the file.
 	   ex.
 	   out = 0 (first entry in index)
-	   pos = 0 * 12 bytes = 0
+	   pos = 16 byte header + 0 * 12 bytes = 16
 
 	   out = 1 (second entry in index)
-	   pos = 1 * 12 bytes = 12
+	   pos = 16 byte header + 1 * 12 bytes = 28
 	*/
-	pos = uint64(out) * entWidth
+	pos = indexHeaderWidth + uint64(out)*entWidth
 	// throw error if the position calculated is greater than our actual size (out of bounds / EOF error)
 	if i.size < pos+entWidth {
 		return 0, 0, io.EOF
@@ -137,14 +274,111 @@ func (i *index) Read(in int64) (out uint32, pos uint64, err error) {
 	return out, pos, nil
 }
 
+/*
+Find returns the first index entry whose relative offset is greater than or equal to the passed in offset.
+returns io.EOF if every entry has a smaller offset, and os.ErrClosed once the index is closed like Read.
+*/
+func (i *index) Find(off uint32) (out uint32, pos uint64, err error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	if i.mmap == nil {
+		return 0, 0, os.ErrClosed
+	}
+	n := i.search(off)
+	if n == i.len() {
+		return 0, 0, io.EOF
+	}
+	out, pos = i.entry(n)
+	return out, pos, nil
+}
+
+/*
+returns the position (entry number) of the first entry whose relative offset is greater than or equal
+to the passed in offset, or the number of entries if there isn't one.
+entries are written in increasing offset order so the entry for an offset is normally the entry at that
+same position and we can check it directly. compacted segments have gaps in their offsets so when the entry
+at that position doesn't match we fall back to binary searching the entries.
+*/
+func (i *index) search(off uint32) uint64 {
+	entries := i.len()
+	if uint64(off) < entries {
+		if out, _ := i.entry(uint64(off)); out == off {
+			return uint64(off)
+		}
+	}
+	return uint64(sort.Search(int(entries), func(j int) bool {
+		out, _ := i.entry(uint64(j))
+		return out >= off
+	}))
+}
+
+/*
+reads the nth entry without checking it against the index's size. callers make sure the entry
+was already written, which lets readers that know how many entries there are walk them
+without racing with appends that update the size
+*/
+func (i *index) entry(n uint64) (out uint32, pos uint64) {
+	start := indexHeaderWidth + n*entWidth
+	return enc.Uint32(i.mmap[start : start+offWidth]), enc.Uint64(i.mmap[start+offWidth : start+entWidth])
+}
+
+/*
+reads the nth entry like entry for readers that don't hold the log's lock (ex. iterators), so the mapping
+can be replaced or released while they read. fails once the index is closed
+*/
+func (i *index) readEntry(n uint64) (out uint32, pos uint64, err error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	if i.mmap == nil {
+		return 0, 0, os.ErrClosed
+	}
+	out, pos = i.entry(n)
+	return out, pos, nil
+}
+
+// an entry of the index, the record's offset relative to the segment's base offset and its position in the store
+type indexEntry struct {
+	off uint32
+	pos uint64
+}
+
+/*
+ReadRange returns the entries whose relative offsets are in [from, to), lowest first. the first one is searched for
+like Find and the ones after it are read in the same pass under a single lock of the mapping, so a range costs one
+search instead of one per offset. has to be called while holding the log's lock so the entries can't race appends
+*/
+func (i *index) ReadRange(from, to uint32) ([]indexEntry, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	if i.mmap == nil {
+		return nil, os.ErrClosed
+	}
+	var entries []indexEntry
+	for n := i.search(from); n < i.len(); n++ {
+		out, pos := i.entry(n)
+		if out >= to {
+			break
+		}
+		entries = append(entries, indexEntry{off: out, pos: pos})
+	}
+	return entries, nil
+}
+
 func (i *index) Write(off uint32, pos uint64) error {
+	// a sealed index is mapped read only, writing to it would fault
+	if i.sealed {
+		return ErrSealed
+	}
+
 	/*
 	   checking the memory maps max size in bytes.
-	   if currentSize + the size of a new entry is greater than the max memory map size,
-	   then return an EOF err
+	   if currentSize + the size of a new entry is greater than the memory map size, the map is grown
+	   and an EOF err is returned once it can't grow past MaxIndexBytes
 	*/
 	if uint64(len(i.mmap)) < i.size+entWidth {
-		return io.EOF
+		if err := i.grow(); err != nil {
+			return err
+		}
 	}
 
 	/*
@@ -158,12 +392,81 @@ func (i *index) Write(off uint32, pos uint64) error {
 	return nil
 }
 
+// syncs the entries written to the memory map to the index file
+func (i *index) Sync() error {
+	if i.sealed {
+		return nil
+	}
+	if err := syncIndex(i.file, i.mmap, i.synced, i.size); err != nil {
+		return err
+	}
+	i.synced = i.size
+	return nil
+}
+
+/*
+syncs the index and releases its mapping, then truncates the file down to its entries and maps it again read only
+through a read only file. the file's permissions are made read only too since the index won't be written to again.
+like the store's, the file is reopened by name
+*/
+func (i *index) seal(name string) error {
+	if i.sealed {
+		return nil
+	}
+	if err := i.Sync(); err != nil {
+		return err
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if err := unmapIndex(i.mmap); err != nil {
+		return err
+	}
+	i.mmap = nil
+	if err := i.file.Truncate(int64(i.size)); err != nil {
+		return err
+	}
+	if err := i.file.Sync(); err != nil {
+		return err
+	}
+	if err := os.Chmod(name, 0444); err != nil {
+		return err
+	}
+	if err := i.file.Close(); err != nil {
+		return err
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	if i.mmap, err = mapSealedIndex(f); err != nil {
+		f.Close()
+		return err
+	}
+	i.file = f
+	i.sealed = true
+	return nil
+}
+
 // method to return the index file path
 func (i *index) Name() string {
 	return i.file.Name()
 }
 
 func (i *index) Close() error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.mmap == nil {
+		return os.ErrClosed
+	}
+	// a sealed index's file was already truncated to its entries and synced
+	if i.sealed {
+		if err := unmapIndex(i.mmap); err != nil {
+			return err
+		}
+		i.mmap = nil
+		return i.file.Close()
+	}
+
 	/*
 		When .Close() is called, we want to make sure our memory mapped file
 		gets synced with the actual index file. This will force the sync and not wait until
@@ -173,9 +476,18 @@ func (i *index) Close() error {
 	*/
 
 	// syncing memory map to persisted file
-	if err := i.mmap.Sync(gommap.MS_SYNC); err != nil {
+	if err := i.Sync(); err != nil {
+		return err
+	}
+
+	/*
+		releasing the mapping before the file is truncated and closed, a mapped file can't be
+		truncated on every platform (ex. windows) and the mapping would outlive the file otherwise
+	*/
+	if err := unmapIndex(i.mmap); err != nil {
 		return err
 	}
+	i.mmap = nil
 
 	// making sure persisted file flushes its buffers to save contents to disk
 	if err := i.file.Sync(); err != nil {
@@ -0,0 +1,39 @@
+//go:build windows || nommap
+
+package log
+
+import (
+	"io"
+	"os"
+)
+
+/*
+fallback for platforms where the index file can't stay memory mapped while it's truncated (ex. windows), or for
+builds with the nommap tag. the index's bytes are read into memory instead and the entries written since the last
+sync are written back to the file with plain file IO, so the index works the same way on top of a byte slice
+*/
+func mapIndex(f *os.File, n uint64) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := f.ReadAt(b, 0); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return b, nil
+}
+
+// reads a sealed index's whole file, the file was truncated down to its entries
+func mapSealedIndex(f *os.File) ([]byte, error) {
+	return io.ReadAll(f)
+}
+
+// writes the bytes in [from, to) that changed since the last sync to the index file
+func syncIndex(f *os.File, mmap []byte, from, to uint64) error {
+	if from >= to {
+		return nil
+	}
+	_, err := f.WriteAt(mmap[from:to], int64(from))
+	return err
+}
+
+func unmapIndex([]byte) error {
+	return nil
+}
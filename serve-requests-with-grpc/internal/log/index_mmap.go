@@ -0,0 +1,45 @@
+//go:build !windows && !nommap
+
+package log
+
+import (
+	"os"
+
+	"github.com/tysonmote/gommap"
+)
+
+/*
+memory maps the first n bytes of the index file.
+- truncate actually increases the file size by adding spaces when the file isn't n bytes yet. this is needed to give
+the gommap memory map implementation the size its memory mapped file should have, since it reads in the file and uses
+its size as the length of the memory map. as part of this truncating process to add white space, the last index entry
+will not be within the actual last byte within the file. To remedy this, when we close the file, we have to truncate
+to remove any white spaces so if it reopens, it will point to the correct position for the next appended record
+- the mapping is linked to the index file with read and write permissions and shared so writes to it end up in the file
+
+ex. if n was 10, then there will be a list of 10 bytes where each idx correlates to the position of the file offset.
+*/
+func mapIndex(f *os.File, n uint64) ([]byte, error) {
+	if err := f.Truncate(int64(n)); err != nil {
+		return nil, err
+	}
+	return gommap.Map(
+		f.Fd(),
+		gommap.PROT_READ|gommap.PROT_WRITE,
+		gommap.MAP_SHARED,
+	)
+}
+
+// maps a sealed index's whole file read only, the file was truncated down to its entries
+func mapSealedIndex(f *os.File) ([]byte, error) {
+	return gommap.Map(f.Fd(), gommap.PROT_READ, gommap.MAP_SHARED)
+}
+
+// flushes the mapping's dirty pages to the index file, every write to the mapping already went to the file's pages
+func syncIndex(f *os.File, mmap []byte, from, to uint64) error {
+	return gommap.MMap(mmap).Sync(gommap.MS_SYNC)
+}
+
+func unmapIndex(mmap []byte) error {
+	return gommap.MMap(mmap).UnsafeUnmap()
+}
@@ -18,7 +18,7 @@ func TestIndex(t *testing.T) {
 	c := Config{}
 	c.Segment.MaxIndexBytes = 1024
 
-	idx, err := newIndex(f, c)
+	idx, err := newIndex(f, 0, c)
 	require.NoError(t, err)
 
 	/*
@@ -60,7 +60,7 @@ func TestIndex(t *testing.T) {
 	   should be able to read its content once index is instantiated from existing file.
 	*/
 	f, _ = os.OpenFile(f.Name(), os.O_RDWR, 0600)
-	idx, err = newIndex(f, c)
+	idx, err = newIndex(f, 0, c)
 	require.NoError(t, err)
 	// testing that we can read the last element of the index after we inserted entries
 	off, pos, err := idx.Read(-1)
@@ -68,3 +68,132 @@ func TestIndex(t *testing.T) {
 	require.Equal(t, uint32(1), off)
 	require.Equal(t, entries[1].Pos, pos)
 }
+
+// testing that entries can be found by offset when the index has gaps in its offsets (ex. compacted segments)
+func TestIndexFind(t *testing.T) {
+	f, err := os.CreateTemp(os.TempDir(), "index_find_test")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+
+	c := Config{}
+	c.Segment.MaxIndexBytes = 1024
+	idx, err := newIndex(f, 0, c)
+	require.NoError(t, err)
+	defer idx.Close()
+
+	for _, entry := range []struct {
+		Off uint32
+		Pos uint64
+	}{
+		{Off: 1, Pos: 0},
+		{Off: 4, Pos: 10},
+		{Off: 5, Pos: 20},
+	} {
+		require.NoError(t, idx.Write(entry.Off, entry.Pos))
+	}
+
+	// offsets that were dropped resolve to the next entry in the index
+	for off, want := range map[uint32]uint32{0: 1, 1: 1, 2: 4, 4: 4, 5: 5} {
+		out, _, err := idx.Find(off)
+		require.NoError(t, err)
+		require.Equal(t, want, out)
+	}
+
+	_, _, err = idx.Find(6)
+	require.Equal(t, io.EOF, err)
+
+	// ranges start from the next entry in the index like Find
+	entries, err := idx.ReadRange(2, 6)
+	require.NoError(t, err)
+	require.Equal(t, []indexEntry{{off: 4, pos: 10}, {off: 5, pos: 20}}, entries)
+	entries, err = idx.ReadRange(0, 5)
+	require.NoError(t, err)
+	require.Equal(t, []indexEntry{{off: 1, pos: 0}, {off: 4, pos: 10}}, entries)
+	entries, err = idx.ReadRange(6, 10)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+// testing that files that aren't indexes of the segment being opened are rejected instead of read as entries
+func TestIndexHeader(t *testing.T) {
+	c := Config{}
+	c.Segment.MaxIndexBytes = 1024
+
+	valid := func(baseOffset uint64) []byte {
+		f, err := os.CreateTemp(os.TempDir(), "index_header_test")
+		require.NoError(t, err)
+		defer os.Remove(f.Name())
+		idx, err := newIndex(f, baseOffset, c)
+		require.NoError(t, err)
+		require.NoError(t, idx.Write(0, 0))
+		require.NoError(t, idx.Close())
+		b, err := os.ReadFile(f.Name())
+		require.NoError(t, err)
+		return b
+	}
+
+	for scenario, test := range map[string]struct {
+		contents []byte
+		want     error
+	}{
+		"store file":       {contents: []byte("DLST\x00\x01\x00\x00"), want: ErrNotIndex},
+		"truncated header": {contents: []byte("DLIX"), want: ErrNotIndex},
+		"other segment":    {contents: valid(16), want: ErrCorruptIndex},
+		"truncated entry":  {contents: valid(0)[:indexHeaderWidth+entWidth-1], want: ErrCorruptIndex},
+	} {
+		t.Run(scenario, func(t *testing.T) {
+			f, err := os.CreateTemp(os.TempDir(), "index_header_test")
+			require.NoError(t, err)
+			defer os.Remove(f.Name())
+			defer f.Close()
+			_, err = f.Write(test.contents)
+			require.NoError(t, err)
+
+			_, err = newIndex(f, 0, c)
+			require.ErrorIs(t, err, test.want)
+		})
+	}
+}
+
+/*
+testing that an index mapped smaller than MaxIndexBytes grows as entries are written until it reaches MaxIndexBytes,
+that a reopened index maps enough of its file for the entries already written, and that readers that don't hold
+the log's lock get an error instead of reading a released mapping once the index is closed
+*/
+func TestIndexGrow(t *testing.T) {
+	f, err := os.CreateTemp(os.TempDir(), "index_grow_test")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+
+	c := Config{}
+	c.Segment.MaxIndexBytes = indexHeaderWidth + entWidth*10
+	c.Segment.InitialIndexBytes = indexHeaderWidth + entWidth
+	idx, err := newIndex(f, 0, c)
+	require.NoError(t, err)
+	require.Equal(t, int(c.Segment.InitialIndexBytes), len(idx.mmap))
+
+	for off := uint32(0); off < 10; off++ {
+		require.NoError(t, idx.Write(off, uint64(off)*10))
+	}
+	require.Equal(t, io.EOF, idx.Write(10, 100))
+	require.Equal(t, int(c.Segment.MaxIndexBytes), len(idx.mmap))
+
+	out, pos, err := idx.readEntry(9)
+	require.NoError(t, err)
+	require.Equal(t, uint32(9), out)
+	require.Equal(t, uint64(90), pos)
+	require.NoError(t, idx.Close())
+	_, _, err = idx.readEntry(9)
+	require.ErrorIs(t, err, os.ErrClosed)
+
+	f, err = os.OpenFile(f.Name(), os.O_RDWR, 0600)
+	require.NoError(t, err)
+	idx, err = newIndex(f, 0, c)
+	require.NoError(t, err)
+	defer idx.Close()
+	require.Equal(t, int(c.Segment.MaxIndexBytes), len(idx.mmap))
+	off, pos, err := idx.Read(-1)
+	require.NoError(t, err)
+	require.Equal(t, uint32(9), off)
+	require.Equal(t, uint64(90), pos)
+}
@@ -0,0 +1,159 @@
+package log
+
+import (
+	api "github.com/phaseharry/distributed-log/serve-requests-with-grpc/api/v1"
+)
+
+/*
+RecordIterator walks a range of records in offset order, reading each record lazily as Next is called.
+
+	it, err := log.ReadRange(from, to)
+	for it.Next() {
+		record := it.Record()
+	}
+	if err := it.Err(); err != nil {}
+*/
+type RecordIterator interface {
+	// Next advances to the next record, returning false once the range is done or an error happened
+	Next() bool
+	// Record returns the record Next advanced to
+	Record() *api.Record
+	// Err returns the error that stopped the iterator, if any
+	Err() error
+}
+
+/*
+ReadRange returns an iterator over the records with offsets in [from, to). the log's lock is only held while
+the iterator is created: it takes a snapshot of the segments and how many records each of them has, then walks the
+segments' indexes directly instead of searching for the segment of every offset like repeated calls to Read would.
+- records appended after ReadRange returns aren't part of the range
+- a to past the end of the log stops at the newest record
+- returns ErrOffsetOutOfRange if there's no record at or after from
+- offloaded segments in the range are fetched from the remote object store up front
+*/
+func (l *Log) ReadRange(from, to uint64) (RecordIterator, error) {
+	if err := l.rlockFetched(from, to); err != nil {
+		return nil, err
+	}
+	defer l.mu.RUnlock()
+
+	last := l.segments[len(l.segments)-1]
+	if from < l.segments[0].baseOffset || from >= last.nextOffset {
+		return nil, api.ErrOffsetOutOfRange{Offset: from}
+	}
+
+	it := &rangeIterator{log: l, to: to}
+	for _, s := range l.segments {
+		if s.nextOffset <= from || to <= s.baseOffset {
+			continue
+		}
+		r, err := newSegmentRange(s)
+		if err != nil {
+			return nil, err
+		}
+		if s.baseOffset < from {
+			r.entry = s.index.search(uint32(from - s.baseOffset))
+		}
+		it.segments = append(it.segments, r)
+	}
+	return it, nil
+}
+
+type rangeIterator struct {
+	log      *Log
+	segments []segmentRange // segments left to walk, the first one is being walked now
+	to       uint64
+	record   *api.Record
+	err      error
+}
+
+/*
+the entries of a segment that are part of the range, entry is the position of the next one to read.
+holds on to the segment's store and index since they're unset if the segment is offloaded while it's being walked
+*/
+type segmentRange struct {
+	segment        *segment
+	store          *store
+	index          *index
+	entry, entries uint64
+}
+
+// opens the segment if it's cold, has to be called while holding the log's lock
+func newSegmentRange(s *segment) (segmentRange, error) {
+	if err := s.open(); err != nil {
+		return segmentRange{}, err
+	}
+	return segmentRange{
+		segment: s,
+		store:   s.store,
+		index:   s.index,
+		entries: s.index.len(),
+	}, nil
+}
+
+// calls fn with every record left in the range, it only reads the store and index it holds on to so it doesn't need the log's lock
+func (r segmentRange) forEach(fn func(*api.Record) error) error {
+	for ; r.entry < r.entries; r.entry++ {
+		_, pos, err := r.index.readEntry(r.entry)
+		if err != nil {
+			return err
+		}
+		p, err := r.store.Read(pos)
+		if err != nil {
+			return err
+		}
+		record, err := unmarshalRecord(p)
+		if err != nil {
+			return err
+		}
+		if err = fn(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (it *rangeIterator) Next() bool {
+	for it.err == nil && len(it.segments) > 0 {
+		cur := &it.segments[0]
+		if cur.entry >= cur.entries {
+			it.segments = it.segments[1:]
+			continue
+		}
+		off, pos, err := cur.index.readEntry(cur.entry)
+		if err != nil {
+			it.err = err
+			break
+		}
+		if cur.segment.baseOffset+uint64(off) >= it.to {
+			it.segments = nil
+			break
+		}
+		cur.entry++
+
+		p, err := cur.store.Read(pos)
+		if err != nil {
+			it.err = err
+			break
+		}
+		record, err := unmarshalRecord(p)
+		if err != nil {
+			it.err = err
+			break
+		}
+		if it.record, it.err = it.log.decrypt(record); it.err != nil {
+			break
+		}
+		return true
+	}
+	it.record = nil
+	return false
+}
+
+func (it *rangeIterator) Record() *api.Record {
+	return it.record
+}
+
+func (it *rangeIterator) Err() error {
+	return it.err
+}
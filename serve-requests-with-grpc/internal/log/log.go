@@ -1,15 +1,23 @@
 package log
 
 import (
+	"context"
+	"errors"
 	"io"
+	"math"
 	"os"
 	"path"
+	"runtime"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	api "github.com/phaseharry/distributed-log/serve-requests-with-grpc/api/v1"
+	"github.com/phaseharry/distributed-log/serve-requests-with-grpc/metrics"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
 )
 
 type Log struct {
@@ -18,8 +26,25 @@ type Log struct {
 	Config        Config
 	activeSegment *segment   // points to the current active segment that's being active written to
 	segments      []*segment // points to a list of segments that's still cataloged on disk and hasn't been fully processed yet. (used and then tossed)
+	annotations   *annotations
+	keys          *keystore   // data keys of encrypted records, nil when encryption isn't enabled
+	background    *background // periodic maintenance tasks like retention
+	spares        *spares     // segments created ahead of time for the log to roll over to
+	tier          *tier       // segments uploaded to the remote object store
+	producers     *producers  // last sequence appended by each idempotent producer
+	flushed       uint64      // records with lower offsets are synced to disk
+	watchers      *watchers   // subscribers waiting on records to be appended
+	genesis       Genesis
+	closed        bool // reads and appends fail with ErrClosed once the log is closed
+	// compactions build their copies without holding mu, so they're run one at a time
+	compacting sync.Mutex
+	// bumped by every truncation, a compaction that raced one can't tell whether the records it kept are still the latest
+	truncations uint64
 }
 
+// ErrClosed is returned by reads and appends of a log that was closed, ex. a topic that was deleted while it was read
+var ErrClosed = errors.New("log is closed")
+
 func NewLog(dir string, c Config) (*Log, error) {
 	if c.Segment.MaxStoreBytes == 0 {
 		c.Segment.MaxStoreBytes = 1024
@@ -27,56 +52,178 @@ func NewLog(dir string, c Config) (*Log, error) {
 	if c.Segment.MaxIndexBytes == 0 {
 		c.Segment.MaxIndexBytes = 1024
 	}
+	if c.Metrics == nil {
+		c.Metrics = metrics.Nop
+	}
+	if c.Logger == nil {
+		c.Logger = zap.NewNop()
+	}
 	l := &Log{
 		Dir:    dir,
 		Config: c,
 	}
-	return l, l.setup()
+	// a log that failed to open isn't returned, it was never fully set up so it couldn't be closed
+	if err := l.setup(); err != nil {
+		return nil, err
+	}
+	return l, nil
 }
 
 func (l *Log) setup() error {
+	l.closed = false
+	l.watchers = newWatchers()
+	if err := l.load(); err != nil {
+		return err
+	}
+	var err error
+	if l.spares, err = newSpares(l.Dir); err != nil {
+		l.unload()
+		return err
+	}
+	l.background = newBackground()
+	l.startRetention()
+	l.startCompaction()
+	l.startTiering()
+	l.startTrash()
+	return nil
+}
+
+// reads the segments and sidecar files in the log's directory into memory
+func (l *Log) load() error {
+	// checking the directory is this cluster's log before anything in it is touched
+	var err error
+	if l.genesis, err = loadGenesis(l.Dir, l.Config.ClusterID); err != nil {
+		return err
+	}
+	// finishing or rolling back a compaction that was interrupted before the segment files are read
+	if err := recoverCompaction(l.Dir); err != nil {
+		return err
+	}
 	files, err := os.ReadDir(l.Dir)
 	if err != nil {
 		return err
 	}
+	if l.annotations, err = newAnnotations(l.Dir); err != nil {
+		return err
+	}
+	if len(l.Config.Encryption.MasterKey) > 0 {
+		if l.keys, err = newKeystore(l.Dir, l.Config.Encryption.MasterKey); err != nil {
+			return err
+		}
+	}
+	if l.producers, err = newProducers(l.Dir); err != nil {
+		return err
+	}
+	if l.tier, err = newTier(l.Dir, l.Config.Tiering.Remote); err != nil {
+		return err
+	}
+
 	var baseOffsets []uint64
 	/*
 		reading segment directories on disk into memory and initializing
 		the index and store models. sorting it by offset so the oldest offsets
-		are at the front of the slice and the newest is at the back
+		are at the front of the slice and the newest is at the back.
+		every segment has a store, so segments are found by their stores and a segment whose index
+		is missing gets it rebuilt. skipping any other file (ex. the annotations sidecar)
 	*/
 	for _, file := range files {
-		offStr := strings.TrimSuffix(
-			file.Name(),
-			path.Ext(file.Name()),
-		)
-		off, _ := strconv.ParseUint(offStr, 10, 0)
+		if path.Ext(file.Name()) != ".store" {
+			continue
+		}
+		off, err := strconv.ParseUint(strings.TrimSuffix(file.Name(), ".store"), 10, 64)
+		if err != nil {
+			continue
+		}
 		baseOffsets = append(baseOffsets, off)
 	}
 	sort.Slice(baseOffsets, func(i, j int) bool {
 		return baseOffsets[i] < baseOffsets[j]
 	})
 
-	for i := 0; i < len(baseOffsets); i++ {
-		if err = l.newSegment(baseOffsets[i]); err != nil {
-			return err
-		}
-		i++
+	if l.segments, err = openSegments(l.Dir, baseOffsets, l.Config); err != nil {
+		return err
+	}
+	if len(l.segments) > 0 {
+		l.activeSegment = l.segments[len(l.segments)-1]
+	}
+	if err = l.loadTiered(); err != nil {
+		return err
 	}
 	/*
 		if there were no segments from a previous state, initialize a segment
 		so any new records to the log can be assigned to that segment
 	*/
-	if l.segments == nil {
+	if len(l.segments) == 0 {
 		if err = l.newSegment(
 			l.Config.Segment.InitialOffset,
 		); err != nil {
-			return nil
+			return err
+		}
+	}
+	// crashing right after the active segment was sealed leaves the log without a segment it can append to
+	if l.activeSegment.sealed {
+		if err = l.newSegment(l.activeSegment.nextOffset); err != nil {
+			return err
+		}
+	}
+	/*
+		sealing the closed segments so they don't hold on to write resources, which also builds the
+		key filters of the ones that don't have one (ex. written before filters existed)
+	*/
+	for _, s := range l.segments {
+		if s != l.activeSegment {
+			if err = s.Seal(); err != nil {
+				return err
+			}
 		}
 	}
+	// whatever was read back in from disk is already durable
+	l.flushed = l.activeSegment.nextOffset
 	return nil
 }
 
+/*
+opens the segments with the base offsets using a worker per CPU so logs with a lot of segments start quickly.
+sealed segments whose metadata matches their files are cold, their files are only opened when they're first read.
+the newest segment is always opened since it's the one the log appends to
+*/
+func openSegments(dir string, baseOffsets []uint64, c Config) ([]*segment, error) {
+	segments := make([]*segment, len(baseOffsets))
+	errs := make([]error, len(baseOffsets))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range min(runtime.GOMAXPROCS(0), len(baseOffsets)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				if i < len(baseOffsets)-1 {
+					if s, ok := newColdSegment(dir, baseOffsets[i], c); ok {
+						segments[i] = s
+						continue
+					}
+				}
+				segments[i], errs[i] = newSegment(dir, baseOffsets[i], c)
+			}
+		}()
+	}
+	for i := range baseOffsets {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		for _, s := range segments {
+			if s != nil {
+				s.Close()
+			}
+		}
+		return nil, err
+	}
+	return segments, nil
+}
+
 /*
 - creates a new segment with the passed-in offset value as its loweest offset
 - append the newly created segment to the segments slice
@@ -89,43 +236,239 @@ func (l *Log) newSegment(off uint64) error {
 	}
 	l.segments = append(l.segments, s)
 	l.activeSegment = s
+	l.logger().Debug("segment created", zap.Uint64("base_offset", off))
 	return nil
 }
 
+// the log's logger, with the log's directory
+func (l *Log) logger() *zap.Logger {
+	return l.Config.Logger.With(zap.String("dir", l.Dir))
+}
+
 func (l *Log) Append(record *api.Record) (uint64, error) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
+	return l.append(record)
+}
+
+// Validate returns the error appending the record would fail with for the record itself, ex. api.ErrRecordTooLarge
+func (l *Log) Validate(record *api.Record) error {
+	if max := l.Config.Segment.MaxRecordBytes; max > 0 {
+		if size := uint64(proto.Size(record)); size > max {
+			return api.ErrRecordTooLarge{Size: size, Max: max}
+		}
+	}
+	return nil
+}
+
+/*
+AppendIdempotent appends the record as the given sequence number of an idempotent producer, deduplicating retries.
+- the next sequence of the producer is appended like Append would
+- the producer's last sequence was already appended, so the offset it was appended at is returned without appending it again
+- any other sequence fails with api.ErrOutOfOrderSequence
+*/
+func (l *Log) AppendIdempotent(record *api.Record, producerID, sequence uint64) (uint64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	off, duplicate, err := l.producers.check(producerID, sequence)
+	if err != nil || duplicate {
+		return off, err
+	}
+	if off, err = l.append(record); err != nil {
+		return 0, err
+	}
+	return off, l.producers.Append(producerID, sequence, off)
+}
+
+// appends the record to the active segment, has to be called while holding the log's write lock
+func (l *Log) append(record *api.Record) (uint64, error) {
+	if l.closed {
+		return 0, ErrClosed
+	}
+	if err := l.Validate(record); err != nil {
+		return 0, err
+	}
+	/*
+		encrypting a copy of the record so the caller's value is left untouched. the record's data key
+		is stored before the record is appended so an appended record always has a key to decrypt it with
+	*/
+	if l.keys != nil {
+		value, err := l.keys.Seal(l.activeSegment.nextOffset, record.Value)
+		if err != nil {
+			return 0, err
+		}
+		encrypted := proto.Clone(record).(*api.Record)
+		encrypted.Value = value
+		defer func() { record.Offset = encrypted.Offset }()
+		record = encrypted
+	}
 
 	/*
 		add new record to current segment and if it has hit maxSize
 		after this insert, create a new segment and assign it as the activeSegment
 		if the current activeSegment is maxed out
 	*/
+	start, written := time.Now(), l.activeSegment.store.size
 	off, err := l.activeSegment.Append(record)
 	if err != nil {
 		return 0, err
 	}
+	l.Config.Metrics.Add("log_bytes_written_total", float64(l.activeSegment.store.size-written), "dir", l.Dir)
+	l.Config.Metrics.Set("log_index_bytes", float64(l.activeSegment.index.size), "dir", l.Dir)
+	l.watchers.notify(off)
+	/*
+		segments are synced before the log rolls over from them, they're never written to again
+		so everything before the new active segment is durable
+	*/
+	if l.Config.Segment.Fsync || l.activeSegment.IsMaxed() {
+		if err = l.sync(); err != nil {
+			return 0, err
+		}
+	}
 	if l.activeSegment.IsMaxed() {
-		err = l.newSegment(off + 1)
+		if err = l.activeSegment.Seal(); err != nil {
+			return 0, err
+		}
+		err = l.roll(off + 1)
+		l.Config.Metrics.Add("log_segment_rolls_total", 1, "dir", l.Dir)
+	} else {
+		l.preallocate()
 	}
+	l.Config.Metrics.Observe("log_append_seconds", time.Since(start).Seconds(), "dir", l.Dir)
 	return off, err
 }
 
-func (l *Log) Read(off uint64) (*api.Record, error) {
+/*
+AppendSync appends the record like Append but only returns once the record is flushed and fsynced to disk,
+so the returned offset survives the machine crashing. Append acknowledges records once they're buffered
+*/
+func (l *Log) AppendSync(record *api.Record) (uint64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	off, err := l.append(record)
+	if err != nil {
+		return 0, err
+	}
+	if l.flushed <= off {
+		err = l.sync()
+	}
+	return off, err
+}
+
+/*
+AppendBatch appends the records under a single acquisition of the log's lock, so they're assigned consecutive
+offsets starting from the returned one with no other records in between. if appending one of them fails
+the records before it stay appended and the offset of the first one is returned along with the error
+*/
+func (l *Log) AppendBatch(records []*api.Record) (uint64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	base := l.activeSegment.nextOffset
+	for _, record := range records {
+		if _, err := l.append(record); err != nil {
+			return base, err
+		}
+	}
+	return base, nil
+}
+
+// Sync flushes and fsyncs every record appended so far
+func (l *Log) Sync() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.sync()
+}
+
+/*
+syncs the active segment with the data keys of its records and the producers' sequences, has to be called while
+holding the log's write lock. the segments before the active one were synced when the log rolled over from them
+*/
+func (l *Log) sync() error {
+	if l.closed {
+		return ErrClosed
+	}
+	if l.keys != nil {
+		if err := l.keys.Sync(); err != nil {
+			return err
+		}
+	}
+	// a durable retry has to find its sequence after a crash or it's appended twice
+	if err := l.producers.Sync(); err != nil {
+		return err
+	}
+	if err := l.activeSegment.Sync(); err != nil {
+		return err
+	}
+	l.flushed = l.activeSegment.nextOffset
+	return nil
+}
+
+/*
+CheckWritable creates and removes a file in the log's directory, failing if the disk the log is on can't be
+written to (ex. it's full or was remounted read-only) before an append would
+*/
+func (l *Log) CheckWritable() error {
+	f, err := os.CreateTemp(l.Dir, ".writable-*")
+	if err != nil {
+		return err
+	}
+	name := f.Name()
+	if _, err = f.Write([]byte{0}); err == nil {
+		err = f.Sync()
+	}
+	f.Close()
+	if rerr := os.Remove(name); err == nil {
+		err = rerr
+	}
+	return err
+}
+
+/*
+FlushedOffset returns the offset that every record before is durable on disk. records at or past it were
+appended but may still be buffered, and can be lost if the machine crashes before they're synced
+*/
+func (l *Log) FlushedOffset() uint64 {
 	l.mu.RLock()
 	defer l.mu.RUnlock()
-	var s *segment
-	/*
-		given an offset, find the segment that the offset belongs in.
-		ie. it must be less than or equal to a segments baseOffset but
-		less than its nextOffset value
-	*/
-	for _, segment := range l.segments {
-		if segment.baseOffset <= off && off < segment.nextOffset {
-			s = segment
-			break
+	return l.flushed
+}
+
+func (l *Log) Read(off uint64) (*api.Record, error) {
+	return l.ReadContext(context.Background(), off)
+}
+
+/*
+ReadContext reads the record at the offset like Read, but gives up once ctx is done. the context is checked
+before the record is read and fetching an offloaded segment from the remote object store is cancelled with it,
+so a consumer that went away doesn't keep the log busy downloading a segment for it
+*/
+func (l *Log) ReadContext(ctx context.Context, off uint64) (*api.Record, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	l.mu.RLock()
+	if l.closed {
+		l.mu.RUnlock()
+		return nil, ErrClosed
+	}
+	s, off := l.find(off)
+	// an offloaded segment has to be fetched from the remote object store before it can be read
+	for s != nil && s.remote {
+		l.mu.RUnlock()
+		if err := l.fetch(ctx, s); err != nil {
+			return nil, err
 		}
+		l.mu.RLock()
+		if l.closed {
+			l.mu.RUnlock()
+			return nil, ErrClosed
+		}
+		s, off = l.find(off)
 	}
+	defer l.mu.RUnlock()
 	// throw error if we can't find the segment based on the offset
 	if s == nil || s.nextOffset <= off {
 		return nil, api.ErrOffsetOutOfRange{Offset: off}
@@ -135,24 +478,147 @@ func (l *Log) Read(off uint64) (*api.Record, error) {
 	   for that offset to get the location of the actual record and use that location
 	   to look the record up in the store
 	*/
-	return s.Read(off)
+	record, err := s.Read(off)
+	if err != nil {
+		return nil, err
+	}
+	return l.decrypt(record)
 }
 
-// closes all segments, but its data is still stored on disk
+/*
+given an offset, find the segment that the offset belongs in.
+ie. it must be less than or equal to a segments baseOffset but
+less than its nextOffset value. returns the offset to read from the segment
+*/
+func (l *Log) find(off uint64) (*segment, uint64) {
+	for _, segment := range l.segments {
+		if segment.baseOffset <= off && off < segment.nextOffset {
+			return segment, off
+		}
+		/*
+			compaction can drop the newest records of a segment or whole segments, leaving gaps
+			between segments. an offset inside one of those gaps reads the next record that's still in the log
+		*/
+		if off >= l.segments[0].baseOffset && off < segment.baseOffset && segment.baseOffset < segment.nextOffset {
+			return segment, segment.baseOffset
+		}
+	}
+	return nil, off
+}
+
+/*
+decrypts the value of a record read from a segment when encryption is enabled.
+a redacted record is returned without its value, its annotations will show that it was redacted
+*/
+func (l *Log) decrypt(record *api.Record) (*api.Record, error) {
+	if l.keys == nil {
+		return record, nil
+	}
+	var err error
+	record.Value, err = l.keys.Open(record.Offset, record.Value)
+	if err == errRedacted {
+		return record, nil
+	}
+	return record, err
+}
+
+/*
+Redact makes the record at the given offset permanently unreadable by deleting the data key its value
+was encrypted with (crypto-shredding), without rewriting the segment it's stored in. the redaction is
+recorded by annotating the record as redacted. only records appended while encryption was enabled can be redacted.
+*/
+func (l *Log) Redact(off uint64) error {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if l.keys == nil {
+		return ErrEncryptionDisabled
+	}
+	if !l.contains(off) {
+		return api.ErrOffsetOutOfRange{Offset: off}
+	}
+	if err := l.keys.Redact(off); err != nil {
+		return err
+	}
+	_, err := l.annotations.Annotate(off, api.Annotation_ANNOTATION_REDACTED)
+	return err
+}
+
+/*
+Annotate attaches an annotation to an existing record without rewriting it. the annotation
+is stored in the log's annotations sidecar and returns every annotation the record now has.
+*/
+func (l *Log) Annotate(off uint64, annotation api.Annotation) ([]api.Annotation, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if !l.contains(off) {
+		return nil, api.ErrOffsetOutOfRange{Offset: off}
+	}
+	return l.annotations.Annotate(off, annotation)
+}
+
+// Annotations returns the annotations attached to the record at the given offset
+func (l *Log) Annotations(off uint64) ([]api.Annotation, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if !l.contains(off) {
+		return nil, api.ErrOffsetOutOfRange{Offset: off}
+	}
+	return l.annotations.Get(off), nil
+}
+
+// reports whether a record with the given offset exists in one of the log's segments
+func (l *Log) contains(off uint64) bool {
+	for _, segment := range l.segments {
+		if segment.baseOffset <= off && off < segment.nextOffset {
+			return true
+		}
+	}
+	return false
+}
+
+// closes all segments, but its data is still stored on disk. closing a log that's already closed returns ErrClosed
 func (l *Log) Close() error {
+	l.background.stop()
+	l.watchers.close()
+
 	l.mu.Lock()
 	defer l.mu.Unlock()
+
+	if l.closed {
+		return ErrClosed
+	}
+	if err := l.removeSpares(); err != nil {
+		return err
+	}
+	l.closed = true
+	return l.unload()
+}
+
+// closes the segments and sidecar files that were read in by load
+func (l *Log) unload() error {
 	for _, segment := range l.segments {
 		if err := segment.Close(); err != nil {
 			return err
 		}
 	}
-	return nil
+	if l.keys != nil {
+		if err := l.keys.Close(); err != nil {
+			return err
+		}
+	}
+	if err := l.producers.Close(); err != nil {
+		return err
+	}
+	return l.annotations.Close()
 }
 
 // closes all segments and remove all of its data from disk. Assuming that it will be called when all data is processed
 func (l *Log) Remove() error {
-	if err := l.Close(); err != nil {
+	// a log that was closed already still has its data removed
+	if err := l.Close(); err != nil && !errors.Is(err, ErrClosed) {
 		return err
 	}
 	return os.RemoveAll(l.Dir)
@@ -190,9 +656,10 @@ func (l *Log) HighestOffset() (uint64, error) {
 
 /*
 truncate removes all segments whose highestOffset value is lower
-than the passed in lowest value. It will delete the segments disk files.
+than or equal to the passed in lowest value. It will delete the segments disk files.
 This is done because we don't have infinite disk space and hopefully by
-the time of Truncate, the records in those segments were processed already
+the time of Truncate, the records in those segments were processed already.
+only whole segments are removed, TruncateBefore and TruncateAfter cut the log at an exact offset
 */
 func (l *Log) Truncate(lowest uint64) error {
 	l.mu.Lock()
@@ -200,7 +667,7 @@ func (l *Log) Truncate(lowest uint64) error {
 	var segments []*segment
 	for _, s := range l.segments {
 		if s.nextOffset <= lowest+1 {
-			if err := s.Remove(); err != nil {
+			if err := l.removeSegment(s); err != nil {
 				return err
 			}
 			continue
@@ -208,6 +675,136 @@ func (l *Log) Truncate(lowest uint64) error {
 		segments = append(segments, s)
 	}
 	l.segments = segments
+	l.logger().Debug("log truncated", zap.Uint64("lowest", lowest))
+	return nil
+}
+
+/*
+TruncateBefore removes every record with an offset lower than offset so offset becomes the log's lowest offset.
+- segments with only lower offsets are removed
+- the segment the cut falls in is rewritten starting at offset, ex. truncating before 5 in a segment with
+offsets 3 to 7 leaves a segment with offsets 5 to 7
+- offsets are never reused, cutting past the highest offset leaves an empty log that appends at the offset
+it would have appended at next
+offloaded segments the cut falls in are fetched first so they can be rewritten.
+*/
+func (l *Log) TruncateBefore(offset uint64) error {
+	return l.truncate("before", offset, func() (*segment, error) {
+		next := l.activeSegment.nextOffset
+		offset := min(offset, next)
+		for _, s := range l.segments {
+			if s.remote && s.baseOffset < offset && offset < s.nextOffset {
+				return s, nil
+			}
+		}
+		var segments []*segment
+		for i, s := range l.segments {
+			var err error
+			switch {
+			case s.baseOffset >= offset:
+				segments = append(segments, s)
+				continue
+			case s.nextOffset <= offset:
+				err = l.removeSegment(s)
+			default:
+				if s, err = l.rewriteSegment(s, offset, func(record *api.Record) bool {
+					return record.Offset >= offset
+				}); err == nil && s != nil {
+					segments = append(segments, s)
+				}
+			}
+			if err != nil {
+				l.segments = append(segments, l.segments[i+1:]...)
+				return nil, err
+			}
+		}
+		l.segments = segments
+		return nil, l.replaceActive(next)
+	})
+}
+
+/*
+TruncateAfter removes every record with an offset higher than offset so the next record appended is given offset+1.
+- segments with only higher offsets are removed
+- the segment the cut falls in is rewritten without the higher offsets and sealed, the log appends to a new segment
+starting at offset+1 afterwards
+- cutting below the lowest offset removes every record
+offloaded segments the cut falls in are fetched first so they can be rewritten. the sidecar files aren't rolled
+back, so annotations of truncated offsets carry over to the records appended at them and a producer that retries
+a sequence that was truncated away gets its old offset back.
+*/
+func (l *Log) TruncateAfter(offset uint64) error {
+	return l.truncate("after", offset, func() (*segment, error) {
+		next := l.activeSegment.nextOffset
+		if next == 0 || offset >= next-1 {
+			return nil, nil
+		}
+		cut := offset + 1
+		for _, s := range l.segments {
+			if s.remote && s.baseOffset < cut && cut < s.nextOffset {
+				return s, nil
+			}
+		}
+		var segments []*segment
+		for i, s := range l.segments {
+			var err error
+			switch {
+			case s.nextOffset <= cut:
+				segments = append(segments, s)
+				continue
+			case s.baseOffset >= cut:
+				err = l.removeSegment(s)
+			default:
+				if s, err = l.rewriteSegment(s, s.baseOffset, func(record *api.Record) bool {
+					return record.Offset < cut
+				}); err == nil && s != nil {
+					segments = append(segments, s)
+				}
+			}
+			if err != nil {
+				l.segments = append(segments, l.segments[i+1:]...)
+				return nil, err
+			}
+		}
+		l.segments = segments
+		return nil, l.replaceActive(cut)
+	})
+}
+
+/*
+runs a truncation while holding the log's write lock. the truncation returns the offloaded segment the cut falls in
+when it has to be fetched before it can be rewritten, in which case the segment is fetched without holding
+the lock and the truncation is run again. side is which side of the offset was cut, for the debug event
+*/
+func (l *Log) truncate(side string, offset uint64, fn func() (*segment, error)) error {
+	for {
+		l.mu.Lock()
+		l.truncations++
+		remote, err := fn()
+		l.mu.Unlock()
+		if err != nil {
+			return err
+		}
+		if remote == nil {
+			l.logger().Debug("log truncated", zap.Uint64(side, offset))
+			return nil
+		}
+		if err = l.fetch(context.Background(), remote); err != nil {
+			return err
+		}
+	}
+}
+
+// starts a new active segment at off if a truncation removed or rewrote the active one
+func (l *Log) replaceActive(off uint64) error {
+	if len(l.segments) > 0 && l.segments[len(l.segments)-1] == l.activeSegment {
+		return nil
+	}
+	if err := l.newSegment(off); err != nil {
+		return err
+	}
+	// the records left in the log are in segments that were closed, so they're already durable
+	l.flushed = off
 	return nil
 }
 
@@ -218,12 +815,18 @@ originReader satisfies the io.Reader interface
 - each segment is turned into a io.Reader interface compatibile struct and then merged into the io.MultiReader interface for the log as a whole
 - io.Reader -> io.MultiReader interface usage to ensure we start reading with the lowest offset segment to the highest offset segment (ordered) and
 that the whole file is read
+- offloaded segments are fetched first, the returned reader fails with the error if one of them can't be
 */
 func (l *Log) Reader() io.Reader {
-	l.mu.RLock()
+	if err := l.rlockFetched(0, math.MaxUint64); err != nil {
+		return errReader{err}
+	}
 	defer l.mu.RUnlock()
 	readers := make([]io.Reader, len(l.segments))
 	for i, segment := range l.segments {
+		if err := segment.open(); err != nil {
+			return errReader{err}
+		}
 		readers[i] = &originReader{segment.store, 0}
 	}
 	return io.MultiReader(readers...)
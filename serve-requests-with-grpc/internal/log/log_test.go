@@ -1,12 +1,24 @@
 package log
 
 import (
+	"bytes"
+	"context"
+	"fmt"
 	"io"
 	"os"
+	"path"
+	"sync"
 	"testing"
+	"time"
 
 	api "github.com/phaseharry/distributed-log/serve-requests-with-grpc/api/v1"
+	"github.com/phaseharry/distributed-log/serve-requests-with-grpc/metrics"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
 )
 
@@ -20,6 +32,42 @@ func TestLog(t *testing.T) {
 		"init with existing segments":          testInitExisting,
 		"reader":                               testReader,
 		"truncate":                             testTruncate,
+		"truncate before":                      testTruncateBefore,
+		"truncate after":                       testTruncateAfter,
+		"annotate":                             testAnnotate,
+		"retention by size":                    testRetentionMaxBytes,
+		"retention by age":                     testRetentionMaxAge,
+		"retention by record count":            testRetentionMaxRecords,
+		"retention in the background":          testRetentionBackground,
+		"compaction":                           testCompaction,
+		"compaction alongside appends":         testCompactionConcurrent,
+		"compaction raced by a truncation":     testCompactionTruncated,
+		"compaction doesn't block appends":     testCompactionUnlocked,
+		"compaction recovery":                  testCompactionRecovery,
+		"redaction":                            testRedact,
+		"read range":                           testReadRange,
+		"preallocate segments":                 testPreallocate,
+		"snapshot and restore":                 testSnapshotRestore,
+		"snapshot of an encrypted log":         testSnapshotEncrypted,
+		"restore corrupted snapshot":           testRestoreCorrupted,
+		"tiered storage":                       testTiering,
+		"tiered fetch":                         testTieringFetch,
+		"idempotent append":                    testAppendIdempotent,
+		"durable append":                       testAppendSync,
+		"batch append":                         testAppendBatch,
+		"read packed":                          testReadPacked,
+		"trash":                                testTrash,
+		"trash of truncations":                 testTrashTruncated,
+		"lookup key":                           testLookupKey,
+		"segment metadata":                     testSegmentMeta,
+		"cold segments":                        testColdSegments,
+		"watch":                                testWatch,
+		"genesis":                              testGenesis,
+		"record errors":                        testRecordErrors,
+		"metrics":                              testMetrics,
+		"storage events":                       testStorageEvents,
+		"read after close":                     testReadAfterClose,
+		"close twice":                          testCloseTwice,
 	} {
 		t.Run(scenario, func(t *testing.T) {
 			dir, err := os.MkdirTemp("", "store-test")
@@ -27,7 +75,8 @@ func TestLog(t *testing.T) {
 			defer os.RemoveAll(dir)
 
 			c := Config{}
-			c.Segment.MaxStoreBytes = 32
+			// 2 records fit in a segment past the store's header
+			c.Segment.MaxStoreBytes = storeHeaderWidth + 32
 			log, err := NewLog(dir, c)
 			require.NoError(t, err)
 
@@ -60,6 +109,110 @@ func testOutOfRangeErr(t *testing.T, log *Log) {
 	require.Equal(t, uint64(1), apiErr.Offset)
 }
 
+// testing that a closed log fails reads and appends instead of reading its released index
+func testReadAfterClose(t *testing.T, log *Log) {
+	for i := 0; i < 3; i++ {
+		_, err := log.Append(&api.Record{Value: []byte("hello world")})
+		require.NoError(t, err)
+	}
+	require.NoError(t, log.Close())
+
+	_, err := log.Read(0)
+	require.ErrorIs(t, err, ErrClosed)
+	_, err = log.ReadRange(0, 3)
+	require.ErrorIs(t, err, ErrClosed)
+	_, err = log.Append(&api.Record{Value: []byte("hello world")})
+	require.ErrorIs(t, err, ErrClosed)
+
+	// the segments' indexes fail reads the same way for readers that got to them before the log was closed
+	_, _, err = log.segments[0].index.Read(0)
+	require.ErrorIs(t, err, os.ErrClosed)
+	_, _, err = log.segments[0].index.Find(0)
+	require.ErrorIs(t, err, os.ErrClosed)
+}
+
+// testing that closing a log a second time returns an error instead of stopping its background tasks again
+func testCloseTwice(t *testing.T, log *Log) {
+	_, err := log.Append(&api.Record{Value: []byte("hello world")})
+	require.NoError(t, err)
+	require.NoError(t, log.Close())
+	require.ErrorIs(t, log.Close(), ErrClosed)
+
+	// its data can still be removed once it's closed
+	require.NoError(t, log.Remove())
+	_, err = os.Stat(log.Dir)
+	require.True(t, os.IsNotExist(err))
+}
+
+func testRecordErrors(t *testing.T, log *Log) {
+	// records bigger than the limit are rejected before anything is stored
+	log.Config.Segment.MaxRecordBytes = 8
+	_, err := log.Append(&api.Record{Value: []byte("hello world")})
+	var tooLarge api.ErrRecordTooLarge
+	require.ErrorAs(t, err, &tooLarge)
+	require.Equal(t, uint64(8), tooLarge.Max)
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	off, err := log.Append(&api.Record{Value: []byte("hey")})
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), off)
+
+	// damaging the stored record's bytes fails the read with ErrCorrupt instead of returning a bad record
+	require.NoError(t, log.Sync())
+	f, err := os.OpenFile(path.Join(log.Dir, "0.store"), os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.WriteAt([]byte{0xff, 0xff, 0xff}, storeHeaderWidth+lenWidth)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	_, err = log.Read(off)
+	var corrupt api.ErrCorrupt
+	require.ErrorAs(t, err, &corrupt)
+	require.Equal(t, off, corrupt.Offset)
+	require.Equal(t, codes.DataLoss, status.Code(err))
+
+	// reading past the end of the log is OutOfRange
+	_, err = log.Read(1)
+	require.Equal(t, codes.OutOfRange, status.Code(err))
+}
+
+func testMetrics(t *testing.T, log *Log) {
+	registry := metrics.NewRegistry()
+	log.Config.Metrics = registry
+	// 2 records fit in a segment, so the log rolls over once the second is appended
+	for range 3 {
+		_, err := log.Append(&api.Record{Value: []byte("hello world")})
+		require.NoError(t, err)
+	}
+	require.Equal(t, float64(1), registry.Value("log_segment_rolls_total", "dir", log.Dir))
+	var written uint64
+	for _, s := range log.segments {
+		written += s.store.size - storeHeaderWidth
+	}
+	require.Equal(t, float64(written), registry.Value("log_bytes_written_total", "dir", log.Dir))
+	require.Equal(t, float64(log.activeSegment.index.size), registry.Value("log_index_bytes", "dir", log.Dir))
+	require.Greater(t, registry.Value("log_append_seconds", "dir", log.Dir), float64(0))
+}
+
+func testStorageEvents(t *testing.T, log *Log) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	log.Config.Logger = zap.New(core)
+	// 2 records fit in a segment, so the log rolls over to a new segment once the second is appended
+	for range 3 {
+		_, err := log.Append(&api.Record{Value: []byte("hello world")})
+		require.NoError(t, err)
+	}
+	require.NoError(t, log.TruncateBefore(2))
+
+	var messages []string
+	for _, entry := range logs.All() {
+		require.Equal(t, log.Dir, entry.ContextMap()["dir"])
+		messages = append(messages, entry.Message)
+	}
+	require.Equal(t, []string{"segment created", "segment removed", "log truncated"}, messages)
+	require.Equal(t, uint64(2), logs.All()[0].ContextMap()["base_offset"])
+	require.Equal(t, uint64(0), logs.All()[1].ContextMap()["base_offset"])
+	require.Equal(t, uint64(2), logs.All()[2].ContextMap()["before"])
+}
+
 func testInitExisting(t *testing.T, log *Log) {
 	append := &api.Record{
 		Value: []byte("hello world"),
@@ -107,8 +260,9 @@ func testReader(t *testing.T, log *Log) {
 	b, err := io.ReadAll(reader)
 	require.NoError(t, err)
 
+	// the store starts with its header and each stored record is prefixed with its length and the codec it was compressed with
 	read := &api.Record{}
-	err = proto.Unmarshal(b[lenWidth:], read)
+	err = proto.Unmarshal(b[storeHeaderWidth+lenWidth+codecWidth:], read)
 	require.NoError(t, err)
 	require.Equal(t, append.Value, read.Value)
 }
@@ -132,3 +286,1278 @@ func testTruncate(t *testing.T, log *Log) {
 	_, err = log.Read(0)
 	require.Error(t, err)
 }
+
+/*
+tests that truncating before an offset that falls mid segment splits the segment so the offset becomes the
+lowest one, and that a split that crashed after it was committed removes the segments before it on reload
+*/
+func testTruncateBefore(t *testing.T, log *Log) {
+	for range 5 {
+		_, err := log.Append(&api.Record{Value: []byte("hello world")})
+		require.NoError(t, err)
+	}
+	require.NoError(t, log.Close())
+
+	// truncating a copy of the log to get the split segment's files
+	dir, err := os.MkdirTemp("", "truncate-before-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"0.store", "0.index", "2.store", "2.index", "4.store", "4.index"} {
+		copyFile(t, path.Join(log.Dir, name), path.Join(dir, name))
+	}
+	truncated, err := NewLog(dir, log.Config)
+	require.NoError(t, err)
+	require.NoError(t, truncated.TruncateBefore(3))
+	lowest, err := truncated.LowestOffset()
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), lowest)
+	_, err = truncated.Read(2)
+	require.Error(t, err)
+	read, err := truncated.Read(3)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), read.Offset)
+	require.NoError(t, truncated.Close())
+
+	// the split crashed after the swap was committed, before the original segments were removed
+	copyFile(t, path.Join(dir, "3.store"), path.Join(log.Dir, "3.store"+swapSuffix))
+	copyFile(t, path.Join(dir, "3.index"), path.Join(log.Dir, "3.index"+swapSuffix))
+	log, err = NewLog(log.Dir, log.Config)
+	require.NoError(t, err)
+	lowest, err = log.LowestOffset()
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), lowest)
+	highest, err := log.HighestOffset()
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), highest)
+	for _, name := range []string{"0.store", "2.store"} {
+		_, err = os.Stat(path.Join(log.Dir, name))
+		require.True(t, os.IsNotExist(err))
+	}
+
+	// truncating past the highest offset empties the log without reusing offsets
+	require.NoError(t, log.TruncateBefore(10))
+	_, err = log.Read(4)
+	require.Error(t, err)
+	off, err := log.Append(&api.Record{Value: []byte("hello world")})
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), off)
+	lowest, err = log.LowestOffset()
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), lowest)
+}
+
+/*
+tests that truncating after an offset that falls mid segment rewrites the segment without the higher offsets
+and that the log appends right after the cut, including once it's reopened
+*/
+func testTruncateAfter(t *testing.T, log *Log) {
+	for range 5 {
+		_, err := log.Append(&api.Record{Value: []byte("hello world")})
+		require.NoError(t, err)
+	}
+	// nothing is past the highest offset
+	require.NoError(t, log.TruncateAfter(4))
+	require.NoError(t, log.TruncateAfter(2))
+
+	highest, err := log.HighestOffset()
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), highest)
+	_, err = log.Read(3)
+	require.Error(t, err)
+	read, err := log.Read(2)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), read.Offset)
+	require.Equal(t, uint64(3), log.FlushedOffset())
+
+	off, err := log.Append(&api.Record{Value: []byte("hello again")})
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), off)
+	require.NoError(t, log.Close())
+
+	log, err = NewLog(log.Dir, log.Config)
+	require.NoError(t, err)
+	defer log.Close()
+	read, err = log.Read(3)
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello again"), read.Value)
+	_, err = log.Read(4)
+	require.Error(t, err)
+}
+
+/*
+tests that records can be annotated after they've been appended and that
+the annotations survive the log being reopened
+*/
+func testAnnotate(t *testing.T, log *Log) {
+	off, err := log.Append(&api.Record{
+		Value: []byte("hello world"),
+	})
+	require.NoError(t, err)
+
+	annotations, err := log.Annotations(off)
+	require.NoError(t, err)
+	require.Empty(t, annotations)
+
+	_, err = log.Annotate(off, api.Annotation_ANNOTATION_PROCESSED)
+	require.NoError(t, err)
+	// annotating a record with an annotation it already has shouldn't duplicate it
+	_, err = log.Annotate(off, api.Annotation_ANNOTATION_PROCESSED)
+	require.NoError(t, err)
+	annotations, err = log.Annotate(off, api.Annotation_ANNOTATION_POISONED)
+	require.NoError(t, err)
+	want := []api.Annotation{
+		api.Annotation_ANNOTATION_PROCESSED,
+		api.Annotation_ANNOTATION_POISONED,
+	}
+	require.Equal(t, want, annotations)
+
+	// records that don't exist can't be annotated
+	_, err = log.Annotate(off+1, api.Annotation_ANNOTATION_PROCESSED)
+	apiErr := err.(api.ErrOffsetOutOfRange)
+	require.Equal(t, off+1, apiErr.Offset)
+
+	require.NoError(t, log.Close())
+	newLog, err := NewLog(log.Dir, log.Config)
+	require.NoError(t, err)
+
+	annotations, err = newLog.Annotations(off)
+	require.NoError(t, err)
+	require.Equal(t, want, annotations)
+
+	// the sidecar file shouldn't be mistaken for a segment when the log is set up
+	require.Equal(t, 1, len(newLog.segments))
+}
+
+// appends records until the log has rolled over to at least the given number of segments
+func appendSegments(t *testing.T, log *Log, n int) {
+	t.Helper()
+	for len(log.segments) < n {
+		_, err := log.Append(&api.Record{
+			Value: []byte("hello world"),
+		})
+		require.NoError(t, err)
+	}
+}
+
+/*
+tests that the oldest segments are removed once the log grows past Retention.MaxBytes
+and that the active segment is always kept
+*/
+func testRetentionMaxBytes(t *testing.T, log *Log) {
+	appendSegments(t, log, 3)
+
+	// no policy configured so nothing should be removed
+	require.NoError(t, log.EnforceRetention())
+	require.Equal(t, 3, len(log.segments))
+
+	log.Config.Retention.MaxBytes = log.activeSegment.Size() + log.segments[1].Size()
+	require.NoError(t, log.EnforceRetention())
+	require.Equal(t, 2, len(log.segments))
+
+	_, err := log.Read(0)
+	require.Error(t, err)
+
+	log.Config.Retention.MaxBytes = 1
+	require.NoError(t, log.EnforceRetention())
+	require.Equal(t, 1, len(log.segments))
+
+	off, err := log.LowestOffset()
+	require.NoError(t, err)
+	require.Equal(t, log.activeSegment.baseOffset, off)
+}
+
+// tests that segments are removed once their newest record is older than Retention.MaxAge
+func testRetentionMaxAge(t *testing.T, log *Log) {
+	appendSegments(t, log, 3)
+
+	log.Config.Retention.MaxAge = time.Hour
+	require.NoError(t, log.EnforceRetention())
+	require.Equal(t, 3, len(log.segments))
+
+	// pretending the oldest segment was last written to two hours ago
+	log.segments[0].modTime = time.Now().Add(-2 * time.Hour)
+	require.NoError(t, log.EnforceRetention())
+	require.Equal(t, 2, len(log.segments))
+}
+
+// tests that the oldest segments are removed once the log holds more than Retention.MaxRecords records
+func testRetentionMaxRecords(t *testing.T, log *Log) {
+	// segments are big enough that only MaxRecords rolls them
+	c := log.Config
+	c.Segment.MaxStoreBytes = 1024
+	c.Segment.MaxRecords = 3
+	require.NoError(t, log.Close())
+	log, err := NewLog(log.Dir, c)
+	require.NoError(t, err)
+	defer log.Close()
+
+	for range 7 {
+		_, err = log.Append(&api.Record{Value: []byte("hello world")})
+		require.NoError(t, err)
+	}
+	require.Equal(t, 3, len(log.segments))
+
+	log.Config.Retention.MaxRecords = 4
+	require.NoError(t, log.EnforceRetention())
+	require.Equal(t, 2, len(log.segments))
+	off, err := log.LowestOffset()
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), off)
+}
+
+// tests that the retention policies are enforced on a ticker without being called
+func testRetentionBackground(t *testing.T, log *Log) {
+	c := log.Config
+	c.Retention.MaxBytes = 1
+	c.Retention.CheckInterval = 10 * time.Millisecond
+	require.NoError(t, log.Close())
+
+	log, err := NewLog(log.Dir, c)
+	require.NoError(t, err)
+	defer log.Close()
+
+	for range 6 {
+		_, err := log.Append(&api.Record{
+			Value: []byte("hello world"),
+		})
+		require.NoError(t, err)
+	}
+	require.Eventually(t, func() bool {
+		log.mu.RLock()
+		defer log.mu.RUnlock()
+		return len(log.segments) == 1
+	}, time.Second, 10*time.Millisecond)
+}
+
+/*
+appends keyed records so that (with 2 records per segment) the log ends up with
+segments [0:a 1:b] [2:a 3:c] [4:b 5:a] and an empty active segment
+*/
+func appendKeyed(t *testing.T, log *Log) {
+	t.Helper()
+	for i, key := range []string{"a", "b", "a", "c", "b", "a"} {
+		_, err := log.Append(&api.Record{
+			Key:   []byte(key),
+			Value: []byte(fmt.Sprintf("value %d", i)),
+		})
+		require.NoError(t, err)
+	}
+	require.Equal(t, 4, len(log.segments))
+}
+
+/*
+tests that compaction keeps only the latest record for each key, drops segments left
+without any records, and that offsets that were compacted away read the next record
+*/
+func testCompaction(t *testing.T, log *Log) {
+	appendKeyed(t, log)
+	require.NoError(t, log.Compact())
+	require.Equal(t, 3, len(log.segments))
+
+	check := func(log *Log) {
+		off, err := log.LowestOffset()
+		require.NoError(t, err)
+		require.Equal(t, uint64(2), off)
+
+		_, err = log.Read(0)
+		require.Error(t, err)
+
+		for off, want := range map[uint64]uint64{2: 3, 3: 3, 4: 4, 5: 5} {
+			read, err := log.Read(off)
+			require.NoError(t, err)
+			require.Equal(t, want, read.Offset)
+			require.Equal(t, []byte(fmt.Sprintf("value %d", want)), read.Value)
+		}
+	}
+	check(log)
+
+	// compacting again with nothing superseded leaves the log as is
+	require.NoError(t, log.Compact())
+	check(log)
+
+	require.NoError(t, log.Close())
+	newLog, err := NewLog(log.Dir, log.Config)
+	require.NoError(t, err)
+	check(newLog)
+
+	off, err := newLog.Append(&api.Record{Key: []byte("a")})
+	require.NoError(t, err)
+	require.Equal(t, uint64(6), off)
+}
+
+// tests that appends and reads carry on while the log is compacted, and that the latest record of each key is kept
+func testCompactionConcurrent(t *testing.T, log *Log) {
+	keys := []string{"a", "b", "c"}
+	done := make(chan error)
+	go func() {
+		for i := 0; i < 100; i++ {
+			if _, err := log.Append(&api.Record{
+				Key:   []byte(keys[i%len(keys)]),
+				Value: []byte(fmt.Sprintf("value %d", i)),
+			}); err != nil {
+				done <- err
+				return
+			}
+			if _, err := log.Read(uint64(i)); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+	for compacting := true; compacting; {
+		select {
+		case err := <-done:
+			require.NoError(t, err)
+			compacting = false
+		default:
+		}
+		require.NoError(t, log.Compact())
+	}
+	require.NoError(t, log.Compact())
+
+	for i, key := range keys {
+		record, err := log.LookupKey([]byte(key))
+		require.NoError(t, err)
+		require.Equal(t, []byte(fmt.Sprintf("value %d", 99-(99-i)%len(keys))), record.Value)
+	}
+}
+
+/*
+tests that appends go through while a compaction is building its copies. the compaction is held up reading
+the first segment's store, which appends never touch
+*/
+func testCompactionUnlocked(t *testing.T, log *Log) {
+	appendKeyed(t, log)
+	store := log.segments[0].store
+	store.mu.Lock()
+	compacted := make(chan error)
+	go func() {
+		compacted <- log.Compact()
+	}()
+	// giving the compaction time to snapshot the segments and get stuck on the store
+	time.Sleep(10 * time.Millisecond)
+
+	appended := make(chan error)
+	go func() {
+		_, err := log.Append(&api.Record{Key: []byte("a"), Value: []byte("value 6")})
+		appended <- err
+	}()
+	select {
+	case err := <-appended:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		store.mu.Unlock()
+		t.Fatal("append blocked behind the compaction")
+	}
+	store.mu.Unlock()
+	require.NoError(t, <-compacted)
+
+	record, err := log.LookupKey([]byte("a"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("value 6"), record.Value)
+}
+
+/*
+tests that copies built before a truncation aren't swapped in, the truncation could've removed the
+records that superseded the ones they left out
+*/
+func testCompactionTruncated(t *testing.T, log *Log) {
+	appendKeyed(t, log)
+
+	log.mu.RLock()
+	snapshot, err := log.snapshotCompaction()
+	log.mu.RUnlock()
+	require.NoError(t, err)
+	copies, err := log.buildCompacted(snapshot)
+	require.NoError(t, err)
+	require.NotEmpty(t, copies)
+	defer func() {
+		for _, c := range copies {
+			c.remove()
+		}
+	}()
+
+	// removes the latest records of a and b
+	require.NoError(t, log.TruncateAfter(3))
+	log.mu.Lock()
+	err = log.swapCompacted(copies, snapshot.truncations)
+	log.mu.Unlock()
+	require.NoError(t, err)
+
+	for key, want := range map[string]uint64{"a": 2, "b": 1} {
+		record, err := log.LookupKey([]byte(key))
+		require.NoError(t, err)
+		require.Equal(t, want, record.Offset)
+	}
+}
+
+/*
+tests that a compaction that crashed part way through swapping in a compacted
+segment is finished if it was committed and rolled back if it wasn't
+*/
+func testCompactionRecovery(t *testing.T, log *Log) {
+	appendKeyed(t, log)
+	require.NoError(t, log.Close())
+
+	// compacting a copy of the log to get the compacted segment files
+	dir, err := os.MkdirTemp("", "compaction-recovery-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"2.store", "2.index", "4.store", "4.index", "6.store", "6.index"} {
+		copyFile(t, path.Join(log.Dir, name), path.Join(dir, name))
+	}
+	compacted, err := NewLog(dir, log.Config)
+	require.NoError(t, err)
+	require.NoError(t, compacted.Compact())
+	require.NoError(t, compacted.Close())
+
+	// segment 2 crashed after the swap was committed
+	copyFile(t, path.Join(dir, "2.store"), path.Join(log.Dir, "2.store"+swapSuffix))
+	copyFile(t, path.Join(dir, "2.index"), path.Join(log.Dir, "2.index"+swapSuffix))
+	// segment 4 crashed before the swap was committed
+	copyFile(t, path.Join(dir, "2.index"), path.Join(log.Dir, "4.index"+swapSuffix))
+
+	newLog, err := NewLog(log.Dir, log.Config)
+	require.NoError(t, err)
+
+	read, err := newLog.Read(2)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), read.Offset)
+
+	read, err = newLog.Read(4)
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), read.Offset)
+
+	_, err = os.Stat(path.Join(log.Dir, "4.index"+swapSuffix))
+	require.True(t, os.IsNotExist(err))
+}
+
+func copyFile(t *testing.T, src, dst string) {
+	t.Helper()
+	b, err := os.ReadFile(src)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(dst, b, 0644))
+}
+
+/*
+tests that record values are encrypted on disk and that redacting a record deletes
+its data key so it can't be read anymore, even after the log is reopened
+*/
+func testRedact(t *testing.T, log *Log) {
+	require.Equal(t, ErrEncryptionDisabled, log.Redact(0))
+
+	c := log.Config
+	c.Encryption.MasterKey = bytes.Repeat([]byte("k"), 32)
+	require.NoError(t, log.Close())
+	log, err := NewLog(log.Dir, c)
+	require.NoError(t, err)
+
+	value := []byte("hello world")
+	for range 2 {
+		record := &api.Record{Value: value}
+		_, err := log.Append(record)
+		require.NoError(t, err)
+		// the caller's record shouldn't be replaced with the encrypted value
+		require.Equal(t, value, record.Value)
+	}
+
+	b, err := io.ReadAll(log.Reader())
+	require.NoError(t, err)
+	require.False(t, bytes.Contains(b, value))
+
+	read, err := log.Read(0)
+	require.NoError(t, err)
+	require.Equal(t, value, read.Value)
+
+	require.NoError(t, log.Redact(0))
+
+	check := func(log *Log) {
+		read, err := log.Read(0)
+		require.NoError(t, err)
+		require.Nil(t, read.Value)
+
+		annotations, err := log.Annotations(0)
+		require.NoError(t, err)
+		require.Equal(t, []api.Annotation{api.Annotation_ANNOTATION_REDACTED}, annotations)
+
+		read, err = log.Read(1)
+		require.NoError(t, err)
+		require.Equal(t, value, read.Value)
+	}
+	check(log)
+
+	require.NoError(t, log.Close())
+	log, err = NewLog(log.Dir, c)
+	require.NoError(t, err)
+	check(log)
+}
+
+// tests that a range of records can be read across multiple segments with an iterator
+func testReadRange(t *testing.T, log *Log) {
+	for i := range 10 {
+		_, err := log.Append(&api.Record{
+			Value: []byte(fmt.Sprintf("value %d", i)),
+		})
+		require.NoError(t, err)
+	}
+	require.Greater(t, len(log.segments), 2)
+
+	collect := func(from, to uint64) []uint64 {
+		it, err := log.ReadRange(from, to)
+		require.NoError(t, err)
+		var offsets []uint64
+		for it.Next() {
+			record := it.Record()
+			require.Equal(t, []byte(fmt.Sprintf("value %d", record.Offset)), record.Value)
+			offsets = append(offsets, record.Offset)
+		}
+		require.NoError(t, it.Err())
+		return offsets
+	}
+
+	require.Equal(t, []uint64{3, 4, 5, 6}, collect(3, 7))
+	require.Equal(t, []uint64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, collect(0, 100))
+	require.Empty(t, collect(5, 5))
+
+	// records appended after the iterator was created aren't part of the range
+	it, err := log.ReadRange(8, 100)
+	require.NoError(t, err)
+	_, err = log.Append(&api.Record{Value: []byte("value 10")})
+	require.NoError(t, err)
+	var count int
+	for it.Next() {
+		count++
+	}
+	require.Equal(t, 2, count)
+
+	_, err = log.ReadRange(11, 20)
+	apiErr := err.(api.ErrOffsetOutOfRange)
+	require.Equal(t, uint64(11), apiErr.Offset)
+}
+
+/*
+tests that the next segment is created ahead of time once the active segment is half full
+and that the log rolls over to it under the right base offset
+*/
+func testPreallocate(t *testing.T, log *Log) {
+	c := log.Config
+	c.Segment.Preallocate = true
+	require.NoError(t, log.Close())
+	log, err := NewLog(log.Dir, c)
+	require.NoError(t, err)
+
+	// a single record fills the store past half way
+	_, err = log.Append(&api.Record{Value: []byte("hello world")})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return len(log.spares.ready) == 1
+	}, time.Second, time.Millisecond)
+	spare := <-log.spares.ready
+	log.spares.ready <- spare
+
+	_, err = log.Append(&api.Record{Value: []byte("hello world")})
+	require.NoError(t, err)
+	require.Equal(t, spare, log.activeSegment)
+	require.Equal(t, uint64(2), log.activeSegment.baseOffset)
+
+	for range 6 {
+		_, err = log.Append(&api.Record{Value: []byte("hello world")})
+		require.NoError(t, err)
+	}
+	for off := uint64(0); off < 8; off++ {
+		read, err := log.Read(off)
+		require.NoError(t, err)
+		require.Equal(t, off, read.Offset)
+	}
+
+	// unused spares are removed when the log is closed so they aren't mistaken for segments
+	require.NoError(t, log.Close())
+	_, err = os.Stat(path.Join(log.Dir, preallocDir))
+	require.True(t, os.IsNotExist(err))
+
+	log, err = NewLog(log.Dir, c)
+	require.NoError(t, err)
+	defer log.Close()
+	for _, s := range log.segments {
+		_, err = os.Stat(segmentPath(log.Dir, s.baseOffset, ".store"))
+		require.NoError(t, err)
+	}
+	off, err := log.HighestOffset()
+	require.NoError(t, err)
+	require.Equal(t, uint64(7), off)
+}
+
+// tests that a log can be rebuilt in another directory from a snapshot of it
+func testSnapshotRestore(t *testing.T, log *Log) {
+	appendKeyed(t, log)
+	// compacting first so the snapshot has to keep the gaps in the offsets
+	require.NoError(t, log.Compact())
+
+	var snapshot bytes.Buffer
+	require.NoError(t, log.Snapshot(&snapshot))
+
+	dir, err := os.MkdirTemp("", "snapshot-restore-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	c := log.Config
+	c.Segment.Compression = CompressionZstd
+	c.Encryption.MasterKey = bytes.Repeat([]byte("k"), 32)
+	restored, err := NewLog(dir, c)
+	require.NoError(t, err)
+	defer restored.Close()
+
+	// records in the log being restored into are replaced
+	_, err = restored.Append(&api.Record{Value: []byte("replaced")})
+	require.NoError(t, err)
+	require.NoError(t, restored.Restore(&snapshot))
+
+	require.Equal(t, len(log.segments), len(restored.segments))
+	for _, off := range []uint64{2, 3, 4, 5} {
+		want, err := log.Read(off)
+		require.NoError(t, err)
+		got, err := restored.Read(off)
+		require.NoError(t, err)
+		require.Equal(t, want.Offset, got.Offset)
+		require.Equal(t, want.Key, got.Key)
+		require.Equal(t, want.Value, got.Value)
+	}
+
+	off, err := restored.Append(&api.Record{Value: []byte("hello world")})
+	require.NoError(t, err)
+	require.Equal(t, uint64(6), off)
+}
+
+/*
+tests that a snapshot of an encrypted log keeps its values encrypted and that a record that was redacted
+is still redacted once the snapshot is restored into a log with the same master key
+*/
+func testSnapshotEncrypted(t *testing.T, log *Log) {
+	c := log.Config
+	c.Encryption.MasterKey = bytes.Repeat([]byte("k"), 32)
+	require.NoError(t, log.Close())
+	log, err := NewLog(log.Dir, c)
+	require.NoError(t, err)
+	defer log.Close()
+	for i := range 3 {
+		_, err := log.Append(&api.Record{Value: []byte(fmt.Sprintf("secret %d", i))})
+		require.NoError(t, err)
+	}
+	require.NoError(t, log.Redact(1))
+
+	var snapshot bytes.Buffer
+	require.NoError(t, log.Snapshot(&snapshot))
+	require.False(t, bytes.Contains(snapshot.Bytes(), []byte("secret")))
+
+	restore := func(c Config) (*Log, error) {
+		dir, err := os.MkdirTemp("", "snapshot-encrypted-test")
+		require.NoError(t, err)
+		t.Cleanup(func() { os.RemoveAll(dir) })
+		restored, err := NewLog(dir, c)
+		require.NoError(t, err)
+		t.Cleanup(func() { restored.Close() })
+		return restored, restored.Restore(bytes.NewReader(snapshot.Bytes()))
+	}
+
+	restored, err := restore(c)
+	require.NoError(t, err)
+	for _, off := range []uint64{0, 2} {
+		read, err := restored.Read(off)
+		require.NoError(t, err)
+		require.Equal(t, []byte(fmt.Sprintf("secret %d", off)), read.Value)
+	}
+	read, err := restored.Read(1)
+	require.NoError(t, err)
+	require.Nil(t, read.Value)
+	annotations, err := restored.Annotations(1)
+	require.NoError(t, err)
+	require.Equal(t, []api.Annotation{api.Annotation_ANNOTATION_REDACTED}, annotations)
+
+	// the data keys can only be unwrapped with the master key they were wrapped with
+	other := c
+	other.Encryption.MasterKey = nil
+	_, err = restore(other)
+	require.ErrorIs(t, err, ErrEncryptionDisabled)
+	other.Encryption.MasterKey = bytes.Repeat([]byte("o"), 32)
+	_, err = restore(other)
+	require.ErrorIs(t, err, ErrMasterKeyMismatch)
+}
+
+// tests that restoring a corrupted snapshot fails without touching the log
+func testRestoreCorrupted(t *testing.T, log *Log) {
+	appendKeyed(t, log)
+
+	var snapshot bytes.Buffer
+	require.NoError(t, log.Snapshot(&snapshot))
+	b := snapshot.Bytes()
+	// flipping a byte inside of the last record
+	b[len(b)-6] ^= 0xff
+
+	require.Error(t, log.Restore(bytes.NewReader(b)))
+	require.Error(t, log.Restore(bytes.NewReader(b[:len(b)/2])))
+	require.Error(t, log.Restore(bytes.NewReader([]byte("not a snapshot"))))
+
+	for off := uint64(0); off < 6; off++ {
+		read, err := log.Read(off)
+		require.NoError(t, err)
+		require.Equal(t, off, read.Offset)
+	}
+}
+
+// in memory ObjectStore used to test tiered storage without a bucket
+type memoryStore struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{objects: make(map[string][]byte)}
+}
+
+func (m *memoryStore) Put(_ context.Context, name string, r io.Reader, _ int64) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[name] = b
+	return nil
+}
+
+func (m *memoryStore) Get(_ context.Context, name string) (io.ReadCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.objects[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return io.NopCloser(bytes.NewReader(b)), nil
+}
+
+func (m *memoryStore) Delete(_ context.Context, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.objects, name)
+	return nil
+}
+
+/*
+tests that closed segments are uploaded and offloaded, read back from the object store
+when their records are read, and are still tracked after the log is reopened
+*/
+func testTiering(t *testing.T, log *Log) {
+	remote := newMemoryStore()
+	c := log.Config
+	c.Tiering.Remote = remote
+	require.NoError(t, log.Close())
+	log, err := NewLog(log.Dir, c)
+	require.NoError(t, err)
+
+	// 2 records fit in a segment so this leaves 3 closed segments and an empty active one
+	for range 6 {
+		_, err = log.Append(&api.Record{Value: []byte("hello world")})
+		require.NoError(t, err)
+	}
+	require.NoError(t, log.Tier())
+	require.Equal(t, 6, len(remote.objects))
+	for _, s := range log.segments[:3] {
+		require.True(t, s.remote)
+		_, err = os.Stat(segmentPath(log.Dir, s.baseOffset, ".store"))
+		require.True(t, os.IsNotExist(err))
+	}
+	require.False(t, log.activeSegment.tiered)
+
+	for off := uint64(0); off < 6; off++ {
+		read, err := log.Read(off)
+		require.NoError(t, err)
+		require.Equal(t, off, read.Offset)
+	}
+	_, err = os.Stat(segmentPath(log.Dir, 0, ".store"))
+	require.NoError(t, err)
+
+	// offloading the fetched segments again and reading them through a range after reopening the log
+	require.NoError(t, log.Tier())
+	require.NoError(t, log.Close())
+	log, err = NewLog(log.Dir, c)
+	require.NoError(t, err)
+	require.Equal(t, 4, len(log.segments))
+	require.True(t, log.segments[0].remote)
+	it, err := log.ReadRange(0, 6)
+	require.NoError(t, err)
+	var read int
+	for it.Next() {
+		require.Equal(t, uint64(read), it.Record().Offset)
+		read++
+	}
+	require.NoError(t, it.Err())
+	require.Equal(t, 6, read)
+
+	off, err := log.Append(&api.Record{Value: []byte("hello world")})
+	require.NoError(t, err)
+	require.Equal(t, uint64(6), off)
+
+	// removing a segment removes its objects too
+	require.NoError(t, log.Truncate(1))
+	require.Equal(t, 4, len(remote.objects))
+	_, err = log.Read(0)
+	require.Error(t, err)
+	require.NoError(t, log.Close())
+
+	c.Tiering.Remote = nil
+	_, err = NewLog(log.Dir, c)
+	require.Equal(t, ErrTieringDisabled, err)
+}
+
+// object store whose downloads wait until release is closed, started is sent to as each one starts
+type slowStore struct {
+	*memoryStore
+	started chan string
+	release chan struct{}
+}
+
+func (m slowStore) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	m.started <- name
+	<-m.release
+	return m.memoryStore.Get(ctx, name)
+}
+
+/*
+tests that fetching an offloaded segment doesn't hold the log's lock while it's downloaded, and that
+readers of a segment that's already being fetched wait for that download instead of starting another one
+*/
+func testTieringFetch(t *testing.T, log *Log) {
+	remote := slowStore{newMemoryStore(), make(chan string, 4), make(chan struct{})}
+	c := log.Config
+	c.Tiering.Remote = remote
+	require.NoError(t, log.Close())
+	log, err := NewLog(log.Dir, c)
+	require.NoError(t, err)
+	defer log.Close()
+	for range 6 {
+		_, err = log.Append(&api.Record{Value: []byte("hello world")})
+		require.NoError(t, err)
+	}
+	require.NoError(t, log.Tier())
+	require.True(t, log.segments[0].remote)
+
+	read := make(chan error, 2)
+	for range 2 {
+		go func() {
+			_, err := log.Read(0)
+			read <- err
+		}()
+	}
+	require.Equal(t, objectName(0, ".index"), <-remote.started)
+
+	// the log appends and reads local segments while the segment is being downloaded
+	off, err := log.Append(&api.Record{Value: []byte("hello world")})
+	require.NoError(t, err)
+	require.Equal(t, uint64(6), off)
+	_, err = log.Read(6)
+	require.NoError(t, err)
+
+	close(remote.release)
+	require.NoError(t, <-read)
+	require.NoError(t, <-read)
+	require.Equal(t, objectName(0, ".store"), <-remote.started)
+	// both readers were served by one download of the index and the store
+	require.Empty(t, remote.started)
+	require.False(t, log.segments[0].remote)
+}
+
+// tests that retried sequences of a producer aren't appended twice, even after the log is reopened
+func testAppendIdempotent(t *testing.T, log *Log) {
+	record := &api.Record{Value: []byte("hello world")}
+	off, err := log.AppendIdempotent(record, 1, 5)
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), off)
+
+	// retrying the last sequence returns its offset without appending it again
+	off, err = log.AppendIdempotent(record, 1, 5)
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), off)
+
+	off, err = log.AppendIdempotent(record, 2, 0)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), off)
+
+	_, err = log.AppendIdempotent(record, 1, 7)
+	require.Equal(t, api.ErrOutOfOrderSequence{ProducerId: 1, Sequence: 7, Expected: 6}, err)
+	_, err = log.AppendIdempotent(record, 1, 4)
+	require.Error(t, err)
+
+	require.NoError(t, log.Close())
+	log, err = NewLog(log.Dir, log.Config)
+	require.NoError(t, err)
+	defer log.Close()
+
+	off, err = log.AppendIdempotent(record, 2, 0)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), off)
+	off, err = log.AppendIdempotent(record, 1, 6)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), off)
+
+	// syncing the log syncs the producers' sequences with it
+	file := log.producers.file
+	closed, err := os.Open(path.Join(log.Dir, producersFileName))
+	require.NoError(t, err)
+	require.NoError(t, closed.Close())
+	log.producers.file = closed
+	require.Error(t, log.Sync())
+	log.producers.file = file
+	require.NoError(t, log.Sync())
+}
+
+// tests that the flushed offset only moves past records once they're synced to disk
+func testAppendSync(t *testing.T, log *Log) {
+	require.Equal(t, uint64(0), log.FlushedOffset())
+
+	off, err := log.Append(&api.Record{Value: []byte("hello world")})
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), log.FlushedOffset())
+
+	// rolling over to a new segment syncs the one that's full
+	off, err = log.Append(&api.Record{Value: []byte("hello world")})
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), log.FlushedOffset())
+
+	off, err = log.AppendSync(&api.Record{Value: []byte("hello world")})
+	require.NoError(t, err)
+	require.Equal(t, off+1, log.FlushedOffset())
+	// the buffered record was flushed to the store's file
+	_, pos, err := log.activeSegment.index.Read(-1)
+	require.NoError(t, err)
+	fi, err := os.Stat(log.activeSegment.store.Name())
+	require.NoError(t, err)
+	require.Greater(t, uint64(fi.Size()), pos)
+
+	_, err = log.Append(&api.Record{Value: []byte("hello world")})
+	require.NoError(t, err)
+	require.NoError(t, log.Sync())
+	require.Equal(t, uint64(4), log.FlushedOffset())
+}
+
+// tests that a batch is appended at consecutive offsets across the segments it fills
+func testAppendBatch(t *testing.T, log *Log) {
+	_, err := log.Append(&api.Record{Value: []byte("hello world")})
+	require.NoError(t, err)
+
+	batch := make([]*api.Record, 5)
+	for i := range batch {
+		batch[i] = &api.Record{Value: []byte(fmt.Sprintf("record %d", i))}
+	}
+	base, err := log.AppendBatch(batch)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), base)
+	for i, want := range batch {
+		read, err := log.Read(base + uint64(i))
+		require.NoError(t, err)
+		require.Equal(t, want.Value, read.Value)
+	}
+	// 3 full segments and the active one the log rolled over to
+	require.Len(t, log.segments, 4)
+}
+
+// tests that packed ranges span segments, stop at max bytes and unpack into the records that were appended
+func testReadPacked(t *testing.T, log *Log) {
+	var want []*api.Record
+	for i := range 5 {
+		record := &api.Record{Value: []byte(fmt.Sprintf("record %d", i))}
+		_, err := log.Append(record)
+		require.NoError(t, err)
+		want = append(want, record)
+	}
+
+	packed, next, err := log.ReadPacked(1, 100, 0)
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), next)
+	records, err := log.Unpack(packed)
+	require.NoError(t, err)
+	require.Len(t, records, 4)
+	for i, record := range records {
+		require.Equal(t, uint64(i+1), record.Offset)
+		require.Equal(t, want[i+1].Value, record.Value)
+	}
+
+	// the records after the first one take up the same space (offset 0 isn't encoded), max bytes fits two of them
+	single, _, err := log.ReadPacked(1, 2, 0)
+	require.NoError(t, err)
+	packed, next, err = log.ReadPacked(1, 100, uint64(2*len(single)+1))
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), next)
+	records, err = log.Unpack(packed)
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	// a record bigger than max bytes is still read on its own
+	packed, next, err = log.ReadPacked(3, 100, 1)
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), next)
+	require.Len(t, packed, len(single))
+
+	_, _, err = log.ReadPacked(5, 100, 0)
+	require.Equal(t, api.ErrOffsetOutOfRange{Offset: 5}, err)
+}
+
+// tests that removed segments are kept in the trash until their grace period is up and can be restored
+func testTrash(t *testing.T, log *Log) {
+	log.Config.Trash.GracePeriod = time.Hour
+	appendSegments(t, log, 3)
+
+	require.NoError(t, log.Truncate(1))
+	_, err := log.Read(0)
+	require.Error(t, err)
+	dirs, err := os.ReadDir(path.Join(log.Dir, trashDir))
+	require.NoError(t, err)
+	require.Equal(t, 1, len(dirs))
+
+	// still within the grace period so nothing is emptied
+	require.NoError(t, log.EmptyTrash())
+	require.NoError(t, log.RestoreTrash())
+	for off := uint64(0); off < 4; off++ {
+		read, err := log.Read(off)
+		require.NoError(t, err)
+		require.Equal(t, off, read.Offset)
+	}
+	dirs, err = os.ReadDir(path.Join(log.Dir, trashDir))
+	require.NoError(t, err)
+	require.Equal(t, 0, len(dirs))
+
+	require.NoError(t, log.Truncate(1))
+	log.Config.Trash.GracePeriod = time.Nanosecond
+	require.NoError(t, log.EmptyTrash())
+	require.NoError(t, log.RestoreTrash())
+	_, err = log.Read(0)
+	require.Error(t, err)
+}
+
+/*
+testing that restoring the trash undoes TruncateBefore and TruncateAfter by replacing the segments they rewrote,
+and that segments TruncateAfter removed stay in the trash once records were appended at their offsets again
+*/
+func testTrashTruncated(t *testing.T, log *Log) {
+	log.Config.Trash.GracePeriod = time.Hour
+	for i := range 6 {
+		_, err := log.Append(&api.Record{Value: []byte(fmt.Sprintf("value %d", i))})
+		require.NoError(t, err)
+	}
+	values := func() []string {
+		lowest, err := log.LowestOffset()
+		require.NoError(t, err)
+		it, err := log.ReadRange(lowest, 100)
+		require.NoError(t, err)
+		var values []string
+		for it.Next() {
+			values = append(values, fmt.Sprintf("%d %s", it.Record().Offset, it.Record().Value))
+		}
+		require.NoError(t, it.Err())
+		return values
+	}
+	want := []string{"0 value 0", "1 value 1", "2 value 2", "3 value 3", "4 value 4", "5 value 5"}
+	trashed := func() int {
+		dirs, err := os.ReadDir(path.Join(log.Dir, trashDir))
+		require.NoError(t, err)
+		return len(dirs)
+	}
+
+	// the segment cut at 3 is rewritten starting at 3, restoring it replaces the rewrite instead of repeating 3
+	require.NoError(t, log.TruncateBefore(3))
+	require.Equal(t, want[3:], values())
+	require.NoError(t, log.RestoreTrash())
+	require.Equal(t, want, values())
+	require.Equal(t, 0, trashed())
+
+	// the segment cut after 2 is rewritten without 3 and the segment after it is removed
+	require.NoError(t, log.TruncateAfter(2))
+	require.Equal(t, want[:3], values())
+	require.NoError(t, log.RestoreTrash())
+	require.Equal(t, want, values())
+	require.Equal(t, 0, trashed())
+	off, err := log.Append(&api.Record{Value: []byte("value 6")})
+	require.NoError(t, err)
+	require.Equal(t, uint64(6), off)
+
+	// records appended after the truncation are kept, the old records at their offsets stay in the trash
+	require.NoError(t, log.TruncateAfter(2))
+	for i := 3; i < 6; i++ {
+		_, err := log.Append(&api.Record{Value: []byte(fmt.Sprintf("new value %d", i))})
+		require.NoError(t, err)
+	}
+	before := trashed()
+	require.ErrorIs(t, log.RestoreTrash(), ErrTrashOverlaps)
+	require.Equal(t, []string{"0 value 0", "1 value 1", "2 value 2", "3 new value 3", "4 new value 4", "5 new value 5"}, values())
+	require.Equal(t, before, trashed())
+	require.NoError(t, log.Close())
+}
+
+// tests that looking up a key returns its latest record and that closed segments get key filters
+func testLookupKey(t *testing.T, log *Log) {
+	appendKeyed(t, log)
+
+	for key, want := range map[string]string{"a": "value 5", "b": "value 4", "c": "value 3"} {
+		record, err := log.LookupKey([]byte(key))
+		require.NoError(t, err)
+		require.Equal(t, want, string(record.Value))
+	}
+	_, err := log.LookupKey([]byte("d"))
+	require.Equal(t, ErrKeyNotFound, err)
+
+	// the first segment with a and b was sealed so its filter rules c out
+	require.NotNil(t, log.segments[0].bloom)
+	require.False(t, log.segments[0].mayContain(hashKey([]byte("c"))))
+	require.Nil(t, log.activeSegment.bloom)
+
+	// filters are read back in when the log is reopened
+	require.NoError(t, log.Close())
+	log, err = NewLog(log.Dir, log.Config)
+	require.NoError(t, err)
+	defer log.Close()
+	require.NotNil(t, log.segments[0].bloom)
+	record, err := log.LookupKey([]byte("c"))
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), record.Offset)
+}
+
+/*
+testing that sealed segments are described from their metadata, that the metadata is read back
+in when the log is reopened and that changes to a sealed segment's files fail verification
+*/
+func testSegmentMeta(t *testing.T, log *Log) {
+	for range 5 {
+		_, err := log.Append(&api.Record{Value: []byte("hello world")})
+		require.NoError(t, err)
+	}
+
+	infos := log.Segments()
+	require.Equal(t, 3, len(infos))
+	for i, info := range infos[:2] {
+		require.True(t, info.Sealed)
+		require.Equal(t, uint64(i*2), info.BaseOffset)
+		require.Equal(t, uint64(i*2+2), info.NextOffset)
+		require.Equal(t, uint64(2), info.Records)
+		require.NotZero(t, info.Checksum)
+		require.False(t, info.FirstAppend.IsZero())
+		require.False(t, info.LastAppend.Before(info.FirstAppend))
+	}
+	require.False(t, infos[2].Sealed)
+	require.Equal(t, uint64(1), infos[2].Records)
+	require.NoError(t, log.Verify())
+
+	require.NoError(t, log.Close())
+	log, err := NewLog(log.Dir, log.Config)
+	require.NoError(t, err)
+	require.NotNil(t, log.segments[0].meta)
+	reopened := log.Segments()
+	for i := range infos[:2] {
+		require.Equal(t, infos[i].Checksum, reopened[i].Checksum)
+		require.True(t, infos[i].FirstAppend.Equal(reopened[i].FirstAppend))
+	}
+
+	// flipping a byte of the first segment's record without changing the store's size
+	require.NoError(t, log.Close())
+	name := segmentPath(log.Dir, 0, ".store")
+	require.NoError(t, os.Chmod(name, 0644))
+	b, err := os.ReadFile(name)
+	require.NoError(t, err)
+	b[len(b)-1] ^= 0xff
+	require.NoError(t, os.WriteFile(name, b, 0444))
+	log, err = NewLog(log.Dir, log.Config)
+	require.NoError(t, err)
+	defer log.Close()
+	require.ErrorIs(t, log.Verify(), ErrSegmentChecksum)
+}
+
+/*
+testing that sealed segments aren't opened until they're read when the log is reopened, and that every
+segment is loaded even when one of them lost its index
+*/
+func testColdSegments(t *testing.T, log *Log) {
+	for i := range 7 {
+		_, err := log.Append(&api.Record{Value: []byte(fmt.Sprintf("value %d", i))})
+		require.NoError(t, err)
+	}
+	require.NoError(t, log.Close())
+	require.NoError(t, os.Remove(segmentPath(log.Dir, 2, ".index")))
+
+	log, err := NewLog(log.Dir, log.Config)
+	require.NoError(t, err)
+	defer log.Close()
+	require.Equal(t, 4, len(log.segments))
+	for i, cold := range []bool{true, false, true, false} {
+		require.Equal(t, cold, log.segments[i].cold.Load(), i)
+	}
+	// cold segments are described without being opened
+	require.Equal(t, uint64(2), log.Segments()[0].Records)
+	require.True(t, log.segments[0].cold.Load())
+
+	for off := uint64(0); off < 7; off++ {
+		record, err := log.Read(off)
+		require.NoError(t, err)
+		require.Equal(t, fmt.Sprintf("value %d", off), string(record.Value))
+	}
+	require.False(t, log.segments[0].cold.Load())
+	require.False(t, log.segments[2].cold.Load())
+}
+
+/*
+tests that watchers are signaled once there's a record at the offset they're waiting on, that signals
+are coalesced into the newest offset, and that the channels are closed when cancelled or the log is closed
+*/
+func testWatch(t *testing.T, log *Log) {
+	append := func() {
+		_, err := log.Append(&api.Record{Value: []byte("hello world")})
+		require.NoError(t, err)
+	}
+	appended, cancel := log.Watch(2)
+	defer cancel()
+	append()
+	append()
+	select {
+	case off := <-appended:
+		t.Fatalf("signaled before the watched offset was appended: %d", off)
+	default:
+	}
+	append()
+	require.Equal(t, uint64(2), <-appended)
+	append()
+	append()
+	require.Equal(t, uint64(4), <-appended)
+
+	// records past the watched offset already exist
+	existing, cancelExisting := log.Watch(0)
+	require.Equal(t, uint64(4), <-existing)
+	cancelExisting()
+	_, ok := <-existing
+	require.False(t, ok)
+
+	require.NoError(t, log.Close())
+	_, ok = <-appended
+	require.False(t, ok)
+}
+
+// tests that the log keeps the cluster it was created for and refuses to open for another cluster
+func testGenesis(t *testing.T, log *Log) {
+	genesis := log.Genesis()
+	require.Len(t, genesis.ClusterID, 32)
+	require.Equal(t, uint32(formatVersion), genesis.FormatVersion)
+	require.NoError(t, log.Close())
+
+	c := log.Config
+	c.ClusterID = genesis.ClusterID
+	log, err := NewLog(log.Dir, c)
+	require.NoError(t, err)
+	require.Equal(t, genesis.ClusterID, log.Genesis().ClusterID)
+	require.True(t, genesis.Created.Equal(log.Genesis().Created))
+	require.NoError(t, log.Close())
+
+	c.ClusterID = "another-cluster"
+	_, err = NewLog(log.Dir, c)
+	require.ErrorIs(t, err, ErrClusterMismatch)
+
+	// logs written by a newer version aren't opened
+	require.NoError(t, os.WriteFile(path.Join(log.Dir, genesisFileName), []byte(`{"format_version": 2}`), 0644))
+	_, err = NewLog(log.Dir, Config{})
+	require.ErrorIs(t, err, ErrUnsupportedFormat)
+}
@@ -0,0 +1,167 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"time"
+)
+
+// 8 bytes each for the record count, next offset, first and last append times, store size and index size + the checksum
+const metaWidth = 8*6 + 4
+
+var (
+	errCorruptMeta = errors.New("corrupt segment metadata")
+
+	ErrSegmentChecksum = errors.New("segment checksum mismatch")
+)
+
+/*
+segmentMeta is what's known about a sealed segment without opening its files. it's written to a {baseOffset}.meta
+file next to the segment's files when the segment is sealed and never changes afterwards, since a sealed segment
+isn't written to again.
+- firstAppend is zero when it isn't known, ex. for segments that were reopened before they were sealed
+- checksum is a crc32 of the store's bytes followed by the index's, used to verify the files haven't changed
+*/
+type segmentMeta struct {
+	records, nextOffset     uint64
+	firstAppend, lastAppend time.Time
+	storeSize, indexSize    uint64
+	checksum                uint32
+}
+
+// SegmentInfo describes one of the log's segments
+type SegmentInfo struct {
+	BaseOffset, NextOffset uint64
+	Records                uint64
+	// bytes the segment's store and index take up, locally or in the remote object store once offloaded
+	Size uint64
+	// when the first and last records were appended, FirstAppend is zero when it isn't known
+	FirstAppend, LastAppend time.Time
+	// crc32 of the segment's files, zero until the segment is sealed
+	Checksum uint32
+	Sealed   bool
+	Remote   bool
+}
+
+func writeMeta(name string, m *segmentMeta) error {
+	p := make([]byte, metaWidth)
+	enc.PutUint64(p[0:8], m.records)
+	enc.PutUint64(p[8:16], m.nextOffset)
+	enc.PutUint64(p[16:24], timeNano(m.firstAppend))
+	enc.PutUint64(p[24:32], timeNano(m.lastAppend))
+	enc.PutUint64(p[32:40], m.storeSize)
+	enc.PutUint64(p[40:48], m.indexSize)
+	enc.PutUint32(p[48:52], m.checksum)
+	// writing to a temporary file first so a crash never leaves partial metadata behind
+	tmp := name + swapSuffix
+	if err := os.WriteFile(tmp, p, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+func readMeta(name string) (*segmentMeta, error) {
+	p, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(p) != metaWidth {
+		return nil, errCorruptMeta
+	}
+	return &segmentMeta{
+		records:     enc.Uint64(p[0:8]),
+		nextOffset:  enc.Uint64(p[8:16]),
+		firstAppend: nanoTime(enc.Uint64(p[16:24])),
+		lastAppend:  nanoTime(enc.Uint64(p[24:32])),
+		storeSize:   enc.Uint64(p[32:40]),
+		indexSize:   enc.Uint64(p[40:48]),
+		checksum:    enc.Uint32(p[48:52]),
+	}, nil
+}
+
+// zero times are written as 0 instead of their UnixNano, which doesn't fit in an int64
+func timeNano(t time.Time) uint64 {
+	if t.IsZero() {
+		return 0
+	}
+	return uint64(t.UnixNano())
+}
+
+func nanoTime(n uint64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(n))
+}
+
+// computes the crc32 of the segment's store followed by its index entries
+func (s *segment) checksum() (uint32, error) {
+	if err := s.open(); err != nil {
+		return 0, err
+	}
+	crc := crc32.New(crcTable)
+	if _, err := io.Copy(crc, io.NewSectionReader(s.store, 0, int64(s.store.size))); err != nil {
+		return 0, err
+	}
+	crc.Write(s.index.mmap[:s.index.size])
+	return crc.Sum32(), nil
+}
+
+// describes the segment, from its metadata if it's sealed
+func (s *segment) info() SegmentInfo {
+	info := SegmentInfo{
+		BaseOffset:  s.baseOffset,
+		NextOffset:  s.nextOffset,
+		Records:     s.Len(),
+		Size:        s.Size(),
+		FirstAppend: s.firstAppend,
+		LastAppend:  s.modTime,
+		Sealed:      s.sealed,
+		Remote:      s.remote,
+	}
+	if s.meta != nil {
+		info.FirstAppend = s.meta.firstAppend
+		info.LastAppend = s.meta.lastAppend
+		info.Checksum = s.meta.checksum
+	}
+	return info
+}
+
+/*
+Segments describes every segment in the log, oldest to newest. sealed and offloaded segments are described
+from their metadata so nothing is read from their files or fetched from the remote object store.
+*/
+func (l *Log) Segments() []SegmentInfo {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	infos := make([]SegmentInfo, 0, len(l.segments))
+	for _, s := range l.segments {
+		infos = append(infos, s.info())
+	}
+	return infos
+}
+
+/*
+Verify recomputes the checksums of the sealed segments that are local and compares them against the ones in
+their metadata, returning ErrSegmentChecksum for the first segment whose files changed since it was sealed
+*/
+func (l *Log) Verify() error {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for _, s := range l.segments {
+		if s.meta == nil || s.remote {
+			continue
+		}
+		sum, err := s.checksum()
+		if err != nil {
+			return err
+		}
+		if sum != s.meta.checksum {
+			return fmt.Errorf("%w: segment at offset %d", ErrSegmentChecksum, s.baseOffset)
+		}
+	}
+	return nil
+}
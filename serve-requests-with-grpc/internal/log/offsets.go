@@ -0,0 +1,152 @@
+package log
+
+import (
+	"errors"
+	"math"
+	"os"
+	"slices"
+	"sync"
+
+	api "github.com/phaseharry/distributed-log/serve-requests-with-grpc/api/v1"
+)
+
+/*
+Offsets are the offsets consumers committed so they can resume where they left off after restarting.
+commits are kept in a log of their own: every commit is appended as a record keyed by the consumer's id with
+the offset as its value, and the log is compacted so it only keeps each consumer's latest commit.
+the commits are replayed into memory when the offsets are opened so fetching an offset doesn't touch disk.
+a commit can carry the offsets above it that were acked individually as a bitmap after the offset
+*/
+type Offsets struct {
+	mu         sync.RWMutex
+	log        *Log
+	byConsumer map[string]uint64
+	acked      map[string][]uint64
+}
+
+// opens the consumer offsets log in dir, c configures the log like any other except compaction is always enabled
+func NewOffsets(dir string, c Config) (*Offsets, error) {
+	c.Compaction.Enabled = true
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	l, err := NewLog(dir, c)
+	if err != nil {
+		return nil, err
+	}
+	o := &Offsets{log: l, byConsumer: make(map[string]uint64), acked: make(map[string][]uint64)}
+
+	lowest, err := l.LowestOffset()
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+	it, err := l.ReadRange(lowest, math.MaxUint64)
+	var outOfRange api.ErrOffsetOutOfRange
+	if errors.As(err, &outOfRange) {
+		// nothing was committed yet
+		return o, nil
+	}
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+	for it.Next() {
+		record := it.Record()
+		if len(record.Value) >= 8 {
+			offset := enc.Uint64(record.Value)
+			o.byConsumer[string(record.Key)] = offset
+			o.acked[string(record.Key)] = decodeAcked(offset, record.Value[8:])
+		}
+	}
+	if err = it.Err(); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return o, nil
+}
+
+/*
+Commit durably records the offset of the next record the consumer will consume, it's fsynced to disk
+before Commit returns so a consumer that resumes from it never skips records it didn't process
+*/
+func (o *Offsets) Commit(consumerID string, offset uint64) error {
+	return o.CommitAcked(consumerID, offset, nil)
+}
+
+/*
+CommitAcked commits the offset like Commit along with the offsets above it that were acked individually,
+ex. records a consumer group's members acked out of order, so they aren't delivered again after a restart.
+acked offsets that aren't above the offset are dropped
+*/
+func (o *Offsets) CommitAcked(consumerID string, offset uint64, acked []uint64) error {
+	acked = slices.DeleteFunc(slices.Clone(acked), func(off uint64) bool { return off <= offset })
+	slices.Sort(acked)
+	value := make([]byte, 8, 8+encodedAckedSize(offset, acked))
+	enc.PutUint64(value, offset)
+	value = encodeAcked(value, offset, acked)
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if _, err := o.log.AppendSync(&api.Record{Key: []byte(consumerID), Value: value}); err != nil {
+		return err
+	}
+	o.byConsumer[consumerID] = offset
+	o.acked[consumerID] = acked
+	return nil
+}
+
+// Fetch returns the consumer's last committed offset, or api.ErrUnknownConsumer if it never committed one
+func (o *Offsets) Fetch(consumerID string) (uint64, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	offset, ok := o.byConsumer[consumerID]
+	if !ok {
+		return 0, api.ErrUnknownConsumer{ConsumerId: consumerID}
+	}
+	return offset, nil
+}
+
+// FetchAcked returns the consumer's last committed offset like Fetch and the offsets above it it acked, lowest first
+func (o *Offsets) FetchAcked(consumerID string) (uint64, []uint64, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	offset, ok := o.byConsumer[consumerID]
+	if !ok {
+		return 0, nil, api.ErrUnknownConsumer{ConsumerId: consumerID}
+	}
+	return offset, slices.Clone(o.acked[consumerID]), nil
+}
+
+// bytes the bitmap of the acked offsets takes, bit i is set when offset+1+i was acked
+func encodedAckedSize(offset uint64, acked []uint64) int {
+	if len(acked) == 0 {
+		return 0
+	}
+	return int((acked[len(acked)-1]-offset-1)/8 + 1)
+}
+
+func encodeAcked(b []byte, offset uint64, acked []uint64) []byte {
+	bitmap := make([]byte, encodedAckedSize(offset, acked))
+	for _, off := range acked {
+		i := off - offset - 1
+		bitmap[i/8] |= 1 << (i % 8)
+	}
+	return append(b, bitmap...)
+}
+
+func decodeAcked(offset uint64, bitmap []byte) []uint64 {
+	var acked []uint64
+	for i, b := range bitmap {
+		for bit := 0; bit < 8; bit++ {
+			if b&(1<<bit) != 0 {
+				acked = append(acked, offset+1+uint64(i*8+bit))
+			}
+		}
+	}
+	return acked
+}
+
+func (o *Offsets) Close() error {
+	return o.log.Close()
+}
@@ -0,0 +1,49 @@
+package log
+
+import (
+	"os"
+	"testing"
+
+	api "github.com/phaseharry/distributed-log/serve-requests-with-grpc/api/v1"
+	"github.com/stretchr/testify/require"
+)
+
+// testing that committed offsets and the offsets acked above them are fetched and replayed when the offsets are reopened
+func TestOffsets(t *testing.T) {
+	dir, err := os.MkdirTemp("", "offsets-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	c := Config{}
+	c.Segment.MaxStoreBytes = storeHeaderWidth + 64
+	o, err := NewOffsets(dir, c)
+	require.NoError(t, err)
+
+	_, err = o.Fetch("billing")
+	require.Equal(t, api.ErrUnknownConsumer{ConsumerId: "billing"}, err)
+	for offset := uint64(0); offset < 5; offset++ {
+		require.NoError(t, o.Commit("billing", offset))
+	}
+	require.NoError(t, o.Commit("shipping", 2))
+	// offsets that aren't above the committed one can't be acked individually
+	require.NoError(t, o.CommitAcked("queue", 3, []uint64{12, 5, 2}))
+	// the log only has to keep each consumer's latest commit
+	require.NoError(t, o.log.Compact())
+	require.NoError(t, o.Close())
+
+	o, err = NewOffsets(dir, c)
+	require.NoError(t, err)
+	defer o.Close()
+	for consumer, want := range map[string]uint64{"billing": 4, "shipping": 2} {
+		offset, err := o.Fetch(consumer)
+		require.NoError(t, err)
+		require.Equal(t, want, offset)
+	}
+	offset, acked, err := o.FetchAcked("queue")
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), offset)
+	require.Equal(t, []uint64{5, 12}, acked)
+	_, acked, err = o.FetchAcked("billing")
+	require.NoError(t, err)
+	require.Empty(t, acked)
+}
@@ -0,0 +1,82 @@
+package log
+
+import (
+	"fmt"
+
+	api "github.com/phaseharry/distributed-log/serve-requests-with-grpc/api/v1"
+)
+
+/*
+ReadPacked returns the records with offsets in [from, to) packed back to back as they're stored, each one prefixed
+with its big endian 8 byte length, along with the offset the next read should start from. every segment's part of
+the range is looked up in one pass over its index and read from its store in one read, so replication and range
+consumers don't pay for a lookup and a read per offset.
+- the records are packed as they're stored: compressed when compression is on and with their values still encrypted,
+ex. for a replica to copy them as is. Unpack decodes them
+- reading stops before the record that would take the packed records past maxBytes, but it always has at least one
+record. maxBytes of 0 means there's no limit
+- returns ErrOffsetOutOfRange if there's no record at or after from like ReadRange, and an empty range with the
+next offset past it if every record in the range was compacted away
+*/
+func (l *Log) ReadPacked(from, to, maxBytes uint64) (packed []byte, next uint64, err error) {
+	if err := l.rlockFetched(from, to); err != nil {
+		return nil, 0, err
+	}
+	defer l.mu.RUnlock()
+
+	last := l.segments[len(l.segments)-1]
+	if from < l.segments[0].baseOffset || from >= last.nextOffset {
+		return nil, 0, api.ErrOffsetOutOfRange{Offset: from}
+	}
+	next = min(to, last.nextOffset)
+	for _, s := range l.segments {
+		if s.nextOffset <= from || to <= s.baseOffset {
+			continue
+		}
+		if err = s.open(); err != nil {
+			return nil, 0, err
+		}
+		rel := uint32(0)
+		if s.baseOffset < from {
+			rel = uint32(from - s.baseOffset)
+		}
+		entries, err := s.index.ReadRange(rel, uint32(min(to, s.nextOffset)-s.baseOffset))
+		if err != nil {
+			return nil, 0, err
+		}
+		var n int
+		if packed, n, err = s.store.readPacked(packed, entries, maxBytes); err != nil {
+			return nil, 0, err
+		}
+		if n < len(entries) {
+			// the records that didn't fit are where the next read starts
+			return packed, s.baseOffset + uint64(entries[n].off), nil
+		}
+	}
+	return packed, next, nil
+}
+
+// Unpack decodes the records ReadPacked packed, decompressing and decrypting them like Read
+func (l *Log) Unpack(packed []byte) ([]*api.Record, error) {
+	var records []*api.Record
+	for len(packed) > 0 {
+		if len(packed) < lenWidth {
+			return nil, fmt.Errorf("packed records end part way through a length")
+		}
+		n := enc.Uint64(packed[:lenWidth])
+		packed = packed[lenWidth:]
+		if uint64(len(packed)) < n {
+			return nil, fmt.Errorf("packed records end part way through a record")
+		}
+		record, err := unmarshalRecord(packed[:n])
+		if err != nil {
+			return nil, err
+		}
+		if record, err = l.decrypt(record); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+		packed = packed[n:]
+	}
+	return records, nil
+}
@@ -0,0 +1,97 @@
+package log
+
+import (
+	"os"
+	"path"
+
+	"go.uber.org/zap"
+)
+
+// directory inside of the log's directory where spare segments are created before they're needed
+const preallocDir = ".prealloc"
+
+/*
+a spare segment is created ahead of time, before we know the offset the next segment will start at,
+so spares are created under a placeholder base offset in the prealloc directory and moved
+into the log's directory under the right base offset when the log rolls over to them.
+*/
+type spares struct {
+	ready     chan *segment // holds at most one spare that's ready to be rolled over to
+	preparing bool          // a spare is being created or is ready and hasn't been used yet
+	created   uint64        // number of spares created so far, used as their placeholder base offsets
+}
+
+func newSpares(dir string) (*spares, error) {
+	// spares left behind by a previous run were never used so they're thrown away
+	if err := os.RemoveAll(path.Join(dir, preallocDir)); err != nil {
+		return nil, err
+	}
+	return &spares{ready: make(chan *segment, 1)}, nil
+}
+
+/*
+starts creating a spare segment in the background once the active segment is half full.
+has to be called while holding the log's write lock
+*/
+func (l *Log) preallocate() {
+	if !l.Config.Segment.Preallocate || l.spares.preparing {
+		return
+	}
+	s := l.activeSegment
+	c := l.Config.Segment
+	halfFull := s.store.size >= c.MaxStoreBytes/2 ||
+		s.index.size >= c.MaxIndexBytes/2 ||
+		(c.MaxRecords > 0 && s.Len() >= c.MaxRecords/2)
+	if !halfFull {
+		return
+	}
+	l.spares.preparing = true
+	placeholder := l.spares.created
+	l.spares.created++
+	l.background.spawn(func() {
+		dir := path.Join(l.Dir, preallocDir)
+		var spare *segment
+		if err := os.MkdirAll(dir, 0755); err == nil {
+			spare, _ = newSegment(dir, placeholder, l.Config)
+		}
+		// sending nil on failure so the next roll creates its segment itself and we try again afterwards
+		l.spares.ready <- spare
+	})
+}
+
+/*
+rolls the log over to a new active segment starting at the given offset, using the spare segment if one
+is ready. when the spare isn't ready yet the segment is created right away and the spare will be used
+for the next roll instead
+*/
+func (l *Log) roll(off uint64) error {
+	select {
+	case spare := <-l.spares.ready:
+		l.spares.preparing = false
+		if spare != nil {
+			if err := spare.move(l.Dir, off); err == nil {
+				l.segments = append(l.segments, spare)
+				l.activeSegment = spare
+				l.logger().Debug("segment created", zap.Uint64("base_offset", off), zap.Bool("preallocated", true))
+				return nil
+			}
+			spare.Close()
+		}
+	default:
+	}
+	return l.newSegment(off)
+}
+
+// removes a spare that was never used, has to be called after the background tasks are stopped
+func (l *Log) removeSpares() error {
+	select {
+	case spare := <-l.spares.ready:
+		if spare != nil {
+			if err := spare.Remove(); err != nil {
+				return err
+			}
+		}
+	default:
+	}
+	return os.RemoveAll(path.Join(l.Dir, preallocDir))
+}
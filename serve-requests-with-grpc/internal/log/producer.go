@@ -0,0 +1,129 @@
+package log
+
+import (
+	"os"
+	"path"
+	"sync"
+
+	api "github.com/phaseharry/distributed-log/serve-requests-with-grpc/api/v1"
+)
+
+const (
+	producersFileName = "producers"
+	// 8 bytes each for the producer's id, its sequence number, and the offset the sequence was appended at
+	producerWidth = 8 * 3
+)
+
+/*
+producers is a sidecar file that tracks the last sequence number each idempotent producer appended so a
+produce that's retried (ex. after a network timeout) isn't appended twice. every idempotent append writes a
+{producerID}{sequence}{offset} entry and the file is replayed when the log is set up, keeping the newest
+entry of each producer. the replayed entries are rewritten into a new file so it doesn't keep growing with
+every append across restarts.
+*/
+type producers struct {
+	mu   sync.Mutex
+	file *os.File
+	last map[uint64]producerSequence
+}
+
+type producerSequence struct {
+	sequence, offset uint64
+}
+
+func newProducers(dir string) (*producers, error) {
+	name := path.Join(dir, producersFileName)
+	p := &producers{last: make(map[uint64]producerSequence)}
+	b, err := os.ReadFile(name)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	// a partially written entry at the end of the file (ex. crash mid write) is dropped
+	for pos := 0; pos+producerWidth <= len(b); pos += producerWidth {
+		entry := b[pos : pos+producerWidth]
+		p.last[enc.Uint64(entry[:8])] = producerSequence{
+			sequence: enc.Uint64(entry[8:16]),
+			offset:   enc.Uint64(entry[16:]),
+		}
+	}
+
+	tmp := name + swapSuffix
+	if p.file, err = os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND, 0644); err != nil {
+		return nil, err
+	}
+	for id, seq := range p.last {
+		if err = p.write(id, seq); err != nil {
+			return nil, err
+		}
+	}
+	if err = p.file.Sync(); err != nil {
+		return nil, err
+	}
+	if err = os.Rename(tmp, name); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+/*
+checks a producer's sequence number before its record is appended. returns the offset the sequence
+was already appended at and true when it's a retry of the producer's last sequence.
+a producer the log hasn't seen yet can start at any sequence
+*/
+func (p *producers) check(id, sequence uint64) (uint64, bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	last, ok := p.last[id]
+	switch {
+	case !ok || sequence == last.sequence+1:
+		return 0, false, nil
+	case sequence == last.sequence:
+		return last.offset, true, nil
+	default:
+		return 0, false, api.ErrOutOfOrderSequence{
+			ProducerId: id,
+			Sequence:   sequence,
+			Expected:   last.sequence + 1,
+		}
+	}
+}
+
+// records that the producer's sequence was appended at the offset
+func (p *producers) Append(id, sequence, offset uint64) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	seq := producerSequence{sequence: sequence, offset: offset}
+	if err := p.write(id, seq); err != nil {
+		return err
+	}
+	p.last[id] = seq
+	return nil
+}
+
+func (p *producers) write(id uint64, seq producerSequence) error {
+	entry := make([]byte, producerWidth)
+	enc.PutUint64(entry[:8], id)
+	enc.PutUint64(entry[8:16], seq.sequence)
+	enc.PutUint64(entry[16:], seq.offset)
+	_, err := p.file.Write(entry)
+	return err
+}
+
+// syncs the sequences appended so far to disk
+func (p *producers) Sync() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.file.Sync()
+}
+
+func (p *producers) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.file.Sync(); err != nil {
+		return err
+	}
+	return p.file.Close()
+}
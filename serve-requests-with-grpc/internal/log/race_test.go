@@ -0,0 +1,6 @@
+//go:build race
+
+package log
+
+// the race detector instruments memory accesses with allocations of its own, so tests counting allocations are skipped
+const raceEnabled = true
@@ -0,0 +1,71 @@
+package log
+
+import "time"
+
+const defaultRetentionCheckInterval = time.Minute
+
+/*
+starts enforcing the retention policies in the background if any policy is configured,
+so old segments get deleted without callers having to keep track of which offsets are safe to Truncate
+*/
+func (l *Log) startRetention() {
+	r := l.Config.Retention
+	if r.MaxAge == 0 && r.MaxBytes == 0 && r.MaxRecords == 0 {
+		return
+	}
+	interval := l.Config.Retention.CheckInterval
+	if interval == 0 {
+		interval = defaultRetentionCheckInterval
+	}
+	l.background.run(interval, l.EnforceRetention)
+}
+
+/*
+EnforceRetention deletes whole segments that have fallen outside of the configured retention policies.
+- segments whose newest record is older than Retention.MaxAge are removed
+- the oldest segments are removed until the log's total size is at or below Retention.MaxBytes
+- the oldest segments are removed until the log holds at most Retention.MaxRecords records
+the active segment is never removed so the log always has a segment to append to. offloaded segments count
+towards MaxBytes and are deleted from the remote object store as well.
+*/
+func (l *Log) EnforceRetention() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var total, records uint64
+	for _, s := range l.segments {
+		total += s.Size()
+		records += s.Len()
+	}
+
+	maxAge := l.Config.Retention.MaxAge
+	maxBytes := l.Config.Retention.MaxBytes
+	maxRecords := l.Config.Retention.MaxRecords
+	now := time.Now()
+
+	/*
+		segments are ordered oldest to newest so once we reach a segment that's inside
+		of both policies, every segment after it is too
+	*/
+	var removed int
+	for _, s := range l.segments {
+		if s == l.activeSegment {
+			break
+		}
+		expired := maxAge > 0 && now.Sub(s.modTime) > maxAge
+		oversized := maxBytes > 0 && total > maxBytes
+		overcount := maxRecords > 0 && records > maxRecords
+		if !expired && !oversized && !overcount {
+			break
+		}
+		total -= s.Size()
+		records -= s.Len()
+		if err := l.removeSegment(s); err != nil {
+			l.segments = l.segments[removed:]
+			return err
+		}
+		removed++
+	}
+	l.segments = l.segments[removed:]
+	return nil
+}
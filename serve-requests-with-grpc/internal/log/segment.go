@@ -1,9 +1,14 @@
 package log
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"os"
 	"path"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	api "github.com/phaseharry/distributed-log/serve-requests-with-grpc/api/v1"
 	"google.golang.org/protobuf/proto"
@@ -18,11 +23,44 @@ need the baseOffset and nextOffset to know what offsets to append new records un
 calculate the relative offsets for index entries. adding these values to store so we know when a segment
 is maxed out based on the config and a new segment will be created as the current segment for new records
 */
+var (
+	// the record's offset can't be stored in the segment's index because it's too far past the segment's base offset
+	ErrOffsetOverflow = errors.New("offset doesn't fit in the segment's 32 bit relative offsets")
+	ErrSealed         = errors.New("segment is sealed, it can't be written to")
+)
+
 type segment struct {
 	store                  *store
 	index                  *index
 	baseOffset, nextOffset uint64
 	config                 Config
+	modTime                time.Time // when the newest record was appended, used by the retention policies
+	dir                    string    // directory the segment's files are in
+	/*
+		tiered segments were uploaded to the log's remote object store. once their local files are
+		offloaded, remote is set and the store and index are nil until the segment is fetched again
+	*/
+	tiered, remote bool
+	remoteSize     uint64    // size of an offloaded segment's files
+	remoteLen      uint64    // number of records in an offloaded segment
+	fetchedAt      time.Time // when an offloaded segment was last fetched
+	/*
+		filter of the keys in the segment, built when the log rolls over from it. until then
+		the hashes of the keys appended to the segment are collected to build it from
+	*/
+	bloom *bloom
+	keys  []keyHash
+	// closed to appends, its files are read only and it doesn't hold on to any write resources
+	sealed bool
+	// written when the segment is sealed, nil until then
+	meta        *segmentMeta
+	firstAppend time.Time // when the first record was appended, zero if it isn't known
+	/*
+		cold segments are sealed segments whose files aren't opened until they're first read, they're
+		described by their metadata until then. opening guards opening them while holding the log's read lock
+	*/
+	cold    atomic.Bool
+	opening sync.Mutex
 }
 
 /*
@@ -35,35 +73,86 @@ func newSegment(dir string, baseOffset uint64, c Config) (*segment, error) {
 	s := &segment{
 		baseOffset: baseOffset,
 		config:     c,
+		dir:        dir,
 	}
 
 	var err error
 
-	// opening up store file that is associated with this baseOffset segment.
-	storeFile, err := os.OpenFile(
-		path.Join(dir, fmt.Sprintf("%d%s", baseOffset, ".store")),
-		os.O_RDWR|os.O_CREATE|os.O_APPEND,
-		0644,
-	)
+	/*
+		opening up store file that is associated with this baseOffset segment.
+		a store that was sealed is opened read only, its permissions don't allow anything else
+	*/
+	storeName := segmentPath(dir, baseOffset, ".store")
+	storeSealed := sealedFile(storeName)
+	flag := os.O_RDWR | os.O_CREATE | os.O_APPEND
+	if storeSealed {
+		flag = os.O_RDONLY
+	} else if err = upgradeLegacyStore(storeName); err != nil {
+		// stores were only sealed once they had a header
+		return nil, err
+	}
+	storeFile, err := os.OpenFile(storeName, flag, 0644)
 	if err != nil {
 		return nil, err
 	}
-	if s.store, err = newStore(storeFile); err != nil {
+	if s.store, err = newStore(storeFile, c); err != nil {
+		return nil, err
+	}
+	if storeSealed {
+		s.store.buf = nil
+	}
+	fi, err := storeFile.Stat()
+	if err != nil {
 		return nil, err
 	}
+	s.modTime = fi.ModTime()
 
-	// opening up index file that is associated with this baseOffset segment.
-	indexFile, err := os.OpenFile(
-		path.Join(dir, fmt.Sprintf("%d%s", baseOffset, ".index")),
-		os.O_RDWR|os.O_CREATE,
-		0644,
-	)
+	// opening up index file that is associated with this baseOffset segment, read only like the store if it was sealed
+	indexName := segmentPath(dir, baseOffset, ".index")
+	indexSealed := sealedFile(indexName)
+	flag = os.O_RDWR | os.O_CREATE
+	if indexSealed {
+		flag = os.O_RDONLY
+	}
+	indexFile, err := os.OpenFile(indexName, flag, 0644)
 	if err != nil {
 		return nil, err
 	}
-	if s.index, err = newIndex(indexFile, c); err != nil {
+	/*
+		the store has everything needed to rebuild the index, so an index that fails validation or
+		was lost (an empty index next to a store with records) is rebuilt instead of failing the segment
+	*/
+	if indexSealed {
+		s.index, err = newSealedIndex(indexFile, baseOffset)
+	} else {
+		s.index, err = newIndex(indexFile, baseOffset, c)
+	}
+	switch {
+	case errors.Is(err, ErrNotIndex) || errors.Is(err, ErrCorruptIndex):
+		indexFile.Close()
+		err = s.RebuildIndex()
+	case err == nil && s.index.len() == 0 && s.store.size > storeHeaderWidth:
+		err = s.RebuildIndex()
+	case err == nil && !s.index.sealed && !s.lastRecordStored():
+		err = s.RebuildIndex()
+	}
+	if err != nil {
 		return nil, err
 	}
+	// a crash part way through sealing can leave only one of the files sealed, the segment can't be appended to either way
+	s.sealed = s.store.buf == nil || s.index.sealed
+
+	/*
+		a sealed segment's metadata is only trusted if it matches the files, ex. the index could've been rebuilt.
+		if it doesn't match it's written again when the segment is sealed
+	*/
+	if s.sealed {
+		if meta, err := readMeta(segmentPath(dir, baseOffset, ".meta")); err == nil &&
+			meta.storeSize == s.store.size && meta.indexSize == s.index.size {
+			s.meta = meta
+			s.firstAppend = meta.firstAppend
+		}
+	}
 
 	/*
 	   reading the latest offset where the next record entry should be placed.
@@ -72,27 +161,118 @@ func newSegment(dir string, baseOffset uint64, c Config) (*segment, error) {
 	   - if there is an error when reading in -1 (where the last added entry is) then that means the file was empty and there is nothing to
 	   read, indicating that the offset where the next entry should be placed is the baseOffset
 	*/
-	if off, _, err := s.index.Read(-1); err != nil {
+	if s.meta != nil {
+		s.nextOffset = s.meta.nextOffset
+	} else if off, _, err := s.index.Read(-1); err != nil {
 		s.nextOffset = baseOffset
 	} else {
 		s.nextOffset = baseOffset + uint64(off) + 1
 	}
 
+	/*
+		reading in the segment's key filter or collecting its keys again if it doesn't have one yet.
+		a filter that can't be read is rebuilt when the segment is sealed
+	*/
+	if s.bloom, err = readBloom(segmentPath(dir, baseOffset, ".bloom")); err != nil {
+		s.bloom = nil
+		if err = s.forEach(func(record *api.Record) error {
+			if len(record.Key) > 0 {
+				s.keys = append(s.keys, hashKey(record.Key))
+			}
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+
 	return s, nil
 }
 
+/*
+creates a cold segment for a sealed segment whose metadata matches its files, without opening them.
+returns false when the segment has to be opened right away instead
+*/
+func newColdSegment(dir string, baseOffset uint64, c Config) (*segment, bool) {
+	storeName, indexName := segmentPath(dir, baseOffset, ".store"), segmentPath(dir, baseOffset, ".index")
+	storeInfo, err := os.Stat(storeName)
+	if err != nil || storeInfo.Mode().Perm()&0200 != 0 {
+		return nil, false
+	}
+	indexInfo, err := os.Stat(indexName)
+	if err != nil || indexInfo.Mode().Perm()&0200 != 0 {
+		return nil, false
+	}
+	meta, err := readMeta(segmentPath(dir, baseOffset, ".meta"))
+	if err != nil || meta.storeSize != uint64(storeInfo.Size()) || meta.indexSize != uint64(indexInfo.Size()) {
+		return nil, false
+	}
+	s := &segment{
+		baseOffset:  baseOffset,
+		nextOffset:  meta.nextOffset,
+		config:      c,
+		modTime:     storeInfo.ModTime(),
+		dir:         dir,
+		sealed:      true,
+		meta:        meta,
+		firstAppend: meta.firstAppend,
+	}
+	// without a filter key lookups open the segment to check it
+	s.bloom, _ = readBloom(segmentPath(dir, baseOffset, ".bloom"))
+	s.cold.Store(true)
+	return s, true
+}
+
+/*
+opens a cold segment's files the first time they're needed. it's safe to call while only holding the log's read lock,
+everything that reads the segment's store or index has to call it first
+*/
+func (s *segment) open() error {
+	if !s.cold.Load() {
+		return nil
+	}
+	s.opening.Lock()
+	defer s.opening.Unlock()
+	if !s.cold.Load() {
+		return nil
+	}
+	opened, err := newSegment(s.dir, s.baseOffset, s.config)
+	if err != nil {
+		return err
+	}
+	s.store, s.index = opened.store, opened.index
+	s.cold.Store(false)
+	return nil
+}
+
 func (s *segment) Append(record *api.Record) (offset uint64, err error) {
-	cur := s.nextOffset
-	record.Offset = cur
+	record.Offset = s.nextOffset
+	return s.write(record)
+}
+
+/*
+writes the record under the offset it already has. Append assigns the segment's nextOffset to records
+while compaction uses this directly to copy records into a new segment without changing their offsets,
+which leaves gaps where superseded records were dropped.
+*/
+func (s *segment) write(record *api.Record) (offset uint64, err error) {
+	cur := record.Offset
+	// checked before anything is written so a record that can't be indexed never makes it into the store
+	if cur < s.baseOffset || cur-s.baseOffset > math.MaxUint32 {
+		return 0, fmt.Errorf("%w: offset %d in the segment at %d", ErrOffsetOverflow, cur, s.baseOffset)
+	}
 
 	/*
-	   assigning the nextOffset value to the currently appended record and marshaling it (turning it into binary)
-	   to prep it for saving it in store file
+	   marshaling the record (turning it into binary) and compressing it with the
+	   configured codec to prep it for saving it in store file. the store copies the
+	   bytes into its buffer so the marshal buffer goes back to the pool afterwards
 	*/
-	p, err := proto.Marshal(record)
+	buf := getBuffer()
+	defer putBuffer(buf)
+	p, err := marshalRecord((*buf)[:0], s.config.Segment.Compression, record)
 	if err != nil {
 		return 0, err
 	}
+	*buf = p
 
 	_, pos, err := s.store.Append(p)
 	if err != nil {
@@ -103,22 +283,90 @@ func (s *segment) Append(record *api.Record) (offset uint64, err error) {
 			index offsets are relative to base offset.
 			ex. 0, 1, 2, etc. will be used for the same index file for each entry to an index and it will map that offset to the actual position of the record within a store file
 		*/
-		uint32(s.nextOffset-uint64(s.baseOffset)),
+		uint32(cur-uint64(s.baseOffset)),
 		pos,
 	); err != nil {
 		return 0, err
 	}
-	s.nextOffset++
+	if len(record.Key) > 0 {
+		s.keys = append(s.keys, hashKey(record.Key))
+	}
+	s.nextOffset = cur + 1
+	s.modTime = time.Now()
+	if s.firstAppend.IsZero() {
+		s.firstAppend = s.modTime
+	}
 	return cur, nil
 }
 
+/*
+Seal closes the segment to appends, called once the log rolls over from it or when a closed segment is opened again.
+- builds the filter of the segment's keys and writes it next to the segment's files if it doesn't have one yet.
+it's read back in whenever the segment is opened again
+- flushes the store and drops its write buffer, then truncates the index to its entries and maps it read only.
+both files are reopened read only and have their permissions made read only
+- writes the segment's metadata to a .meta file next to its files
+appends to a sealed segment fail with ErrSealed
+*/
+func (s *segment) Seal() error {
+	if s.remote || s.cold.Load() {
+		return nil
+	}
+	if s.bloom == nil {
+		b := newBloom(s.keys)
+		if err := writeBloom(segmentPath(s.dir, s.baseOffset, ".bloom"), b); err != nil {
+			return err
+		}
+		s.bloom = b
+		s.keys = nil
+	}
+	if err := s.store.seal(segmentPath(s.dir, s.baseOffset, ".store")); err != nil {
+		return err
+	}
+	if err := s.index.seal(segmentPath(s.dir, s.baseOffset, ".index")); err != nil {
+		return err
+	}
+	s.sealed = true
+	if s.meta != nil {
+		return nil
+	}
+	sum, err := s.checksum()
+	if err != nil {
+		return err
+	}
+	meta := &segmentMeta{
+		records:     s.Len(),
+		nextOffset:  s.nextOffset,
+		firstAppend: s.firstAppend,
+		lastAppend:  s.modTime,
+		storeSize:   s.store.size,
+		indexSize:   s.index.size,
+		checksum:    sum,
+	}
+	if err = writeMeta(segmentPath(s.dir, s.baseOffset, ".meta"), meta); err != nil {
+		return err
+	}
+	s.meta = meta
+	return nil
+}
+
+// reports whether the segment might have a record with the key, false means it definitely doesn't
+func (s *segment) mayContain(key keyHash) bool {
+	return s.bloom == nil || s.bloom.mayContain(key)
+}
+
 func (s *segment) Read(off uint64) (*api.Record, error) {
 	/*
 		1. given an absolute offset value, use it to get the position of the index entry by subtracting	the baseOffset to get the position of the index entry for offset (relative offset).
 		2. use the position value that the index points to to get the actual binary of the record
 		3. unmarshal the binary to get the actual record of the log
+		if the segment was compacted and the record at the offset was dropped, the next record
+		that's still in the segment is returned instead
 	*/
-	_, pos, err := s.index.Read(int64(off - s.baseOffset))
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	_, pos, err := s.index.Find(uint32(off - s.baseOffset))
 	if err != nil {
 		return nil, err
 	}
@@ -127,18 +375,203 @@ func (s *segment) Read(off uint64) (*api.Record, error) {
 	if err != nil {
 		return nil, err
 	}
+	record, err := unmarshalRecord(p)
+	if err != nil {
+		return nil, api.ErrCorrupt{Offset: off, Reason: err.Error()}
+	}
+	return record, nil
+}
+
+/*
+marshal buffers are pooled so appending a record doesn't allocate a new buffer for it. buffers that grew
+past maxPooledBuffer for a huge record are dropped instead of being kept around for every later append
+*/
+const maxPooledBuffer = 1 << 20
+
+var buffers = sync.Pool{New: func() any {
+	b := make([]byte, 0, 512)
+	return &b
+}}
+
+func getBuffer() *[]byte {
+	return buffers.Get().(*[]byte)
+}
+
+func putBuffer(b *[]byte) {
+	if cap(*b) > maxPooledBuffer {
+		return
+	}
+	buffers.Put(b)
+}
+
+// marshals the record and appends it to dst compressed with the codec
+func marshalRecord(dst []byte, c Compression, record *api.Record) ([]byte, error) {
+	// uncompressed records are marshaled straight in after the codec instead of being copied there
+	if c == CompressionNone {
+		return proto.MarshalOptions{}.MarshalAppend(append(dst, byte(c)), record)
+	}
+	buf := getBuffer()
+	defer putBuffer(buf)
+	p, err := proto.MarshalOptions{}.MarshalAppend((*buf)[:0], record)
+	if err != nil {
+		return nil, err
+	}
+	*buf = p
+	return compress(dst, c, p)
+}
+
+// decompresses a record read from the store and unmarshals it
+func unmarshalRecord(p []byte) (*api.Record, error) {
+	p, err := decompress(p)
+	if err != nil {
+		return nil, err
+	}
 	record := &api.Record{}
 	err = proto.Unmarshal(p, record)
 	return record, err
 }
 
+/*
+reports whether the record of the index's last entry made it to the store. records are indexed once they're in the
+store's write buffer, so ones that were still buffered when it failed to flush (ex. the disk filled up or the process
+crashed) are indexed without being stored
+*/
+func (s *segment) lastRecordStored() bool {
+	_, pos, err := s.index.Read(-1)
+	if err != nil {
+		return true
+	}
+	_, err = s.store.Read(pos)
+	return err == nil
+}
+
+/*
+RebuildIndex regenerates the segment's index from scratch by scanning the records in its store.
+the new index is written next to the old one and renamed over it once it's complete, so a crash part way
+through leaves the old index in place. scanning stops at the first record that can't be read, ex. one
+that was only partially written before a crash
+*/
+func (s *segment) RebuildIndex() error {
+	name := segmentPath(s.dir, s.baseOffset, ".index")
+	tmp, err := os.OpenFile(name+swapSuffix, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	rebuilt, err := newIndex(tmp, s.baseOffset, s.config)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	for pos := uint64(storeHeaderWidth); pos < s.store.size; {
+		p, err := s.store.Read(pos)
+		if err != nil {
+			break
+		}
+		record, err := unmarshalRecord(p)
+		if err != nil || record.Offset < s.baseOffset {
+			break
+		}
+		if err = rebuilt.Write(uint32(record.Offset-s.baseOffset), pos); err != nil {
+			rebuilt.Close()
+			return err
+		}
+		pos += lenWidth + uint64(len(p))
+	}
+	if err = rebuilt.Close(); err != nil {
+		return err
+	}
+
+	if s.index != nil {
+		if err = s.index.Close(); err != nil {
+			return err
+		}
+	}
+	if err = os.Rename(name+swapSuffix, name); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(name, os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	s.index, err = newIndex(f, s.baseOffset, s.config)
+	return err
+}
+
+// calls fn with every record in the segment in offset order
+func (s *segment) forEach(fn func(*api.Record) error) error {
+	if err := s.open(); err != nil {
+		return err
+	}
+	for i := uint64(0); i < s.index.len(); i++ {
+		_, pos, err := s.index.Read(int64(i))
+		if err != nil {
+			return err
+		}
+		p, err := s.store.Read(pos)
+		if err != nil {
+			return err
+		}
+		record, err := unmarshalRecord(p)
+		if err != nil {
+			return err
+		}
+		if err = fn(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flushes the segment's store and index to disk
+func (s *segment) Sync() error {
+	if err := s.store.Sync(); err != nil {
+		return err
+	}
+	return s.index.Sync()
+}
+
 /*
 returns a boolean indicating whether the index file or the store file has reached the max size of each defined in config.
 - index file max will be reached if there are a lot of small record entries
 - store fix max will be reached if there are a few huge record entries
+- the relative offsets will run out once the segment spans more than 2^32 offsets
 */
 func (s *segment) IsMaxed() bool {
-	return s.store.size >= s.config.Segment.MaxStoreBytes || s.index.size >= s.config.Segment.MaxIndexBytes
+	maxRecords := s.config.Segment.MaxRecords
+	return s.store.size >= s.config.Segment.MaxStoreBytes ||
+		s.index.size >= s.config.Segment.MaxIndexBytes ||
+		(maxRecords > 0 && s.Len() >= maxRecords) ||
+		s.nextOffset-s.baseOffset > math.MaxUint32
+}
+
+// returns the number of records in the segment, compacted segments have fewer records than offsets
+func (s *segment) Len() uint64 {
+	if s.remote {
+		return s.remoteLen
+	}
+	if s.cold.Load() {
+		return s.meta.records
+	}
+	return s.index.len()
+}
+
+// returns the number of bytes the segment's store and index files take up
+func (s *segment) Size() uint64 {
+	if s.remote {
+		return s.remoteSize
+	}
+	if s.cold.Load() {
+		return s.meta.storeSize + s.meta.indexSize
+	}
+	return s.store.size + s.index.size
+}
+
+// returns the size of the segment's store without opening it if it's cold
+func (s *segment) storeSize() uint64 {
+	if s.cold.Load() {
+		return s.meta.storeSize
+	}
+	return s.store.size
 }
 
 /*
@@ -147,19 +580,79 @@ to the log and index as well as deleting their respective files. when called, it
 the records has been processed already and storage can be cleared and be used by other entries
 */
 func (s *segment) Remove() error {
+	if err := s.removeFiles(); err != nil {
+		return err
+	}
+	// the key filter and metadata are only written once the segment is sealed
+	for _, ext := range []string{".bloom", ".meta"} {
+		if err := os.Remove(segmentPath(s.dir, s.baseOffset, ext)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// closes the segment and deletes its store and index files
+func (s *segment) removeFiles() error {
+	// an offloaded segment doesn't have any local files left to remove
+	if s.remote {
+		return nil
+	}
 	if err := s.Close(); err != nil {
 		return err
 	}
-	if err := os.Remove(s.index.Name()); err != nil {
+	if err := os.Remove(segmentPath(s.dir, s.baseOffset, ".index")); err != nil {
 		return err
 	}
-	if err := os.Remove(s.store.Name()); err != nil {
+	if err := os.Remove(segmentPath(s.dir, s.baseOffset, ".store")); err != nil {
 		return err
 	}
 	return nil
 }
 
+/*
+deletes the local files of a segment that was uploaded to the remote object store while keeping
+what the log needs to know about it to fetch it again. the key filter is kept so key lookups can
+skip the segment without fetching it
+*/
+func (s *segment) offload() error {
+	size, records := s.Size(), s.Len()
+	if err := s.removeFiles(); err != nil {
+		return err
+	}
+	s.store, s.index = nil, nil
+	s.cold.Store(false)
+	s.remote = true
+	s.remoteSize = size
+	s.remoteLen = records
+	return nil
+}
+
+/*
+moves an empty segment's files into the directory under a new base offset. used to turn a preallocated
+spare segment into the log's next active segment. the open files stay valid across the rename
+*/
+func (s *segment) move(dir string, baseOffset uint64) error {
+	for _, ext := range []string{".index", ".store"} {
+		if err := os.Rename(
+			segmentPath(s.dir, s.baseOffset, ext),
+			segmentPath(dir, baseOffset, ext),
+		); err != nil {
+			return err
+		}
+	}
+	s.index.setBaseOffset(baseOffset)
+	s.dir = dir
+	s.baseOffset = baseOffset
+	s.nextOffset = baseOffset
+	s.modTime = time.Now()
+	return nil
+}
+
 func (s *segment) Close() error {
+	if s.remote || s.cold.Load() {
+		return nil
+	}
 	if err := s.index.Close(); err != nil {
 		return err
 	}
@@ -169,6 +662,16 @@ func (s *segment) Close() error {
 	return nil
 }
 
+// reports whether the file's permissions were made read only when its segment was sealed
+func sealedFile(name string) bool {
+	fi, err := os.Stat(name)
+	return err == nil && fi.Mode().Perm()&0200 == 0
+}
+
+func segmentPath(dir string, baseOffset uint64, ext string) string {
+	return path.Join(dir, fmt.Sprintf("%d%s", baseOffset, ext))
+}
+
 /*
 util function that returns the nearest and lesser multiple of k in j.
 ex. nearestMultiple(9, 4) = 8
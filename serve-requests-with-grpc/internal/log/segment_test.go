@@ -1,13 +1,17 @@
 package log
 
 import (
+	"bytes"
+	"errors"
 	"io"
 	"io/ioutil"
+	"math"
 	"os"
 	"testing"
 
 	api "github.com/phaseharry/distributed-log/serve-requests-with-grpc/api/v1"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
 )
 
 func TestSegment(t *testing.T) {
@@ -18,7 +22,7 @@ func TestSegment(t *testing.T) {
 
 	c := Config{}
 	c.Segment.MaxStoreBytes = 1024
-	c.Segment.MaxIndexBytes = entWidth * 3
+	c.Segment.MaxIndexBytes = indexHeaderWidth + entWidth*3
 
 	s, err := newSegment(dir, 16, c)
 	require.NoError(t, err)
@@ -63,3 +67,403 @@ func TestSegment(t *testing.T) {
 	require.NoError(t, err)
 	require.False(t, s.IsMaxed())
 }
+
+// testing that a segment is maxed once it holds Segment.MaxRecords records
+func TestSegmentMaxRecords(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "segment-max-records-test")
+	defer os.RemoveAll(dir)
+
+	c := Config{}
+	c.Segment.MaxStoreBytes = 1024
+	c.Segment.MaxIndexBytes = 1024
+	c.Segment.MaxRecords = 2
+
+	s, err := newSegment(dir, 0, c)
+	require.NoError(t, err)
+	defer s.Close()
+	for i := 0; i < 2; i++ {
+		require.False(t, s.IsMaxed())
+		_, err = s.Append(&api.Record{Value: []byte("hello world")})
+		require.NoError(t, err)
+	}
+	require.True(t, s.IsMaxed())
+	require.Equal(t, uint64(2), s.Len())
+}
+
+/*
+testing that records are compressed with the configured codec and that a segment
+with records compressed by different codecs can still read all of them
+*/
+func TestSegmentCompression(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "segment-compression-test")
+	defer os.RemoveAll(dir)
+
+	want := &api.Record{Value: bytes.Repeat([]byte("hello world "), 100)}
+
+	c := Config{}
+	c.Segment.MaxStoreBytes = 1024 * 1024
+	c.Segment.MaxIndexBytes = 1024
+
+	codecs := []Compression{
+		CompressionNone,
+		CompressionGzip,
+		CompressionSnappy,
+		CompressionZstd,
+	}
+	var sizes []uint64
+	for _, codec := range codecs {
+		c.Segment.Compression = codec
+		s, err := newSegment(dir, 0, c)
+		require.NoError(t, err)
+
+		before := s.store.size
+		_, err = s.Append(want)
+		require.NoError(t, err)
+		sizes = append(sizes, s.store.size-before)
+
+		// every record appended so far was compressed with a different codec
+		for off := uint64(0); off < s.nextOffset; off++ {
+			got, err := s.Read(off)
+			require.NoError(t, err)
+			require.Equal(t, want.Value, got.Value)
+		}
+		require.NoError(t, s.Close())
+	}
+
+	for i := 1; i < len(codecs); i++ {
+		require.Less(t, sizes[i], sizes[0], codecs[i].String())
+	}
+}
+
+/*
+testing that a sealed segment can still be read but not appended to, that its files are truncated and read only,
+and that it's opened sealed again
+*/
+func TestSegmentSeal(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "segment-seal-test")
+	defer os.RemoveAll(dir)
+
+	c := Config{}
+	c.Segment.MaxStoreBytes = 1024
+	c.Segment.MaxIndexBytes = 1024
+	want := &api.Record{Value: []byte("hello world"), Key: []byte("key")}
+
+	s, err := newSegment(dir, 16, c)
+	require.NoError(t, err)
+	for range 3 {
+		_, err = s.Append(want)
+		require.NoError(t, err)
+	}
+	require.NoError(t, s.Seal())
+	require.True(t, s.sealed)
+	require.True(t, s.mayContain(hashKey(want.Key)))
+
+	_, err = s.Append(want)
+	require.ErrorIs(t, err, ErrSealed)
+	require.Equal(t, uint64(19), s.nextOffset)
+
+	check := func(s *segment) {
+		t.Helper()
+		for off := uint64(16); off < 19; off++ {
+			got, err := s.Read(off)
+			require.NoError(t, err)
+			require.Equal(t, want.Value, got.Value)
+		}
+		for _, ext := range []string{".store", ".index"} {
+			fi, err := os.Stat(segmentPath(dir, 16, ext))
+			require.NoError(t, err)
+			require.Equal(t, os.FileMode(0444), fi.Mode().Perm())
+		}
+		fi, err := os.Stat(segmentPath(dir, 16, ".index"))
+		require.NoError(t, err)
+		require.Equal(t, int64(indexHeaderWidth+entWidth*3), fi.Size())
+	}
+	check(s)
+	require.NoError(t, s.Close())
+
+	s, err = newSegment(dir, 16, c)
+	require.NoError(t, err)
+	defer s.Close()
+	require.True(t, s.sealed)
+	check(s)
+	_, err = s.Append(want)
+	require.ErrorIs(t, err, ErrSealed)
+}
+
+/*
+testing that a record whose offset doesn't fit in the index's relative offsets is rejected before it's stored,
+and that the segment reports being maxed once its relative offsets run out so the log rolls over first
+*/
+func TestSegmentOffsetOverflow(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "segment-offset-overflow-test")
+	defer os.RemoveAll(dir)
+
+	c := Config{}
+	c.Segment.MaxStoreBytes = 1024
+	c.Segment.MaxIndexBytes = 1024
+	s, err := newSegment(dir, 16, c)
+	require.NoError(t, err)
+	defer s.Close()
+
+	size := s.store.size
+	_, err = s.write(&api.Record{Value: []byte("hello world"), Offset: 16 + math.MaxUint32 + 1})
+	require.ErrorIs(t, err, ErrOffsetOverflow)
+	require.Equal(t, size, s.store.size)
+	require.Equal(t, uint64(0), s.Len())
+
+	off, err := s.write(&api.Record{Value: []byte("hello world"), Offset: 16 + math.MaxUint32})
+	require.NoError(t, err)
+	got, err := s.Read(off)
+	require.NoError(t, err)
+	require.Equal(t, off, got.Offset)
+	require.True(t, s.IsMaxed())
+}
+
+/*
+testing that a segment whose index was lost, corrupted or only partially written rebuilds it from its store,
+including the gaps in the offsets of a compacted segment
+*/
+func TestSegmentRebuildIndex(t *testing.T) {
+	c := Config{}
+	c.Segment.MaxStoreBytes = 1024
+	c.Segment.MaxIndexBytes = 1024
+
+	for scenario, damage := range map[string]func(name string) error{
+		"missing index": os.Remove,
+		"foreign index": func(name string) error {
+			return os.WriteFile(name, []byte("not an index file"), 0644)
+		},
+		"truncated entry": func(name string) error {
+			fi, err := os.Stat(name)
+			if err != nil {
+				return err
+			}
+			return os.Truncate(name, fi.Size()-1)
+		},
+	} {
+		t.Run(scenario, func(t *testing.T) {
+			dir, _ := os.MkdirTemp("", "segment-rebuild-index-test")
+			defer os.RemoveAll(dir)
+
+			s, err := newSegment(dir, 16, c)
+			require.NoError(t, err)
+			offsets := []uint64{16, 18, 19}
+			for _, off := range offsets {
+				_, err = s.write(&api.Record{Value: []byte("hello world"), Offset: off})
+				require.NoError(t, err)
+			}
+			require.NoError(t, s.Close())
+
+			require.NoError(t, damage(segmentPath(dir, 16, ".index")))
+
+			s, err = newSegment(dir, 16, c)
+			require.NoError(t, err)
+			defer s.Close()
+			require.Equal(t, uint64(len(offsets)), s.Len())
+			require.Equal(t, uint64(20), s.nextOffset)
+			for _, off := range offsets {
+				got, err := s.Read(off)
+				require.NoError(t, err)
+				require.Equal(t, off, got.Offset)
+			}
+		})
+	}
+}
+
+/*
+testing that a segment written in the baseline format, a store without a header whose records don't have a codec
+byte and an index without a header, is upgraded when it's opened and keeps its records
+*/
+func TestSegmentLegacyFormat(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "segment-legacy-test")
+	defer os.RemoveAll(dir)
+
+	var store, index []byte
+	for i := uint64(0); i < 3; i++ {
+		p, err := proto.Marshal(&api.Record{Value: []byte("hello world"), Offset: 16 + i})
+		require.NoError(t, err)
+		index = enc.AppendUint32(index, uint32(i))
+		index = enc.AppendUint64(index, uint64(len(store)))
+		store = enc.AppendUint64(store, uint64(len(p)))
+		store = append(store, p...)
+	}
+	require.NoError(t, os.WriteFile(segmentPath(dir, 16, ".store"), store, 0644))
+	require.NoError(t, os.WriteFile(segmentPath(dir, 16, ".index"), index, 0644))
+
+	c := Config{}
+	c.Segment.MaxStoreBytes = 1024
+	c.Segment.MaxIndexBytes = 1024
+	s, err := newSegment(dir, 16, c)
+	require.NoError(t, err)
+	require.Equal(t, uint64(19), s.nextOffset)
+	for off := uint64(16); off < 19; off++ {
+		got, err := s.Read(off)
+		require.NoError(t, err)
+		require.Equal(t, off, got.Offset)
+		require.Equal(t, []byte("hello world"), got.Value)
+	}
+	off, err := s.Append(&api.Record{Value: []byte("hello world")})
+	require.NoError(t, err)
+	require.Equal(t, uint64(19), off)
+	require.NoError(t, s.Close())
+
+	b, err := os.ReadFile(segmentPath(dir, 16, ".store"))
+	require.NoError(t, err)
+	require.Equal(t, storeMagic, string(b[:len(storeMagic)]))
+	s, err = newSegment(dir, 16, c)
+	require.NoError(t, err)
+	defer s.Close()
+	require.Equal(t, uint64(20), s.nextOffset)
+	got, err := s.Read(16)
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello world"), got.Value)
+}
+
+// testing that a legacy store with a torn or unparsable record fails to open instead of losing the records after it
+func TestSegmentLegacyCorrupt(t *testing.T) {
+	var store []byte
+	var first int
+	for i := uint64(0); i < 2; i++ {
+		p, err := proto.Marshal(&api.Record{Value: []byte("hello world"), Offset: i})
+		require.NoError(t, err)
+		store = enc.AppendUint64(store, uint64(len(p)))
+		store = append(store, p...)
+		if i == 0 {
+			first = len(store)
+		}
+	}
+	for scenario, corrupt := range map[string][]byte{
+		// the last record's length says it's longer than what was written
+		"torn record": append(store, append(enc.AppendUint64(nil, 64), "hello"...)...),
+		// the second record doesn't unmarshal, the record after it is still there
+		"unparsable record": append(append(append([]byte(nil), store[:first]...),
+			append(enc.AppendUint64(nil, 4), 0xff, 0xff, 0xff, 0xff)...), store[first:]...),
+	} {
+		t.Run(scenario, func(t *testing.T) {
+			dir, _ := ioutil.TempDir("", "segment-legacy-test")
+			defer os.RemoveAll(dir)
+			require.NoError(t, os.WriteFile(segmentPath(dir, 0, ".store"), corrupt, 0644))
+
+			c := Config{}
+			c.Segment.MaxStoreBytes = 1024
+			c.Segment.MaxIndexBytes = 1024
+			_, err := newSegment(dir, 0, c)
+			require.ErrorIs(t, err, ErrCorruptLegacyStore)
+			b, err := os.ReadFile(segmentPath(dir, 0, ".store"))
+			require.NoError(t, err)
+			require.Equal(t, corrupt, b)
+			_, err = os.Stat(segmentPath(dir, 0, ".store") + upgradeSuffix)
+			require.True(t, os.IsNotExist(err))
+		})
+	}
+}
+
+/*
+testing that a store write failing part way through an append, ex. the disk filling up or a sync failing, leaves
+the segment's next offset and index matching the records that made it to the store, before and after reopening
+*/
+func TestSegmentFaults(t *testing.T) {
+	small := &api.Record{Value: []byte("hello world")}
+	// bigger than the store's write buffer so it's written to the file while it's appended
+	large := &api.Record{Value: bytes.Repeat([]byte("a"), 8192)}
+
+	for scenario, test := range map[string]struct {
+		fault func() *faultyFile
+		// records appended after the fault is injected, the last one's append or the sync after it fails
+		records []*api.Record
+		// records that are in the segment once it's reopened
+		stored uint64
+	}{
+		"short write": {
+			fault:   func() *faultyFile { return &faultyFile{capacity: 100} },
+			records: []*api.Record{large},
+			stored:  2,
+		},
+		"disk full while syncing buffered records": {
+			fault:   func() *faultyFile { return &faultyFile{capacity: 0} },
+			records: []*api.Record{small, small},
+			stored:  2,
+		},
+		"failed sync": {
+			fault:   func() *faultyFile { return &faultyFile{capacity: -1, syncErr: errors.New("sync failed")} },
+			records: []*api.Record{small},
+			stored:  3,
+		},
+	} {
+		t.Run(scenario, func(t *testing.T) {
+			dir, _ := os.MkdirTemp("", "segment-faults-test")
+			defer os.RemoveAll(dir)
+
+			c := Config{}
+			c.Segment.MaxStoreBytes = 1024 * 1024
+			c.Segment.MaxIndexBytes = 1024
+			s, err := newSegment(dir, 16, c)
+			require.NoError(t, err)
+			for range 2 {
+				_, err = s.Append(small)
+				require.NoError(t, err)
+			}
+			require.NoError(t, s.Sync())
+
+			f := test.fault()
+			f.File = s.store.file.(*os.File)
+			s.store.file = f
+			s.store.buf.Reset(f)
+			for _, record := range test.records {
+				if _, err = s.Append(record); err != nil {
+					break
+				}
+			}
+			if err == nil {
+				err = s.Sync()
+			}
+			require.Error(t, err)
+			// an append that failed isn't indexed, buffered ones are until the store is reopened
+			require.Equal(t, 16+s.index.len(), s.nextOffset)
+			s.Close()
+
+			s, err = newSegment(dir, 16, c)
+			require.NoError(t, err)
+			defer s.Close()
+			require.Equal(t, test.stored, s.index.len())
+			require.Equal(t, 16+test.stored, s.nextOffset)
+			for off := uint64(16); off < s.nextOffset; off++ {
+				got, err := s.Read(off)
+				require.NoError(t, err)
+				require.Equal(t, off, got.Offset)
+			}
+			off, err := s.Append(small)
+			require.NoError(t, err)
+			require.Equal(t, 16+test.stored, off)
+			got, err := s.Read(off)
+			require.NoError(t, err)
+			require.Equal(t, small.Value, got.Value)
+		})
+	}
+}
+
+// testing that appending a record reuses pooled buffers instead of allocating new ones
+func TestSegmentAppendAllocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocations aren't counted under the race detector")
+	}
+	dir, _ := os.MkdirTemp("", "segment-allocs-test")
+	defer os.RemoveAll(dir)
+
+	c := Config{}
+	c.Segment.MaxStoreBytes = 1024 * 1024
+	c.Segment.MaxIndexBytes = 1024 * 1024
+	s, err := newSegment(dir, 0, c)
+	require.NoError(t, err)
+	defer s.Close()
+
+	record := &api.Record{Value: []byte("hello world")}
+	for _, codec := range []Compression{CompressionNone, CompressionSnappy, CompressionZstd} {
+		s.config.Segment.Compression = codec
+		allocs := testing.AllocsPerRun(100, func() {
+			_, err = s.Append(record)
+		})
+		require.NoError(t, err)
+		require.Zero(t, allocs, codec.String())
+	}
+}
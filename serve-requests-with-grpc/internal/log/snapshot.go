@@ -0,0 +1,336 @@
+package log
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path"
+
+	api "github.com/phaseharry/distributed-log/serve-requests-with-grpc/api/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	snapshotMagic = "DLOG"
+	// version 1 snapshots have plaintext values and no key state after each record
+	snapshotVersion = uint32(2)
+	// directory inside of the log's directory where a snapshot is restored before it replaces the log
+	restoreDir = ".restore"
+)
+
+// how a record's value is written in a snapshot, the key state written after the record
+const (
+	snapshotPlain    = byte(0) // not encrypted, ex. appended before encryption was enabled
+	snapshotSealed   = byte(1) // encrypted, followed by its wrapped data key
+	snapshotRedacted = byte(2) // encrypted and its data key was deleted
+)
+
+var (
+	crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+	ErrSnapshotChecksum = errors.New("snapshot checksum mismatch")
+)
+
+/*
+Snapshot writes the whole log to w in a streamable format that Restore can rebuild the log from:
+
+	{magic}{version}{segmentCount}
+	for every segment:
+		{baseOffset}{recordCount}
+		for every record: {recordLength}{marshaledRecord}{keyState}{wrappedDataKey if it's sealed}
+		{checksum}
+
+the checksum is a crc32 of the segment's section (everything from its baseOffset to its last record's key) so a
+corrupted or truncated snapshot is caught before it replaces anything. records are written decompressed, the log
+they're restored into compresses them with its own config. values of an encrypted log are written as they're stored,
+encrypted, along with their wrapped data keys so a snapshot doesn't expose what encryption and redaction protect.
+such a snapshot can only be restored into a log with the same master key, and its redacted records stay redacted.
+like ReadRange the log's lock is only held while taking a snapshot of the segments, records appended
+afterwards aren't part of the snapshot. offloaded segments are fetched from the remote object store first.
+*/
+func (l *Log) Snapshot(w io.Writer) error {
+	if err := l.rlockFetched(0, math.MaxUint64); err != nil {
+		return err
+	}
+	segments := make([]segmentRange, len(l.segments))
+	for i, s := range l.segments {
+		r, err := newSegmentRange(s)
+		if err != nil {
+			l.mu.RUnlock()
+			return err
+		}
+		segments[i] = r
+	}
+	keys := l.keys
+	l.mu.RUnlock()
+
+	bw := bufio.NewWriter(w)
+	if _, err := bw.WriteString(snapshotMagic); err != nil {
+		return err
+	}
+	if err := binary.Write(bw, enc, snapshotVersion); err != nil {
+		return err
+	}
+	if err := binary.Write(bw, enc, uint64(len(segments))); err != nil {
+		return err
+	}
+	for _, r := range segments {
+		crc := crc32.New(crcTable)
+		sw := io.MultiWriter(bw, crc)
+		if err := binary.Write(sw, enc, r.segment.baseOffset); err != nil {
+			return err
+		}
+		if err := binary.Write(sw, enc, r.entries); err != nil {
+			return err
+		}
+		for ; r.entry < r.entries; r.entry++ {
+			_, pos, err := r.index.readEntry(r.entry)
+			if err != nil {
+				return err
+			}
+			p, err := r.store.Read(pos)
+			if err != nil {
+				return err
+			}
+			record, err := unmarshalRecord(p)
+			if err != nil {
+				return err
+			}
+			if p, err = proto.Marshal(record); err != nil {
+				return err
+			}
+			if err = binary.Write(sw, enc, uint64(len(p))); err != nil {
+				return err
+			}
+			if _, err = sw.Write(p); err != nil {
+				return err
+			}
+			state, wrapped := snapshotPlain, []byte(nil)
+			if keys != nil {
+				var encrypted bool
+				if wrapped, encrypted = keys.Wrapped(record.Offset); encrypted && wrapped == nil {
+					state = snapshotRedacted
+				} else if encrypted {
+					state = snapshotSealed
+				}
+			}
+			if _, err = sw.Write(append([]byte{state}, wrapped...)); err != nil {
+				return err
+			}
+		}
+		if err := binary.Write(bw, enc, crc.Sum32()); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+/*
+Restore replaces the log's records with the ones in a snapshot written by Snapshot. the snapshot is rebuilt
+into a staging directory first and every segment's checksum is verified before the log's existing segments
+are touched, so a corrupted snapshot leaves the log as it was. the log's annotations and producer sequences are cleared
+since they belonged to the records that were replaced, and its uploaded segments are deleted from the remote object store.
+the snapshot's redacted records are annotated as redacted again. a snapshot of an encrypted log fails with
+ErrEncryptionDisabled if the log isn't encrypted and ErrMasterKeyMismatch if it's encrypted with another master key.
+*/
+func (l *Log) Restore(r io.Reader) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	staging := path.Join(l.Dir, restoreDir)
+	if err := os.RemoveAll(staging); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(staging, 0755); err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+
+	if err := l.stage(bufio.NewReader(r), staging); err != nil {
+		return err
+	}
+
+	// swapping the staged files in for the log's current ones and reading them back in
+	if err := l.unload(); err != nil {
+		return err
+	}
+	for _, s := range l.segments {
+		for _, ext := range []string{".index", ".store", ".bloom", ".meta"} {
+			if err := os.Remove(segmentPath(l.Dir, s.baseOffset, ext)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		if s.tiered {
+			if err := l.tier.deleteObjects(s.baseOffset); err != nil {
+				return err
+			}
+		}
+	}
+	for _, name := range []string{annotationsFileName, keysFileName, tieredFileName, producersFileName} {
+		if err := os.Remove(path.Join(l.Dir, name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	files, err := os.ReadDir(staging)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err := os.Rename(path.Join(staging, file.Name()), path.Join(l.Dir, file.Name())); err != nil {
+			return err
+		}
+	}
+	return l.load()
+}
+
+// rebuilds the snapshot's segments (and data keys if the log is encrypted) in the staging directory
+func (l *Log) stage(r io.Reader, dir string) error {
+	magic := make([]byte, len(snapshotMagic))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return err
+	}
+	if string(magic) != snapshotMagic {
+		return fmt.Errorf("not a log snapshot")
+	}
+	var version uint32
+	if err := binary.Read(r, enc, &version); err != nil {
+		return err
+	}
+	if version == 0 || version > snapshotVersion {
+		return fmt.Errorf("unsupported snapshot version: %d", version)
+	}
+	var segments uint64
+	if err := binary.Read(r, enc, &segments); err != nil {
+		return err
+	}
+
+	st := staged{version: version, config: l.Config}
+	var err error
+	if len(l.Config.Encryption.MasterKey) > 0 {
+		if st.keys, err = newKeystore(dir, l.Config.Encryption.MasterKey); err != nil {
+			return err
+		}
+		defer st.keys.Close()
+	}
+	if st.annotations, err = newAnnotations(dir); err != nil {
+		return err
+	}
+	defer st.annotations.Close()
+
+	for ; segments > 0; segments-- {
+		if err := st.segment(r, dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// the snapshot being staged and the sidecars its records' keys and redactions are staged into
+type staged struct {
+	version     uint32
+	config      Config
+	keys        *keystore // nil if the log isn't encrypted
+	annotations *annotations
+}
+
+func (st staged) segment(r io.Reader, dir string) (err error) {
+	crc := crc32.New(crcTable)
+	tr := io.TeeReader(r, crc)
+
+	var baseOffset, records uint64
+	if err := binary.Read(tr, enc, &baseOffset); err != nil {
+		return err
+	}
+	if err := binary.Read(tr, enc, &records); err != nil {
+		return err
+	}
+	s, err := newSegment(dir, baseOffset, st.config)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := s.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	for ; records > 0; records-- {
+		var size uint64
+		if err := binary.Read(tr, enc, &size); err != nil {
+			return err
+		}
+		if size > math.MaxInt64 {
+			return fmt.Errorf("corrupt snapshot record size: %d", size)
+		}
+		// copying instead of allocating size bytes up front in case a corrupted size is huge
+		var buf bytes.Buffer
+		if _, err := io.CopyN(&buf, tr, int64(size)); err != nil {
+			return err
+		}
+		record := &api.Record{}
+		if err := proto.Unmarshal(buf.Bytes(), record); err != nil {
+			return err
+		}
+		if err := st.key(tr, record); err != nil {
+			return err
+		}
+		if _, err := s.write(record); err != nil {
+			return err
+		}
+	}
+
+	var checksum uint32
+	if err := binary.Read(r, enc, &checksum); err != nil {
+		return err
+	}
+	if checksum != crc.Sum32() {
+		return ErrSnapshotChecksum
+	}
+	return nil
+}
+
+/*
+reads the record's key state and stages its key. plaintext values are encrypted with a new data key if the log is
+encrypted, encrypted ones keep their wrapped data key and redacted ones are annotated as redacted again
+*/
+func (st staged) key(r io.Reader, record *api.Record) error {
+	state := []byte{snapshotPlain}
+	if st.version > 1 {
+		if _, err := io.ReadFull(r, state); err != nil {
+			return err
+		}
+	}
+	switch state[0] {
+	case snapshotPlain:
+		if st.keys == nil {
+			return nil
+		}
+		var err error
+		record.Value, err = st.keys.Seal(record.Offset, record.Value)
+		return err
+	case snapshotSealed, snapshotRedacted:
+	default:
+		return fmt.Errorf("corrupt snapshot key state: %d", state[0])
+	}
+	if st.keys == nil {
+		return fmt.Errorf("snapshot has encrypted records: %w", ErrEncryptionDisabled)
+	}
+	if state[0] == snapshotRedacted {
+		if err := st.keys.Add(record.Offset, nil); err != nil {
+			return err
+		}
+		_, err := st.annotations.Annotate(record.Offset, api.Annotation_ANNOTATION_REDACTED)
+		return err
+	}
+	wrapped := make([]byte, wrappedKeyWidth)
+	if _, err := io.ReadFull(r, wrapped); err != nil {
+		return err
+	}
+	return st.keys.Add(record.Offset, wrapped)
+}
@@ -3,8 +3,14 @@ package log
 import (
 	"bufio"
 	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"sync"
+
+	api "github.com/phaseharry/distributed-log/serve-requests-with-grpc/api/v1"
+	"google.golang.org/protobuf/proto"
 )
 
 /*
@@ -34,36 +40,250 @@ var (
 
 const (
 	lenWidth = 8 // 8 for 8 bytes used to store the record's length
+
+	storeMagic   = "DLST"
+	storeVersion = uint16(1)
+	/*
+		every store file starts with a header: {magic}{version}{byteOrder}{reserved}
+		- magic: 4 bytes that mark the file as a store so foreign files are rejected when they're opened
+		- version: 2 byte format version so stores written in a newer format can be told apart from older ones
+		- byteOrder: 1 byte flag for the byte order the record lengths are written in
+		- reserved: 1 byte for future flags
+		the header itself is always big endian. records start right after it.
+	*/
+	storeHeaderWidth = 8
+
+	bigEndianFlag    = 0
+	littleEndianFlag = 1
+
+	// suffix of the copy a legacy store is upgraded into before it's renamed over the original
+	upgradeSuffix = ".upgrade"
 )
 
+var ErrNotStore = errors.New("file isn't a store, its header doesn't start with the store magic")
+
+/*
+the subset of *os.File's methods the store uses. the store depends on this instead of *os.File
+so tests can wrap files to inject slow writes and write errors (ex. a full disk)
+*/
+type file interface {
+	io.ReaderAt
+	io.Writer
+	io.Closer
+	Name() string
+	Stat() (os.FileInfo, error)
+	Sync() error
+}
+
 /*
 wrapper around a file that appends and read bytes
 from a file
 */
 type store struct {
-	*os.File
-	mu   sync.Mutex
-	buf  *bufio.Writer
-	size uint64
+	file
+	mu     sync.Mutex
+	buf    *bufio.Writer // nil once the store is sealed, it's only read from afterwards
+	size   uint64
+	order  binary.ByteOrder // byte order of the record lengths, read from the store's header
+	lenBuf [lenWidth]byte   // scratch space for the length prefix of the record being appended
 }
 
-func newStore(f *os.File) (*store, error) {
-	fi, err := os.Stat(f.Name())
+/*
+opens a store over the file. an empty file is given a header with the configured byte order,
+otherwise the file's header is validated and the store uses the byte order it was written with
+*/
+func newStore(f file, c Config) (*store, error) {
+	fi, err := f.Stat()
 	if err != nil {
 		return nil, err
 	}
-	size := uint64(fi.Size())
-	return &store{
-		File: f,
-		size: size,
+	s := &store{
+		file: f,
+		size: uint64(fi.Size()),
 		buf:  bufio.NewWriter(f),
-	}, nil
+	}
+	if s.size == 0 {
+		err = s.writeHeader(c.Segment.ByteOrder)
+	} else {
+		err = s.readHeader()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func storeHeader(byteOrderFlag byte) []byte {
+	header := make([]byte, storeHeaderWidth)
+	copy(header, storeMagic)
+	binary.BigEndian.PutUint16(header[4:6], storeVersion)
+	header[6] = byteOrderFlag
+	return header
+}
+
+// writes the header of a new store straight to the file so the file is never left without one
+func (s *store) writeHeader(order binary.ByteOrder) error {
+	var header []byte
+	switch order {
+	case nil, binary.BigEndian:
+		s.order = binary.BigEndian
+		header = storeHeader(bigEndianFlag)
+	case binary.LittleEndian:
+		s.order = binary.LittleEndian
+		header = storeHeader(littleEndianFlag)
+	default:
+		return fmt.Errorf("unsupported store byte order: %s", order)
+	}
+	if _, err := s.file.Write(header); err != nil {
+		return err
+	}
+	s.size = storeHeaderWidth
+	return nil
+}
+
+func (s *store) readHeader() error {
+	header := make([]byte, storeHeaderWidth)
+	if _, err := s.file.ReadAt(header, 0); err != nil {
+		if err == io.EOF {
+			return ErrNotStore
+		}
+		return err
+	}
+	if string(header[:4]) != storeMagic {
+		return ErrNotStore
+	}
+	if version := binary.BigEndian.Uint16(header[4:6]); version != storeVersion {
+		return fmt.Errorf("unsupported store format version: %d", version)
+	}
+	switch header[6] {
+	case bigEndianFlag:
+		s.order = binary.BigEndian
+	case littleEndianFlag:
+		s.order = binary.LittleEndian
+	default:
+		return fmt.Errorf("unsupported store byte order flag: %d", header[6])
+	}
+	return nil
+}
+
+// ErrCorruptLegacyStore is returned when a store written before stores had a header has a torn or unparsable record
+var ErrCorruptLegacyStore = errors.New("legacy store has a torn or unparsable record")
+
+/*
+upgrades a store written before stores had a header to the current format. those are version 0 stores: their
+records are prefixed with their big endian length from the start of the file and were never compressed, so they
+don't have a codec byte either. the records are streamed into a copy after a header with the uncompressed codec and
+the copy is renamed over the original once it's synced, so a crash part way through leaves the legacy store to
+upgrade again. the positions in the segment's index don't match the copy, legacy indexes don't have a header either
+so they fail validation and are rebuilt.
+- stores that already have a header are left as they are after reading just the header
+- stores that don't start with a record aren't legacy stores and are left for newStore to reject
+- a torn or unparsable record after the first one fails with ErrCorruptLegacyStore instead of dropping
+the records after it, the original is left as it was
+*/
+func upgradeLegacyStore(name string) error {
+	f, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	header := make([]byte, storeHeaderWidth)
+	if _, err := io.ReadFull(f, header); err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if string(header[:len(storeMagic)]) == storeMagic {
+		return nil
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	size := uint64(fi.Size())
+
+	tmp, err := os.OpenFile(name+upgradeSuffix, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	// the copy is closed before it's renamed, removing it afterwards only cleans up one that wasn't
+	defer func() {
+		tmp.Close()
+		os.Remove(name + upgradeSuffix)
+	}()
+	r := bufio.NewReader(io.NewSectionReader(f, 0, fi.Size()))
+	w := bufio.NewWriter(tmp)
+	if _, err = w.Write(storeHeader(bigEndianFlag)); err != nil {
+		return err
+	}
+	for pos := uint64(0); pos < size; {
+		p, err := readLegacyRecord(r, size-pos)
+		if err != nil {
+			return err
+		}
+		if p == nil {
+			if pos == 0 {
+				return nil
+			}
+			return fmt.Errorf("%s at position %d: %w", name, pos, ErrCorruptLegacyStore)
+		}
+		if _, err = w.Write(enc.AppendUint64(nil, codecWidth+uint64(len(p)))); err != nil {
+			return err
+		}
+		if err = w.WriteByte(byte(CompressionNone)); err != nil {
+			return err
+		}
+		if _, err = w.Write(p); err != nil {
+			return err
+		}
+		pos += lenWidth + uint64(len(p))
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(name+upgradeSuffix, name)
+}
+
+// reads the next record of a legacy store that has left bytes after it, nil if the record is torn or doesn't parse
+func readLegacyRecord(r io.Reader, left uint64) ([]byte, error) {
+	if left < lenWidth {
+		return nil, nil
+	}
+	length := make([]byte, lenWidth)
+	if _, err := io.ReadFull(r, length); err != nil {
+		return nil, err
+	}
+	// the length is checked against what's left of the file before anything is allocated for it
+	n := enc.Uint64(length)
+	if n > left-lenWidth {
+		return nil, nil
+	}
+	p := make([]byte, n)
+	if _, err := io.ReadFull(r, p); err != nil {
+		return nil, err
+	}
+	if proto.Unmarshal(p, &api.Record{}) != nil {
+		return nil, nil
+	}
+	return p, nil
 }
 
 func (s *store) Append(p []byte) (uint64, uint64, error) {
 	// making sure that we have exclusive write access when append a record
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	if s.buf == nil {
+		return 0, 0, ErrSealed
+	}
 
 	// where the current record will be stored.
 	position := s.size
@@ -75,7 +295,8 @@ func (s *store) Append(p []byte) (uint64, uint64, error) {
 		in our store before we store our data. Since we're using uint64 to save the length of the byte array, we use 8 bytes just to save the size of the record.
 		see: https://go.dev/ref/spec#Size_and_alignment_guarantees
 	*/
-	if err := binary.Write(s.buf, enc, uint64(len(p))); err != nil {
+	s.order.PutUint64(s.lenBuf[:], uint64(len(p)))
+	if _, err := s.buf.Write(s.lenBuf[:]); err != nil {
 		return 0, 0, err
 	}
 
@@ -117,7 +338,7 @@ func (s *store) Read(pos uint64) ([]byte, error) {
 		Write anything that's still within buffers to the actual store file incase we're trying
 		to read a file that hasn't been flushed to disk (file) yet.
 	*/
-	if err := s.buf.Flush(); err != nil {
+	if err := s.flush(); err != nil {
 		return nil, err
 	}
 	/*
@@ -130,7 +351,7 @@ func (s *store) Read(pos uint64) ([]byte, error) {
 		Using the passed in position (offset that's a size value of where to start looking), read in exactly len(size) (lenWidth) bytes into
 		the size slice.
 	*/
-	if _, err := s.File.ReadAt(size, int64(pos)); err != nil {
+	if _, err := s.file.ReadAt(size, int64(pos)); err != nil {
 		return nil, err
 	}
 
@@ -139,8 +360,13 @@ func (s *store) Read(pos uint64) ([]byte, error) {
 		in the largest address. Then using the initial position size offset and adding lengthWidth (8) to offset the size value, we read in the number of bytes
 		that's the size of our record.
 	*/
-	record := make([]byte, enc.Uint64(size))
-	if _, err := s.File.ReadAt(record, int64(pos+lenWidth)); err != nil {
+	// a length past the end of the store was only partially written, ex. before a crash
+	length := s.order.Uint64(size)
+	if length > s.size-pos-lenWidth {
+		return nil, io.ErrUnexpectedEOF
+	}
+	record := make([]byte, length)
+	if _, err := s.file.ReadAt(record, int64(pos+lenWidth)); err != nil {
 		return nil, err
 	}
 
@@ -157,24 +383,151 @@ func (s *store) ReadAt(p []byte, off int64) (int, error) {
 	defer s.mu.Unlock()
 
 	// Flushing buffer to disk. If error, stop processing
-	if err := s.buf.Flush(); err != nil {
+	if err := s.flush(); err != nil {
 		return 0, err
 	}
-	return s.File.ReadAt(p, off)
+	return s.file.ReadAt(p, off)
+}
+
+/*
+appends the records at the entries' positions to dst, each one prefixed with its big endian length, stopping before
+the record that would grow dst past maxBytes unless dst is empty. the records are stored back to back so they're
+read with a single read. returns how many of the entries were packed
+*/
+func (s *store) readPacked(dst []byte, entries []indexEntry, maxBytes uint64) ([]byte, int, error) {
+	if len(entries) == 0 {
+		return dst, 0, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.flush(); err != nil {
+		return nil, 0, err
+	}
+
+	// the records before the last one end where the record after them starts
+	size := make([]byte, lenWidth)
+	lastPos := entries[len(entries)-1].pos
+	if _, err := s.file.ReadAt(size, int64(lastPos)); err != nil {
+		return nil, 0, err
+	}
+	end := lastPos + lenWidth + s.order.Uint64(size)
+	n, total := 0, uint64(len(dst))
+	for ; n < len(entries); n++ {
+		recordEnd := end
+		if n+1 < len(entries) {
+			recordEnd = entries[n+1].pos
+		}
+		recordSize := recordEnd - entries[n].pos
+		if maxBytes > 0 && total > 0 && total+recordSize > maxBytes {
+			break
+		}
+		total += recordSize
+	}
+	if n == 0 {
+		return dst, 0, nil
+	}
+	if n < len(entries) {
+		end = entries[n].pos
+	}
+
+	start := entries[0].pos
+	buf := make([]byte, end-start)
+	if _, err := s.file.ReadAt(buf, int64(start)); err != nil {
+		return nil, 0, err
+	}
+	for _, e := range entries[:n] {
+		p := buf[e.pos-start:]
+		length := s.order.Uint64(p[:lenWidth])
+		if uint64(len(p)) < lenWidth+length {
+			return nil, 0, fmt.Errorf("record at position %d runs past the records read", e.pos)
+		}
+		dst = enc.AppendUint64(dst, length)
+		dst = append(dst, p[lenWidth:lenWidth+length]...)
+	}
+	return dst, n, nil
+}
+
+// flushes the buffered records to the file and fsyncs it so they're on disk
+func (s *store) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// a sealed store was synced when it was sealed
+	if s.buf == nil {
+		return nil
+	}
+	if err := s.buf.Flush(); err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+// flushes the write buffer to the file, sealed stores don't have one. has to be called while holding the lock
+func (s *store) flush() error {
+	if s.buf == nil {
+		return nil
+	}
+	return s.buf.Flush()
+}
+
+/*
+flushes and syncs the store, then reopens its file read only and drops the write buffer since the store
+won't be written to again. the file's permissions are made read only too so nothing else writes to it either.
+the file is reopened by name, which is passed in since the file could've been moved since it was opened
+*/
+func (s *store) seal(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.buf == nil {
+		return nil
+	}
+	if err := s.buf.Flush(); err != nil {
+		return err
+	}
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+	if err := os.Chmod(name, 0444); err != nil {
+		return err
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	if err = s.file.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	s.file = f
+	s.buf = nil
+	return nil
 }
 
 /*
 Closing the current file connection to the store.
 1. flush any existing bytes within buffer to file (persist any buffered data before closing file)
-2. close the file connection
+2. make sure the file's contents are flushed to disk like the index does when it's closed
+3. close the file connection
 */
 func (s *store) Close() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if err := s.buf.Flush(); err != nil {
-		return err
+	if s.buf == nil {
+		return s.file.Close()
 	}
 
-	return s.File.Close()
+	/*
+		closing the file even if the flush or sync fails (ex. the disk is full)
+		so a failing store doesn't leak its file descriptor, and returning the first error
+	*/
+	err := s.buf.Flush()
+	if err == nil {
+		err = s.file.Sync()
+	}
+	if closeErr := s.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
 }
@@ -1,9 +1,13 @@
 package log
 
 import (
+	"encoding/binary"
 	"io/ioutil"
 	"os"
+	"sync"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -24,7 +28,7 @@ func TestStoreAppendRead(t *testing.T) {
 	defer os.Remove(f.Name())
 
 	// Creates new store connection using the created temp file
-	s, err := newStore(f)
+	s, err := newStore(f, Config{})
 	require.NoError(t, err)
 
 	// testing various store operations
@@ -36,7 +40,7 @@ func TestStoreAppendRead(t *testing.T) {
 	 Create another store reference with the same file to test that it can
 	 read from the same file again
 	*/
-	s, err = newStore(f)
+	s, err = newStore(f, Config{})
 	require.NoError(t, err)
 	testRead(t, s)
 }
@@ -53,7 +57,7 @@ func testAppend(t *testing.T, s *store) {
 
 		/*
 			record i = 1
-			initial recordPosition will be 0 since we start with an empty file.
+			initial recordPosition will be right after the store's header since we start with an empty file.
 			since we're storing each entry as ${sizeOfRecord}${record}, the bytesWritten
 			will equal to 8 bytes (the amount of space we allocate to store size of record)
 			plus the actual number of bytes for the record.
@@ -66,16 +70,16 @@ func testAppend(t *testing.T, s *store) {
 
 			recordPosition will the start of where the current record is stored
 		*/
-		require.Equal(t, recordPosition+bytesWritten, width*i)
+		require.Equal(t, recordPosition+bytesWritten, storeHeaderWidth+width*i)
 	}
 }
 
 func testRead(t *testing.T, s *store) {
 	t.Helper()
-	pos := uint64(0)
+	pos := uint64(storeHeaderWidth)
 	/*
 		test case to read the records we stored as part of the testAppend function.
-		starting at position 0, we read the first record & test that the returned byte record is
+		starting right after the header, we read the first record & test that the returned byte record is
 		the same as the one we wrote earlier "write".
 		We need increment our position variable by adding the width (size of each record entry) so
 		we can read the next entry.
@@ -90,14 +94,14 @@ func testRead(t *testing.T, s *store) {
 
 func testReadAt(t *testing.T, s *store) {
 	t.Helper()
-	off := int64(0)
+	off := int64(storeHeaderWidth)
 
 	// testing to read the same 3 records we initially created in the testAppend function.
 
 	for i := uint64(1); i < 4; i++ {
 		/*
 		  reading the first 8 bytes to get the size of the record
-		  using the initial offset of 0 to get the first record's size
+		  using the offset right after the header to get the first record's size
 		*/
 		recordSize := make([]byte, lenWidth)
 		recordSizeByteCount, err := s.ReadAt(recordSize, off)
@@ -141,7 +145,7 @@ func TestStoreClose(t *testing.T) {
 	   1. create new store with that temp file
 	   2. append the test "write" record entry
 	*/
-	s, err := newStore(f)
+	s, err := newStore(f, Config{})
 	require.NoError(t, err)
 	_, _, err = s.Append(write)
 	require.NoError(t, err)
@@ -156,6 +160,69 @@ func TestStoreClose(t *testing.T) {
 	require.True(t, afterSize > beforeSize)
 }
 
+/*
+testing that a store written little endian keeps reading and appending little endian after it's reopened,
+even when the store is reopened with a config that asks for big endian
+*/
+func TestStoreByteOrder(t *testing.T) {
+	f, err := os.CreateTemp("", "store_byte_order_test")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+
+	c := Config{}
+	c.Segment.ByteOrder = binary.LittleEndian
+	s, err := newStore(f, c)
+	require.NoError(t, err)
+	_, pos, err := s.Append(write)
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+
+	// the record's length is written in the store's byte order
+	b, err := os.ReadFile(f.Name())
+	require.NoError(t, err)
+	require.Equal(t, uint64(len(write)), binary.LittleEndian.Uint64(b[pos:pos+lenWidth]))
+
+	f, err = os.OpenFile(f.Name(), os.O_RDWR|os.O_APPEND, 0644)
+	require.NoError(t, err)
+	c.Segment.ByteOrder = binary.BigEndian
+	s, err = newStore(f, c)
+	require.NoError(t, err)
+	defer s.Close()
+	require.Equal(t, binary.ByteOrder(binary.LittleEndian), s.order)
+	_, next, err := s.Append(write)
+	require.NoError(t, err)
+	for _, p := range []uint64{pos, next} {
+		read, err := s.Read(p)
+		require.NoError(t, err)
+		require.Equal(t, write, read)
+	}
+}
+
+// testing that files without a store header, or with a newer format version, aren't opened as stores
+func TestStoreHeader(t *testing.T) {
+	for scenario, contents := range map[string][]byte{
+		"foreign file":        []byte("not a store file"),
+		"truncated header":    []byte("DLS"),
+		"unsupported version": {'D', 'L', 'S', 'T', 0, 2, bigEndianFlag, 0},
+		"unknown byte order":  {'D', 'L', 'S', 'T', 0, 1, 7, 0},
+	} {
+		t.Run(scenario, func(t *testing.T) {
+			f, err := os.CreateTemp("", "store_header_test")
+			require.NoError(t, err)
+			defer os.Remove(f.Name())
+			defer f.Close()
+			_, err = f.Write(contents)
+			require.NoError(t, err)
+
+			_, err = newStore(f, Config{})
+			require.Error(t, err)
+			if scenario == "foreign file" || scenario == "truncated header" {
+				require.ErrorIs(t, err, ErrNotStore)
+			}
+		})
+	}
+}
+
 // test util to open file and get size
 func openFile(name string) (file *os.File, size int64, err error) {
 	f, err := os.OpenFile(
@@ -172,3 +239,154 @@ func openFile(name string) (file *os.File, size int64, err error) {
 	}
 	return f, fi.Size(), nil
 }
+
+/*
+faultyFile wraps a file to simulate a slow or full disk so the store's write path errors can be tested.
+- latency: delay added to every write and sync
+- capacity: number of bytes that can still be written before writes fail with ENOSPC. a write that
+doesn't fit is partially written up to the capacity. a negative capacity never fills up
+- syncErr: error returned by Sync instead of syncing
+*/
+type faultyFile struct {
+	*os.File
+	mu       sync.Mutex
+	latency  time.Duration
+	capacity int
+	syncErr  error
+}
+
+func (f *faultyFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	time.Sleep(f.latency)
+	if f.capacity < 0 {
+		return f.File.Write(p)
+	}
+	if len(p) > f.capacity {
+		n, err := f.File.Write(p[:f.capacity])
+		f.capacity -= n
+		if err == nil {
+			err = syscall.ENOSPC
+		}
+		return n, err
+	}
+	n, err := f.File.Write(p)
+	f.capacity -= n
+	return n, err
+}
+
+func (f *faultyFile) Sync() error {
+	time.Sleep(f.latency)
+	if f.syncErr != nil {
+		return f.syncErr
+	}
+	return f.File.Sync()
+}
+
+/*
+testing that a disk that fills up part way through a record stops the store from accepting writes,
+and that the records that made it to disk before the partial one can still be read after reopening
+*/
+func TestStoreFullDisk(t *testing.T) {
+	f, err := os.CreateTemp("", "store_full_disk_test")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+
+	capacity := storeHeaderWidth + int(width)*2 + 3
+	s, err := newStore(&faultyFile{File: f, capacity: capacity}, Config{})
+	require.NoError(t, err)
+
+	// appends are buffered so the disk filling up isn't noticed until the buffer is flushed
+	for range 3 {
+		_, _, err = s.Append(write)
+		require.NoError(t, err)
+	}
+	_, err = s.Read(storeHeaderWidth)
+	require.ErrorIs(t, err, syscall.ENOSPC)
+
+	// once a write has failed the store keeps failing instead of writing after a partial record
+	_, _, err = s.Append(write)
+	require.ErrorIs(t, err, syscall.ENOSPC)
+	require.ErrorIs(t, s.Close(), syscall.ENOSPC)
+
+	fi, err := os.Stat(f.Name())
+	require.NoError(t, err)
+	require.Equal(t, int64(capacity), fi.Size())
+
+	f, err = os.OpenFile(f.Name(), os.O_RDWR|os.O_APPEND, 0644)
+	require.NoError(t, err)
+	s, err = newStore(f, Config{})
+	require.NoError(t, err)
+	defer s.Close()
+	for pos := uint64(storeHeaderWidth); pos < storeHeaderWidth+width*2; pos += width {
+		read, err := s.Read(pos)
+		require.NoError(t, err)
+		require.Equal(t, write, read)
+	}
+	_, err = s.Read(storeHeaderWidth + width*2)
+	require.Error(t, err)
+}
+
+// testing that a failed fsync is returned when the store is closed and the file is still closed
+func TestStoreSyncError(t *testing.T) {
+	f, err := os.CreateTemp("", "store_sync_error_test")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+
+	s, err := newStore(&faultyFile{File: f, capacity: -1, syncErr: syscall.EIO}, Config{})
+	require.NoError(t, err)
+	_, _, err = s.Append(write)
+	require.NoError(t, err)
+
+	require.ErrorIs(t, s.Close(), syscall.EIO)
+	_, err = f.Write(write)
+	require.ErrorIs(t, err, os.ErrClosed)
+}
+
+// testing that concurrent appends and reads against a slow disk don't interleave records
+func TestStoreSlowDisk(t *testing.T) {
+	f, err := os.CreateTemp("", "store_slow_disk_test")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+
+	s, err := newStore(&faultyFile{File: f, capacity: -1, latency: time.Millisecond}, Config{})
+	require.NoError(t, err)
+	defer s.Close()
+
+	var wg sync.WaitGroup
+	positions := make(chan uint64, 20)
+	errs := make(chan error, 20)
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, pos, err := s.Append(write)
+			if err != nil {
+				errs <- err
+				return
+			}
+			// reading forces a flush while other goroutines keep appending
+			if _, err = s.Read(pos); err != nil {
+				errs <- err
+				return
+			}
+			positions <- pos
+		}()
+	}
+	wg.Wait()
+	close(positions)
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	seen := make(map[uint64]bool)
+	for pos := range positions {
+		read, err := s.Read(pos)
+		require.NoError(t, err)
+		require.Equal(t, write, read)
+		seen[pos] = true
+	}
+	require.Equal(t, 20, len(seen))
+}
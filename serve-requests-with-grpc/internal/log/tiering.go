@@ -0,0 +1,486 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	tieredFileName         = "tiered"
+	defaultTieringInterval = time.Minute
+	// directory inside of the log's directory where segments are downloaded before they're moved into place
+	fetchDir = ".fetch"
+	// 8 bytes each for the base offset, next offset, store size, index size and modification time
+	tieredWidth = 8 * 5
+)
+
+var ErrTieringDisabled = errors.New("log has tiered segments but no remote object store is configured")
+
+/*
+ObjectStore is the remote storage closed segments are offloaded to. names are relative to wherever the
+store keeps the log's objects (ex. a bucket and prefix), so a store shouldn't be shared between logs.
+*/
+type ObjectStore interface {
+	Put(ctx context.Context, name string, r io.Reader, size int64) error
+	Get(ctx context.Context, name string) (io.ReadCloser, error)
+	Delete(ctx context.Context, name string) error
+}
+
+/*
+the uploaded segments are tracked in a sidecar file so the log knows which segments it can read back
+from the object store after their local files were deleted. unlike the annotations and keys sidecars it's
+small (an entry per segment) so it's rewritten as a whole and renamed into place on every change.
+*/
+type tier struct {
+	remote   ObjectStore
+	file     string
+	uploaded map[uint64]tieredSegment
+	// fetches in flight by base offset, readers of a segment that's being fetched wait for it instead of downloading it too
+	fetchingMu sync.Mutex
+	fetching   map[uint64]*fetchCall
+}
+
+// a fetch of an offloaded segment, err is set once done is closed
+type fetchCall struct {
+	done chan struct{}
+	err  error
+}
+
+// what's known about an uploaded segment without having its files
+type tieredSegment struct {
+	baseOffset, nextOffset uint64
+	storeSize, indexSize   uint64
+	modTime                time.Time
+}
+
+func newTier(dir string, remote ObjectStore) (*tier, error) {
+	// a fetch that was interrupted is fetched again the next time the segment is read
+	if err := os.RemoveAll(path.Join(dir, fetchDir)); err != nil {
+		return nil, err
+	}
+	t := &tier{
+		remote:   remote,
+		file:     path.Join(dir, tieredFileName),
+		uploaded: make(map[uint64]tieredSegment),
+		fetching: make(map[uint64]*fetchCall),
+	}
+	b, err := os.ReadFile(t.file)
+	if os.IsNotExist(err) {
+		return t, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for pos := 0; pos+tieredWidth <= len(b); pos += tieredWidth {
+		entry := b[pos : pos+tieredWidth]
+		ts := tieredSegment{
+			baseOffset: enc.Uint64(entry[0:8]),
+			nextOffset: enc.Uint64(entry[8:16]),
+			storeSize:  enc.Uint64(entry[16:24]),
+			indexSize:  enc.Uint64(entry[24:32]),
+			modTime:    time.Unix(0, int64(enc.Uint64(entry[32:40]))),
+		}
+		t.uploaded[ts.baseOffset] = ts
+	}
+	if len(t.uploaded) > 0 && remote == nil {
+		return nil, ErrTieringDisabled
+	}
+	return t, nil
+}
+
+// writes every uploaded segment to a temporary file and renames it over the sidecar
+func (t *tier) save() error {
+	b := make([]byte, 0, len(t.uploaded)*tieredWidth)
+	entry := make([]byte, tieredWidth)
+	for _, ts := range t.uploaded {
+		enc.PutUint64(entry[0:8], ts.baseOffset)
+		enc.PutUint64(entry[8:16], ts.nextOffset)
+		enc.PutUint64(entry[16:24], ts.storeSize)
+		enc.PutUint64(entry[24:32], ts.indexSize)
+		enc.PutUint64(entry[32:40], uint64(ts.modTime.UnixNano()))
+		b = append(b, entry...)
+	}
+	tmp := t.file + swapSuffix
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(b); err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, t.file)
+}
+
+// deletes an uploaded segment's objects and stops tracking it
+func (t *tier) delete(baseOffset uint64) error {
+	if err := t.deleteObjects(baseOffset); err != nil {
+		return err
+	}
+	delete(t.uploaded, baseOffset)
+	return t.save()
+}
+
+func (t *tier) deleteObjects(baseOffset uint64) error {
+	for _, ext := range []string{".store", ".index"} {
+		if err := t.remote.Delete(context.Background(), objectName(baseOffset, ext)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func objectName(baseOffset uint64, ext string) string {
+	return fmt.Sprintf("%d%s", baseOffset, ext)
+}
+
+// starts offloading closed segments in the background if a remote object store is configured
+func (l *Log) startTiering() {
+	if l.Config.Tiering.Remote == nil {
+		return
+	}
+	interval := l.Config.Tiering.Interval
+	if interval == 0 {
+		interval = defaultTieringInterval
+	}
+	l.background.run(interval, l.Tier)
+}
+
+/*
+Tier uploads every closed segment that isn't in the remote object store yet, then deletes the local files of
+uploaded segments that are past Tiering.LocalRetention. a segment whose files were deleted is kept in the log
+and is fetched back from the object store when one of its records is read.
+- uploads happen without holding the log's lock so appends aren't blocked on the network. a segment that was
+compacted while it was being uploaded is uploaded again on the next call
+- uploaded segments are never compacted again
+*/
+func (l *Log) Tier() error {
+	if l.tier == nil || l.tier.remote == nil {
+		return nil
+	}
+	type upload struct {
+		segment *segment
+		store   *store
+		size    int64
+		index   []byte
+	}
+	l.mu.RLock()
+	var pending []upload
+	for _, s := range l.segments {
+		if s == l.activeSegment {
+			break
+		}
+		if s.tiered {
+			continue
+		}
+		if err := s.open(); err != nil {
+			l.mu.RUnlock()
+			return err
+		}
+		// copying the index's header and entries since its file is padded out to MaxIndexBytes while it's open
+		pending = append(pending, upload{
+			segment: s,
+			store:   s.store,
+			size:    int64(s.store.size),
+			index:   append([]byte(nil), s.index.mmap[:s.index.size]...),
+		})
+	}
+	l.mu.RUnlock()
+
+	for _, u := range pending {
+		if err := l.upload(u.segment, u.store, u.size, u.index); err != nil {
+			return err
+		}
+	}
+	return l.offload()
+}
+
+// uploads a closed segment's files and starts tracking it as uploaded if it's still part of the log
+func (l *Log) upload(s *segment, store *store, size int64, index []byte) error {
+	ctx := context.Background()
+	if err := l.tier.remote.Put(ctx, objectName(s.baseOffset, ".index"), bytes.NewReader(index), int64(len(index))); err != nil {
+		return err
+	}
+	if err := l.tier.remote.Put(ctx, objectName(s.baseOffset, ".store"), io.NewSectionReader(store, 0, size), size); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.hasSegment(s) {
+		// compacted or removed while it was being uploaded, what was uploaded might not match anymore
+		return l.tier.deleteObjects(s.baseOffset)
+	}
+	l.tier.uploaded[s.baseOffset] = tieredSegment{
+		baseOffset: s.baseOffset,
+		nextOffset: s.nextOffset,
+		storeSize:  uint64(size),
+		indexSize:  uint64(len(index)),
+		modTime:    s.modTime,
+	}
+	if err := l.tier.save(); err != nil {
+		delete(l.tier.uploaded, s.baseOffset)
+		return err
+	}
+	s.tiered = true
+	return nil
+}
+
+/*
+deletes the local files of uploaded segments that haven't been written to or fetched within
+Tiering.LocalRetention. readers that are walking one of those segments (ex. a ReadRange iterator)
+get an error once its files are closed
+*/
+func (l *Log) offload() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	for _, s := range l.segments {
+		if !s.tiered || s.remote || s == l.activeSegment {
+			continue
+		}
+		used := s.modTime
+		if s.fetchedAt.After(used) {
+			used = s.fetchedAt
+		}
+		if now.Sub(used) < l.Config.Tiering.LocalRetention {
+			continue
+		}
+		if err := s.offload(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+downloads an offloaded segment's files back into the log's directory. the files are downloaded into the
+fetch directory first and the store is renamed into place last so a crash part way through leaves a
+store that's missing or doesn't match the uploaded size, which load treats as not fetched.
+the segment is downloaded without holding the log's lock so appends and reads of other segments carry on, and
+only once when several readers need it at the same time. the write lock is only taken to move the files into place
+*/
+func (l *Log) fetch(ctx context.Context, s *segment) error {
+	for {
+		l.mu.RLock()
+		// another reader fetched it already or it was removed from the log
+		if !s.remote || !l.hasSegment(s) {
+			l.mu.RUnlock()
+			return nil
+		}
+		t := l.tier
+		l.mu.RUnlock()
+
+		t.fetchingMu.Lock()
+		call, fetching := t.fetching[s.baseOffset]
+		if !fetching {
+			call = &fetchCall{done: make(chan struct{})}
+			t.fetching[s.baseOffset] = call
+		}
+		t.fetchingMu.Unlock()
+		if !fetching {
+			call.err = l.fetchSegment(ctx, t, s)
+			t.fetchingMu.Lock()
+			delete(t.fetching, s.baseOffset)
+			t.fetchingMu.Unlock()
+			close(call.done)
+			return call.err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-call.done:
+		}
+		// the reader fetching it gave up (ex. its consumer went away), so this reader fetches it itself
+		if call.err != nil && ctx.Err() == nil &&
+			(errors.Is(call.err, context.Canceled) || errors.Is(call.err, context.DeadlineExceeded)) {
+			continue
+		}
+		if call.err != nil {
+			return call.err
+		}
+	}
+}
+
+// downloads the segment's files into its own directory inside the fetch directory and swaps them in
+func (l *Log) fetchSegment(ctx context.Context, t *tier, s *segment) error {
+	tmpDir := path.Join(l.Dir, fetchDir, strconv.FormatUint(s.baseOffset, 10))
+	if err := os.MkdirAll(tmpDir, 0755); err != nil {
+		return err
+	}
+	defer func() {
+		os.RemoveAll(tmpDir)
+		// only removed once no other segment is being fetched into it
+		os.Remove(path.Dir(tmpDir))
+	}()
+	for _, ext := range []string{".index", ".store"} {
+		if err := download(ctx, t.remote, objectName(s.baseOffset, ext), segmentPath(tmpDir, s.baseOffset, ext)); err != nil {
+			return err
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// fetched by a reader that was waiting on an earlier fetch, or removed from the log while it was downloaded
+	if !s.remote || !l.hasSegment(s) {
+		return nil
+	}
+	for _, ext := range []string{".index", ".store"} {
+		if err := os.Rename(segmentPath(tmpDir, s.baseOffset, ext), segmentPath(l.Dir, s.baseOffset, ext)); err != nil {
+			return err
+		}
+	}
+	fetched, err := newSegment(l.Dir, s.baseOffset, l.Config)
+	if err != nil {
+		return err
+	}
+	if err = fetched.Seal(); err != nil {
+		return err
+	}
+	s.store, s.index = fetched.store, fetched.index
+	s.remote = false
+	s.fetchedAt = time.Now()
+	return nil
+}
+
+func download(ctx context.Context, remote ObjectStore, name, dst string) error {
+	r, err := remote.Get(ctx, name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(f, r); err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+/*
+read locks the log once every offloaded segment that has records in [from, to) is fetched.
+the lock is only held when there's no error
+*/
+func (l *Log) rlockFetched(from, to uint64) error {
+	for {
+		l.mu.RLock()
+		if l.closed {
+			l.mu.RUnlock()
+			return ErrClosed
+		}
+		var s *segment
+		for _, segment := range l.segments {
+			if segment.remote && segment.baseOffset < to && from < segment.nextOffset {
+				s = segment
+				break
+			}
+		}
+		if s == nil {
+			return nil
+		}
+		l.mu.RUnlock()
+		if err := l.fetch(context.Background(), s); err != nil {
+			return err
+		}
+	}
+}
+
+/*
+matches the log's segments with the uploaded segments once they're read in.
+- uploaded segments without a matching local store are added as offloaded segments. a store that doesn't match
+the uploaded size is left over from a fetch that was interrupted, so it's deleted and fetched again when needed
+- segments that are still local are marked as uploaded
+*/
+func (l *Log) loadTiered() error {
+	if len(l.tier.uploaded) == 0 {
+		return nil
+	}
+	local := make(map[uint64]*segment, len(l.segments))
+	for _, s := range l.segments {
+		local[s.baseOffset] = s
+	}
+	for base, ts := range l.tier.uploaded {
+		s, ok := local[base]
+		if ok && s.storeSize() == ts.storeSize {
+			s.tiered = true
+			continue
+		}
+		if ok {
+			if err := s.removeFiles(); err != nil {
+				return err
+			}
+		}
+		local[base] = &segment{
+			baseOffset: ts.baseOffset,
+			nextOffset: ts.nextOffset,
+			config:     l.Config,
+			modTime:    ts.modTime,
+			dir:        l.Dir,
+			tiered:     true,
+			remote:     true,
+			sealed:     true,
+			remoteSize: ts.storeSize + ts.indexSize,
+			remoteLen:  (ts.indexSize - indexHeaderWidth) / entWidth,
+		}
+		// without a filter key lookups fetch the segment to check it
+		local[base].bloom, _ = readBloom(segmentPath(l.Dir, base, ".bloom"))
+		if meta, err := readMeta(segmentPath(l.Dir, base, ".meta")); err == nil {
+			local[base].meta = meta
+			local[base].firstAppend = meta.firstAppend
+		}
+	}
+	l.segments = l.segments[:0]
+	for _, s := range local {
+		l.segments = append(l.segments, s)
+	}
+	sort.Slice(l.segments, func(i, j int) bool {
+		return l.segments[i].baseOffset < l.segments[j].baseOffset
+	})
+	last := l.segments[len(l.segments)-1]
+	l.activeSegment = last
+	// the active segment has to be local to append to, uploaded segments are never written to again
+	if last.tiered {
+		return l.newSegment(last.nextOffset)
+	}
+	return nil
+}
+
+// reports whether the segment is still one of the log's segments, it could've been compacted or removed
+func (l *Log) hasSegment(s *segment) bool {
+	for _, segment := range l.segments {
+		if segment == s {
+			return true
+		}
+	}
+	return false
+}
+
+// an io.Reader that fails with err, used by readers that can't return errors up front
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
@@ -0,0 +1,228 @@
+package log
+
+import (
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	api "github.com/phaseharry/distributed-log/serve-requests-with-grpc/api/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// file in a topic's directory its config is written to when it's created
+	topicConfigFileName = "topic.config"
+	// prefix deleted topics' directories are renamed with until their data is removed
+	deletedTopicPrefix = ".deleted-"
+)
+
+// kafka's rule for topic names, they're used as directory names so they can't be "." or ".."
+var topicName = regexp.MustCompile(`^[a-zA-Z0-9_-][a-zA-Z0-9._-]{0,248}$`)
+
+/*
+Topics are named logs that each live in their own directory under a root directory, ex. {dir}/orders.
+a topic's config is written to its directory when it's created so the topic is reopened with the same config,
+the settings the topic's config doesn't set come from the base config every topic starts from.
+*/
+type Topics struct {
+	mu      sync.RWMutex
+	dir     string
+	base    Config
+	logs    map[string]*Log
+	configs map[string]*api.TopicConfig
+	// removals of deleted topics' data that are still running
+	removing sync.WaitGroup
+}
+
+// opens the topics in dir, creating dir if it doesn't exist yet
+func NewTopics(dir string, base Config) (*Topics, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	t := &Topics{
+		dir:     dir,
+		base:    base,
+		logs:    make(map[string]*Log),
+		configs: make(map[string]*api.TopicConfig),
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		if file.IsDir() && strings.HasPrefix(file.Name(), deletedTopicPrefix) {
+			// the topic was deleted but we crashed before its data was removed
+			t.remove(path.Join(dir, file.Name()))
+			continue
+		}
+		// skipping anything that isn't a topic
+		if !file.IsDir() || !topicName.MatchString(file.Name()) {
+			continue
+		}
+		b, err := os.ReadFile(path.Join(dir, file.Name(), topicConfigFileName))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			t.Close()
+			return nil, err
+		}
+		c := &api.TopicConfig{}
+		if err = proto.Unmarshal(b, c); err != nil {
+			t.Close()
+			return nil, err
+		}
+		if err = t.open(file.Name(), c); err != nil {
+			t.Close()
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+func (t *Topics) open(name string, c *api.TopicConfig) error {
+	l, err := NewLog(path.Join(t.dir, name), t.base.withTopic(c))
+	if err != nil {
+		return err
+	}
+	t.logs[name] = l
+	t.configs[name] = c
+	return nil
+}
+
+// returns the base config with the settings the topic's config sets
+func (c Config) withTopic(tc *api.TopicConfig) Config {
+	if tc.MaxSegmentBytes > 0 {
+		c.Segment.MaxStoreBytes = tc.MaxSegmentBytes
+	}
+	if tc.MaxSegmentRecords > 0 {
+		c.Segment.MaxRecords = tc.MaxSegmentRecords
+	}
+	if tc.RetentionMaxAge != nil {
+		c.Retention.MaxAge = tc.RetentionMaxAge.AsDuration()
+	}
+	if tc.RetentionMaxBytes > 0 {
+		c.Retention.MaxBytes = tc.RetentionMaxBytes
+	}
+	if tc.RetentionMaxRecords > 0 {
+		c.Retention.MaxRecords = tc.RetentionMaxRecords
+	}
+	if tc.Compaction {
+		c.Compaction.Enabled = true
+	}
+	return c
+}
+
+// Topic returns the log of the topic, or api.ErrUnknownTopic if there's no topic with the name
+func (t *Topics) Topic(name string) (*Log, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	l, ok := t.logs[name]
+	if !ok {
+		return nil, api.ErrUnknownTopic{Topic: name}
+	}
+	return l, nil
+}
+
+/*
+Create creates a topic with the config, c can be nil to use the base config. returns api.ErrInvalidTopic
+if the name can't be used as a directory name and api.ErrTopicExists if there's already a topic with the name
+*/
+func (t *Topics) Create(name string, c *api.TopicConfig) error {
+	if !topicName.MatchString(name) {
+		return api.ErrInvalidTopic{Topic: name}
+	}
+	if c == nil {
+		c = &api.TopicConfig{}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.logs[name]; ok {
+		return api.ErrTopicExists{Topic: name}
+	}
+	dir := path.Join(t.dir, name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	b, err := proto.Marshal(c)
+	if err != nil {
+		return err
+	}
+	// the config is written last through a temporary file so a directory with a config is always a whole topic
+	name2 := path.Join(dir, topicConfigFileName)
+	if err = os.WriteFile(name2+swapSuffix, b, 0644); err != nil {
+		return err
+	}
+	if err = os.Rename(name2+swapSuffix, name2); err != nil {
+		return err
+	}
+	return t.open(name, c)
+}
+
+// List returns every topic and the config it was created with, sorted by name
+func (t *Topics) List() []*api.Topic {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	topics := make([]*api.Topic, 0, len(t.logs))
+	for name, c := range t.configs {
+		topics = append(topics, &api.Topic{Name: name, Config: c})
+	}
+	sort.Slice(topics, func(i, j int) bool { return topics[i].Name < topics[j].Name })
+	return topics
+}
+
+/*
+Delete closes the topic's log and removes its data. once Delete returns the topic is gone: produces and reads
+fail with api.ErrUnknownTopic and the log's watchers are closed, while its directory is removed in the background.
+the directory is renamed out of the way first so a topic whose removal was interrupted is never opened again,
+and a topic with the same name can be created right away
+*/
+func (t *Topics) Delete(name string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	l, ok := t.logs[name]
+	if !ok {
+		return api.ErrUnknownTopic{Topic: name}
+	}
+	delete(t.logs, name)
+	delete(t.configs, name)
+	if err := l.Close(); err != nil {
+		return err
+	}
+	deleted := path.Join(t.dir, deletedTopicPrefix+name+"-"+strconv.FormatInt(time.Now().UnixNano(), 10))
+	if err := os.Rename(l.Dir, deleted); err != nil {
+		return err
+	}
+	t.remove(deleted)
+	return nil
+}
+
+/*
+removes a deleted topic's directory in the background, topics with lots of segments can take a while.
+a removal that fails is retried the next time the topics are opened
+*/
+func (t *Topics) remove(dir string) {
+	t.removing.Add(1)
+	go func() {
+		defer t.removing.Done()
+		os.RemoveAll(dir)
+	}()
+}
+
+// Close closes every topic's log and waits for deleted topics' data to be removed, the other records stay on disk
+func (t *Topics) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	defer t.removing.Wait()
+	for _, l := range t.logs {
+		if err := l.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package log
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	api "github.com/phaseharry/distributed-log/serve-requests-with-grpc/api/v1"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// testing that topics are separate logs with their own config, reopened with it, and removed when deleted
+func TestTopics(t *testing.T) {
+	dir, err := os.MkdirTemp("", "topics-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	base := Config{}
+	base.Segment.MaxStoreBytes = 1024
+	topics, err := NewTopics(dir, base)
+	require.NoError(t, err)
+
+	orders := &api.TopicConfig{MaxSegmentRecords: 2, RetentionMaxAge: durationpb.New(time.Hour)}
+	require.NoError(t, topics.Create("orders", orders))
+	require.NoError(t, topics.Create("payments", nil))
+	require.Equal(t, api.ErrTopicExists{Topic: "orders"}, topics.Create("orders", nil))
+	for _, name := range []string{"", ".", "..", "orders/eu", "orders eu"} {
+		require.Equal(t, api.ErrInvalidTopic{Topic: name}, topics.Create(name, nil))
+	}
+	_, err = topics.Topic("refunds")
+	require.Equal(t, api.ErrUnknownTopic{Topic: "refunds"}, err)
+
+	l, err := topics.Topic("orders")
+	require.NoError(t, err)
+	require.Equal(t, uint64(1024), l.Config.Segment.MaxStoreBytes)
+	require.Equal(t, uint64(2), l.Config.Segment.MaxRecords)
+	require.Equal(t, time.Hour, l.Config.Retention.MaxAge)
+	for range 3 {
+		_, err = l.Append(&api.Record{Value: []byte("hello world")})
+		require.NoError(t, err)
+	}
+	// every topic's offsets start from 0
+	p, err := topics.Topic("payments")
+	require.NoError(t, err)
+	off, err := p.Append(&api.Record{Value: []byte("hello world")})
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), off)
+	require.NoError(t, topics.Close())
+
+	topics, err = NewTopics(dir, base)
+	require.NoError(t, err)
+	list := topics.List()
+	require.Len(t, list, 2)
+	require.Equal(t, "orders", list[0].Name)
+	require.True(t, proto.Equal(orders, list[0].Config))
+	require.Equal(t, "payments", list[1].Name)
+	l, err = topics.Topic("orders")
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), l.Config.Segment.MaxRecords)
+	highest, err := l.HighestOffset()
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), highest)
+
+	require.NoError(t, topics.Delete("orders"))
+	require.Equal(t, api.ErrUnknownTopic{Topic: "orders"}, topics.Delete("orders"))
+	_, err = os.Stat(path.Join(dir, "orders"))
+	require.True(t, os.IsNotExist(err))
+	require.Len(t, topics.List(), 1)
+
+	// the name can be reused right away, the new topic doesn't have the deleted topic's records
+	require.NoError(t, topics.Create("orders", nil))
+	l, err = topics.Topic("orders")
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), l.segments[len(l.segments)-1].nextOffset)
+	require.NoError(t, topics.Close())
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+}
@@ -0,0 +1,342 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	api "github.com/phaseharry/distributed-log/serve-requests-with-grpc/api/v1"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// directory inside of the log's directory that removed segments are moved into
+	trashDir                  = ".trash"
+	defaultTrashCheckInterval = time.Minute
+)
+
+// starts emptying the trash in the background if removed segments are kept in it
+func (l *Log) startTrash() {
+	if l.Config.Trash.GracePeriod == 0 {
+		return
+	}
+	interval := l.Config.Trash.CheckInterval
+	if interval == 0 {
+		interval = defaultTrashCheckInterval
+	}
+	l.background.run(interval, l.EmptyTrash)
+}
+
+/*
+removes a segment that's no longer part of the log. the segment is moved to the trash if there's a grace
+period, otherwise its files are deleted. uploaded segments are deleted from the remote object store too
+*/
+func (l *Log) removeSegment(s *segment) error {
+	var err error
+	trashed := l.Config.Trash.GracePeriod > 0 && !s.remote
+	if trashed {
+		err = l.trashSegment(s)
+	} else {
+		err = s.Remove()
+	}
+	if err != nil {
+		return err
+	}
+	l.logger().Debug("segment removed",
+		zap.Uint64("base_offset", s.baseOffset),
+		zap.Uint64("next_offset", s.nextOffset),
+		zap.Bool("trashed", trashed),
+	)
+	if !s.tiered {
+		return nil
+	}
+	return l.tier.delete(s.baseOffset)
+}
+
+/*
+closes the segment and moves its files into a directory in the trash named after when it was removed.
+the files keep their modification times so a restored segment is as old as it was before
+*/
+func (l *Log) trashSegment(s *segment) error {
+	dir := path.Join(l.Dir, trashDir, strconv.FormatInt(time.Now().UnixNano(), 10))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if err := s.Close(); err != nil {
+		return err
+	}
+	for _, ext := range []string{".index", ".store", ".bloom", ".meta"} {
+		err := os.Rename(
+			segmentPath(l.Dir, s.baseOffset, ext),
+			segmentPath(dir, s.baseOffset, ext),
+		)
+		// the key filter and metadata are only written once the segment is sealed
+		if err != nil && !((ext == ".bloom" || ext == ".meta") && os.IsNotExist(err)) {
+			return err
+		}
+	}
+	return nil
+}
+
+// EmptyTrash deletes the segments that were removed longer than Trash.GracePeriod ago
+func (l *Log) EmptyTrash() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	dirs, err := os.ReadDir(path.Join(l.Dir, trashDir))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, dir := range dirs {
+		removed, err := strconv.ParseInt(dir.Name(), 10, 64)
+		if err == nil && now.Sub(time.Unix(0, removed)) < l.Config.Trash.GracePeriod {
+			continue
+		}
+		if err := os.RemoveAll(path.Join(l.Dir, trashDir, dir.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ErrTrashOverlaps is returned by RestoreTrash for trashed segments that would overlap records appended since they were removed
+var ErrTrashOverlaps = errors.New("trashed segment overlaps records appended since it was removed")
+
+/*
+RestoreTrash moves the segments in the trash back into the log, undoing the retention policies, Truncate,
+TruncateBefore, TruncateAfter, or compaction that removed them. restored segments are read back in along with
+the log's other segments.
+- a trashed segment whose offsets overlap the log's segments replaces them if they were rewritten from it,
+since every one of their records is also in it, ex. the segment TruncateBefore cut the front off
+- a trashed segment whose records are all in one of the log's segments already is dropped from the trash
+- any other trashed segment is left in the trash and ErrTrashOverlaps is returned for it, ex. one that TruncateAfter
+removed before records were appended at its offsets again, or past the log's end after records were appended
+*/
+func (l *Log) RestoreTrash() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	trash := path.Join(l.Dir, trashDir)
+	dirs, err := os.ReadDir(trash)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// the trashed segments are only opened to plan the restore, their files are moved once they're closed again
+	trashed, err := openTrash(trash, dirs, l.Config)
+	var replaced map[*segment]bool
+	var conflicts []error
+	if err == nil {
+		replaced, conflicts = l.planRestore(trashed)
+	}
+	for _, t := range trashed {
+		if cerr := t.segment.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	// the replaced segments' records are all in the trashed segments replacing them, so they're deleted
+	var segments []*segment
+	for _, s := range l.segments {
+		if !replaced[s] {
+			segments = append(segments, s)
+			continue
+		}
+		if err = s.Remove(); err != nil {
+			return err
+		}
+		if s.tiered {
+			if err = l.tier.delete(s.baseOffset); err != nil {
+				return err
+			}
+		}
+	}
+	l.segments = segments
+	if err = l.unload(); err != nil {
+		return err
+	}
+	for _, t := range trashed {
+		if t.keep {
+			continue
+		}
+		for _, ext := range []string{".index", ".store", ".bloom", ".meta"} {
+			name := segmentPath(t.dir, t.segment.baseOffset, ext)
+			if t.restore {
+				err = os.Rename(name, segmentPath(l.Dir, t.segment.baseOffset, ext))
+			} else {
+				err = os.Remove(name)
+			}
+			// the key filter and metadata are only written once the segment is sealed
+			if err != nil && !((ext == ".bloom" || ext == ".meta") && os.IsNotExist(err)) {
+				return err
+			}
+		}
+		// the directory is left behind if another segment in it is kept
+		os.Remove(t.dir)
+	}
+	if err = l.load(); err != nil {
+		return err
+	}
+	return errors.Join(conflicts...)
+}
+
+// a segment in the trash and what RestoreTrash does with it, it's dropped from the trash unless it's restored or kept
+type trashedSegment struct {
+	segment       *segment
+	dir           string
+	removed       time.Time
+	restore, keep bool
+}
+
+// opens the segments in the trash ordered by their base offsets, those trashed at the same base offset oldest first
+func openTrash(trash string, dirs []os.DirEntry, c Config) ([]*trashedSegment, error) {
+	var trashed []*trashedSegment
+	for _, dir := range dirs {
+		removed, err := strconv.ParseInt(dir.Name(), 10, 64)
+		if err != nil {
+			continue
+		}
+		files, err := os.ReadDir(path.Join(trash, dir.Name()))
+		if err != nil {
+			return trashed, err
+		}
+		for _, file := range files {
+			if path.Ext(file.Name()) != ".store" {
+				continue
+			}
+			off, err := strconv.ParseUint(strings.TrimSuffix(file.Name(), ".store"), 10, 64)
+			if err != nil {
+				continue
+			}
+			s, err := newSegment(path.Join(trash, dir.Name()), off, c)
+			if err != nil {
+				return trashed, err
+			}
+			trashed = append(trashed, &trashedSegment{segment: s, dir: path.Join(trash, dir.Name()), removed: time.Unix(0, removed)})
+		}
+	}
+	sort.SliceStable(trashed, func(i, j int) bool {
+		if trashed[i].segment.baseOffset != trashed[j].segment.baseOffset {
+			return trashed[i].segment.baseOffset < trashed[j].segment.baseOffset
+		}
+		return trashed[i].removed.Before(trashed[j].removed)
+	})
+	return trashed, nil
+}
+
+/*
+decides which trashed segments are restored, returning the log's segments they replace and the errors of the
+ones that are kept in the trash. the trashed segments are checked against the log's segments as they'd be
+once the segments before them were restored, so a segment TruncateAfter removed follows the one it cut that's restored.
+*/
+func (l *Log) planRestore(trashed []*trashedSegment) (map[*segment]bool, []error) {
+	live := append([]*segment(nil), l.segments...)
+	replaced := make(map[*segment]bool)
+	restored := make(map[*segment]*trashedSegment)
+	var conflicts []error
+	for _, t := range trashed {
+		var overlapping []*segment
+		for _, s := range live {
+			if overlaps(s, t.segment) {
+				overlapping = append(overlapping, s)
+			}
+		}
+		redundant, rewritten := false, true
+		for _, s := range overlapping {
+			redundant = redundant || subset(t.segment, s)
+			rewritten = rewritten && subset(s, t.segment)
+		}
+		switch {
+		case redundant:
+			continue
+		case !rewritten || (len(overlapping) == 0 && l.appendedSince(live, t)):
+			t.keep = true
+			conflicts = append(conflicts, fmt.Errorf("%w: segment %d", ErrTrashOverlaps, t.segment.baseOffset))
+			continue
+		}
+		var next []*segment
+		for _, s := range live {
+			if !slices.Contains(overlapping, s) {
+				next = append(next, s)
+			} else if r, ok := restored[s]; ok {
+				// a segment that was going to be restored is dropped from the trash instead
+				r.restore = false
+			} else {
+				replaced[s] = true
+			}
+		}
+		t.restore = true
+		restored[t.segment] = t
+		live = append(next, t.segment)
+		sort.Slice(live, func(i, j int) bool {
+			return live[i].baseOffset < live[j].baseOffset
+		})
+	}
+	return replaced, conflicts
+}
+
+/*
+reports whether a trashed segment that doesn't overlap the log's segments comes after the log's newest records and
+records were appended after it was removed, ex. TruncateAfter removed it and the log appended new records in its place
+*/
+func (l *Log) appendedSince(live []*segment, t *trashedSegment) bool {
+	for i := len(live) - 1; i >= 0; i-- {
+		s := live[i]
+		if s.Len() == 0 {
+			continue
+		}
+		return s.baseOffset < t.segment.baseOffset && s.modTime.After(t.removed)
+	}
+	return false
+}
+
+/*
+reports whether a segment has records at the trashed segment's offsets. an empty segment overlaps the
+trashed segment if it starts before its end, it's the active segment a truncation started in its place
+*/
+func overlaps(s, trashed *segment) bool {
+	if s.Len() == 0 {
+		return s.baseOffset < trashed.nextOffset
+	}
+	return s.baseOffset < trashed.nextOffset && trashed.baseOffset < s.nextOffset
+}
+
+// reports whether every record in a is in b too, offloaded segments aren't read to check
+func subset(a, b *segment) bool {
+	if a.remote || b.remote {
+		return false
+	}
+	if a.Len() == 0 {
+		return true
+	}
+	if a.baseOffset < b.baseOffset || a.nextOffset > b.nextOffset {
+		return false
+	}
+	err := a.forEach(func(record *api.Record) error {
+		other, err := b.Read(record.Offset)
+		if err != nil {
+			return err
+		}
+		if !proto.Equal(record, other) {
+			return ErrTrashOverlaps
+		}
+		return nil
+	})
+	return err == nil
+}
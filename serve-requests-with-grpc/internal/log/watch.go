@@ -0,0 +1,89 @@
+package log
+
+import "sync"
+
+/*
+watchers are the subscribers waiting on records to be appended to the log. every subscriber has a channel
+that holds at most the newest appended offset, so a subscriber that's slow to receive is signaled once
+with the latest offset instead of blocking appends.
+*/
+type watchers struct {
+	mu     sync.Mutex
+	byChan map[chan uint64]uint64 // offset each subscriber is waiting on records from
+	closed bool
+}
+
+func newWatchers() *watchers {
+	return &watchers{byChan: make(map[chan uint64]uint64)}
+}
+
+// signals the subscribers waiting on an offset lower than or equal to the appended one
+func (w *watchers) notify(off uint64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for c, from := range w.byChan {
+		if off >= from {
+			signal(c, off)
+		}
+	}
+}
+
+// has to be called while holding the watchers' lock so nothing else sends on the channel or closes it
+func signal(c chan uint64, off uint64) {
+	// replacing an offset the subscriber hasn't received yet with the newer one
+	select {
+	case <-c:
+	default:
+	}
+	c <- off
+}
+
+// closes every subscriber's channel, subscribing afterwards returns a closed channel
+func (w *watchers) close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for c := range w.byChan {
+		close(c)
+		delete(w.byChan, c)
+	}
+	w.closed = true
+}
+
+/*
+Watch subscribes to records being appended to the log. the returned channel receives the offset of the newest
+record appended once there's a record at fromOffset or past it, right away if there already is one.
+signals are coalesced so a subscriber that falls behind only receives the latest offset.
+the channel is closed once cancel is called or the log is closed, cancel has to be called to stop watching
+*/
+func (l *Log) Watch(fromOffset uint64) (<-chan uint64, func()) {
+	c := make(chan uint64, 1)
+	l.watchers.mu.Lock()
+	if l.watchers.closed {
+		l.watchers.mu.Unlock()
+		close(c)
+		return c, func() {}
+	}
+	l.watchers.byChan[c] = fromOffset
+	l.watchers.mu.Unlock()
+
+	// an append racing with this only signals the channel twice
+	l.mu.RLock()
+	next := l.activeSegment.nextOffset
+	l.mu.RUnlock()
+	if next > fromOffset {
+		l.watchers.mu.Lock()
+		if _, ok := l.watchers.byChan[c]; ok {
+			signal(c, next-1)
+		}
+		l.watchers.mu.Unlock()
+	}
+
+	return c, func() {
+		l.watchers.mu.Lock()
+		defer l.watchers.mu.Unlock()
+		if _, ok := l.watchers.byChan[c]; ok {
+			close(c)
+			delete(l.watchers.byChan, c)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package objectstore
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"path"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+/*
+S3Config configures a connection to an S3 compatible bucket (AWS S3, MinIO, etc.)
+- Endpoint: host and optional port of the service, ex. s3.amazonaws.com or localhost:9000
+- Prefix: objects are stored under this prefix so several logs can share a bucket
+- Secure: connects over https
+- Transport: optional http transport, ex. to trust a custom certificate authority
+*/
+type S3Config struct {
+	Endpoint        string
+	Bucket          string
+	Prefix          string
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	Secure          bool
+	Transport       http.RoundTripper
+}
+
+// S3 stores a log's offloaded segments as objects in an S3 compatible bucket
+type S3 struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+func NewS3(c S3Config) (*S3, error) {
+	client, err := minio.New(c.Endpoint, &minio.Options{
+		Creds:     credentials.NewStaticV4(c.AccessKeyID, c.SecretAccessKey, ""),
+		Secure:    c.Secure,
+		Region:    c.Region,
+		Transport: c.Transport,
+		// path style requests work with every S3 compatible service, virtual hosted buckets need DNS set up for them
+		BucketLookup: minio.BucketLookupPath,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &S3{client: client, bucket: c.Bucket, prefix: c.Prefix}, nil
+}
+
+func (s *S3) Put(ctx context.Context, name string, r io.Reader, size int64) error {
+	_, err := s.client.PutObject(ctx, s.bucket, s.key(name), r, size, minio.PutObjectOptions{
+		ContentType: "application/octet-stream",
+	})
+	return err
+}
+
+func (s *S3) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	obj, err := s.client.GetObject(ctx, s.bucket, s.key(name), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	// GetObject doesn't send a request until the object is read, stat surfaces a missing object right away
+	if _, err = obj.Stat(); err != nil {
+		obj.Close()
+		return nil, err
+	}
+	return obj, nil
+}
+
+func (s *S3) Delete(ctx context.Context, name string) error {
+	return s.client.RemoveObject(ctx, s.bucket, s.key(name), minio.RemoveObjectOptions{})
+}
+
+func (s *S3) key(name string) string {
+	return path.Join(s.prefix, name)
+}
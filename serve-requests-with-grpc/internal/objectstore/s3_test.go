@@ -0,0 +1,92 @@
+package objectstore
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/phaseharry/distributed-log/serve-requests-with-grpc/internal/log"
+	"github.com/stretchr/testify/require"
+)
+
+var _ log.ObjectStore = (*S3)(nil)
+
+/*
+fake S3 service that keeps objects in memory keyed by their path. served over tls since the
+client signs plain http uploads with aws' chunked streaming signature instead of a regular body
+*/
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		f.objects[r.URL.Path] = b
+	case http.MethodGet, http.MethodHead:
+		b, ok := f.objects[r.URL.Path]
+		if !ok {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, "<Error><Code>NoSuchKey</Code><Message>not found</Message></Error>")
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+		w.Header().Set("ETag", `"etag"`)
+		if r.Method == http.MethodGet {
+			w.Write(b)
+		}
+	case http.MethodDelete:
+		delete(f.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestS3(t *testing.T) {
+	fake := &fakeS3{objects: make(map[string][]byte)}
+	srv := httptest.NewTLSServer(fake)
+	defer srv.Close()
+
+	s3, err := NewS3(S3Config{
+		Endpoint:        strings.TrimPrefix(srv.URL, "https://"),
+		Bucket:          "segments",
+		Prefix:          "topic",
+		Region:          "us-east-1",
+		AccessKeyID:     "access",
+		SecretAccessKey: "secret",
+		Secure:          true,
+		Transport:       srv.Client().Transport,
+	})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	want := []byte("hello world")
+	require.NoError(t, s3.Put(ctx, "0.store", bytes.NewReader(want), int64(len(want))))
+	require.Equal(t, want, fake.objects["/segments/topic/0.store"])
+
+	r, err := s3.Get(ctx, "0.store")
+	require.NoError(t, err)
+	got, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	require.Equal(t, want, got)
+
+	require.NoError(t, s3.Delete(ctx, "0.store"))
+	_, err = s3.Get(ctx, "0.store")
+	require.Error(t, err)
+}
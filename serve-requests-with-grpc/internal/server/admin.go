@@ -0,0 +1,99 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/phaseharry/distributed-log/serve-requests-with-grpc/internal/log"
+)
+
+/*
+AdminHandler serves the endpoints used to look inside a running broker during an incident. it has no
+authentication of its own, so it belongs on a listener that's only reachable by operators:
+- /debug/pprof/: the runtime profiles from net/http/pprof, ex. go tool pprof http://host/debug/pprof/heap
+- /debug/gc: garbage collector and memory stats as json
+- /debug/log: the segments and offsets of the log and of every topic's log as json
+- /debug/streams: the open streams, see Streams
+- /metrics: the server's metrics when they're kept in a handler, ex. a metrics.Registry
+*/
+func (s *Server) AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/debug/gc", serveGC)
+	mux.HandleFunc("/debug/log", s.srv.serveLayout)
+	mux.Handle("/debug/streams", s.srv.Streams)
+	if h, ok := s.srv.Metrics.(http.Handler); ok {
+		mux.Handle("/metrics", h)
+	}
+	return mux
+}
+
+// GCStats is what /debug/gc serves
+type GCStats struct {
+	NumGC       int64           `json:"num_gc"`
+	LastGC      time.Time       `json:"last_gc"`
+	PauseTotal  time.Duration   `json:"pause_total_ns"`
+	RecentPause []time.Duration `json:"recent_pauses_ns"`
+	HeapAlloc   uint64          `json:"heap_alloc_bytes"`
+	HeapObjects uint64          `json:"heap_objects"`
+	Sys         uint64          `json:"sys_bytes"`
+	Goroutines  int             `json:"goroutines"`
+}
+
+func serveGC(w http.ResponseWriter, r *http.Request) {
+	var gc debug.GCStats
+	debug.ReadGCStats(&gc)
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	stats := GCStats{
+		NumGC:       gc.NumGC,
+		LastGC:      gc.LastGC,
+		PauseTotal:  gc.PauseTotal,
+		RecentPause: gc.Pause[:min(len(gc.Pause), 16)],
+		HeapAlloc:   mem.HeapAlloc,
+		HeapObjects: mem.HeapObjects,
+		Sys:         mem.Sys,
+		Goroutines:  runtime.NumGoroutine(),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// LogLayout is how a log is laid out on disk, /debug/log serves one for the server's log and for every topic
+type LogLayout struct {
+	// empty for the server's default log
+	Topic         string            `json:"topic"`
+	HighestOffset uint64            `json:"highest_offset"`
+	FlushedOffset uint64            `json:"flushed_offset"`
+	Segments      []log.SegmentInfo `json:"segments"`
+}
+
+func (s *grpcServer) serveLayout(w http.ResponseWriter, r *http.Request) {
+	topics := []string{""}
+	if s.Topics != nil {
+		for _, t := range s.Topics.List() {
+			topics = append(topics, t.Name)
+		}
+	}
+	layouts := make([]LogLayout, 0, len(topics))
+	for _, topic := range topics {
+		l, err := s.log(topic)
+		if err != nil {
+			// deleted since it was listed
+			continue
+		}
+		layout := LogLayout{Topic: topic, FlushedOffset: l.FlushedOffset(), Segments: l.Segments()}
+		layout.HighestOffset, _ = l.HighestOffset()
+		layouts = append(layouts, layout)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(layouts)
+}
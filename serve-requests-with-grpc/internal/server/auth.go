@@ -0,0 +1,113 @@
+package server
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// actions rpcs are authorized as
+const (
+	ProduceAction = "produce"
+	ConsumeAction = "consume"
+	// creating and deleting topics, redacting records, etc.
+	AdminAction = "admin"
+)
+
+// the action of every rpc, rpcs that aren't listed need the admin action
+var actions = map[string]string{
+	"/log.v1.Log/Produce":       ProduceAction,
+	"/log.v1.Log/ProduceStream": ProduceAction,
+	"/log.v1.Log/ProduceBatch":  ProduceAction,
+	"/log.v1.Log/Consume":       ConsumeAction,
+	"/log.v1.Log/ConsumeStream": ConsumeAction,
+	"/log.v1.Log/ConsumeBatch":  ConsumeAction,
+	"/log.v1.Log/Fetch":         ConsumeAction,
+	"/log.v1.Log/ConsumeGroup":  ConsumeAction,
+	"/log.v1.Log/AckGroup":      ConsumeAction,
+	"/log.v1.Log/Annotate":      ConsumeAction,
+	"/log.v1.Log/CommitOffset":  ConsumeAction,
+	"/log.v1.Log/FetchOffset":   ConsumeAction,
+	"/log.v1.Log/GetDescriptor": ConsumeAction,
+	"/log.v1.Log/Describe":      ConsumeAction,
+}
+
+// decides whether a subject can do an action on a topic, returning a PermissionDenied status if it can't
+type Authorizer interface {
+	Authorize(subject, topic, action string) error
+}
+
+// returns the subject the client authenticated as
+func (s *grpcServer) subject(ctx context.Context) (string, error) {
+	if s.Authenticate != nil {
+		return s.Authenticate(ctx)
+	}
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "", nil
+	}
+	if info, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(info.State.PeerCertificates) > 0 {
+		return info.State.PeerCertificates[0].Subject.CommonName, nil
+	}
+	return "", nil
+}
+
+/*
+authorizes the request as the rpc's action on the topic it's for. requests without a topic are for the
+default log, topic rpcs are for the topic they name
+*/
+func (s *grpcServer) authorize(ctx context.Context, method string, req any) error {
+	subject, err := s.subject(ctx)
+	if err != nil {
+		return err
+	}
+	action, ok := actions[method]
+	if !ok {
+		action = AdminAction
+	}
+	var topic string
+	switch req := req.(type) {
+	case interface{ GetTopic() string }:
+		topic = req.GetTopic()
+	case interface{ GetName() string }:
+		topic = req.GetName()
+	}
+	return s.Authorizer.Authorize(subject, topic, action)
+}
+
+func (s *grpcServer) authorizeUnary(
+	ctx context.Context,
+	req any,
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (any, error) {
+	if err := s.authorize(ctx, info.FullMethod, req); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// streams are authorized request by request since every request of a ProduceStream can be for another topic
+func (s *grpcServer) authorizeStream(
+	srv any,
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	return handler(srv, &authorizedStream{ServerStream: ss, server: s, method: info.FullMethod})
+}
+
+type authorizedStream struct {
+	grpc.ServerStream
+	server *grpcServer
+	method string
+}
+
+func (s *authorizedStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return s.server.authorize(s.Context(), s.method, m)
+}
@@ -0,0 +1,224 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	api "github.com/phaseharry/distributed-log/serve-requests-with-grpc/api/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// records a ConsumeBatch responds with when the request doesn't ask for a number
+	defaultBatchRecords = 100
+	// most records a ConsumeBatch responds with so one request can't make the server hold the whole log in memory
+	maxBatchRecords = 10000
+)
+
+// appends every record of the batch at consecutive offsets in one round trip
+func (s *grpcServer) ProduceBatch(ctx context.Context, req *api.ProduceBatchRequest) (*api.ProduceBatchResponse, error) {
+	l, err := s.log(req.Topic)
+	if err != nil {
+		return nil, err
+	}
+	records := req.Records
+	if s.StampOrigin {
+		identity, err := s.subject(ctx)
+		if err != nil {
+			return nil, err
+		}
+		received := time.Now()
+		records = make([]*api.Record, len(req.Records))
+		for i, record := range req.Records {
+			records[i] = stampOrigin(ctx, record, identity, received)
+		}
+	}
+	var base uint64
+	err = await(ctx, func() (err error) {
+		if base, err = l.AppendBatch(records); err == nil && req.Durable {
+			err = l.Sync()
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &api.ProduceBatchResponse{BaseOffset: base, FlushedOffset: l.FlushedOffset()}, nil
+}
+
+/*
+responds with the records from the offset on, up to the number of records and total size the request asks for.
+the records are read with a single range iterator instead of looking up every offset, so compacted logs can
+respond with fewer records than asked for. fails with ErrOffsetOutOfRange like Consume when there's no record
+at or after the offset
+*/
+func (s *grpcServer) ConsumeBatch(ctx context.Context, req *api.ConsumeBatchRequest) (*api.ConsumeBatchResponse, error) {
+	l, err := s.log(req.Topic)
+	if err != nil {
+		return nil, err
+	}
+	n := uint64(defaultBatchRecords)
+	if req.MaxRecords > 0 {
+		n = min(uint64(req.MaxRecords), maxBatchRecords)
+	}
+	it, err := l.ReadRange(req.Offset, req.Offset+n)
+	if err != nil {
+		return nil, err
+	}
+	res := &api.ConsumeBatchResponse{NextOffset: req.Offset}
+	var size uint64
+	for uint64(len(res.Records)) < n && it.Next() {
+		record := it.Record()
+		size += uint64(proto.Size(record))
+		if req.MaxBytes > 0 && size > req.MaxBytes && len(res.Records) > 0 {
+			break
+		}
+		res.Records = append(res.Records, record)
+		res.NextOffset = record.Offset + 1
+		if err = ctx.Err(); err != nil {
+			return nil, contextError(err)
+		}
+	}
+	if err = it.Err(); err != nil {
+		return nil, err
+	}
+	if len(res.Records) == 0 {
+		// every record in the range was compacted away, the next batch starts from the records after it
+		res.NextOffset = req.Offset + n
+	}
+	return res, nil
+}
+
+/*
+responds with a page of the records from the offset on like ConsumeBatch, for clients that page through the log
+with one request per page. the page's next offset is where the next page starts, and instead of failing past the
+end of the log the page is empty and marked as the end, so clients can poll for records appended after it
+*/
+func (s *grpcServer) Fetch(ctx context.Context, req *api.FetchRequest) (*api.FetchResponse, error) {
+	l, err := s.log(req.Topic)
+	if err != nil {
+		return nil, err
+	}
+	batch, err := s.ConsumeBatch(ctx, &api.ConsumeBatchRequest{
+		Offset:     req.Offset,
+		MaxRecords: req.MaxRecords,
+		MaxBytes:   req.MaxBytes,
+		Topic:      req.Topic,
+	})
+	switch err.(type) {
+	case nil:
+	case api.ErrOffsetOutOfRange:
+		return &api.FetchResponse{NextOffset: req.Offset, End: true}, nil
+	default:
+		return nil, err
+	}
+	highest, err := l.HighestOffset()
+	if err != nil {
+		return nil, err
+	}
+	return &api.FetchResponse{
+		Records:    filterRecords(req.Filter, batch.Records),
+		NextOffset: batch.NextOffset,
+		End:        batch.NextOffset > highest,
+	}, nil
+}
+
+/*
+streams the records from the request's offset on in batches, a long-poll over the stream: a batch is sent once it
+has max records, once its records add up to min bytes, or max wait after its first record was read, whichever
+comes first. without min bytes every batch is sent as soon as there's a record to send.
+only one batch is held at a time and Send blocks while the client's flow control window is full,
+so a slow consumer holds the stream back instead of piling records up in the server's memory
+*/
+func (s *grpcServer) streamBatches(
+	l CommitLog,
+	req *api.ConsumeRequest,
+	stream api.Log_ConsumeStreamServer,
+	tracked *trackedStream,
+	appended <-chan uint64,
+) error {
+	ctx := stream.Context()
+	n := min(int(req.MaxRecords), maxBatchRecords)
+	maxWait := time.Duration(req.MaxWaitMs) * time.Millisecond
+	res := &api.ConsumeResponse{}
+	var size uint64
+	var timer *time.Timer
+	var expired <-chan time.Time
+	send := func() error {
+		if timer != nil {
+			timer.Stop()
+		}
+		expired = nil
+		if err := stream.Send(res); err != nil {
+			return err
+		}
+		for range res.Records {
+			tracked.record()
+		}
+		if len(res.Records) > 0 {
+			s.reportLag(l, tracked, res.Records[len(res.Records)-1].Offset)
+		}
+		res, size = &api.ConsumeResponse{}, 0
+		return nil
+	}
+	for {
+		batch, err := s.ConsumeBatch(ctx, &api.ConsumeBatchRequest{
+			Offset:     req.Offset,
+			MaxRecords: uint32(n - len(res.Records)),
+			Topic:      req.Topic,
+		})
+		switch err.(type) {
+		case nil:
+			batch.Records = filterRecords(req.Filter, batch.Records)
+			if len(res.Records) == 0 && len(batch.Records) > 0 && maxWait > 0 {
+				timer = time.NewTimer(maxWait)
+				expired = timer.C
+			}
+			for _, record := range batch.Records {
+				size += uint64(proto.Size(record))
+			}
+			res.Records = append(res.Records, batch.Records...)
+			req.Offset = batch.NextOffset
+			if len(batch.Records) == 0 {
+				/*
+					a compacted range without records or a range without a record that matches the filter,
+					the records after them are already in the log
+				*/
+				continue
+			}
+		case api.ErrOffsetOutOfRange:
+		default:
+			return contextError(err)
+		}
+
+		if len(res.Records) >= n || (len(res.Records) > 0 && size >= req.MinBytes) {
+			if err = send(); err != nil {
+				return err
+			}
+			continue
+		}
+		if err = tracked.wait(); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return contextError(ctx.Err())
+		case <-s.draining:
+			// handing over the records the batch has so far so they aren't read again after the client reconnects
+			if len(res.Records) > 0 {
+				if err = send(); err != nil {
+					return err
+				}
+			}
+			return errShuttingDown
+		case <-expired:
+			if err = send(); err != nil {
+				return err
+			}
+		case _, ok := <-appended:
+			if !ok {
+				return s.logClosed(req.Topic)
+			}
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"context"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	api "github.com/phaseharry/distributed-log/serve-requests-with-grpc/api/v1"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// role brokers report until the log is replicated
+const standaloneRole = "standalone"
+
+/*
+describes the broker as a whole for a quick look at its health: what it's running, for how long, how much the
+default log and the topics take up, and the streams it has open
+*/
+func (s *grpcServer) DescribeBroker(ctx context.Context, req *api.DescribeBrokerRequest) (*api.DescribeBrokerResponse, error) {
+	stats := s.Streams.Stats()
+	res := &api.DescribeBrokerResponse{
+		GoVersion:      runtime.Version(),
+		Uptime:         durationpb.New(time.Since(s.started)),
+		OpenStreams:    uint32(len(stats.Open)),
+		WaitingStreams: uint32(stats.Waiting),
+		Role:           standaloneRole,
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		res.Version = info.Main.Version
+	}
+	logs := []CommitLog{s.CommitLog}
+	if s.Topics != nil {
+		topics := s.Topics.List()
+		res.Topics = uint32(len(topics))
+		for _, topic := range topics {
+			// skipping topics deleted since they were listed
+			if l, err := s.Topics.Topic(topic.Name); err == nil {
+				logs = append(logs, l)
+			}
+		}
+	}
+	for _, l := range logs {
+		for _, info := range l.Segments() {
+			res.Segments++
+			res.SizeBytes += info.Size
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"google.golang.org/grpc/encoding"
+	// registers the gzip compressor so clients can ask for gzip compressed responses
+	_ "google.golang.org/grpc/encoding/gzip"
+)
+
+/*
+names of the compressors the server registers. clients pick one with grpc.UseCompressor and the server compresses
+its responses with the one the request was compressed with, ex. zstd for consumers reading large batches
+*/
+const (
+	Gzip = "gzip"
+	Zstd = "zstd"
+)
+
+// room a produce request takes up around its record, for its topic, producer id and sequence
+const requestOverhead = 4 << 10
+
+/*
+MsgSizeFor returns the smallest MaxRecvMsgSize that fits a produce of a record of maxRecordBytes, so every record
+the log accepts can be produced and records over its limit fail with api.ErrRecordTooLarge instead of grpc's
+ResourceExhausted, as long as they fit the message. batches need room for all of their records
+*/
+func MsgSizeFor(maxRecordBytes uint64) int {
+	return int(maxRecordBytes) + requestOverhead
+}
+
+// CheckMsgSize fails when the receive size doesn't fit a produce of the biggest record the log accepts
+func CheckMsgSize(maxRecvMsgSize int, maxRecordBytes uint64) error {
+	if maxRecvMsgSize > 0 && maxRecordBytes > 0 && maxRecvMsgSize < MsgSizeFor(maxRecordBytes) {
+		return fmt.Errorf("max receive message size %d is too small for records of up to %d bytes, it needs to be at least %d",
+			maxRecvMsgSize, maxRecordBytes, MsgSizeFor(maxRecordBytes))
+	}
+	return nil
+}
+
+func init() {
+	encoding.RegisterCompressor(zstdCompressor{})
+}
+
+var (
+	// EncodeAll and DecodeAll can be called concurrently, so every message shares them
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+// compresses every message in one go, grpc hands compressors whole messages anyway
+type zstdCompressor struct{}
+
+func (zstdCompressor) Name() string {
+	return Zstd
+}
+
+func (zstdCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	return &zstdWriter{w: w}, nil
+}
+
+func (zstdCompressor) Decompress(r io.Reader) (io.Reader, error) {
+	p, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if p, err = zstdDecoder.DecodeAll(p, nil); err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(p), nil
+}
+
+// buffers the message and writes it compressed once it's closed
+type zstdWriter struct {
+	w   io.Writer
+	buf bytes.Buffer
+}
+
+func (z *zstdWriter) Write(p []byte) (int, error) {
+	return z.buf.Write(p)
+}
+
+func (z *zstdWriter) Close() error {
+	_, err := z.w.Write(zstdEncoder.EncodeAll(z.buf.Bytes(), nil))
+	return err
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"bytes"
+
+	api "github.com/phaseharry/distributed-log/serve-requests-with-grpc/api/v1"
+)
+
+// whether the record matches the filter, every record matches a nil filter
+func matches(filter *api.RecordFilter, record *api.Record) bool {
+	if filter == nil {
+		return true
+	}
+	if !bytes.HasPrefix(record.Key, filter.KeyPrefix) {
+		return false
+	}
+	for name, value := range filter.Headers {
+		if v, ok := record.Headers[name]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+// the records that match the filter, in place
+func filterRecords(filter *api.RecordFilter, records []*api.Record) []*api.Record {
+	if filter == nil {
+		return records
+	}
+	matched := records[:0]
+	for _, record := range records {
+		if matches(filter, record) {
+			matched = append(matched, record)
+		}
+	}
+	return matched
+}
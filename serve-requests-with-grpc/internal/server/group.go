@@ -0,0 +1,556 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	api "github.com/phaseharry/distributed-log/serve-requests-with-grpc/api/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+/*
+prefix of the consumer ids groups commit their offsets under so they don't collide with consumers' own ids,
+groups of a topic commit theirs under topic/{topic}/group/{name} instead
+*/
+const groupOffsetPrefix = "group/"
+
+// the consumer id the group of the topic commits its offset under, which also identifies the group
+func groupID(topic, name string) string {
+	if topic == "" {
+		return groupOffsetPrefix + name
+	}
+	return "topic/" + topic + "/" + groupOffsetPrefix + name
+}
+
+/*
+group is a named set of consumers sharing the log's records, each record is delivered to only one of its members.
+- members claim the next record nobody claimed yet, up to the number of records they're allowed to have in flight,
+and ack it once it's processed
+- a member that leaves (its stream ends) has its unacked records redelivered to the remaining members first,
+so joining and leaving rebalances the work without partitions
+- members can ask for an ack timeout, records they don't ack in time are taken back and redelivered like the
+records of members that left, so a member that's stuck on a record doesn't hold it forever
+- the group's redelivery policy backs redeliveries off exponentially and gives up on records that ran out of
+attempts, appending them to its dead letter topic and counting them as acked
+- the group's committed offset is the lowest offset that isn't acked yet. it's committed to the offset store
+so the group resumes from it after the server restarts, records that were in flight are delivered again.
+stores that keep the offsets acked above it (see AckStore) don't have the records that were acked out of order
+delivered again
+*/
+type group struct {
+	id        string
+	name      string
+	topic     string
+	mu        sync.Mutex
+	next      uint64               // next offset nobody claimed yet
+	inFlight  map[uint64]delivery  // claimed offsets that weren't acked yet
+	redeliver []uint64             // offsets whose member left or whose ack timed out before acking them, lowest first
+	retryAt   map[uint64]time.Time // when offsets waiting to be redelivered are backed off until
+	attempts  map[uint64]uint32    // how many times the offsets that weren't acked yet were delivered
+	members   map[string]int       // number of records each member has in flight
+	policy    *api.RedeliveryPolicy
+	committed uint64
+	// the offset store keeps the offsets acked above the committed one, so every ack is committed
+	keepsAcked bool
+	changed    chan struct{} // closed and replaced when records are acked or redelivered so waiting members check again
+}
+
+// a record delivered to a group's member
+type delivery struct {
+	member string
+	// when the record is taken back if it isn't acked, zero when the member didn't ask for an ack timeout
+	deadline time.Time
+}
+
+type groups struct {
+	mu     sync.Mutex
+	byName map[string]*group
+}
+
+func newGroups() *groups {
+	return &groups{byName: make(map[string]*group)}
+}
+
+// returns the topic's group with the name, starting it from its committed offset the first time it's used
+func (s *grpcServer) group(topic, name string) (*group, error) {
+	if name == "" {
+		return nil, status.Error(codes.InvalidArgument, "group is required")
+	}
+	id := groupID(topic, name)
+	s.groups.mu.Lock()
+	defer s.groups.mu.Unlock()
+	if g, ok := s.groups.byName[id]; ok {
+		return g, nil
+	}
+	g := &group{
+		id:       id,
+		name:     name,
+		topic:    topic,
+		inFlight: make(map[uint64]delivery),
+		retryAt:  make(map[uint64]time.Time),
+		attempts: make(map[uint64]uint32),
+		members:  make(map[string]int),
+		changed:  make(chan struct{}),
+	}
+	if s.Offsets != nil {
+		var off uint64
+		var acked []uint64
+		var err error
+		if store, ok := s.Offsets.(AckStore); ok {
+			g.keepsAcked = true
+			off, acked, err = store.FetchAcked(id)
+		} else {
+			off, err = s.Offsets.Fetch(id)
+		}
+		var unknown api.ErrUnknownConsumer
+		switch {
+		case err == nil:
+			g.resume(off, acked)
+		case !errors.As(err, &unknown):
+			return nil, err
+		}
+	}
+	s.groups.byName[id] = g
+	return g, nil
+}
+
+/*
+starts the group from its committed offset, the records between it and the highest offset that was acked
+that weren't acked themselves were in flight and are redelivered first
+*/
+func (g *group) resume(committed uint64, acked []uint64) {
+	g.next, g.committed = committed, committed
+	if len(acked) == 0 {
+		return
+	}
+	g.next = acked[len(acked)-1] + 1
+	for off := committed; off < g.next; off++ {
+		if _, ok := slices.BinarySearch(acked, off); !ok {
+			g.redeliver = append(g.redeliver, off)
+		}
+	}
+}
+
+func (g *group) join(member string) error {
+	if member == "" {
+		return status.Error(codes.InvalidArgument, "member id is required")
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, ok := g.members[member]; ok {
+		return status.Errorf(codes.AlreadyExists, "member %s already joined the group", member)
+	}
+	g.members[member] = 0
+	return nil
+}
+
+// replaces the group's redelivery policy, the records already backing off keep waiting for as long as they were
+func (g *group) setPolicy(policy *api.RedeliveryPolicy) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.policy = policy
+}
+
+/*
+queues the offset to be redelivered once the policy's backoff for the attempts it had passed,
+has to be called while holding the group's lock
+*/
+func (g *group) requeue(off uint64, now time.Time) {
+	i, ok := slices.BinarySearch(g.redeliver, off)
+	if !ok {
+		g.redeliver = slices.Insert(g.redeliver, i, off)
+	}
+	if backoff := g.backoff(g.attempts[off]); backoff > 0 {
+		g.retryAt[off] = now.Add(backoff)
+	}
+}
+
+// how long a record that was delivered the number of times waits before it's redelivered
+func (g *group) backoff(attempts uint32) time.Duration {
+	if g.policy == nil || g.policy.InitialBackoffMs == 0 || attempts == 0 {
+		return 0
+	}
+	backoff := time.Duration(g.policy.InitialBackoffMs) * time.Millisecond
+	maxBackoff := time.Duration(g.policy.MaxBackoffMs) * time.Millisecond
+	for range min(attempts-1, 32) {
+		backoff *= 2
+		if maxBackoff > 0 && backoff >= maxBackoff {
+			return maxBackoff
+		}
+	}
+	return backoff
+}
+
+// returns the index of the lowest offset waiting to be redelivered that's done backing off, -1 if there's none
+func (g *group) ready(now time.Time) int {
+	for i, off := range g.redeliver {
+		if at, ok := g.retryAt[off]; !ok || !now.Before(at) {
+			return i
+		}
+	}
+	return -1
+}
+
+// takes the offset at the index off the offsets waiting to be redelivered
+func (g *group) dequeue(i int) {
+	delete(g.retryAt, g.redeliver[i])
+	g.redeliver = slices.Delete(g.redeliver, i, i+1)
+}
+
+// reports whether the record ran out of delivery attempts, has to be called while holding the group's lock
+func (g *group) exhausted(off uint64) bool {
+	return g.policy != nil && g.policy.MaxAttempts > 0 && g.attempts[off] >= g.policy.MaxAttempts
+}
+
+/*
+removes the member from the group and hands the records it didn't ack to the remaining members.
+returns how many records the member had in flight
+*/
+func (g *group) leave(member string) int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	n := g.members[member]
+	delete(g.members, member)
+	now := time.Now()
+	for off, d := range g.inFlight {
+		if d.member == member {
+			delete(g.inFlight, off)
+			g.requeue(off, now)
+		}
+	}
+	g.signal()
+	return n
+}
+
+/*
+takes back the records whose ack timeout passed so they're redelivered. returns how many records were taken back,
+has to be called while holding the group's lock
+*/
+func (g *group) expire(now time.Time) int {
+	var n int
+	for off, d := range g.inFlight {
+		if d.deadline.IsZero() || now.Before(d.deadline) {
+			continue
+		}
+		delete(g.inFlight, off)
+		g.members[d.member]--
+		g.requeue(off, now)
+		n++
+	}
+	if n > 0 {
+		g.signal()
+	}
+	return n
+}
+
+/*
+returns when the next record in flight is taken back or the next record backing off can be redelivered,
+zero if no record has an ack timeout or is backing off
+*/
+func (g *group) nextDeadline() time.Time {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var next time.Time
+	earliest := func(t time.Time) {
+		if !t.IsZero() && (next.IsZero() || t.Before(next)) {
+			next = t
+		}
+	}
+	for _, d := range g.inFlight {
+		earliest(d.deadline)
+	}
+	for _, at := range g.retryAt {
+		earliest(at)
+	}
+	return next
+}
+
+/*
+claims the next record for the member, redelivered records that are done backing off first. returns a nil
+response and a channel that's closed once the group changes when the member has as many records in flight as
+it's allowed or every record was claimed. the group's lock is held while the record is read so two members never
+claim the same offset. records claimed with an ack timeout are taken back once it passes, records that ran out
+of attempts are dead lettered instead of being redelivered
+*/
+func (s *grpcServer) claim(
+	ctx context.Context,
+	g *group,
+	member string,
+	maxInFlight int,
+	ackTimeout time.Duration,
+) (*api.ConsumeResponse, <-chan struct{}, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := time.Now()
+	s.Streams.addInFlight(-g.expire(now))
+	if g.members[member] >= maxInFlight {
+		return nil, g.changed, nil
+	}
+	for {
+		i := g.ready(now)
+		redelivery := i >= 0
+		off := g.next
+		if redelivery {
+			off = g.redeliver[i]
+		}
+		res, err := s.Consume(ctx, &api.ConsumeRequest{Offset: off, Topic: g.topic})
+		var outOfRange api.ErrOffsetOutOfRange
+		switch {
+		case errors.As(err, &outOfRange) && redelivery:
+			// the record was removed from the log (ex. by retention) before it could be redelivered
+			g.dequeue(i)
+			delete(g.attempts, off)
+			continue
+		case errors.As(err, &outOfRange):
+			return nil, g.changed, nil
+		case err != nil:
+			return nil, nil, err
+		}
+		if redelivery {
+			g.dequeue(i)
+			if g.exhausted(off) {
+				if err = s.deadLetter(g, off, res.Record); err != nil {
+					g.requeue(off, now)
+					return nil, nil, err
+				}
+				continue
+			}
+		} else {
+			// compacted logs can skip over offsets, continuing from the record that was actually read
+			g.next = res.Record.Offset + 1
+		}
+		d := delivery{member: member}
+		if ackTimeout > 0 {
+			d.deadline = now.Add(ackTimeout)
+		}
+		g.inFlight[res.Record.Offset] = d
+		g.attempts[res.Record.Offset]++
+		g.members[member]++
+		res.DeliveryAttempt = g.attempts[res.Record.Offset]
+		return res, nil, nil
+	}
+}
+
+/*
+gives up on a record that ran out of attempts by appending it to the group's dead letter topic, stamped with
+where it came from, and counting it as acked. has to be called while holding the group's lock
+*/
+func (s *grpcServer) deadLetter(g *group, off uint64, record *api.Record) error {
+	if topic := g.policy.DeadLetterTopic; topic != "" {
+		l, err := s.log(topic)
+		if err != nil {
+			return err
+		}
+		dead := proto.Clone(record).(*api.Record)
+		dead.Offset = 0
+		if dead.Headers == nil {
+			dead.Headers = make(map[string]string)
+		}
+		dead.Headers[api.DeadLetterGroupHeader] = g.name
+		dead.Headers[api.DeadLetterTopicHeader] = g.topic
+		dead.Headers[api.DeadLetterOffsetHeader] = strconv.FormatUint(off, 10)
+		dead.Headers[api.DeadLetterAttemptsHeader] = strconv.FormatUint(uint64(g.attempts[off]), 10)
+		if _, err = l.Append(dead); err != nil {
+			return err
+		}
+	}
+	delete(g.attempts, off)
+	_, err := g.commit(s.groupCommit(g))
+	return err
+}
+
+/*
+acks a record that was delivered to the member and commits the group's new offset if every record
+below it was acked. fails if the record isn't in flight for the member, ex. because it left the group
+and the record was redelivered to someone else. commit is also handed the offsets above the committed one
+that were acked individually
+*/
+func (g *group) ack(member string, off uint64, commit func(committed uint64, acked []uint64) error) (uint64, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if d, ok := g.inFlight[off]; !ok || d.member != member {
+		return 0, status.Errorf(codes.FailedPrecondition, "offset %d isn't in flight for member %s", off, member)
+	}
+	delete(g.inFlight, off)
+	delete(g.attempts, off)
+	if _, ok := g.members[member]; ok {
+		g.members[member]--
+	}
+	defer g.signal()
+	return g.commit(commit)
+}
+
+/*
+commits the group's offset, the lowest offset that isn't acked yet, if it moved or the offset store keeps the
+offsets acked above it. has to be called while holding the group's lock
+*/
+func (g *group) commit(commit func(committed uint64, acked []uint64) error) (uint64, error) {
+	committed := g.next
+	for o := range g.inFlight {
+		committed = min(committed, o)
+	}
+	if len(g.redeliver) > 0 {
+		committed = min(committed, g.redeliver[0])
+	}
+	if committed == g.committed && !g.keepsAcked {
+		return committed, nil
+	}
+	if commit != nil {
+		if err := commit(committed, g.acked(committed)); err != nil {
+			return 0, err
+		}
+	}
+	g.committed = committed
+	return committed, nil
+}
+
+/*
+returns the offsets above the committed one that were acked, the ones that were claimed and aren't in flight
+or waiting to be redelivered. has to be called while holding the group's lock
+*/
+func (g *group) acked(committed uint64) []uint64 {
+	var acked []uint64
+	for off := committed + 1; off < g.next; off++ {
+		if _, ok := g.inFlight[off]; ok {
+			continue
+		}
+		if _, ok := slices.BinarySearch(g.redeliver, off); ok {
+			continue
+		}
+		acked = append(acked, off)
+	}
+	return acked
+}
+
+// wakes the members waiting on the group to change, has to be called while holding the group's lock
+func (g *group) signal() {
+	close(g.changed)
+	g.changed = make(chan struct{})
+}
+
+/*
+joins the stream to the group as the member and streams it the records it claims until the stream ends,
+at which point the member leaves the group. members wait on records being appended to the log like
+ConsumeStream and on the group changing when they can't claim anything yet
+*/
+func (s *grpcServer) ConsumeGroup(req *api.ConsumeGroupRequest, stream api.Log_ConsumeGroupServer) error {
+	l, err := s.log(req.Topic)
+	if err != nil {
+		return err
+	}
+	g, err := s.group(req.Topic, req.Group)
+	if err != nil {
+		return err
+	}
+	tracked, err := s.track(stream, "ConsumeGroup")
+	if err != nil {
+		return err
+	}
+	defer tracked.close()
+	if err = s.checkPolicy(req.Redelivery); err != nil {
+		return err
+	}
+	if err = g.join(req.MemberId); err != nil {
+		return err
+	}
+	if req.Redelivery != nil {
+		g.setPolicy(req.Redelivery)
+	}
+	defer func() {
+		s.Streams.addInFlight(-g.leave(req.MemberId))
+	}()
+
+	appended, cancel := l.Watch(0)
+	defer cancel()
+	maxInFlight := s.Streams.maxInFlight(max(int(req.MaxInFlight), 1))
+	ackTimeout := time.Duration(req.AckTimeoutMs) * time.Millisecond
+	ctx := stream.Context()
+	for {
+		res, changed, err := s.claim(ctx, g, req.MemberId, maxInFlight, ackTimeout)
+		if err != nil {
+			return contextError(err)
+		}
+		if res == nil {
+			if err = tracked.wait(); err != nil {
+				return err
+			}
+			// waking up when a record in flight times out or is done backing off so it's redelivered right away
+			var timeout <-chan time.Time
+			if deadline := g.nextDeadline(); !deadline.IsZero() {
+				timeout = time.After(time.Until(deadline))
+			}
+			select {
+			case <-timeout:
+			case <-ctx.Done():
+				return contextError(ctx.Err())
+			case <-s.draining:
+				return errShuttingDown
+			case <-changed:
+			case _, ok := <-appended:
+				if !ok {
+					return s.logClosed(req.Topic)
+				}
+			}
+			continue
+		}
+		s.Streams.addInFlight(1)
+		tracked.record()
+		if err = stream.Send(res); err != nil {
+			return err
+		}
+	}
+}
+
+// acks a record delivered to a group's member, responds with the group's committed offset
+func (s *grpcServer) AckGroup(ctx context.Context, req *api.AckGroupRequest) (*api.AckGroupResponse, error) {
+	if _, err := s.log(req.Topic); err != nil {
+		return nil, err
+	}
+	g, err := s.group(req.Topic, req.Group)
+	if err != nil {
+		return nil, err
+	}
+	committed, err := g.ack(req.MemberId, req.Offset, s.groupCommit(g))
+	if err != nil {
+		return nil, err
+	}
+	s.Streams.addInFlight(-1)
+	return &api.AckGroupResponse{CommittedOffset: committed}, nil
+}
+
+// commits the group's offset to the offset store, nil when the server doesn't have one
+func (s *grpcServer) groupCommit(g *group) func(uint64, []uint64) error {
+	if store, ok := s.Offsets.(AckStore); ok {
+		return func(off uint64, acked []uint64) error {
+			return store.CommitAcked(g.id, off, acked)
+		}
+	}
+	if s.Offsets != nil {
+		return func(off uint64, _ []uint64) error {
+			return s.Offsets.Commit(g.id, off)
+		}
+	}
+	return nil
+}
+
+// fails for policies whose backoff can't be applied or whose dead letter topic doesn't exist
+func (s *grpcServer) checkPolicy(policy *api.RedeliveryPolicy) error {
+	if policy == nil {
+		return nil
+	}
+	if policy.MaxBackoffMs > 0 && policy.MaxBackoffMs < policy.InitialBackoffMs {
+		return status.Error(codes.InvalidArgument, "max backoff is lower than the initial backoff")
+	}
+	if policy.DeadLetterTopic != "" {
+		if _, err := s.log(policy.DeadLetterTopic); err != nil {
+			return err
+		}
+	}
+	return nil
+}
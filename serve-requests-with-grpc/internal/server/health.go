@@ -0,0 +1,71 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// how often Watch checks the log's health again
+const healthWatchInterval = time.Second
+
+/*
+serves the standard grpc.health.v1 service so load balancers and orchestrators can tell whether the broker
+can take traffic. the server is reported as serving while the default log's disk can be written to and it isn't
+shutting down, both for the empty service name and the log's service
+*/
+type healthServer struct {
+	server *grpcServer
+}
+
+func (h *healthServer) status(service string) (healthpb.HealthCheckResponse_ServingStatus, error) {
+	if service != "" && service != "log.v1.Log" {
+		return healthpb.HealthCheckResponse_SERVICE_UNKNOWN, status.Errorf(codes.NotFound, "unknown service %s", service)
+	}
+	if h.server.shuttingDown() {
+		return healthpb.HealthCheckResponse_NOT_SERVING, nil
+	}
+	if err := h.server.CommitLog.CheckWritable(); err != nil {
+		return healthpb.HealthCheckResponse_NOT_SERVING, nil
+	}
+	return healthpb.HealthCheckResponse_SERVING, nil
+}
+
+func (h *healthServer) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	st, err := h.status(req.Service)
+	if err != nil {
+		return nil, err
+	}
+	return &healthpb.HealthCheckResponse{Status: st}, nil
+}
+
+// sends the status right away and then again every time it changes until the client goes away
+func (h *healthServer) Watch(req *healthpb.HealthCheckRequest, stream healthpb.Health_WatchServer) error {
+	ticker := time.NewTicker(healthWatchInterval)
+	defer ticker.Stop()
+	last := healthpb.HealthCheckResponse_UNKNOWN
+	for {
+		draining := h.server.shuttingDown()
+		// unknown services are reported as such instead of failing so the client sees them being added
+		st, _ := h.status(req.Service)
+		if st != last {
+			if err := stream.Send(&healthpb.HealthCheckResponse{Status: st}); err != nil {
+				return err
+			}
+			last = st
+		}
+		// ending the watch once the status while shutting down was sent so it doesn't hold up the shutdown
+		if draining {
+			return nil
+		}
+		select {
+		case <-stream.Context().Done():
+			return contextError(stream.Context().Err())
+		case <-h.server.draining:
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io/fs"
+	"net"
+	"os"
+
+	"google.golang.org/grpc/credentials"
+)
+
+/*
+ListenerConfig is an address the server is served on, the server can be served on any number of them at once
+ex. a unix socket for sidecars on the same host next to a tcp address with tls for everyone else
+*/
+type ListenerConfig struct {
+	// tcp or unix, defaults to tcp
+	Network string
+	// host:port for tcp, the socket's path for unix
+	Address string
+	// connections accepted on the listener are served over tls when set, ex. to require client certificates
+	TLS *tls.Config
+	/*
+		an already bound listener to serve instead of listening on Network and Address, ex. one of
+		SystemdListeners. it still gets the tls settings
+	*/
+	Listener net.Listener
+}
+
+/*
+Listen starts listening on the address for the server to Serve, connections it accepts carry the listener's tls
+settings so every listener can have its own. a unix socket that's left over from a server that didn't shut down
+cleanly is replaced
+*/
+func Listen(c ListenerConfig) (net.Listener, error) {
+	if c.Listener != nil {
+		return &listener{Listener: c.Listener, tls: c.TLS}, nil
+	}
+	if c.Network == "" {
+		c.Network = "tcp"
+	}
+	if c.Network == "unix" {
+		if fi, err := os.Stat(c.Address); err == nil && fi.Mode()&fs.ModeSocket != 0 {
+			if err = os.Remove(c.Address); err != nil {
+				return nil, err
+			}
+		}
+	}
+	l, err := net.Listen(c.Network, c.Address)
+	if err != nil {
+		return nil, err
+	}
+	return &listener{Listener: l, tls: c.TLS}, nil
+}
+
+type listener struct {
+	net.Listener
+	tls *tls.Config
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &listenerConn{Conn: conn, tls: l.tls}, nil
+}
+
+// a connection accepted by a listener from Listen, tls is the listener's settings
+type listenerConn struct {
+	net.Conn
+	tls *tls.Config
+}
+
+/*
+the server's transport credentials, they handshake connections with the tls settings of the listener that accepted
+them. connections from listeners without tls and from listeners that didn't come from Listen are served as is
+*/
+type listenerCredentials struct{}
+
+func (listenerCredentials) ServerHandshake(conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	lc, ok := conn.(*listenerConn)
+	if !ok {
+		return conn, nil, nil
+	}
+	if lc.tls == nil {
+		return lc.Conn, nil, nil
+	}
+	return credentials.NewTLS(lc.tls).ServerHandshake(lc.Conn)
+}
+
+func (listenerCredentials) ClientHandshake(context.Context, string, net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return nil, nil, errors.New("listener credentials are only used by the server")
+}
+
+func (listenerCredentials) Info() credentials.ProtocolInfo {
+	return credentials.ProtocolInfo{SecurityProtocol: "listener"}
+}
+
+func (c listenerCredentials) Clone() credentials.TransportCredentials {
+	return c
+}
+
+func (listenerCredentials) OverrideServerName(string) error {
+	return nil
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+type loggerKey struct{}
+
+/*
+Logger returns the logger of the rpc, it carries the rpc's method and peer so everything logged with it can be
+tied back to the rpc. it's a no-op logger for contexts that aren't an rpc's or when the server has no Config.Logger
+*/
+func Logger(ctx context.Context) *zap.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*zap.Logger); ok {
+		return logger
+	}
+	return zap.NewNop()
+}
+
+/*
+logs every rpc once it's done with its method, peer, duration and status code plus the topic and offset of the
+rpcs that have one. rpcs that succeeded are logged at debug level, ones the client got wrong (ex. an offset
+that's out of range) at info and ones the server failed at error level. it's installed ahead of Config.Middleware
+so rpcs that middleware rejects are logged too
+*/
+func (s *grpcServer) loggingMiddleware() Middleware {
+	rpcLogger := func(ctx context.Context, method string) *zap.Logger {
+		logger := s.Logger.With(zap.String("method", method))
+		if p, ok := peer.FromContext(ctx); ok {
+			logger = logger.With(zap.String("peer", p.Addr.String()))
+		}
+		return logger
+	}
+	return Middleware{
+		Unary: func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			start := time.Now()
+			logger := rpcLogger(ctx, info.FullMethod)
+			res, err := handler(context.WithValue(ctx, loggerKey{}, logger), req)
+			logRPC(logger, err, time.Since(start), requestFields(req, res, err)...)
+			return res, err
+		},
+		Stream: func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			start := time.Now()
+			logger := rpcLogger(ss.Context(), info.FullMethod)
+			err := handler(srv, &loggedStream{ServerStream: ss, ctx: context.WithValue(ss.Context(), loggerKey{}, logger)})
+			logRPC(logger, err, time.Since(start))
+			return err
+		},
+	}
+}
+
+// a stream whose context carries the rpc's logger
+type loggedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *loggedStream) Context() context.Context {
+	return s.ctx
+}
+
+func logRPC(logger *zap.Logger, err error, took time.Duration, fields ...zap.Field) {
+	code := status.Code(err)
+	fields = append(fields, zap.Duration("duration", took), zap.Stringer("code", code))
+	level := zapcore.DebugLevel
+	switch code {
+	case codes.OK:
+	case codes.Unknown, codes.Internal, codes.DataLoss, codes.Unimplemented:
+		level = zapcore.ErrorLevel
+		fields = append(fields, zap.Error(err))
+	default:
+		level = zapcore.InfoLevel
+		fields = append(fields, zap.Error(err))
+	}
+	if ce := logger.Check(level, "rpc"); ce != nil {
+		ce.Write(fields...)
+	}
+}
+
+// the topic of the request and the offset it asked for or its response was given, when they have one
+func requestFields(req, res any, err error) []zap.Field {
+	var fields []zap.Field
+	if r, ok := req.(interface{ GetTopic() string }); ok && r.GetTopic() != "" {
+		fields = append(fields, zap.String("topic", r.GetTopic()))
+	}
+	if r, ok := req.(interface{ GetOffset() uint64 }); ok {
+		fields = append(fields, zap.Uint64("offset", r.GetOffset()))
+	} else if r, ok := res.(interface{ GetOffset() uint64 }); ok && err == nil {
+		fields = append(fields, zap.Uint64("offset", r.GetOffset()))
+	}
+	return fields
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc/status"
+)
+
+/*
+counts every rpc by method and status code and measures how long they took, streams once they end.
+it's installed ahead of Config.Middleware so rpcs that middleware rejects are counted too
+*/
+func (s *grpcServer) metricsMiddleware() Middleware {
+	return Observe(func(method string, err error, took time.Duration) {
+		s.Metrics.Add("log_rpcs_total", 1, "method", method, "code", status.Code(err).String())
+		s.Metrics.Observe("log_rpc_seconds", took.Seconds(), "method", method)
+	})
+}
+
+// reports how many records the stream is behind the end of the log once it delivered the record at the offset
+func (s *grpcServer) reportLag(l CommitLog, tracked *trackedStream, off uint64) {
+	highest, err := l.HighestOffset()
+	if err != nil || highest < off {
+		return
+	}
+	s.Metrics.Set("log_consume_lag", float64(highest-off), tracked.lagLabels()...)
+}
+
+// drops the stream's lag once it ends so streams that are gone don't keep reporting it
+func (s *grpcServer) forgetLag(tracked *trackedStream) {
+	s.Metrics.Forget("log_consume_lag", tracked.lagLabels()...)
+}
+
+func (t *trackedStream) lagLabels() []string {
+	return []string{"stream", strconv.FormatUint(t.info.ID, 10), "rpc", t.info.RPC}
+}
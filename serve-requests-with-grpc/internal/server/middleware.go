@@ -0,0 +1,89 @@
+package server
+
+import (
+	"context"
+	"runtime/debug"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+/*
+Middleware wraps every rpc the server handles, ex. to log or measure them. either interceptor can be nil
+for middleware that only cares about unary rpcs or streams. Config.Middleware runs in order before the
+server's own timeout, auth and quota interceptors, so the first middleware sees every rpc including the ones
+those reject
+*/
+type Middleware struct {
+	Unary  grpc.UnaryServerInterceptor
+	Stream grpc.StreamServerInterceptor
+}
+
+// assembles the middleware into the server options that install it, skipping the halves that are nil
+func middlewareOptions(middleware []Middleware) []grpc.ServerOption {
+	var unary []grpc.UnaryServerInterceptor
+	var stream []grpc.StreamServerInterceptor
+	for _, m := range middleware {
+		if m.Unary != nil {
+			unary = append(unary, m.Unary)
+		}
+		if m.Stream != nil {
+			stream = append(stream, m.Stream)
+		}
+	}
+	return []grpc.ServerOption{grpc.ChainUnaryInterceptor(unary...), grpc.ChainStreamInterceptor(stream...)}
+}
+
+/*
+Observe calls fn with the method, the error and how long it took once every rpc is done. streams are observed
+once they end. it's the building block for ex. metrics, Logging is built on it
+*/
+func Observe(fn func(method string, err error, took time.Duration)) Middleware {
+	return Middleware{
+		Unary: func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			start := time.Now()
+			res, err := handler(ctx, req)
+			fn(info.FullMethod, err, time.Since(start))
+			return res, err
+		},
+		Stream: func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			start := time.Now()
+			err := handler(srv, ss)
+			fn(info.FullMethod, err, time.Since(start))
+			return err
+		},
+	}
+}
+
+// Logging writes a line for every rpc with its method, status code and duration, ex. Logging(log.Printf)
+func Logging(printf func(format string, args ...any)) Middleware {
+	return Observe(func(method string, err error, took time.Duration) {
+		printf("%s %s %s", method, status.Code(err), took)
+	})
+}
+
+/*
+Recovery turns panics in handlers into Internal errors for the client instead of crashing the broker, after
+handing the panic and its stack to fn. it should come first in Config.Middleware so it covers the rest.
+panics in goroutines the handlers start aren't recovered, ex. an append that's awaited
+*/
+func Recovery(fn func(p any, stack []byte)) Middleware {
+	recovered := func(err *error) {
+		if p := recover(); p != nil {
+			fn(p, debug.Stack())
+			*err = status.Errorf(codes.Internal, "panic: %v", p)
+		}
+	}
+	return Middleware{
+		Unary: func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (res any, err error) {
+			defer recovered(&err)
+			return handler(ctx, req)
+		},
+		Stream: func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+			defer recovered(&err)
+			return handler(srv, ss)
+		},
+	}
+}
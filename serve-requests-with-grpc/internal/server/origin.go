@@ -0,0 +1,35 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	api "github.com/phaseharry/distributed-log/serve-requests-with-grpc/api/v1"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/protobuf/proto"
+)
+
+/*
+returns a copy of the record stamped with who produced it and when the server received it, the reserved
+headers the producer sent are dropped first. the identity header is only set for producers that
+authenticated, ex. with a tls client certificate
+*/
+func stampOrigin(ctx context.Context, record *api.Record, identity string, received time.Time) *api.Record {
+	stamped := proto.Clone(record).(*api.Record)
+	for name := range stamped.Headers {
+		if api.IsReservedHeader(name) {
+			delete(stamped.Headers, name)
+		}
+	}
+	if stamped.Headers == nil {
+		stamped.Headers = make(map[string]string)
+	}
+	stamped.Headers[api.OriginTimeHeader] = received.UTC().Format(time.RFC3339Nano)
+	if identity != "" {
+		stamped.Headers[api.OriginIdentityHeader] = identity
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		stamped.Headers[api.OriginPeerHeader] = p.Addr.String()
+	}
+	return stamped
+}
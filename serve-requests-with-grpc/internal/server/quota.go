@@ -0,0 +1,269 @@
+package server
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	api "github.com/phaseharry/distributed-log/serve-requests-with-grpc/api/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/protobuf/proto"
+)
+
+// clients over this many are tracked before the ones that have been idle for a while are forgotten
+const maxIdleClients = 1024
+
+// Quota caps how fast records can be produced, zero means no cap. bursts of up to a second's worth are allowed
+type Quota struct {
+	RecordsPerSecond float64
+	BytesPerSecond   float64
+}
+
+/*
+Quotas caps how fast every client and all of them together can produce, so one misbehaving producer can't starve
+everyone else sharing the server. clients are told apart by the subject they authenticated as, or by their address
+when they're anonymous:
+
+	quotas := server.NewQuotas(server.Quota{RecordsPerSecond: 1000, BytesPerSecond: 1 << 20}, server.Quota{BytesPerSecond: 64 << 20})
+	quotas.Set("ingest", server.Quota{BytesPerSecond: 16 << 20})
+
+unary produces over quota fail with ResourceExhausted and a RetryInfo detail telling the client when to retry,
+produce streams are slowed down instead so they're held back without being torn down
+*/
+type Quotas struct {
+	perClient Quota
+	global    *buckets
+
+	mu        sync.Mutex
+	overrides map[string]Quota
+	clients   map[string]*buckets
+}
+
+func NewQuotas(perClient, global Quota) *Quotas {
+	return &Quotas{
+		perClient: perClient,
+		global:    newBuckets(global, time.Now()),
+		overrides: make(map[string]Quota),
+		clients:   make(map[string]*buckets),
+	}
+}
+
+// Set replaces the quota of the client, ex. to give a known high volume producer more room than the default
+func (q *Quotas) Set(client string, quota Quota) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.overrides[client] = quota
+	delete(q.clients, client)
+}
+
+/*
+takes the records and bytes out of the client's and the global quota, or neither of them when either is
+exhausted. returns how long until the quotas have room for them, zero when they were taken along with how much of
+the quotas is used afterwards. a dry run only checks whether they'd be taken
+*/
+func (q *Quotas) take(client string, records, bytes float64, now time.Time, dryRun bool) (time.Duration, []usage) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	b, ok := q.clients[client]
+	if !ok {
+		if len(q.clients) >= maxIdleClients {
+			q.forgetIdle(now)
+		}
+		quota, ok := q.overrides[client]
+		if !ok {
+			quota = q.perClient
+		}
+		b = newBuckets(quota, now)
+		q.clients[client] = b
+	}
+	b.refill(now)
+	q.global.refill(now)
+	if wait := max(b.wait(records, bytes), q.global.wait(records, bytes)); wait > 0 {
+		return wait, nil
+	}
+	if dryRun {
+		return 0, nil
+	}
+	b.take(records, bytes)
+	q.global.take(records, bytes)
+	return 0, append(b.usage("quota"), q.global.usage("global quota")...)
+}
+
+// forgets the clients whose quotas refilled, they start out with a full quota again the next time they produce
+func (q *Quotas) forgetIdle(now time.Time) {
+	for client, b := range q.clients {
+		if now.Sub(b.last) >= time.Second {
+			delete(q.clients, client)
+		}
+	}
+}
+
+// the token buckets of a quota, one for records and one for bytes
+type buckets struct {
+	records, bytes bucket
+	last           time.Time
+}
+
+type bucket struct {
+	rate, tokens float64
+}
+
+func newBuckets(quota Quota, now time.Time) *buckets {
+	return &buckets{
+		records: bucket{rate: quota.RecordsPerSecond, tokens: quota.RecordsPerSecond},
+		bytes:   bucket{rate: quota.BytesPerSecond, tokens: quota.BytesPerSecond},
+		last:    now,
+	}
+}
+
+func (b *buckets) refill(now time.Time) {
+	elapsed := now.Sub(b.last).Seconds()
+	b.last = now
+	for _, bucket := range []*bucket{&b.records, &b.bytes} {
+		bucket.tokens = min(bucket.tokens+elapsed*bucket.rate, bucket.rate)
+	}
+}
+
+func (b *buckets) wait(records, bytes float64) time.Duration {
+	return max(b.records.wait(records), b.bytes.wait(bytes))
+}
+
+// how much of the buckets is used, the tokens a bucket is in debt count as used too
+func (b *buckets) usage(limit string) []usage {
+	return []usage{
+		{limit: limit + " records", used: b.records.rate - b.records.tokens, max: b.records.rate},
+		{limit: limit + " bytes", used: b.bytes.rate - b.bytes.tokens, max: b.bytes.rate},
+	}
+}
+
+func (b *buckets) take(records, bytes float64) {
+	b.records.tokens -= records
+	b.bytes.tokens -= bytes
+}
+
+/*
+how long until the bucket has the tokens. requests bigger than a second's worth only need a full bucket and
+leave it in debt, so they're let through instead of being rejected forever
+*/
+func (b *bucket) wait(n float64) time.Duration {
+	if b.rate == 0 {
+		return 0
+	}
+	need := min(n, b.rate)
+	if b.tokens >= need {
+		return 0
+	}
+	return time.Duration((need - b.tokens) / b.rate * float64(time.Second))
+}
+
+// the records and bytes a request produces, zero for requests that don't produce
+func produced(req any) (records, bytes float64) {
+	switch req := req.(type) {
+	case *api.ProduceRequest:
+		return 1, float64(proto.Size(req.Record))
+	case *api.ProduceBatchRequest:
+		for _, record := range req.Records {
+			bytes += float64(proto.Size(record))
+		}
+		return float64(len(req.Records)), bytes
+	}
+	return 0, 0
+}
+
+// the client the request's quota is taken from, anonymous clients are told apart by their address
+func (s *grpcServer) quotaClient(ctx context.Context) (string, error) {
+	subject, err := s.subject(ctx)
+	if err != nil || subject != "" {
+		return subject, err
+	}
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "", nil
+	}
+	if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+		return host, nil
+	}
+	return p.Addr.String(), nil
+}
+
+/*
+returns how long the client has to wait before the request fits its quota, warning the client once it's past
+the soft limit of its quota when the request was let through. produces that are only validated are checked
+against the quota without taking from it
+*/
+func (s *grpcServer) quotaWait(
+	ctx context.Context,
+	req any,
+	setHeader func(metadata.MD) error,
+) (string, time.Duration, error) {
+	records, bytes := produced(req)
+	if records == 0 {
+		return "", 0, nil
+	}
+	client, err := s.quotaClient(ctx)
+	if err != nil {
+		return "", 0, err
+	}
+	validateOnly := false
+	if r, ok := req.(*api.ProduceRequest); ok {
+		validateOnly = r.ValidateOnly
+	}
+	wait, usages := s.Quotas.take(client, records, bytes, time.Now(), validateOnly)
+	s.warnSoftLimits(ctx, setHeader, usages...)
+	return client, wait, nil
+}
+
+func (s *grpcServer) quotaUnary(
+	ctx context.Context,
+	req any,
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (any, error) {
+	client, wait, err := s.quotaWait(ctx, req, func(md metadata.MD) error {
+		return grpc.SetHeader(ctx, md)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if wait > 0 {
+		return nil, api.ErrThrottled{Client: client, RetryAfter: wait}
+	}
+	return handler(ctx, req)
+}
+
+func (s *grpcServer) quotaStream(
+	srv any,
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	return handler(srv, &throttledStream{ServerStream: ss, server: s})
+}
+
+// holds requests back until they fit the client's quota instead of failing the stream
+type throttledStream struct {
+	grpc.ServerStream
+	server *grpcServer
+}
+
+func (s *throttledStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	for {
+		_, wait, err := s.server.quotaWait(s.Context(), m, s.ServerStream.SetHeader)
+		if err != nil || wait == 0 {
+			return err
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-s.Context().Done():
+			timer.Stop()
+			return contextError(s.Context().Err())
+		case <-timer.C:
+		}
+	}
+}
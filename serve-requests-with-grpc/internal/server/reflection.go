@@ -0,0 +1,132 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"sort"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+/*
+serves grpc.reflection.v1alpha from the descriptors the generated code registered, so tools like grpcurl can
+list and call the rpcs without the protos. grpc's own reflection package depends on the deprecated descriptor
+package which doesn't build against the protobuf runtime the generated code needs
+*/
+type reflectionServer struct {
+	gsrv *grpc.Server
+}
+
+func (r *reflectionServer) ServerReflectionInfo(stream rpb.ServerReflection_ServerReflectionInfoServer) error {
+	// files already sent on the stream aren't sent again as dependencies of later ones
+	sent := make(map[string]bool)
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		res := &rpb.ServerReflectionResponse{ValidHost: req.Host, OriginalRequest: req}
+		switch msg := req.MessageRequest.(type) {
+		case *rpb.ServerReflectionRequest_FileByFilename:
+			file, err := protoregistry.GlobalFiles.FindFileByPath(msg.FileByFilename)
+			files(res, file, err, sent)
+		case *rpb.ServerReflectionRequest_FileContainingSymbol:
+			desc, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(msg.FileContainingSymbol))
+			var file protoreflect.FileDescriptor
+			if err == nil {
+				file = desc.ParentFile()
+			}
+			files(res, file, err, sent)
+		case *rpb.ServerReflectionRequest_FileContainingExtension:
+			ext, err := protoregistry.GlobalTypes.FindExtensionByNumber(
+				protoreflect.FullName(msg.FileContainingExtension.ContainingType),
+				protoreflect.FieldNumber(msg.FileContainingExtension.ExtensionNumber),
+			)
+			var file protoreflect.FileDescriptor
+			if err == nil {
+				file = ext.TypeDescriptor().ParentFile()
+			}
+			files(res, file, err, sent)
+		case *rpb.ServerReflectionRequest_AllExtensionNumbersOfType:
+			name := protoreflect.FullName(msg.AllExtensionNumbersOfType)
+			if _, err := protoregistry.GlobalFiles.FindDescriptorByName(name); err != nil {
+				res.MessageResponse = reflectionError(err)
+				break
+			}
+			numbers := &rpb.ExtensionNumberResponse{BaseTypeName: string(name)}
+			protoregistry.GlobalTypes.RangeExtensionsByMessage(name, func(ext protoreflect.ExtensionType) bool {
+				numbers.ExtensionNumber = append(numbers.ExtensionNumber, int32(ext.TypeDescriptor().Number()))
+				return true
+			})
+			res.MessageResponse = &rpb.ServerReflectionResponse_AllExtensionNumbersResponse{AllExtensionNumbersResponse: numbers}
+		case *rpb.ServerReflectionRequest_ListServices:
+			services := &rpb.ListServiceResponse{}
+			for name := range r.gsrv.GetServiceInfo() {
+				services.Service = append(services.Service, &rpb.ServiceResponse{Name: name})
+			}
+			sort.Slice(services.Service, func(i, j int) bool { return services.Service[i].Name < services.Service[j].Name })
+			res.MessageResponse = &rpb.ServerReflectionResponse_ListServicesResponse{ListServicesResponse: services}
+		default:
+			return status.Errorf(codes.InvalidArgument, "invalid reflection request %v", req.MessageRequest)
+		}
+		if err = stream.Send(res); err != nil {
+			return err
+		}
+	}
+}
+
+// answers with the file and the dependencies it has that weren't sent on the stream yet
+func files(res *rpb.ServerReflectionResponse, file protoreflect.FileDescriptor, err error, sent map[string]bool) {
+	if err != nil {
+		res.MessageResponse = reflectionError(err)
+		return
+	}
+	descriptors := &rpb.FileDescriptorResponse{}
+	var add func(protoreflect.FileDescriptor) error
+	add = func(file protoreflect.FileDescriptor) error {
+		if sent[file.Path()] {
+			return nil
+		}
+		sent[file.Path()] = true
+		b, err := proto.Marshal(protodesc.ToFileDescriptorProto(file))
+		if err != nil {
+			return err
+		}
+		descriptors.FileDescriptorProto = append(descriptors.FileDescriptorProto, b)
+		imports := file.Imports()
+		for i := 0; i < imports.Len(); i++ {
+			if err = add(imports.Get(i).FileDescriptor); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	// the requested file is always sent, clients ask for it again when they lost track of it
+	delete(sent, file.Path())
+	if err = add(file); err != nil {
+		res.MessageResponse = reflectionError(err)
+		return
+	}
+	res.MessageResponse = &rpb.ServerReflectionResponse_FileDescriptorResponse{FileDescriptorResponse: descriptors}
+}
+
+func reflectionError(err error) *rpb.ServerReflectionResponse_ErrorResponse {
+	code := codes.Internal
+	if errors.Is(err, protoregistry.NotFound) {
+		code = codes.NotFound
+	}
+	return &rpb.ServerReflectionResponse_ErrorResponse{ErrorResponse: &rpb.ErrorResponse{
+		ErrorCode:    int32(code),
+		ErrorMessage: err.Error(),
+	}}
+}
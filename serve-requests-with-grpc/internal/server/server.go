@@ -2,13 +2,99 @@ package server
 
 import (
 	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
 
 	api "github.com/phaseharry/distributed-log/serve-requests-with-grpc/api/v1"
+	"github.com/phaseharry/distributed-log/serve-requests-with-grpc/internal/log"
+	"github.com/phaseharry/distributed-log/serve-requests-with-grpc/metrics"
+	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 type Config struct {
 	CommitLog CommitLog
+	/*
+		descriptors of the messages producers pack into google.protobuf.Any values, handed out by GetDescriptor
+		so dynamic clients can decode them. defaults to every message linked into the server's binary
+	*/
+	Descriptors *protoregistry.Files
+	// where consumers commit the offsets they resume from, CommitOffset and FetchOffset are unimplemented when nil
+	Offsets OffsetStore
+	// tracks the open streams and caps what they hold on to, defaults to tracking them without any limits
+	Streams *Streams
+	// named logs requests with a topic are served from, the topic rpcs are unimplemented when nil
+	Topics TopicStore
+	/*
+		stamps every produced record with the producer's address, its tls identity, and when the record was
+		received in the reserved origin headers, so an audit can tell who wrote a record long after they disconnected
+	*/
+	StampOrigin bool
+	/*
+		connection age limits and keepalive pings, ex. MaxConnectionAge so clients behind an L4 load balancer
+		reconnect every so often and spread out over the brokers instead of staying pinned to one of them.
+		defaults to grpc's, connections are kept forever
+	*/
+	Keepalive keepalive.ServerParameters
+	// how often clients are allowed to ping, clients that ping more often are disconnected. defaults to grpc's
+	KeepaliveEnforcement *keepalive.EnforcementPolicy
+	/*
+		decides whether the client can do what its rpc does, ex. the auth package's Authorizer. every rpc
+		is allowed when nil
+	*/
+	Authorizer Authorizer
+	/*
+		returns the subject the client authenticated as, ex. by looking up a bearer token in the rpc's metadata.
+		defaults to the common name of the client's tls certificate, clients without one are the subject ""
+	*/
+	Authenticate func(ctx context.Context) (string, error)
+	// registers the server reflection service so tools like grpcurl can list and call the rpcs without the protos
+	Reflection bool
+	/*
+		caps how long a unary rpc is processed before it fails with DeadlineExceeded, so a disk that stopped
+		responding doesn't hold rpcs forever. clients' own deadlines apply when they're sooner, rpcs are only
+		bounded by those when it's zero
+	*/
+	MaxRPCTime time.Duration
+	// caps how fast clients can produce, see Quotas. produces aren't limited when nil
+	Quotas *Quotas
+	// cross cutting behavior wrapped around every rpc, ex. Recovery and Logging. see Middleware for the order
+	Middleware []Middleware
+	/*
+		where the server reports rpc counts by status code, rpc latency and how far behind the end of the log
+		every ConsumeStream is, ex. a metrics.Registry served at /metrics. defaults to metrics.Nop
+	*/
+	Metrics metrics.Metrics
+	/*
+		logs every rpc with its method, peer, duration and outcome, see Logger for logging with those fields from
+		middleware. nothing is logged when nil
+	*/
+	Logger *zap.Logger
+	/*
+		fraction of every hard limit (the Streams limits and the Quotas) past which rpcs are warned that they're
+		getting close to it, ex. 0.8 to warn producers at 80% of their quota before they're throttled.
+		see WarningHeader. nothing is warned about when it's zero
+	*/
+	SoftLimit float64
+	/*
+		biggest messages the server receives and sends, defaulting to grpc's 4MiB and no limit. requests over
+		MaxRecvMsgSize are rejected by grpc with a ResourceExhausted error that doesn't say which record was too
+		big, so it should leave room for a request around the biggest record the log accepts. see MsgSizeFor
+	*/
+	MaxRecvMsgSize int
+	MaxSendMsgSize int
 }
 
 var _ api.LogServer = (*grpcServer)(nil)
@@ -22,67 +108,341 @@ ex. Produce, Consume, ProduceStream, and ConsumeStream
 type grpcServer struct {
 	api.UnimplementedLogServer
 	*Config
+	groups  *groups
+	started time.Time
+	// closed once the server starts shutting down
+	draining  chan struct{}
+	drainOnce sync.Once
 }
 
-func NewGrpcServer(config *Config) (*grpc.Server, error) {
-	gsrv := grpc.NewServer()
+func NewGrpcServer(config *Config) (*Server, error) {
 	srv, err := newGrpcServer(config)
 
 	if err != nil {
 		return nil, err
 	}
 
+	opts := []grpc.ServerOption{
+		grpc.KeepaliveParams(config.Keepalive),
+		// listeners from Listen each have their own tls settings, see listenerCredentials
+		grpc.Creds(listenerCredentials{}),
+	}
+	if config.KeepaliveEnforcement != nil {
+		opts = append(opts, grpc.KeepaliveEnforcementPolicy(*config.KeepaliveEnforcement))
+	}
+	if config.MaxRecvMsgSize > 0 {
+		opts = append(opts, grpc.MaxRecvMsgSize(config.MaxRecvMsgSize))
+	}
+	if config.MaxSendMsgSize > 0 {
+		opts = append(opts, grpc.MaxSendMsgSize(config.MaxSendMsgSize))
+	}
+	middleware := []Middleware{srv.metricsMiddleware()}
+	if config.Logger != nil {
+		middleware = append(middleware, srv.loggingMiddleware())
+	}
+	opts = append(opts, middlewareOptions(append(middleware, config.Middleware...))...)
+	if config.MaxRPCTime > 0 {
+		opts = append(opts, grpc.ChainUnaryInterceptor(srv.timeoutUnary))
+	}
+	if config.Authorizer != nil {
+		opts = append(opts,
+			grpc.ChainUnaryInterceptor(srv.authorizeUnary),
+			grpc.ChainStreamInterceptor(srv.authorizeStream),
+		)
+	}
+	if config.Quotas != nil {
+		opts = append(opts,
+			grpc.ChainUnaryInterceptor(srv.quotaUnary),
+			grpc.ChainStreamInterceptor(srv.quotaStream),
+		)
+	}
+	gsrv := grpc.NewServer(opts...)
+	healthpb.RegisterHealthServer(gsrv, &healthServer{server: srv})
+	if config.Reflection {
+		rpb.RegisterServerReflectionServer(gsrv, &reflectionServer{gsrv: gsrv})
+	}
+
 	api.RegisterLogServer(gsrv, srv)
 
-	return gsrv, nil
+	return &Server{Server: gsrv, srv: srv}, nil
 }
 
 func newGrpcServer(config *Config) (srv *grpcServer, err error) {
+	if config.Streams == nil {
+		config.Streams = NewStreams(Limits{})
+	}
+	if config.Metrics == nil {
+		config.Metrics = metrics.Nop
+	}
 	srv = &grpcServer{
-		Config: config,
+		Config:   config,
+		groups:   newGroups(),
+		started:  time.Now(),
+		draining: make(chan struct{}),
 	}
 	return srv, nil
 }
 
+// the checks a produce that's only validated runs in place of appending the record
+func (s *grpcServer) validate(l CommitLog, record *api.Record) error {
+	if record == nil {
+		return status.Error(codes.InvalidArgument, "produce request has no record")
+	}
+	return l.Validate(record)
+}
+
 func (s *grpcServer) Produce(ctx context.Context, req *api.ProduceRequest) (*api.ProduceResponse, error) {
-	offset, err := s.CommitLog.Append(req.Record)
+	l, err := s.log(req.Topic)
 	if err != nil {
 		return nil, err
 	}
-	return &api.ProduceResponse{Offset: offset}, nil
+	if s.StampOrigin {
+		identity, err := s.subject(ctx)
+		if err != nil {
+			return nil, err
+		}
+		req.Record = stampOrigin(ctx, req.Record, identity, time.Now())
+	}
+	if req.ValidateOnly {
+		if err = s.validate(l, req.Record); err != nil {
+			return nil, err
+		}
+		return &api.ProduceResponse{}, nil
+	}
+	var offset uint64
+	err = await(ctx, func() (err error) {
+		if req.ProducerId != 0 {
+			offset, err = l.AppendIdempotent(req.Record, req.ProducerId, req.Sequence)
+		} else {
+			offset, err = l.Append(req.Record)
+		}
+		if err == nil && req.Durable {
+			err = l.Sync()
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &api.ProduceResponse{Offset: offset, FlushedOffset: l.FlushedOffset()}, nil
 }
 
 func (s *grpcServer) Consume(ctx context.Context, req *api.ConsumeRequest) (*api.ConsumeResponse, error) {
-	record, err := s.CommitLog.Read(req.Offset)
+	l, err := s.log(req.Topic)
 	if err != nil {
 		return nil, err
 	}
-	return &api.ConsumeResponse{Record: record}, nil
+	if req.ValidateOnly {
+		return &api.ConsumeResponse{}, nil
+	}
+	record, err := l.ReadContext(ctx, req.Offset)
+	if err != nil {
+		return nil, contextError(err)
+	}
+	if req.UnpackAny {
+		if record, err = api.UnpackAny(record); err != nil {
+			return nil, err
+		}
+	}
+	// the record read is the next one still in the log when the offset was compacted away
+	annotations, err := l.Annotations(record.Offset)
+	if err != nil {
+		return nil, err
+	}
+	return &api.ConsumeResponse{Record: record, Annotations: annotations}, nil
+}
+
+/*
+attaches an annotation (processed, poisoned, redacted, etc.) to a record that already exists
+in the log. responds with every annotation the record has so far
+*/
+func (s *grpcServer) Annotate(ctx context.Context, req *api.AnnotateRequest) (*api.AnnotateResponse, error) {
+	l, err := s.log(req.Topic)
+	if err != nil {
+		return nil, err
+	}
+	annotations, err := l.Annotate(req.Offset, req.Annotation)
+	if err != nil {
+		return nil, err
+	}
+	return &api.AnnotateResponse{Annotations: annotations}, nil
+}
+
+/*
+makes the record at the offset permanently unreadable by deleting its encryption key.
+consuming the record afterwards returns it without a value and annotated as redacted
+*/
+func (s *grpcServer) Redact(ctx context.Context, req *api.RedactRequest) (*api.RedactResponse, error) {
+	l, err := s.log(req.Topic)
+	if err != nil {
+		return nil, err
+	}
+	if err = l.Redact(req.Offset); err != nil {
+		return nil, redactError(err)
+	}
+	return &api.RedactResponse{}, nil
+}
+
+/*
+turns the log's redaction errors into the statuses clients get, ex. redacting a log
+that isn't encrypted is a FailedPrecondition rather than an Unknown error
+*/
+func redactError(err error) error {
+	switch {
+	case errors.Is(err, log.ErrEncryptionDisabled):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, log.ErrNotEncrypted):
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return err
+}
+
+/*
+describes the log so operators can watch it grow without shelling into the server: its offsets,
+how many segments it has and how much they take up, and the segment records are appended to
+*/
+func (s *grpcServer) Describe(ctx context.Context, req *api.DescribeRequest) (*api.DescribeResponse, error) {
+	l, err := s.log(req.Topic)
+	if err != nil {
+		return nil, err
+	}
+	segments := l.Segments()
+	res := &api.DescribeResponse{
+		LowestOffset:  segments[0].BaseOffset,
+		NextOffset:    segments[len(segments)-1].NextOffset,
+		Segments:      uint64(len(segments)),
+		ActiveSegment: segmentInfo(segments[len(segments)-1]),
+	}
+	if res.NextOffset > 0 {
+		res.HighestOffset = res.NextOffset - 1
+	}
+	for _, info := range segments {
+		res.SizeBytes += info.Size
+		if info.Remote {
+			res.RemoteBytes += info.Size
+		}
+	}
+	return res, nil
+}
+
+func segmentInfo(info log.SegmentInfo) *api.SegmentInfo {
+	res := &api.SegmentInfo{
+		BaseOffset: info.BaseOffset,
+		NextOffset: info.NextOffset,
+		Records:    info.Records,
+		SizeBytes:  info.Size,
+		Sealed:     info.Sealed,
+		Remote:     info.Remote,
+	}
+	if !info.FirstAppend.IsZero() {
+		res.FirstAppend = timestamppb.New(info.FirstAppend)
+	}
+	if !info.LastAppend.IsZero() {
+		res.LastAppend = timestamppb.New(info.LastAppend)
+	}
+	return res
+}
+
+/*
+responds with the descriptor of the file that defines the message along with the descriptors of every file
+it imports, so clients that weren't compiled with the message can still decode records holding it
+*/
+func (s *grpcServer) GetDescriptor(ctx context.Context, req *api.GetDescriptorRequest) (*api.GetDescriptorResponse, error) {
+	files := s.Descriptors
+	if files == nil {
+		files = protoregistry.GlobalFiles
+	}
+	d, err := files.FindDescriptorByName(api.MessageName(req.TypeName))
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "no descriptor for %s", req.TypeName)
+	}
+	if _, ok := d.(protoreflect.MessageDescriptor); !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "%s isn't a message", req.TypeName)
+	}
+	set := &descriptorpb.FileDescriptorSet{}
+	addFile(set, d.ParentFile(), make(map[string]bool))
+	return &api.GetDescriptorResponse{FileDescriptorSet: set}, nil
+}
+
+// adds the file's imports and then the file to the set, skipping files that were already added
+func addFile(set *descriptorpb.FileDescriptorSet, file protoreflect.FileDescriptor, added map[string]bool) {
+	if added[file.Path()] {
+		return
+	}
+	added[file.Path()] = true
+	imports := file.Imports()
+	for i := 0; i < imports.Len(); i++ {
+		addFile(set, imports.Get(i).FileDescriptor, added)
+	}
+	set.File = append(set.File, protodesc.ToFileDescriptorProto(file))
+}
+
+// durably commits the offset of the next record the consumer will consume
+func (s *grpcServer) CommitOffset(ctx context.Context, req *api.CommitOffsetRequest) (*api.CommitOffsetResponse, error) {
+	if err := s.checkConsumer(req.ConsumerId); err != nil {
+		return nil, err
+	}
+	if err := s.Offsets.Commit(req.ConsumerId, req.Offset); err != nil {
+		return nil, err
+	}
+	return &api.CommitOffsetResponse{}, nil
+}
+
+// responds with the offset the consumer last committed so it can resume consuming from it
+func (s *grpcServer) FetchOffset(ctx context.Context, req *api.FetchOffsetRequest) (*api.FetchOffsetResponse, error) {
+	if err := s.checkConsumer(req.ConsumerId); err != nil {
+		return nil, err
+	}
+	offset, err := s.Offsets.Fetch(req.ConsumerId)
+	if err != nil {
+		return nil, err
+	}
+	return &api.FetchOffsetResponse{Offset: offset}, nil
+}
+
+func (s *grpcServer) checkConsumer(consumerID string) error {
+	if s.Offsets == nil {
+		return status.Error(codes.Unimplemented, "consumer offsets aren't enabled")
+	}
+	if consumerID == "" {
+		return status.Error(codes.InvalidArgument, "consumer id is required")
+	}
+	return nil
 }
 
 func (s *grpcServer) ProduceStream(stream api.Log_ProduceStreamServer) error {
 	/*
 		implements a bidirectional streaming rpc so clients can stream logs to log server and log server
-		can respond with the offset value (indiciating that it was saved successfully) or error out
+		can respond with an ack for every request, in the order they were received.
 
-		only stops stream and returns an error if there was an error in
-			- consuming a message from the stream
-			- error in calling the Produce function on the grpc server (creating a log entry)
-			- error in sending a response back through the stream with the offset value of where that entry
-			was saved
+		an ack has the offset the record was saved at, or the error producing it failed with so one bad record
+		(ex. an out of order sequence) doesn't tear down the stream for the records behind it. the stream only
+		stops if
+			- the client closed its side of the stream, which ends the rpc cleanly
+			- receiving a request or sending an ack failed, ex. because the client went away
 	*/
+	tracked, err := s.track(stream, "ProduceStream")
+	if err != nil {
+		return err
+	}
+	defer tracked.close()
 	for {
 		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
 		if err != nil {
 			return err
 		}
 		res, err := s.Produce(stream.Context(), req)
 		if err != nil {
-			return err
+			st := status.Convert(err)
+			res = &api.ProduceResponse{Error: &api.ProduceError{Code: uint32(st.Code()), Message: st.Message()}}
 		}
 		if err = stream.Send(res); err != nil {
 			return err
 		}
+		tracked.record()
 	}
 }
 
@@ -95,30 +455,77 @@ func (s *grpcServer) ConsumeStream(
 	   from that starting offset, it will read the value at that offset and
 	   send that value back to client. It will continually do this even when we've
 	   read through all records after that offset. It will wait until a new record
-	   has been added. The stream will only end if there's an error or if the client
-	   has terminated the stream connection.
+	   has been added by watching the log instead of retrying the read. The stream will
+	   only end if there's an error or if the client has terminated the stream connection.
+	   requests that ask for max_records are streamed batches of records instead, see streamBatches
 	*/
+	l, err := s.log(req.Topic)
+	if err != nil {
+		return err
+	}
+	// validate_only is for Consume, streams read the log regardless
+	req.ValidateOnly = false
+	tracked, err := s.track(stream, "ConsumeStream")
+	if err != nil {
+		return err
+	}
+	defer tracked.close()
+	defer s.forgetLag(tracked)
+	appended, cancel := l.Watch(req.Offset)
+	defer cancel()
+	if req.MaxRecords > 0 {
+		return s.streamBatches(l, req, stream, tracked, appended)
+	}
 	for {
-		select {
-		case <-stream.Context().Done():
-			return nil
-		default:
-			res, err := s.Consume(stream.Context(), req)
-			switch err.(type) {
-			case nil:
-			case api.ErrOffsetOutOfRange:
-				continue
-			default:
+		res, err := s.Consume(stream.Context(), req)
+		switch err.(type) {
+		case nil:
+		case api.ErrOffsetOutOfRange:
+			if err = tracked.wait(); err != nil {
 				return err
 			}
-			if err = stream.Send(res); err != nil {
-				return err
+			select {
+			case <-stream.Context().Done():
+				return contextError(stream.Context().Err())
+			case <-s.draining:
+				return errShuttingDown
+			case _, ok := <-appended:
+				if !ok {
+					return s.logClosed(req.Topic)
+				}
 			}
-			req.Offset++
+			continue
+		default:
+			return err
+		}
+		if !matches(req.Filter, res.Record) {
+			req.Offset = res.Record.Offset + 1
+			continue
+		}
+		if err = stream.Send(res); err != nil {
+			return err
 		}
+		tracked.record()
+		s.reportLag(l, tracked, res.Record.Offset)
+		/*
+		   continuing from the record that was actually read since compacted logs
+		   can skip over offsets whose records were compacted away
+		*/
+		req.Offset = res.Record.Offset + 1
 	}
 }
 
+// turns a context's error into the status clients get for a cancelled or timed out rpc
+func contextError(err error) error {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	}
+	return err
+}
+
 /*
 using an interface to decouple the server implementation with the log implementation.
 this will let us swap out log implementations based on the environment we running in.
@@ -127,5 +534,35 @@ while testing env will get a mocked version that writes and reads to / from memo
 */
 type CommitLog interface {
 	Append(*api.Record) (uint64, error)
+	AppendIdempotent(record *api.Record, producerID, sequence uint64) (uint64, error)
+	AppendBatch([]*api.Record) (uint64, error)
+	Sync() error
+	FlushedOffset() uint64
+	HighestOffset() (uint64, error)
+	Validate(*api.Record) error
 	Read(uint64) (*api.Record, error)
+	ReadContext(context.Context, uint64) (*api.Record, error)
+	ReadRange(from, to uint64) (log.RecordIterator, error)
+	Annotate(uint64, api.Annotation) ([]api.Annotation, error)
+	Annotations(uint64) ([]api.Annotation, error)
+	Redact(uint64) error
+	Watch(fromOffset uint64) (<-chan uint64, func())
+	Segments() []log.SegmentInfo
+	CheckWritable() error
+	Close() error
+}
+
+// stores the offsets consumers commit, ex. the log package's Offsets
+type OffsetStore interface {
+	Commit(consumerID string, offset uint64) error
+	Fetch(consumerID string) (uint64, error)
+}
+
+/*
+offset stores that also keep the offsets above a consumer's committed offset that were acked individually,
+consumer groups use them so records their members acked out of order aren't delivered again after a restart
+*/
+type AckStore interface {
+	CommitAcked(consumerID string, offset uint64, acked []uint64) error
+	FetchAcked(consumerID string) (uint64, []uint64, error)
 }
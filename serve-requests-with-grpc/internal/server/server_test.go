@@ -1,18 +1,42 @@
 package server
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	api "github.com/phaseharry/distributed-log/serve-requests-with-grpc/api/v1"
+	"github.com/phaseharry/distributed-log/serve-requests-with-grpc/internal/auth"
 	"github.com/phaseharry/distributed-log/serve-requests-with-grpc/internal/log"
+	"github.com/phaseharry/distributed-log/serve-requests-with-grpc/metrics"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
 )
 
 func TestServer(t *testing.T) {
@@ -21,9 +45,28 @@ func TestServer(t *testing.T) {
 		client api.LogClient,
 		config *Config,
 	){
-		"produce/consume a message to/from the log succeeds": testProduceConsume,
-		"produce/consume stream succeeds":                    testProduceConsumeStream,
-		"consume past log boundary fails":                    testConsumePastBoundary,
+		"produce/consume a message to/from the log succeeds":    testProduceConsume,
+		"produce/consume stream succeeds":                       testProduceConsumeStream,
+		"consume past log boundary fails":                       testConsumePastBoundary,
+		"annotate a record succeeds":                            testAnnotate,
+		"redacting records that can't be redacted fails":        testRedactFails,
+		"consume across a compaction gap annotates the record":  testAnnotateCompacted,
+		"retried idempotent produce isn't duplicated":           testIdempotentProduce,
+		"durable produce is flushed":                            testDurableProduce,
+		"any payloads are unpacked and described":               testAnyPayload,
+		"consume stream waits for new records":                  testConsumeStreamWaits,
+		"committed consumer offsets are fetched":                testConsumerOffsets,
+		"consumer group members share records":                  testConsumerGroup,
+		"consumer group records are redelivered on ack timeout": testConsumerGroupAckTimeout,
+		"consumer group dead letters records out of attempts":   testConsumerGroupDeadLetter,
+		"topics are created, listed and deleted":                testTopics,
+		"produced records are stamped with their origin":        testOriginHeaders,
+		"describe reports the log's offsets and segments":       testDescribe,
+		"batches are produced and consumed":                     testBatch,
+		"consume stream long-polls for batches":                 testConsumeStreamBatches,
+		"describe broker sums up the logs and streams":          testDescribeBroker,
+		"consume stream skips records the filter doesn't match": testConsumeStreamFilter,
+		"fetch pages through the log":                           testFetch,
 	}
 
 	for scenario, fn := range scenarios {
@@ -35,6 +78,571 @@ func TestServer(t *testing.T) {
 	}
 }
 
+/*
+testing that consume streams cancelled or timed out by their clients release everything they were holding,
+the handler goroutines and the log watchers they were waiting on, instead of leaking one per stream
+*/
+func TestConsumeStreamCancellation(t *testing.T) {
+	client, _, teardown := setupTest(t, nil)
+	defer teardown()
+	ctx := context.Background()
+
+	// connecting the client before taking the goroutines that are expected to keep running
+	produce, err := client.Produce(ctx, &api.ProduceRequest{Record: &api.Record{Value: []byte("hello world")}})
+	require.NoError(t, err)
+	running := goleak.IgnoreCurrent()
+
+	for i := 0; i < 2000; i++ {
+		var streamCtx context.Context
+		var cancel context.CancelFunc
+		want := codes.Canceled
+		if i%2 == 0 {
+			streamCtx, cancel = context.WithCancel(ctx)
+		} else {
+			streamCtx, cancel = context.WithTimeout(ctx, time.Millisecond)
+			want = codes.DeadlineExceeded
+		}
+		stream, err := client.ConsumeStream(streamCtx, &api.ConsumeRequest{Offset: produce.Offset + 1})
+		require.NoError(t, err)
+		if want == codes.Canceled {
+			cancel()
+		}
+		_, err = stream.Recv()
+		require.Equal(t, want, status.Code(err))
+		cancel()
+	}
+
+	// the server might still be unwinding the last streams
+	goleak.VerifyNone(t, running)
+}
+
+/*
+testing that open streams are tracked while they wait, that streams past the limit are rejected,
+and that the tracked streams are dumped as json for debugging
+*/
+func TestStreamLimits(t *testing.T) {
+	streams := NewStreams(Limits{MaxStreams: 1})
+	client, _, teardown := setupTest(t, func(c *Config) {
+		c.Streams = streams
+	})
+	defer teardown()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err := client.ConsumeStream(ctx, &api.ConsumeRequest{Offset: 0})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		stats := streams.Stats()
+		return len(stats.Open) == 1 && stats.Open[0].Waiting
+	}, time.Second, 10*time.Millisecond)
+
+	rejected, err := client.ConsumeStream(context.Background(), &api.ConsumeRequest{Offset: 0})
+	require.NoError(t, err)
+	_, err = rejected.Recv()
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	rec := httptest.NewRecorder()
+	streams.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/streams", nil))
+	var stats StreamStats
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&stats))
+	require.Equal(t, "ConsumeStream", stats.Open[0].RPC)
+	require.Equal(t, 1, stats.Waiting)
+	require.Equal(t, uint64(1), stats.Rejected)
+
+	cancel()
+	require.Eventually(t, func() bool {
+		stats := streams.Stats()
+		return len(stats.Open) == 0 && stats.Waiting == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+// testing that connections older than the max connection age are closed once their grace period is up
+func TestMaxConnectionAge(t *testing.T) {
+	client, _, teardown := setupTest(t, func(c *Config) {
+		c.Keepalive = keepalive.ServerParameters{
+			MaxConnectionAge:      100 * time.Millisecond,
+			MaxConnectionAgeGrace: 100 * time.Millisecond,
+		}
+	})
+	defer teardown()
+
+	stream, err := client.ConsumeStream(context.Background(), &api.ConsumeRequest{Offset: 0})
+	require.NoError(t, err)
+	// the stream waits on records that are never produced until the connection is closed under it
+	_, err = stream.Recv()
+	require.Equal(t, codes.Unavailable, status.Code(err))
+
+	// the client reconnects on the next rpc
+	_, err = client.Produce(context.Background(), &api.ProduceRequest{Record: &api.Record{Value: []byte("hello world")}})
+	require.NoError(t, err)
+}
+
+/*
+testing that rpcs are only allowed for the subjects the authorizer's rules grant them to, streams included.
+the subject is taken from the rpc's metadata in place of a tls certificate
+*/
+func TestAuthorization(t *testing.T) {
+	client, _, teardown := setupTest(t, func(c *Config) {
+		c.Authorizer = auth.New(
+			auth.Rule{Subject: "checkout", Topic: "", Action: ProduceAction},
+			auth.Rule{Subject: "billing", Topic: "", Action: ConsumeAction},
+		)
+		c.Authenticate = func(ctx context.Context) (string, error) {
+			md, _ := metadata.FromIncomingContext(ctx)
+			if subject := md.Get("subject"); len(subject) > 0 {
+				return subject[0], nil
+			}
+			return "", nil
+		}
+	})
+	defer teardown()
+	as := func(subject string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(), "subject", subject)
+	}
+	record := &api.Record{Value: []byte("hello world")}
+
+	produce, err := client.Produce(as("checkout"), &api.ProduceRequest{Record: record})
+	require.NoError(t, err)
+	_, err = client.Produce(as("billing"), &api.ProduceRequest{Record: record})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = client.Produce(as("checkout"), &api.ProduceRequest{Record: record, Topic: "orders"})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = client.Consume(as("billing"), &api.ConsumeRequest{Offset: produce.Offset})
+	require.NoError(t, err)
+	_, err = client.CreateTopic(as("checkout"), &api.CreateTopicRequest{Name: "orders"})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	stream, err := client.ConsumeStream(as("checkout"), &api.ConsumeRequest{Offset: produce.Offset})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+	stream, err = client.ConsumeStream(as("billing"), &api.ConsumeRequest{Offset: produce.Offset})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.NoError(t, err)
+}
+
+// testing that validated requests go through the auth, quota and validation checks without touching the log
+func TestValidateOnly(t *testing.T) {
+	client, _, teardown := setupTest(t, func(c *Config) {
+		c.Authorizer = auth.New(
+			auth.Rule{Subject: "checkout", Topic: "", Action: ProduceAction},
+			auth.Rule{Subject: "billing", Topic: "", Action: ConsumeAction},
+		)
+		c.Authenticate = func(ctx context.Context) (string, error) {
+			md, _ := metadata.FromIncomingContext(ctx)
+			if subject := md.Get("subject"); len(subject) > 0 {
+				return subject[0], nil
+			}
+			return "", nil
+		}
+		// refilling too slowly for a second produce to fit
+		c.Quotas = NewQuotas(Quota{RecordsPerSecond: 1}, Quota{})
+	})
+	defer teardown()
+	as := func(subject string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(), "subject", subject)
+	}
+	record := &api.Record{Value: []byte("hello world")}
+
+	for range 3 {
+		res, err := client.Produce(as("checkout"), &api.ProduceRequest{Record: record, ValidateOnly: true})
+		require.NoError(t, err)
+		require.Equal(t, uint64(0), res.Offset)
+	}
+	_, err := client.Produce(as("billing"), &api.ProduceRequest{Record: record, ValidateOnly: true})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = client.Produce(as("checkout"), &api.ProduceRequest{ValidateOnly: true})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = client.Produce(as("checkout"), &api.ProduceRequest{Record: record, Topic: "orders", ValidateOnly: true})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// nothing was appended and the quota is still full
+	_, err = client.Consume(as("billing"), &api.ConsumeRequest{Offset: 0, ValidateOnly: true})
+	require.NoError(t, err)
+	_, err = client.Consume(as("billing"), &api.ConsumeRequest{Offset: 0})
+	require.Equal(t, codes.OutOfRange, status.Code(err))
+	_, err = client.Consume(as("checkout"), &api.ConsumeRequest{Offset: 0, ValidateOnly: true})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = client.Produce(as("checkout"), &api.ProduceRequest{Record: record})
+	require.NoError(t, err)
+	_, err = client.Produce(as("checkout"), &api.ProduceRequest{Record: record, ValidateOnly: true})
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
+
+/*
+testing that the health service follows whether the log can be written to and that reflection
+describes the log's service when it's enabled
+*/
+func TestHealthAndReflection(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server-health-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	clog, err := log.NewLog(dir, log.Config{})
+	require.NoError(t, err)
+	defer clog.Close()
+
+	l, err := net.Listen("tcp", ":0")
+	require.NoError(t, err)
+	server, err := NewGrpcServer(&Config{CommitLog: clog, Reflection: true})
+	require.NoError(t, err)
+	go server.Serve(l)
+	defer server.Stop()
+	cc, err := grpc.Dial(l.Addr().String(), grpc.WithInsecure())
+	require.NoError(t, err)
+	defer cc.Close()
+	ctx := context.Background()
+
+	health := healthpb.NewHealthClient(cc)
+	for _, service := range []string{"", "log.v1.Log"} {
+		res, err := health.Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+		require.NoError(t, err)
+		require.Equal(t, healthpb.HealthCheckResponse_SERVING, res.Status)
+	}
+	_, err = health.Check(ctx, &healthpb.HealthCheckRequest{Service: "unknown"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	reflection, err := rpb.NewServerReflectionClient(cc).ServerReflectionInfo(ctx)
+	require.NoError(t, err)
+	err = reflection.Send(&rpb.ServerReflectionRequest{MessageRequest: &rpb.ServerReflectionRequest_ListServices{}})
+	require.NoError(t, err)
+	res, err := reflection.Recv()
+	require.NoError(t, err)
+	var services []string
+	for _, service := range res.GetListServicesResponse().Service {
+		services = append(services, service.Name)
+	}
+	require.Contains(t, services, "log.v1.Log")
+	require.Contains(t, services, "grpc.health.v1.Health")
+	err = reflection.Send(&rpb.ServerReflectionRequest{
+		MessageRequest: &rpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: "log.v1.Log"},
+	})
+	require.NoError(t, err)
+	res, err = reflection.Recv()
+	require.NoError(t, err)
+	files := res.GetFileDescriptorResponse().FileDescriptorProto
+	require.NotEmpty(t, files)
+	file := &descriptorpb.FileDescriptorProto{}
+	require.NoError(t, proto.Unmarshal(files[0], file))
+	require.Equal(t, "log.v1", file.GetPackage())
+	require.NoError(t, reflection.CloseSend())
+
+	// the log's disk going away takes the server out of rotation
+	require.NoError(t, os.RemoveAll(dir))
+	check, err := health.Check(ctx, &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	require.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, check.Status)
+}
+
+// testing that a produce stuck on the disk fails once the max rpc time is up instead of hanging
+func TestMaxRPCTime(t *testing.T) {
+	unblock := make(chan struct{})
+	defer close(unblock)
+	client, _, teardown := setupTest(t, func(c *Config) {
+		c.CommitLog = wedgedLog{CommitLog: c.CommitLog, unblock: unblock}
+		c.MaxRPCTime = 50 * time.Millisecond
+	})
+	defer teardown()
+
+	started := time.Now()
+	_, err := client.Produce(context.Background(), &api.ProduceRequest{Record: &api.Record{Value: []byte("hello world")}})
+	require.Equal(t, codes.DeadlineExceeded, status.Code(err))
+	require.Less(t, time.Since(started), time.Second)
+
+	// rpcs that aren't stuck aren't affected
+	_, err = client.Consume(context.Background(), &api.ConsumeRequest{Offset: 0})
+	require.Equal(t, status.Code(api.ErrOffsetOutOfRange{}.GRPCStatus().Err()), status.Code(err))
+}
+
+// a log whose appends block until they're unblocked and then fail, like a disk that stopped responding
+type wedgedLog struct {
+	CommitLog
+	unblock chan struct{}
+}
+
+func (l wedgedLog) Append(record *api.Record) (uint64, error) {
+	<-l.unblock
+	return 0, io.ErrUnexpectedEOF
+}
+
+// testing that rpcs are counted by status code and consume streams report how far behind the log they are
+func TestMetrics(t *testing.T) {
+	registry := metrics.NewRegistry()
+	client, _, teardown := setupTest(t, func(c *Config) {
+		c.Metrics = registry
+	})
+	defer teardown()
+
+	ctx := context.Background()
+	for range 3 {
+		_, err := client.Produce(ctx, &api.ProduceRequest{Record: &api.Record{Value: []byte("hello world")}})
+		require.NoError(t, err)
+	}
+	_, err := client.Consume(ctx, &api.ConsumeRequest{Offset: 3})
+	require.Error(t, err)
+	require.Equal(t, float64(3), registry.Value("log_rpcs_total", "method", "/log.v1.Log/Produce", "code", "OK"))
+	require.Equal(t, float64(1), registry.Value("log_rpcs_total", "method", "/log.v1.Log/Consume", "code", "OutOfRange"))
+
+	streamCtx, cancel := context.WithCancel(ctx)
+	stream, err := client.ConsumeStream(streamCtx, &api.ConsumeRequest{Offset: 0})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.NoError(t, err)
+	// the stream catches up with the end of the log once it's sent offsets 1 and 2 too
+	scrape := func() string {
+		res := httptest.NewRecorder()
+		registry.ServeHTTP(res, httptest.NewRequest("GET", "/metrics", nil))
+		return res.Body.String()
+	}
+	require.Eventually(t, func() bool {
+		return strings.Contains(scrape(), `log_consume_lag{rpc="ConsumeStream",stream="1"} 0`)
+	}, time.Second, 10*time.Millisecond)
+	require.Contains(t, scrape(), `log_rpc_seconds_count{method="/log.v1.Log/Produce"} 3`)
+
+	cancel()
+	require.Eventually(t, func() bool {
+		return registry.Value("log_rpcs_total", "method", "/log.v1.Log/ConsumeStream", "code", "Canceled") == 1
+	}, time.Second, 10*time.Millisecond)
+	require.NotContains(t, scrape(), "log_consume_lag{")
+}
+
+// testing that rpcs are logged with their fields and that middleware can log with the rpc's logger
+func TestLogging(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	client, _, teardown := setupTest(t, func(c *Config) {
+		c.Logger = zap.New(core)
+		c.Middleware = []Middleware{{
+			Unary: func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+				Logger(ctx).Info("from middleware")
+				return handler(ctx, req)
+			},
+		}}
+	})
+	defer teardown()
+
+	ctx := context.Background()
+	produce, err := client.Produce(ctx, &api.ProduceRequest{Record: &api.Record{Value: []byte("hello world")}})
+	require.NoError(t, err)
+	_, err = client.Consume(ctx, &api.ConsumeRequest{Offset: produce.Offset + 1})
+	require.Error(t, err)
+
+	entries := logs.All()
+	require.Len(t, entries, 4)
+	require.Equal(t, "from middleware", entries[0].Message)
+	require.Equal(t, "/log.v1.Log/Produce", entries[0].ContextMap()["method"])
+	require.Contains(t, entries[0].ContextMap(), "peer")
+
+	produced := entries[1].ContextMap()
+	require.Equal(t, zapcore.DebugLevel, entries[1].Level)
+	require.Equal(t, "rpc", entries[1].Message)
+	require.Equal(t, "/log.v1.Log/Produce", produced["method"])
+	require.Equal(t, produce.Offset, produced["offset"])
+	require.Equal(t, "OK", produced["code"])
+	require.Contains(t, produced, "duration")
+
+	// the client asking for an offset that doesn't exist yet is logged at info
+	consumed := entries[3].ContextMap()
+	require.Equal(t, zapcore.InfoLevel, entries[3].Level)
+	require.Equal(t, produce.Offset+1, consumed["offset"])
+	require.Equal(t, "OutOfRange", consumed["code"])
+}
+
+// testing that rpcs are warned once they're past the soft limit of a limit, before they hit it
+func TestSoftLimits(t *testing.T) {
+	registry := metrics.NewRegistry()
+	client, _, teardown := setupTest(t, func(c *Config) {
+		c.Streams = NewStreams(Limits{MaxStreams: 2})
+		// the quota refills a little in between produces, so the second one is at just under 50%
+		c.Quotas = NewQuotas(Quota{RecordsPerSecond: 4}, Quota{})
+		c.SoftLimit = 0.4
+		c.Metrics = registry
+	})
+	defer teardown()
+
+	ctx := context.Background()
+	produce := func() metadata.MD {
+		var header metadata.MD
+		_, err := client.Produce(ctx, &api.ProduceRequest{Record: &api.Record{Value: []byte("hello world")}}, grpc.Header(&header))
+		require.NoError(t, err)
+		return header
+	}
+	require.Empty(t, produce().Get(WarningHeader))
+	require.Equal(t, []string{"quota records at 50% of its limit"}, produce().Get(WarningHeader))
+	require.Equal(t, float64(1), registry.Value("log_soft_limit_warnings_total", "limit", "quota records"))
+
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := client.ConsumeStream(streamCtx, &api.ConsumeRequest{Offset: 0})
+	require.NoError(t, err)
+	header, err := stream.Header()
+	require.NoError(t, err)
+	require.Equal(t, []string{"streams at 50% of its limit"}, header.Get(WarningHeader))
+}
+
+// testing that clients can have their requests and responses compressed, and messages over the limits are rejected
+func TestCompression(t *testing.T) {
+	client, _, teardown := setupTest(t, func(c *Config) {
+		c.MaxRecvMsgSize = MsgSizeFor(1 << 10)
+	})
+	defer teardown()
+
+	ctx := context.Background()
+	want := bytes.Repeat([]byte("hello world "), 50)
+	for _, compressor := range []string{Zstd, Gzip} {
+		produce, err := client.Produce(ctx, &api.ProduceRequest{Record: &api.Record{Value: want}}, grpc.UseCompressor(compressor))
+		require.NoError(t, err, compressor)
+		consume, err := client.Consume(ctx, &api.ConsumeRequest{Offset: produce.Offset}, grpc.UseCompressor(compressor))
+		require.NoError(t, err, compressor)
+		require.Equal(t, want, consume.Record.Value)
+	}
+
+	_, err := client.Produce(ctx, &api.ProduceRequest{Record: &api.Record{Value: make([]byte, MsgSizeFor(1<<10))}})
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
+
+// testing that middleware from the config wraps every rpc, recovering panics and logging the rpcs in order
+func TestMiddleware(t *testing.T) {
+	var mu sync.Mutex
+	var lines []string
+	var recovered any
+	client, _, teardown := setupTest(t, func(c *Config) {
+		c.CommitLog = panickingLog{CommitLog: c.CommitLog}
+		c.Middleware = []Middleware{
+			Recovery(func(p any, stack []byte) {
+				recovered = p
+			}),
+			Logging(func(format string, args ...any) {
+				mu.Lock()
+				defer mu.Unlock()
+				lines = append(lines, fmt.Sprintf(format, args...))
+			}),
+		}
+	})
+	defer teardown()
+
+	_, err := client.Consume(context.Background(), &api.ConsumeRequest{Offset: 0})
+	require.Equal(t, codes.Internal, status.Code(err))
+	require.Equal(t, "disk on fire", recovered)
+	_, err = client.Produce(context.Background(), &api.ProduceRequest{Record: &api.Record{Value: []byte("hello world")}})
+	require.NoError(t, err)
+
+	mu.Lock()
+	defer mu.Unlock()
+	// the panic unwound past the logging middleware, so only the produce is logged
+	require.Len(t, lines, 1)
+	require.Contains(t, lines[0], "/log.v1.Log/Produce OK")
+}
+
+// a log whose reads panic
+type panickingLog struct {
+	CommitLog
+}
+
+func (l panickingLog) ReadContext(ctx context.Context, off uint64) (*api.Record, error) {
+	panic("disk on fire")
+}
+
+/*
+testing that shutting down ends the streams waiting on records, waits for the rpcs in flight and leaves
+the log closed with the records that were produced on disk
+*/
+func TestShutdown(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server-shutdown-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	clog, err := log.NewLog(dir, log.Config{})
+	require.NoError(t, err)
+
+	l, err := net.Listen("tcp", ":0")
+	require.NoError(t, err)
+	server, err := NewGrpcServer(&Config{CommitLog: clog})
+	require.NoError(t, err)
+	go server.Serve(l)
+	cc, err := grpc.Dial(l.Addr().String(), grpc.WithInsecure())
+	require.NoError(t, err)
+	defer cc.Close()
+	client := api.NewLogClient(cc)
+	ctx := context.Background()
+
+	produce, err := client.Produce(ctx, &api.ProduceRequest{Record: &api.Record{Value: []byte("hello world")}})
+	require.NoError(t, err)
+	stream, err := client.ConsumeStream(ctx, &api.ConsumeRequest{Offset: produce.Offset})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.NoError(t, err)
+
+	shutdownCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	require.NoError(t, server.Shutdown(shutdownCtx))
+	// the stream was waiting on the next record and is told to reconnect instead
+	_, err = stream.Recv()
+	require.Equal(t, codes.Unavailable, status.Code(err))
+	_, err = client.Produce(ctx, &api.ProduceRequest{Record: &api.Record{Value: []byte("too late")}})
+	require.Equal(t, codes.Unavailable, status.Code(err))
+
+	clog, err = log.NewLog(dir, log.Config{})
+	require.NoError(t, err)
+	defer clog.Close()
+	record, err := clog.Read(produce.Offset)
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello world"), record.Value)
+}
+
+/*
+testing that clients over their quota or over the global one are told when to retry, and that produce streams
+are held back instead. the client is taken from the rpc's metadata in place of a tls certificate
+*/
+func TestQuotas(t *testing.T) {
+	client, _, teardown := setupTest(t, func(c *Config) {
+		c.Quotas = NewQuotas(Quota{RecordsPerSecond: 2}, Quota{RecordsPerSecond: 3})
+		c.Quotas.Set("streamer", Quota{RecordsPerSecond: 4})
+		c.Authenticate = func(ctx context.Context) (string, error) {
+			md, _ := metadata.FromIncomingContext(ctx)
+			if subject := md.Get("subject"); len(subject) > 0 {
+				return subject[0], nil
+			}
+			return "", nil
+		}
+	})
+	defer teardown()
+	produce := func(subject string) error {
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "subject", subject)
+		_, err := client.Produce(ctx, &api.ProduceRequest{Record: &api.Record{Value: []byte("hello world")}})
+		return err
+	}
+
+	require.NoError(t, produce("a"))
+	require.NoError(t, produce("a"))
+	err := produce("a")
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+	var retry *errdetails.RetryInfo
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.RetryInfo); ok {
+			retry = info
+		}
+	}
+	require.NotNil(t, retry)
+	require.Greater(t, retry.RetryDelay.AsDuration(), time.Duration(0))
+	require.LessOrEqual(t, retry.RetryDelay.AsDuration(), time.Second)
+	// b has its own quota but all clients together only get 3 records a second
+	require.NoError(t, produce("b"))
+	require.Equal(t, codes.ResourceExhausted, status.Code(produce("b")))
+
+	// the stream's records are held back until the global quota refilled instead of failing
+	time.Sleep(time.Second)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "subject", "streamer")
+	stream, err := client.ProduceStream(ctx)
+	require.NoError(t, err)
+	started := time.Now()
+	for range 4 {
+		require.NoError(t, stream.Send(&api.ProduceRequest{Record: &api.Record{Value: []byte("hello world")}}))
+		res, err := stream.Recv()
+		require.NoError(t, err)
+		require.Nil(t, res.Error)
+	}
+	require.GreaterOrEqual(t, time.Since(started), 250*time.Millisecond)
+	require.NoError(t, stream.CloseSend())
+}
+
 func setupTest(t *testing.T, fn func(*Config)) (
 	client api.LogClient,
 	config *Config,
@@ -61,8 +669,16 @@ func setupTest(t *testing.T, fn func(*Config)) (
 	clog, err := log.NewLog(dir, log.Config{})
 	require.NoError(t, err)
 
+	offsets, err := log.NewOffsets(path.Join(dir, ".offsets"), log.Config{})
+	require.NoError(t, err)
+
+	topics, err := log.NewTopics(path.Join(dir, ".topics"), log.Config{})
+	require.NoError(t, err)
+
 	cfg := &Config{
 		CommitLog: clog,
+		Offsets:   offsets,
+		Topics:    topicStore{topics},
 	}
 
 	if fn != nil {
@@ -91,10 +707,24 @@ func setupTest(t *testing.T, fn func(*Config)) (
 		server.Stop()
 		cc.Close()
 		l.Close()
+		offsets.Close()
+		topics.Close()
 		clog.Remove()
 	}
 }
 
+type topicStore struct {
+	*log.Topics
+}
+
+func (t topicStore) Topic(name string) (CommitLog, error) {
+	l, err := t.Topics.Topic(name)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
 /*
 testing that we can create a log using the client and server.
 then using our server to fetch for it using the offset of the newly created record
@@ -103,7 +733,8 @@ func testProduceConsume(t *testing.T, client api.LogClient, config *Config) {
 	ctx := context.Background()
 
 	want := &api.Record{
-		Value: []byte("hello world"),
+		Value:   []byte("hello world"),
+		Headers: map[string]string{"trace-id": "abc123", "content-type": "text/plain"},
 	}
 
 	produce, err := client.Produce(
@@ -120,6 +751,7 @@ func testProduceConsume(t *testing.T, client api.LogClient, config *Config) {
 	require.NoError(t, err)
 	require.Equal(t, want.Value, consume.Record.Value)
 	require.Equal(t, want.Offset, consume.Record.Offset)
+	require.Equal(t, want.Headers, consume.Record.Headers)
 }
 
 // test that consuming an offset that is out of bounds will return an OutsetOutOfRange error
@@ -190,9 +822,18 @@ func testProduceConsumeStream(
 				)
 			}
 		}
+		// records that can't be produced are acked with their error without ending the stream
+		err = stream.Send(&api.ProduceRequest{Record: records[0], Topic: "orders"})
+		require.NoError(t, err)
+		res, err := stream.Recv()
+		require.NoError(t, err)
+		require.Equal(t, uint32(codes.NotFound), res.Error.Code)
+
 		// Close the send side to signal the server that no more messages will be sent
 		err = stream.CloseSend()
 		require.NoError(t, err)
+		_, err = stream.Recv()
+		require.Equal(t, io.EOF, err)
 	}
 	{
 		// testing that we can consume streams to get records created from previous block
@@ -215,3 +856,646 @@ func testProduceConsumeStream(
 		cancel()
 	}
 }
+
+// test that annotations attached to a record are returned when the record is consumed
+func testAnnotate(t *testing.T, client api.LogClient, config *Config) {
+	ctx := context.Background()
+
+	produce, err := client.Produce(ctx, &api.ProduceRequest{
+		Record: &api.Record{
+			Value: []byte("hello world"),
+		},
+	})
+	require.NoError(t, err)
+
+	annotate, err := client.Annotate(ctx, &api.AnnotateRequest{
+		Offset:     produce.Offset,
+		Annotation: api.Annotation_ANNOTATION_POISONED,
+	})
+	require.NoError(t, err)
+	require.Equal(t, []api.Annotation{api.Annotation_ANNOTATION_POISONED}, annotate.Annotations)
+
+	consume, err := client.Consume(ctx, &api.ConsumeRequest{
+		Offset: produce.Offset,
+	})
+	require.NoError(t, err)
+	require.Equal(t, []api.Annotation{api.Annotation_ANNOTATION_POISONED}, consume.Annotations)
+}
+
+/*
+testing that consuming an offset that was compacted away responds with the annotations of the
+next record that's still in the log, the record it responds with, not the ones of the offset asked for
+*/
+func testAnnotateCompacted(t *testing.T, client api.LogClient, config *Config) {
+	ctx := context.Background()
+
+	var offsets []uint64
+	for _, key := range []string{"", "a", ""} {
+		produce, err := client.Produce(ctx, &api.ProduceRequest{
+			Record: &api.Record{Key: []byte(key), Value: []byte("hello world")},
+		})
+		require.NoError(t, err)
+		offsets = append(offsets, produce.Offset)
+	}
+	for offset, annotation := range map[uint64]api.Annotation{
+		offsets[1]: api.Annotation_ANNOTATION_POISONED,
+		offsets[2]: api.Annotation_ANNOTATION_PROCESSED,
+	} {
+		_, err := client.Annotate(ctx, &api.AnnotateRequest{Offset: offset, Annotation: annotation})
+		require.NoError(t, err)
+	}
+
+	// filling the first segment so it's closed and compacted, then superseding the keyed record
+	for i := 0; i < 100; i++ {
+		_, err := client.Produce(ctx, &api.ProduceRequest{
+			Record: &api.Record{Value: []byte("hello world")},
+		})
+		require.NoError(t, err)
+	}
+	_, err := client.Produce(ctx, &api.ProduceRequest{
+		Record: &api.Record{Key: []byte("a"), Value: []byte("hello world")},
+	})
+	require.NoError(t, err)
+	require.NoError(t, config.CommitLog.(*log.Log).Compact())
+
+	consume, err := client.Consume(ctx, &api.ConsumeRequest{Offset: offsets[1]})
+	require.NoError(t, err)
+	require.Equal(t, offsets[2], consume.Record.Offset)
+	require.Equal(t, []api.Annotation{api.Annotation_ANNOTATION_PROCESSED}, consume.Annotations)
+}
+
+// testing that redacting fails with a precondition without encryption and with a bad argument for unencrypted records
+func testRedactFails(t *testing.T, client api.LogClient, config *Config) {
+	ctx := context.Background()
+
+	produce, err := client.Produce(ctx, &api.ProduceRequest{
+		Record: &api.Record{Value: []byte("hello world")},
+	})
+	require.NoError(t, err)
+	_, err = client.Redact(ctx, &api.RedactRequest{Offset: produce.Offset})
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	// a log with encryption enabled after its first record was appended
+	dir, err := ioutil.TempDir("", "server-redact-test")
+	require.NoError(t, err)
+	plain, err := log.NewLog(dir, log.Config{})
+	require.NoError(t, err)
+	_, err = plain.Append(&api.Record{Value: []byte("hello world")})
+	require.NoError(t, err)
+	require.NoError(t, plain.Close())
+	c := log.Config{}
+	c.Encryption.MasterKey = bytes.Repeat([]byte("k"), 32)
+	encrypted, err := log.NewLog(dir, c)
+	require.NoError(t, err)
+	defer encrypted.Remove()
+
+	clog := config.CommitLog
+	config.CommitLog = encrypted
+	defer func() { config.CommitLog = clog }()
+
+	_, err = client.Redact(ctx, &api.RedactRequest{Offset: 0})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+// test that retrying an idempotent produce returns the offset of the first attempt
+func testIdempotentProduce(t *testing.T, client api.LogClient, config *Config) {
+	ctx := context.Background()
+	req := &api.ProduceRequest{
+		Record:     &api.Record{Value: []byte("hello world")},
+		ProducerId: 1,
+		Sequence:   0,
+	}
+	first, err := client.Produce(ctx, req)
+	require.NoError(t, err)
+	retry, err := client.Produce(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, first.Offset, retry.Offset)
+
+	req.Sequence = 2
+	_, err = client.Produce(ctx, req)
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	_, err = client.Consume(ctx, &api.ConsumeRequest{Offset: first.Offset + 1})
+	require.Error(t, err)
+}
+
+// test that a durable produce responds with a flushed offset past the produced record
+func testDurableProduce(t *testing.T, client api.LogClient, config *Config) {
+	ctx := context.Background()
+	res, err := client.Produce(ctx, &api.ProduceRequest{
+		Record:  &api.Record{Value: []byte("hello world")},
+		Durable: true,
+	})
+	require.NoError(t, err)
+	require.Greater(t, res.FlushedOffset, res.Offset)
+}
+
+/*
+test that a record produced as an Any can be unmarshaled whether or not the server unpacks it and that
+dynamic clients can get the descriptor of the message it holds
+*/
+func testAnyPayload(t *testing.T, client api.LogClient, config *Config) {
+	ctx := context.Background()
+	want := &api.AnnotateRequest{Offset: 7, Annotation: api.Annotation_ANNOTATION_PROCESSED}
+	record, err := api.NewAnyRecord(want)
+	require.NoError(t, err)
+	produce, err := client.Produce(ctx, &api.ProduceRequest{Record: record})
+	require.NoError(t, err)
+
+	for _, unpack := range []bool{false, true} {
+		consume, err := client.Consume(ctx, &api.ConsumeRequest{Offset: produce.Offset, UnpackAny: unpack})
+		require.NoError(t, err)
+		got := &api.AnnotateRequest{}
+		require.NoError(t, api.UnmarshalAny(consume.Record, got))
+		require.Equal(t, want.Offset, got.Offset)
+		require.Equal(t, want.Annotation, got.Annotation)
+		require.Error(t, api.UnmarshalAny(consume.Record, &api.RedactRequest{}))
+	}
+
+	describe, err := client.GetDescriptor(ctx, &api.GetDescriptorRequest{
+		TypeName: "type.googleapis.com/log.v1.AnnotateRequest",
+	})
+	require.NoError(t, err)
+	files, err := protodesc.NewFiles(describe.FileDescriptorSet)
+	require.NoError(t, err)
+	_, err = files.FindDescriptorByName("log.v1.AnnotateRequest")
+	require.NoError(t, err)
+
+	_, err = client.GetDescriptor(ctx, &api.GetDescriptorRequest{TypeName: "log.v1.Missing"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+}
+
+// test that a consume stream that caught up with the log sends records produced afterwards
+func testConsumeStreamWaits(t *testing.T, client api.LogClient, config *Config) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := client.ConsumeStream(ctx, &api.ConsumeRequest{Offset: 0})
+	require.NoError(t, err)
+
+	// giving the stream time to find the log empty and start waiting
+	time.Sleep(50 * time.Millisecond)
+	for i := uint64(0); i < 2; i++ {
+		_, err = client.Produce(ctx, &api.ProduceRequest{Record: &api.Record{Value: []byte("hello world")}})
+		require.NoError(t, err)
+		res, err := stream.Recv()
+		require.NoError(t, err)
+		require.Equal(t, i, res.Record.Offset)
+	}
+}
+
+// test that consumers fetch the offset they committed last and that unknown consumers aren't found
+func testConsumerOffsets(t *testing.T, client api.LogClient, config *Config) {
+	ctx := context.Background()
+	_, err := client.FetchOffset(ctx, &api.FetchOffsetRequest{ConsumerId: "billing"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	for _, offset := range []uint64{3, 7} {
+		_, err = client.CommitOffset(ctx, &api.CommitOffsetRequest{ConsumerId: "billing", Offset: offset})
+		require.NoError(t, err)
+	}
+	res, err := client.FetchOffset(ctx, &api.FetchOffsetRequest{ConsumerId: "billing"})
+	require.NoError(t, err)
+	require.Equal(t, uint64(7), res.Offset)
+
+	_, err = client.CommitOffset(ctx, &api.CommitOffsetRequest{Offset: 1})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+/*
+test that a group's members are each delivered different records, that the records of a member that
+leaves are redelivered to the others, and that the group commits the offset below its unacked records
+*/
+func testConsumerGroup(t *testing.T, client api.LogClient, config *Config) {
+	ctx := context.Background()
+	for range 3 {
+		_, err := client.Produce(ctx, &api.ProduceRequest{Record: &api.Record{Value: []byte("hello world")}})
+		require.NoError(t, err)
+	}
+	join := func(ctx context.Context, member string) api.Log_ConsumeGroupClient {
+		stream, err := client.ConsumeGroup(ctx, &api.ConsumeGroupRequest{Group: "workers", MemberId: member})
+		require.NoError(t, err)
+		return stream
+	}
+	recv := func(stream api.Log_ConsumeGroupClient, want uint64) {
+		res, err := stream.Recv()
+		require.NoError(t, err)
+		require.Equal(t, want, res.Record.Offset)
+	}
+	ack := func(member string, off, want uint64) {
+		res, err := client.AckGroup(ctx, &api.AckGroupRequest{Group: "workers", MemberId: member, Offset: off})
+		require.NoError(t, err)
+		require.Equal(t, want, res.CommittedOffset)
+	}
+
+	a := join(ctx, "a")
+	recv(a, 0)
+	bCtx, leave := context.WithCancel(ctx)
+	b := join(bCtx, "b")
+	recv(b, 1)
+
+	_, err := client.AckGroup(ctx, &api.AckGroupRequest{Group: "workers", MemberId: "a", Offset: 1})
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+	ack("a", 0, 1)
+	recv(a, 2)
+
+	// b leaves without acking its record so it's redelivered to a, which is the only record left
+	ack("a", 2, 1)
+	leave()
+	recv(a, 1)
+	ack("a", 1, 3)
+
+	res, err := client.FetchOffset(ctx, &api.FetchOffsetRequest{ConsumerId: groupOffsetPrefix + "workers"})
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), res.Offset)
+}
+
+/*
+test that a record the member doesn't ack within its ack timeout is redelivered, and that the records
+acked out of order are committed along with the group's offset
+*/
+func testConsumerGroupAckTimeout(t *testing.T, client api.LogClient, config *Config) {
+	ctx := context.Background()
+	for range 3 {
+		_, err := client.Produce(ctx, &api.ProduceRequest{Record: &api.Record{Value: []byte("hello world")}})
+		require.NoError(t, err)
+	}
+	stream, err := client.ConsumeGroup(ctx, &api.ConsumeGroupRequest{
+		Group:        "queue",
+		MemberId:     "a",
+		MaxInFlight:  3,
+		AckTimeoutMs: 100,
+	})
+	require.NoError(t, err)
+	for want := range uint64(3) {
+		res, err := stream.Recv()
+		require.NoError(t, err)
+		require.Equal(t, want, res.Record.Offset)
+	}
+	for _, off := range []uint64{0, 2} {
+		res, err := client.AckGroup(ctx, &api.AckGroupRequest{Group: "queue", MemberId: "a", Offset: off})
+		require.NoError(t, err)
+		require.Equal(t, uint64(1), res.CommittedOffset)
+	}
+	committed, acked, err := config.Offsets.(AckStore).FetchAcked(groupOffsetPrefix + "queue")
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), committed)
+	require.Equal(t, []uint64{2}, acked)
+
+	// the record that wasn't acked is taken back and delivered again
+	res, err := stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), res.Record.Offset)
+	ack, err := client.AckGroup(ctx, &api.AckGroupRequest{Group: "queue", MemberId: "a", Offset: 1})
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), ack.CommittedOffset)
+}
+
+/*
+test that redeliveries back off and that a record is appended to the group's dead letter topic
+and counted as acked once it ran out of attempts
+*/
+func testConsumerGroupDeadLetter(t *testing.T, client api.LogClient, config *Config) {
+	ctx := context.Background()
+	_, err := client.CreateTopic(ctx, &api.CreateTopicRequest{Name: "dead-letters"})
+	require.NoError(t, err)
+	produce, err := client.Produce(ctx, &api.ProduceRequest{Record: &api.Record{Value: []byte("poison")}})
+	require.NoError(t, err)
+
+	// dead letter topics have to exist when the policy is set
+	missing, err := client.ConsumeGroup(ctx, &api.ConsumeGroupRequest{
+		Group:      "jobs",
+		MemberId:   "a",
+		Redelivery: &api.RedeliveryPolicy{MaxAttempts: 2, DeadLetterTopic: "missing"},
+	})
+	require.NoError(t, err)
+	_, err = missing.Recv()
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	stream, err := client.ConsumeGroup(ctx, &api.ConsumeGroupRequest{
+		Group:        "jobs",
+		MemberId:     "a",
+		AckTimeoutMs: 50,
+		Redelivery:   &api.RedeliveryPolicy{InitialBackoffMs: 100, MaxAttempts: 2, DeadLetterTopic: "dead-letters"},
+	})
+	require.NoError(t, err)
+	res, err := stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, uint32(1), res.DeliveryAttempt)
+	// the record isn't acked, it's redelivered once its ack timed out and it backed off
+	delivered := time.Now()
+	res, err = stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, uint32(2), res.DeliveryAttempt)
+	require.GreaterOrEqual(t, time.Since(delivered), 150*time.Millisecond)
+
+	// the record ran out of attempts after its second ack timed out
+	require.Eventually(t, func() bool {
+		res, err := client.FetchOffset(ctx, &api.FetchOffsetRequest{ConsumerId: groupOffsetPrefix + "jobs"})
+		return err == nil && res.Offset == produce.Offset+1
+	}, 2*time.Second, 20*time.Millisecond)
+	dead, err := client.Consume(ctx, &api.ConsumeRequest{Topic: "dead-letters", Offset: 0})
+	require.NoError(t, err)
+	require.Equal(t, []byte("poison"), dead.Record.Value)
+	require.Equal(t, "jobs", dead.Record.Headers[api.DeadLetterGroupHeader])
+	require.Equal(t, fmt.Sprint(produce.Offset), dead.Record.Headers[api.DeadLetterOffsetHeader])
+	require.Equal(t, "2", dead.Record.Headers[api.DeadLetterAttemptsHeader])
+}
+
+/*
+test that records produced to a topic are only consumed from it, that requests for a topic that
+doesn't exist fail, and that a topic's records are gone once it's deleted
+*/
+func testTopics(t *testing.T, client api.LogClient, config *Config) {
+	ctx := context.Background()
+	_, err := client.Produce(ctx, &api.ProduceRequest{Topic: "orders", Record: &api.Record{Value: []byte("order")}})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = client.CreateTopic(ctx, &api.CreateTopicRequest{
+		Name:   "orders",
+		Config: &api.TopicConfig{MaxSegmentRecords: 10},
+	})
+	require.NoError(t, err)
+	_, err = client.CreateTopic(ctx, &api.CreateTopicRequest{Name: "orders"})
+	require.Equal(t, codes.AlreadyExists, status.Code(err))
+	_, err = client.CreateTopic(ctx, &api.CreateTopicRequest{Name: "../orders"})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	produced, err := client.Produce(ctx, &api.ProduceRequest{Topic: "orders", Record: &api.Record{Value: []byte("order")}})
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), produced.Offset)
+	res, err := client.Consume(ctx, &api.ConsumeRequest{Topic: "orders", Offset: produced.Offset})
+	require.NoError(t, err)
+	require.Equal(t, []byte("order"), res.Record.Value)
+	// the record wasn't appended to the log requests without a topic go to
+	_, err = client.Consume(ctx, &api.ConsumeRequest{Offset: produced.Offset})
+	require.Equal(t, status.Code(api.ErrOffsetOutOfRange{}.GRPCStatus().Err()), status.Code(err))
+
+	list, err := client.ListTopics(ctx, &api.ListTopicsRequest{})
+	require.NoError(t, err)
+	require.Len(t, list.Topics, 1)
+	require.Equal(t, "orders", list.Topics[0].Name)
+	require.Equal(t, uint64(10), list.Topics[0].Config.MaxSegmentRecords)
+
+	// streams waiting on the topic end once it's deleted
+	stream, err := client.ConsumeStream(ctx, &api.ConsumeRequest{Topic: "orders", Offset: produced.Offset + 1})
+	require.NoError(t, err)
+	_, err = client.DeleteTopic(ctx, &api.DeleteTopicRequest{Name: "orders"})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.Equal(t, codes.NotFound, status.Code(err))
+	_, err = client.Consume(ctx, &api.ConsumeRequest{Topic: "orders", Offset: produced.Offset})
+	require.Equal(t, codes.NotFound, status.Code(err))
+	_, err = client.DeleteTopic(ctx, &api.DeleteTopicRequest{Name: "orders"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+}
+
+// test that the server stamps records with their origin when asked to and drops origins forged by producers
+func testOriginHeaders(t *testing.T, client api.LogClient, config *Config) {
+	ctx := context.Background()
+	config.StampOrigin = true
+	before := time.Now()
+	produce, err := client.Produce(ctx, &api.ProduceRequest{Record: &api.Record{
+		Value:   []byte("hello world"),
+		Headers: map[string]string{"trace-id": "abc123", api.OriginIdentityHeader: "admin"},
+	}})
+	require.NoError(t, err)
+	consume, err := client.Consume(ctx, &api.ConsumeRequest{Offset: produce.Offset})
+	require.NoError(t, err)
+
+	headers := consume.Record.Headers
+	require.Equal(t, "abc123", headers["trace-id"])
+	// the client dialed without tls so it has no identity, only an address
+	require.NotContains(t, headers, api.OriginIdentityHeader)
+	_, _, err = net.SplitHostPort(headers[api.OriginPeerHeader])
+	require.NoError(t, err)
+	received, err := time.Parse(time.RFC3339Nano, headers[api.OriginTimeHeader])
+	require.NoError(t, err)
+	require.False(t, received.Before(before.Truncate(time.Second)))
+}
+
+// test that describe reports the offsets and size of the log as records are produced to it
+func testDescribe(t *testing.T, client api.LogClient, config *Config) {
+	ctx := context.Background()
+	res, err := client.Describe(ctx, &api.DescribeRequest{})
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), res.NextOffset)
+	require.Equal(t, uint64(1), res.Segments)
+
+	for range 3 {
+		_, err = client.Produce(ctx, &api.ProduceRequest{Record: &api.Record{Value: []byte("hello world")}})
+		require.NoError(t, err)
+	}
+	res, err = client.Describe(ctx, &api.DescribeRequest{})
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), res.LowestOffset)
+	require.Equal(t, uint64(2), res.HighestOffset)
+	require.Equal(t, uint64(3), res.NextOffset)
+	require.Equal(t, uint64(3), res.ActiveSegment.Records)
+	require.NotZero(t, res.SizeBytes)
+	require.Zero(t, res.RemoteBytes)
+
+	_, err = client.Describe(ctx, &api.DescribeRequest{Topic: "orders"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+}
+
+// test that batches are appended at consecutive offsets and consumed up to the records and bytes asked for
+func testBatch(t *testing.T, client api.LogClient, config *Config) {
+	ctx := context.Background()
+	records := make([]*api.Record, 10)
+	for i := range records {
+		records[i] = &api.Record{Value: []byte(fmt.Sprintf("record %d", i))}
+	}
+	produced, err := client.ProduceBatch(ctx, &api.ProduceBatchRequest{Records: records, Durable: true})
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), produced.BaseOffset)
+	require.Equal(t, uint64(10), produced.FlushedOffset)
+
+	res, err := client.ConsumeBatch(ctx, &api.ConsumeBatchRequest{Offset: 2, MaxRecords: 3})
+	require.NoError(t, err)
+	require.Len(t, res.Records, 3)
+	for i, record := range res.Records {
+		require.Equal(t, uint64(2+i), record.Offset)
+		require.Equal(t, records[2+i].Value, record.Value)
+	}
+	require.Equal(t, uint64(5), res.NextOffset)
+
+	// the batch stops before the record that would take it past max bytes
+	size := uint64(proto.Size(res.Records[0]))
+	res, err = client.ConsumeBatch(ctx, &api.ConsumeBatchRequest{Offset: 5, MaxBytes: 2*size + 1})
+	require.NoError(t, err)
+	require.Len(t, res.Records, 2)
+	// but always has at least one record
+	res, err = client.ConsumeBatch(ctx, &api.ConsumeBatchRequest{Offset: 5, MaxBytes: 1})
+	require.NoError(t, err)
+	require.Len(t, res.Records, 1)
+
+	res, err = client.ConsumeBatch(ctx, &api.ConsumeBatchRequest{Offset: 7})
+	require.NoError(t, err)
+	require.Len(t, res.Records, 3)
+	require.Equal(t, uint64(10), res.NextOffset)
+	_, err = client.ConsumeBatch(ctx, &api.ConsumeBatchRequest{Offset: 10})
+	require.Equal(t, status.Code(api.ErrOffsetOutOfRange{}.GRPCStatus().Err()), status.Code(err))
+}
+
+// test that fetching pages with their next offsets reads every record once and ends with an empty page
+func testFetch(t *testing.T, client api.LogClient, config *Config) {
+	ctx := context.Background()
+	res, err := client.Fetch(ctx, &api.FetchRequest{Offset: 0})
+	require.NoError(t, err)
+	require.Empty(t, res.Records)
+	require.Equal(t, uint64(0), res.NextOffset)
+	require.True(t, res.End)
+
+	records := make([]*api.Record, 5)
+	for i := range records {
+		key := "odd"
+		if i%2 == 0 {
+			key = "even"
+		}
+		records[i] = &api.Record{Key: []byte(key), Value: []byte(fmt.Sprintf("record %d", i))}
+	}
+	_, err = client.ProduceBatch(ctx, &api.ProduceBatchRequest{Records: records})
+	require.NoError(t, err)
+
+	var fetched [][]byte
+	var pages int
+	for offset := uint64(0); ; {
+		pages++
+		res, err = client.Fetch(ctx, &api.FetchRequest{Offset: offset, MaxRecords: 2})
+		require.NoError(t, err)
+		for _, record := range res.Records {
+			fetched = append(fetched, record.Value)
+		}
+		offset = res.NextOffset
+		if res.End {
+			break
+		}
+	}
+	require.Equal(t, 3, pages)
+	require.Len(t, fetched, 5)
+	for i, value := range fetched {
+		require.Equal(t, records[i].Value, value)
+	}
+	res, err = client.Fetch(ctx, &api.FetchRequest{Offset: 5})
+	require.NoError(t, err)
+	require.Empty(t, res.Records)
+	require.True(t, res.End)
+
+	// filtered pages can come back empty before the end
+	res, err = client.Fetch(ctx, &api.FetchRequest{Offset: 1, MaxRecords: 1, Filter: &api.RecordFilter{KeyPrefix: []byte("even")}})
+	require.NoError(t, err)
+	require.Empty(t, res.Records)
+	require.Equal(t, uint64(2), res.NextOffset)
+	require.False(t, res.End)
+}
+
+/*
+test that batched consume streams send what's available right away without min bytes, hold batches back
+until they have min bytes, and send batches that aren't big enough once max wait passes
+*/
+func testConsumeStreamBatches(t *testing.T, client api.LogClient, config *Config) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	produce := func(n int) {
+		records := make([]*api.Record, n)
+		for i := range records {
+			records[i] = &api.Record{Value: []byte("hello world")}
+		}
+		_, err := client.ProduceBatch(ctx, &api.ProduceBatchRequest{Records: records})
+		require.NoError(t, err)
+	}
+	recv := func(stream api.Log_ConsumeStreamClient, want int) {
+		res, err := stream.Recv()
+		require.NoError(t, err)
+		require.Len(t, res.Records, want)
+	}
+	produce(5)
+
+	stream, err := client.ConsumeStream(ctx, &api.ConsumeRequest{Offset: 0, MaxRecords: 3})
+	require.NoError(t, err)
+	recv(stream, 3)
+	recv(stream, 2)
+
+	size := uint64(proto.Size(&api.Record{Value: []byte("hello world"), Offset: 5}))
+	stream, err = client.ConsumeStream(ctx, &api.ConsumeRequest{
+		Offset:     5,
+		MaxRecords: 10,
+		MinBytes:   3 * size,
+		MaxWaitMs:  60 * 1000,
+	})
+	require.NoError(t, err)
+	produce(2)
+	time.Sleep(50 * time.Millisecond)
+	produce(1)
+	recv(stream, 3)
+
+	stream, err = client.ConsumeStream(ctx, &api.ConsumeRequest{
+		Offset:     8,
+		MaxRecords: 10,
+		MinBytes:   100 * size,
+		MaxWaitMs:  50,
+	})
+	require.NoError(t, err)
+	produce(1)
+	recv(stream, 1)
+}
+
+// test that streams only send the records that match their filter, one at a time and in batches
+func testConsumeStreamFilter(t *testing.T, client api.LogClient, config *Config) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	records := []*api.Record{
+		{Value: []byte("a"), Key: []byte("eu/orders"), Headers: map[string]string{"type": "created"}},
+		{Value: []byte("b"), Key: []byte("us/orders"), Headers: map[string]string{"type": "created"}},
+		{Value: []byte("c"), Key: []byte("eu/orders"), Headers: map[string]string{"type": "shipped"}},
+		{Value: []byte("d"), Key: []byte("eu/payments"), Headers: map[string]string{"type": "created"}},
+	}
+	_, err := client.ProduceBatch(ctx, &api.ProduceBatchRequest{Records: records})
+	require.NoError(t, err)
+	filter := &api.RecordFilter{KeyPrefix: []byte("eu/"), Headers: map[string]string{"type": "created"}}
+
+	stream, err := client.ConsumeStream(ctx, &api.ConsumeRequest{Offset: 0, Filter: filter})
+	require.NoError(t, err)
+	for _, want := range []string{"a", "d"} {
+		res, err := stream.Recv()
+		require.NoError(t, err)
+		require.Equal(t, want, string(res.Record.Value))
+	}
+
+	// the batches are sent as soon as they have a record, the first 2 records only have one that matches
+	stream, err = client.ConsumeStream(ctx, &api.ConsumeRequest{Offset: 0, MaxRecords: 2, Filter: filter})
+	require.NoError(t, err)
+	for _, want := range []string{"a", "d"} {
+		res, err := stream.Recv()
+		require.NoError(t, err)
+		require.Len(t, res.Records, 1)
+		require.Equal(t, want, string(res.Records[0].Value))
+	}
+}
+
+// test that describing the broker adds up the default log and the topics and counts the open streams
+func testDescribeBroker(t *testing.T, client api.LogClient, config *Config) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, err := client.CreateTopic(ctx, &api.CreateTopicRequest{Name: "orders"})
+	require.NoError(t, err)
+	_, err = client.Produce(ctx, &api.ProduceRequest{Record: &api.Record{Value: []byte("hello world")}})
+	require.NoError(t, err)
+	_, err = client.ConsumeStream(ctx, &api.ConsumeRequest{Offset: 1})
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		res, err := client.DescribeBroker(ctx, &api.DescribeBrokerRequest{})
+		require.NoError(t, err)
+		return res.WaitingStreams == 1
+	}, time.Second, 10*time.Millisecond)
+	res, err := client.DescribeBroker(ctx, &api.DescribeBrokerRequest{})
+	require.NoError(t, err)
+	require.Equal(t, uint32(1), res.Topics)
+	require.Equal(t, uint64(2), res.Segments)
+	require.NotZero(t, res.SizeBytes)
+	require.Equal(t, uint32(1), res.OpenStreams)
+	require.Equal(t, "standalone", res.Role)
+	require.NotEmpty(t, res.GoVersion)
+	require.Positive(t, res.Uptime.AsDuration())
+}
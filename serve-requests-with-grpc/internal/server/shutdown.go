@@ -0,0 +1,76 @@
+package server
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// streams that are caught up end with this once the server starts shutting down so clients move on
+var errShuttingDown = status.Error(codes.Unavailable, "server shutting down")
+
+/*
+Server is the gRPC server serving the log. Stop ends rpcs and connections right away, Shutdown lets
+them finish first and leaves the log flushed and closed:
+
+	srv, err := server.NewGrpcServer(config)
+	go srv.Serve(listener)
+	...
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	err = srv.Shutdown(ctx)
+*/
+type Server struct {
+	*grpc.Server
+	srv *grpcServer
+}
+
+/*
+Shutdown stops accepting new connections and rpcs, waits for the rpcs in flight to finish and then syncs and
+closes the log and the topics' logs. health checks report NOT_SERVING while it's draining, and streams that are
+waiting on records that haven't been appended yet end with Unavailable instead of holding the shutdown up.
+rpcs still running once ctx is done are cancelled before the logs are closed
+*/
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.srv.drain()
+	stopped := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		s.Stop()
+		<-stopped
+	}
+
+	err := s.srv.CommitLog.Sync()
+	if cerr := s.srv.CommitLog.Close(); err == nil {
+		err = cerr
+	}
+	if s.srv.Topics != nil {
+		if cerr := s.srv.Topics.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// marks the server as shutting down, waking up the streams waiting on records
+func (s *grpcServer) drain() {
+	s.drainOnce.Do(func() {
+		close(s.draining)
+	})
+}
+
+func (s *grpcServer) shuttingDown() bool {
+	select {
+	case <-s.draining:
+		return true
+	default:
+		return false
+	}
+}
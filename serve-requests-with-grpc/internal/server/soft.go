@@ -0,0 +1,49 @@
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// response header rpcs carry a warning in for every hard limit that's past Config.SoftLimit
+const WarningHeader = "log-warning"
+
+// how much of one of the server's hard limits is used
+type usage struct {
+	limit     string
+	used, max float64
+}
+
+/*
+warns about the limits that are past the soft limit, before rpcs start being rejected or held back for hitting
+them. every warning is counted in the server's metrics, logged, and set in the response's WarningHeader so the
+client can back off. the header can't be set on streams that already sent their headers, those are only counted and logged
+*/
+func (s *grpcServer) warnSoftLimits(ctx context.Context, setHeader func(metadata.MD) error, usages ...usage) {
+	if s.SoftLimit <= 0 {
+		return
+	}
+	for _, u := range usages {
+		if u.max <= 0 || u.used < s.SoftLimit*u.max {
+			continue
+		}
+		warning := fmt.Sprintf("%s at %.0f%% of its limit", u.limit, 100*u.used/u.max)
+		s.Metrics.Add("log_soft_limit_warnings_total", 1, "limit", u.limit)
+		Logger(ctx).Warn("soft limit", zap.String("limit", u.limit), zap.Float64("used", u.used), zap.Float64("max", u.max))
+		setHeader(metadata.Pairs(WarningHeader, warning))
+	}
+}
+
+// starts tracking the stream, warning it about the stream limits that are past the soft limit
+func (s *grpcServer) track(stream grpc.ServerStream, rpc string) (*trackedStream, error) {
+	tracked, err := s.Streams.track(stream.Context(), rpc)
+	if err != nil {
+		return nil, err
+	}
+	s.warnSoftLimits(stream.Context(), stream.SetHeader, s.Streams.usage()...)
+	return tracked, nil
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Limits caps what streams can hold on to so clients that leak streams can't exhaust the server, zero means no cap
+type Limits struct {
+	// streams open at once across ConsumeStream, ProduceStream and ConsumeGroup
+	MaxStreams int
+	// streams waiting on records to be appended or on their group at once
+	MaxWaiters int
+	// records a group member can have in flight, lowering what members ask for
+	MaxInFlight int
+}
+
+/*
+Streams keeps track of the server's open streams, which of them are waiting, and the records group members
+have in flight, and rejects new ones with ResourceExhausted once one of its limits is hit.
+it's an http.Handler that dumps what it's tracking as json so streams that were never closed can be found:
+
+	streams := server.NewStreams(server.Limits{MaxStreams: 1000})
+	srv, err := server.NewGrpcServer(&server.Config{CommitLog: log, Streams: streams})
+	http.Handle("/debug/streams", streams)
+*/
+type Streams struct {
+	limits Limits
+
+	mu       sync.Mutex
+	nextID   uint64
+	open     map[uint64]*StreamInfo
+	waiting  int
+	inFlight int
+	opened   uint64
+	rejected uint64
+}
+
+// StreamInfo describes an open stream
+type StreamInfo struct {
+	ID      uint64    `json:"id"`
+	RPC     string    `json:"rpc"`
+	Peer    string    `json:"peer"`
+	Started time.Time `json:"started"`
+	// the stream is waiting on records to be appended or on its group
+	Waiting bool `json:"waiting"`
+	// records sent to or received from the client so far
+	Records uint64 `json:"records"`
+}
+
+// StreamStats is a snapshot of what Streams is tracking
+type StreamStats struct {
+	Open []StreamInfo `json:"open"`
+	// streams currently waiting
+	Waiting int `json:"waiting"`
+	// records delivered to group members that they haven't acked yet
+	InFlight int `json:"in_flight"`
+	// streams opened and rejected for hitting a limit since the server started
+	Opened   uint64 `json:"opened"`
+	Rejected uint64 `json:"rejected"`
+	Limits   Limits `json:"limits"`
+}
+
+func NewStreams(limits Limits) *Streams {
+	return &Streams{limits: limits, open: make(map[uint64]*StreamInfo)}
+}
+
+// Stats returns a snapshot of the open streams, oldest first, and the resources they hold
+func (s *Streams) Stats() StreamStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := StreamStats{
+		Open:     make([]StreamInfo, 0, len(s.open)),
+		Waiting:  s.waiting,
+		InFlight: s.inFlight,
+		Opened:   s.opened,
+		Rejected: s.rejected,
+		Limits:   s.limits,
+	}
+	for _, info := range s.open {
+		stats.Open = append(stats.Open, *info)
+	}
+	sort.Slice(stats.Open, func(i, j int) bool { return stats.Open[i].ID < stats.Open[j].ID })
+	return stats
+}
+
+func (s *Streams) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.Stats())
+}
+
+// a stream being tracked, close has to be called once the stream's handler returns
+type trackedStream struct {
+	streams *Streams
+	info    *StreamInfo
+}
+
+// starts tracking a stream, fails if the server already has as many open streams as it's allowed
+func (s *Streams) track(ctx context.Context, rpc string) (*trackedStream, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.limits.MaxStreams > 0 && len(s.open) >= s.limits.MaxStreams {
+		s.rejected++
+		return nil, status.Errorf(codes.ResourceExhausted, "too many open streams: %d", len(s.open))
+	}
+	s.nextID++
+	s.opened++
+	info := &StreamInfo{ID: s.nextID, RPC: rpc, Started: time.Now()}
+	if p, ok := peer.FromContext(ctx); ok {
+		info.Peer = p.Addr.String()
+	}
+	s.open[info.ID] = info
+	return &trackedStream{streams: s, info: info}, nil
+}
+
+func (t *trackedStream) close() {
+	t.streams.mu.Lock()
+	defer t.streams.mu.Unlock()
+	if t.info.Waiting {
+		t.streams.waiting--
+	}
+	delete(t.streams.open, t.info.ID)
+}
+
+// marks the stream as waiting, fails if the server already has as many waiting streams as it's allowed
+func (t *trackedStream) wait() error {
+	t.streams.mu.Lock()
+	defer t.streams.mu.Unlock()
+	if t.info.Waiting {
+		return nil
+	}
+	if t.streams.limits.MaxWaiters > 0 && t.streams.waiting >= t.streams.limits.MaxWaiters {
+		t.streams.rejected++
+		return status.Errorf(codes.ResourceExhausted, "too many waiting streams: %d", t.streams.waiting)
+	}
+	t.info.Waiting = true
+	t.streams.waiting++
+	return nil
+}
+
+// marks the stream as no longer waiting once it has a record to handle
+func (t *trackedStream) record() {
+	t.streams.mu.Lock()
+	defer t.streams.mu.Unlock()
+	if t.info.Waiting {
+		t.info.Waiting = false
+		t.streams.waiting--
+	}
+	t.info.Records++
+}
+
+// how much of every limit the streams use
+func (s *Streams) usage() []usage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return []usage{
+		{limit: "streams", used: float64(len(s.open)), max: float64(s.limits.MaxStreams)},
+		{limit: "waiting streams", used: float64(s.waiting), max: float64(s.limits.MaxWaiters)},
+		{limit: "records in flight", used: float64(s.inFlight), max: float64(s.limits.MaxInFlight)},
+	}
+}
+
+// caps the number of records a group member asks to have in flight
+func (s *Streams) maxInFlight(requested int) int {
+	if s.limits.MaxInFlight > 0 {
+		return min(requested, s.limits.MaxInFlight)
+	}
+	return requested
+}
+
+// adjusts the number of records group members have in flight
+func (s *Streams) addInFlight(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inFlight += n
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// file descriptors systemd passes to socket activated services start after stdin, stdout and stderr
+const listenFDsStart = 3
+
+/*
+SystemdListeners returns the listeners systemd passed the process when it was started by socket activation, in the
+order of the socket unit's Listen lines, so the server can be served on them through ListenerConfig.Listener.
+connections that arrive while the broker restarts queue up on the sockets instead of being refused. it returns
+nothing when the process wasn't socket activated, and unsets the variables systemd passes them in so child
+processes don't take them too
+*/
+func SystemdListeners() ([]net.Listener, error) {
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+	defer os.Unsetenv("LISTEN_FDNAMES")
+	if pid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	listeners := make([]net.Listener, 0, n)
+	for i := 0; i < n; i++ {
+		name := "LISTEN_FD_" + strconv.Itoa(listenFDsStart+i)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		f := os.NewFile(uintptr(listenFDsStart+i), name)
+		// FileListener dups the descriptor, so the file is closed either way
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, err
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+/*
+Notify sends the state to systemd's notification socket, ex. "READY=1" once the broker is ready to serve so units
+with Type=notify only count it as started then, and "STOPPING=1" once it starts shutting down. it returns
+false without an error when the process isn't run by systemd with a notification socket
+*/
+func Notify(state string) (bool, error) {
+	addr := os.Getenv("NOTIFY_SOCKET")
+	if addr == "" {
+		return false, nil
+	}
+	// a leading @ is an abstract socket, which starts with a null byte instead
+	if strings.HasPrefix(addr, "@") {
+		addr = "\x00" + addr[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	if _, err = conn.Write([]byte(state)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,41 @@
+package server
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+// caps how long unary rpcs are processed, the client's own deadline still applies when it's sooner
+func (s *grpcServer) timeoutUnary(
+	ctx context.Context,
+	req any,
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (any, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.MaxRPCTime)
+	defer cancel()
+	return handler(ctx, req)
+}
+
+/*
+runs fn unless ctx is already done and stops waiting on it once ctx is done, so a client that went away or
+a disk that stopped responding doesn't hold the rpc. fn keeps running in the background and may still
+succeed, ex. a record that was being appended can end up in the log after the client was told its
+deadline passed, which is why producers that retry should produce idempotently
+*/
+func await(ctx context.Context, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return contextError(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return contextError(ctx.Err())
+	}
+}
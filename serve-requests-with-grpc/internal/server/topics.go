@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+
+	api "github.com/phaseharry/distributed-log/serve-requests-with-grpc/api/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// manages the server's named logs, ex. the log package's Topics
+type TopicStore interface {
+	Topic(name string) (CommitLog, error)
+	Create(name string, config *api.TopicConfig) error
+	List() []*api.Topic
+	Delete(name string) error
+	Close() error
+}
+
+/*
+returns the log requests for the topic are served from. requests without a topic go to the
+server's CommitLog so clients that don't know about topics keep working unchanged
+*/
+func (s *grpcServer) log(topic string) (CommitLog, error) {
+	if topic == "" {
+		return s.CommitLog, nil
+	}
+	if s.Topics == nil {
+		return nil, api.ErrUnknownTopic{Topic: topic}
+	}
+	return s.Topics.Topic(topic)
+}
+
+/*
+the status streams end with once the log they're watching is closed. streams of a topic that was deleted
+end with the topic's NotFound so consumers can tell it apart from the server shutting down
+*/
+func (s *grpcServer) logClosed(topic string) error {
+	if _, err := s.log(topic); err != nil {
+		return err
+	}
+	return status.Error(codes.Unavailable, "log closed")
+}
+
+func (s *grpcServer) CreateTopic(ctx context.Context, req *api.CreateTopicRequest) (*api.CreateTopicResponse, error) {
+	if err := s.checkTopics(); err != nil {
+		return nil, err
+	}
+	if err := s.Topics.Create(req.Name, req.Config); err != nil {
+		return nil, err
+	}
+	return &api.CreateTopicResponse{}, nil
+}
+
+// responds with every topic and the config it was created with, sorted by name
+func (s *grpcServer) ListTopics(ctx context.Context, req *api.ListTopicsRequest) (*api.ListTopicsResponse, error) {
+	if err := s.checkTopics(); err != nil {
+		return nil, err
+	}
+	return &api.ListTopicsResponse{Topics: s.Topics.List()}, nil
+}
+
+// removes the topic and its records, streams consuming the topic end with NotFound
+func (s *grpcServer) DeleteTopic(ctx context.Context, req *api.DeleteTopicRequest) (*api.DeleteTopicResponse, error) {
+	if err := s.checkTopics(); err != nil {
+		return nil, err
+	}
+	if err := s.Topics.Delete(req.Name); err != nil {
+		return nil, err
+	}
+	return &api.DeleteTopicResponse{}, nil
+}
+
+func (s *grpcServer) checkTopics() error {
+	if s.Topics == nil {
+		return status.Error(codes.Unimplemented, "topics aren't enabled")
+	}
+	return nil
+}
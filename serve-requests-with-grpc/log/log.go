@@ -0,0 +1,158 @@
+/*
+Package log is the stable API of the commit log for projects that want to use the log engine directly
+instead of through the gRPC server. the engine itself lives in an internal package so it can keep changing,
+this package only exposes what external projects can depend on across releases:
+
+	l, err := log.Open(dir, log.WithSegmentBytes(1<<20), log.WithRetention(24*time.Hour, 0))
+	defer l.Close()
+	off, err := l.Append(&api.Record{Value: []byte("hello world")})
+	record, err := l.Read(off)
+*/
+package log
+
+import (
+	"io"
+	"time"
+
+	api "github.com/phaseharry/distributed-log/serve-requests-with-grpc/api/v1"
+	engine "github.com/phaseharry/distributed-log/serve-requests-with-grpc/internal/log"
+)
+
+// Log is an append-only sequence of records split across segment files in a directory
+type Log interface {
+	// Append adds the record to the end of the log and returns the offset it was assigned
+	Append(record *api.Record) (uint64, error)
+	/*
+		AppendIdempotent appends the record as the next sequence number of a producer. retrying the producer's
+		last sequence returns the offset it was appended at instead of appending it again, any other sequence
+		fails with api.ErrOutOfOrderSequence
+	*/
+	AppendIdempotent(record *api.Record, producerID, sequence uint64) (uint64, error)
+	// AppendSync appends the record and only returns once it's fsynced to disk
+	AppendSync(record *api.Record) (uint64, error)
+	// AppendBatch appends the records at consecutive offsets and returns the offset of the first one
+	AppendBatch(records []*api.Record) (uint64, error)
+	// Validate returns the error Append would fail with because of the record itself, ex. api.ErrRecordTooLarge
+	Validate(record *api.Record) error
+	// Sync fsyncs every record appended so far
+	Sync() error
+	// FlushedOffset returns the offset that every record before is durable on disk
+	FlushedOffset() uint64
+	// Read returns the record at the offset, or api.ErrOffsetOutOfRange if there isn't one
+	Read(off uint64) (*api.Record, error)
+	// LookupKey returns the latest record with the key, skipping segments whose key filter rules it out
+	LookupKey(key []byte) (*api.Record, error)
+	// ReadRange returns an iterator over the records with offsets in [from, to)
+	ReadRange(from, to uint64) (RecordIterator, error)
+	/*
+		ReadPacked returns the records with offsets in [from, to) as they're stored, packed back to back up
+		to maxBytes, and the offset the next read starts from. Unpack decodes them
+	*/
+	ReadPacked(from, to, maxBytes uint64) ([]byte, uint64, error)
+	Unpack(packed []byte) ([]*api.Record, error)
+	LowestOffset() (uint64, error)
+	HighestOffset() (uint64, error)
+	// Truncate removes the segments whose records all have offsets lower than or equal to lowest
+	Truncate(lowest uint64) error
+	// TruncateBefore removes every record with an offset lower than offset, splitting the segment the cut falls in
+	TruncateBefore(offset uint64) error
+	// TruncateAfter removes every record with an offset higher than offset, the next append is given offset+1
+	TruncateAfter(offset uint64) error
+	/*
+		Watch returns a channel that receives the newest appended offset once there's a record at fromOffset or
+		past it. the channel is closed when cancel is called or the log is closed
+	*/
+	Watch(fromOffset uint64) (<-chan uint64, func())
+	// Reader returns a reader over the raw contents of every segment's store, oldest first
+	Reader() io.Reader
+	// Close closes the log's files, its records stay on disk
+	Close() error
+	// Remove closes the log and deletes its directory
+	Remove() error
+}
+
+/*
+RecordIterator walks a range of records in offset order:
+
+	it, err := l.ReadRange(from, to)
+	for it.Next() {
+		record := it.Record()
+	}
+	if err := it.Err(); err != nil {}
+*/
+type RecordIterator = engine.RecordIterator
+
+// ErrClusterMismatch is returned by Open for a log that was created for another cluster
+var ErrClusterMismatch = engine.ErrClusterMismatch
+
+// Option configures a log opened with Open
+type Option func(*engine.Config)
+
+// WithSegmentBytes sets how big a segment's store grows before the log rolls over to a new segment
+func WithSegmentBytes(n uint64) Option {
+	return func(c *engine.Config) {
+		c.Segment.MaxStoreBytes = n
+	}
+}
+
+/*
+WithIndexBytes sets how big a segment's index grows before the log rolls over to a new segment.
+every record takes up 12 bytes of the index
+*/
+func WithIndexBytes(n uint64) Option {
+	return func(c *engine.Config) {
+		c.Segment.MaxIndexBytes = n
+	}
+}
+
+/*
+WithRetention deletes segments whose newest record is older than maxAge and the oldest segments once
+the log is bigger than maxBytes. a zero value disables that policy
+*/
+func WithRetention(maxAge time.Duration, maxBytes uint64) Option {
+	return func(c *engine.Config) {
+		c.Retention.MaxAge = maxAge
+		c.Retention.MaxBytes = maxBytes
+	}
+}
+
+// WithMaxRecordBytes rejects appends of records bigger than n bytes with api.ErrRecordTooLarge
+func WithMaxRecordBytes(n uint64) Option {
+	return func(c *engine.Config) {
+		c.Segment.MaxRecordBytes = n
+	}
+}
+
+// WithFsync syncs every appended record to disk before Append returns
+func WithFsync(fsync bool) Option {
+	return func(c *engine.Config) {
+		c.Segment.Fsync = fsync
+	}
+}
+
+/*
+WithClusterID checks that the log belongs to the cluster when it's opened, Open fails with ErrClusterMismatch
+for another cluster's log. new logs are created for the cluster
+*/
+func WithClusterID(id string) Option {
+	return func(c *engine.Config) {
+		c.ClusterID = id
+	}
+}
+
+/*
+Open opens the log stored in dir, creating it if it's empty. segments default to 1024 byte
+stores and indexes, without retention or fsync
+*/
+func Open(dir string, opts ...Option) (Log, error) {
+	var c engine.Config
+	for _, opt := range opts {
+		opt(&c)
+	}
+	// returning a nil *engine.Log as the interface would make a log that failed to open look like it opened
+	l, err := engine.NewLog(dir, c)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
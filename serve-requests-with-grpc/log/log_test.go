@@ -0,0 +1,58 @@
+package log
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	api "github.com/phaseharry/distributed-log/serve-requests-with-grpc/api/v1"
+	"github.com/stretchr/testify/require"
+)
+
+// testing that a log opened with options appends, reads, and rolls segments like the engine
+func TestOpen(t *testing.T) {
+	dir, err := os.MkdirTemp("", "log-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	l, err := Open(dir,
+		WithSegmentBytes(40),
+		WithIndexBytes(1024),
+		WithRetention(time.Hour, 0),
+		WithFsync(true),
+	)
+	require.NoError(t, err)
+
+	for i := uint64(0); i < 4; i++ {
+		off, err := l.Append(&api.Record{Value: []byte("hello world")})
+		require.NoError(t, err)
+		require.Equal(t, i, off)
+	}
+	record, err := l.Read(3)
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello world"), record.Value)
+
+	// 2 records fit in a 40 byte segment so the first segment can be truncated away
+	require.NoError(t, l.Truncate(1))
+	lowest, err := l.LowestOffset()
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), lowest)
+
+	it, err := l.ReadRange(2, 4)
+	require.NoError(t, err)
+	var read int
+	for it.Next() {
+		read++
+	}
+	require.NoError(t, it.Err())
+	require.Equal(t, 2, read)
+	require.NoError(t, l.Close())
+
+	// records were synced to disk so they're there after reopening
+	l, err = Open(dir, WithSegmentBytes(40))
+	require.NoError(t, err)
+	defer l.Close()
+	highest, err := l.HighestOffset()
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), highest)
+}
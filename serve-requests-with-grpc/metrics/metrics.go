@@ -0,0 +1,217 @@
+/*
+Package metrics is how the log and the grpc server report what they're doing. both take a Metrics in their
+config so deployments can send the measurements wherever they already collect them, Registry keeps them in
+memory and serves them in the prometheus text format:
+
+	registry := metrics.NewRegistry()
+	l, err := log.NewLog(dir, log.Config{Metrics: registry})
+	srv, err := server.NewGrpcServer(&server.Config{CommitLog: l, Metrics: registry})
+	http.Handle("/metrics", registry)
+
+labels are passed as name, value pairs, ex. Add("log_rpcs_total", 1, "method", method, "code", code)
+*/
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Metrics records counters, gauges and histograms by name and labels
+type Metrics interface {
+	// Add increases the counter by delta
+	Add(name string, delta float64, labels ...string)
+	// Set sets the gauge to value
+	Set(name string, value float64, labels ...string)
+	// Observe adds value to the histogram
+	Observe(name string, value float64, labels ...string)
+	// Forget drops the gauge, ex. once the stream it was measuring ended
+	Forget(name string, labels ...string)
+}
+
+// Nop discards everything, it's what the log and the server use when they aren't given a Metrics
+var Nop Metrics = nop{}
+
+type nop struct{}
+
+func (nop) Add(string, float64, ...string)     {}
+func (nop) Set(string, float64, ...string)     {}
+func (nop) Observe(string, float64, ...string) {}
+func (nop) Forget(string, ...string)           {}
+
+// upper bounds of the histograms' buckets in seconds, the same as prometheus' client defaults
+var Buckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type kind int
+
+const (
+	counter kind = iota
+	gauge
+	histogram
+)
+
+func (k kind) String() string {
+	return [...]string{"counter", "gauge", "histogram"}[k]
+}
+
+type series struct {
+	labels string
+	value  float64
+	// histograms only, the count of observations at or below every bucket's bound and their sum
+	buckets []uint64
+	count   uint64
+}
+
+type family struct {
+	kind   kind
+	series map[string]*series
+}
+
+/*
+Registry is a Metrics that keeps everything in memory, and an http.Handler that serves it in the prometheus
+text exposition format. histograms use Buckets
+*/
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]*family
+}
+
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]*family)}
+}
+
+func (r *Registry) Add(name string, delta float64, labels ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.series(name, counter, labels).value += delta
+}
+
+func (r *Registry) Set(name string, value float64, labels ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.series(name, gauge, labels).value = value
+}
+
+func (r *Registry) Observe(name string, value float64, labels ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := r.series(name, histogram, labels)
+	if s.buckets == nil {
+		s.buckets = make([]uint64, len(Buckets))
+	}
+	for i, bound := range Buckets {
+		if value <= bound {
+			s.buckets[i]++
+		}
+	}
+	s.value += value
+	s.count++
+}
+
+func (r *Registry) Forget(name string, labels ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if f, ok := r.families[name]; ok {
+		delete(f.series, formatLabels(labels))
+	}
+}
+
+// Value returns the counter's or gauge's value, or the histogram's sum, zero when it was never recorded
+func (r *Registry) Value(name string, labels ...string) float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if f, ok := r.families[name]; ok {
+		if s, ok := f.series[formatLabels(labels)]; ok {
+			return s.value
+		}
+	}
+	return 0
+}
+
+// has to be called while holding the registry's lock
+func (r *Registry) series(name string, k kind, labels []string) *series {
+	f, ok := r.families[name]
+	if !ok {
+		f = &family{kind: k, series: make(map[string]*series)}
+		r.families[name] = f
+	}
+	key := formatLabels(labels)
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labels: key}
+		f.series[key] = s
+	}
+	return s
+}
+
+// formats the name, value pairs the way prometheus writes them, sorted by name so the order they're passed in doesn't matter
+func formatLabels(labels []string) string {
+	if len(labels) < 2 {
+		return ""
+	}
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, labels[i]+"="+strconv.Quote(labels[i+1]))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := r.families[name]
+		fmt.Fprintf(w, "# TYPE %s %s\n", name, f.kind)
+		keys := make([]string, 0, len(f.series))
+		for key := range f.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			s := f.series[key]
+			if f.kind != histogram {
+				fmt.Fprintf(w, "%s%s %s\n", name, braced(s.labels), formatValue(s.value))
+				continue
+			}
+			for i, bound := range Buckets {
+				fmt.Fprintf(w, "%s_bucket%s %d\n", name, braced(join(s.labels, `le="`+formatValue(bound)+`"`)), s.buckets[i])
+			}
+			fmt.Fprintf(w, "%s_bucket%s %d\n", name, braced(join(s.labels, `le="+Inf"`)), s.count)
+			fmt.Fprintf(w, "%s_sum%s %s\n", name, braced(s.labels), formatValue(s.value))
+			fmt.Fprintf(w, "%s_count%s %d\n", name, braced(s.labels), s.count)
+		}
+	}
+}
+
+func braced(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+func join(labels, label string) string {
+	if labels == "" {
+		return label
+	}
+	return labels + "," + label
+}
+
+func formatValue(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
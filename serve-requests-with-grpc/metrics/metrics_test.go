@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testing that the registry keeps series apart by labels and serves them in the prometheus text format
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	r.Add("rpcs_total", 1, "method", "Produce", "code", "OK")
+	r.Add("rpcs_total", 2, "code", "OK", "method", "Produce")
+	r.Add("rpcs_total", 1, "method", "Consume", "code", "OutOfRange")
+	r.Set("lag", 7, "stream", "1")
+	r.Set("lag", 3, "stream", "2")
+	r.Forget("lag", "stream", "2")
+	r.Observe("append_seconds", 0.02)
+	r.Observe("append_seconds", 20)
+
+	// labels passed in a different order are the same series
+	require.Equal(t, float64(3), r.Value("rpcs_total", "method", "Produce", "code", "OK"))
+	require.Equal(t, float64(0), r.Value("lag", "stream", "2"))
+
+	res := httptest.NewRecorder()
+	r.ServeHTTP(res, httptest.NewRequest("GET", "/metrics", nil))
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	require.Equal(t, `# TYPE append_seconds histogram
+append_seconds_bucket{le="0.005"} 0
+append_seconds_bucket{le="0.01"} 0
+append_seconds_bucket{le="0.025"} 1
+append_seconds_bucket{le="0.05"} 1
+append_seconds_bucket{le="0.1"} 1
+append_seconds_bucket{le="0.25"} 1
+append_seconds_bucket{le="0.5"} 1
+append_seconds_bucket{le="1"} 1
+append_seconds_bucket{le="2.5"} 1
+append_seconds_bucket{le="5"} 1
+append_seconds_bucket{le="10"} 1
+append_seconds_bucket{le="+Inf"} 2
+append_seconds_sum 20.02
+append_seconds_count 2
+# TYPE lag gauge
+lag{stream="1"} 7
+# TYPE rpcs_total counter
+rpcs_total{code="OK",method="Produce"} 3
+rpcs_total{code="OutOfRange",method="Consume"} 1
+`, string(body))
+}